@@ -17,6 +17,9 @@ var (
 	logDir       = flag.String("log-dir", "", "specify the log directory")
 	Config       = flag.String("config", "config.yaml", "specify the config.yaml path")
 	export       = flag.Bool("export", false, "Exports prices to a JSON file.")
+
+	EncryptSecrets  = flag.Bool("encrypt-secrets", false, "Encrypts existing channel keys and secrets with secret_encryption_key, then exits.")
+	RotateSecretKey = flag.Bool("rotate-secret-key", false, "Re-encrypts all secrets with the current secret_encryption_key, then exits.")
 )
 
 func InitCli() {
@@ -61,5 +64,5 @@ func help() {
 	fmt.Println("Copyright (C) 2025 deanxv. All rights reserved.")
 	fmt.Println("Original copyright holder: JustSong")
 	fmt.Println("GitHub: https://github.com/deanxv/done-hub")
-	fmt.Println("Usage: done-hub [--port <port>] [--log-dir <log directory>] [--config <config.yaml path>] [--version] [--help]")
+	fmt.Println("Usage: done-hub [--port <port>] [--log-dir <log directory>] [--config <config.yaml path>] [--encrypt-secrets] [--rotate-secret-key] [--version] [--help]")
 }
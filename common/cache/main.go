@@ -5,6 +5,7 @@ import (
 	"done-hub/common/config"
 	"done-hub/common/redis"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/coocood/freecache"
@@ -13,6 +14,7 @@ import (
 	"github.com/eko/gocache/lib/v4/store"
 	freecache_store "github.com/eko/gocache/store/freecache/v4"
 	redis_store "github.com/eko/gocache/store/redis/v4"
+	"github.com/spf13/viper"
 	"golang.org/x/sync/singleflight"
 )
 
@@ -22,6 +24,9 @@ var (
 	sfGroup       singleflight.Group
 	CacheTimeout  = 5 * time.Second
 	CacheNotFound = errors.New("cache not found")
+
+	responseCache     *marshaler.Marshaler
+	responseCacheOnce sync.Once
 )
 
 func InitCacheManager() {
@@ -30,7 +35,7 @@ func InitCacheManager() {
 		redisStore := redis_store.NewRedis(redis.RDB)
 		client = cacheM.New[any](redisStore)
 	} else {
-		freecacheStore := freecache_store.NewFreecache(freecache.NewCache(1024 * 1024))
+		freecacheStore := freecache_store.NewFreecache(freecache.NewCache(viper.GetInt("memory_cache_size") * 1024 * 1024))
 		client = cacheM.New[any](freecacheStore)
 	}
 
@@ -38,8 +43,12 @@ func InitCacheManager() {
 }
 
 func GetCache[T any](key string) (T, error) {
+	return getCache[T](kvCache, key)
+}
+
+func getCache[T any](m *marshaler.Marshaler, key string) (T, error) {
 	var val T
-	_, err := kvCache.Get(ctx, key, &val)
+	_, err := m.Get(ctx, key, &val)
 	if err != nil {
 		if errors.Is(err, store.NotFound{}) {
 			return *new(T), CacheNotFound
@@ -53,6 +62,29 @@ func SetCache(key string, value any, expiration time.Duration) error {
 	return kvCache.Set(ctx, key, value, store.WithExpiration(expiration))
 }
 
+// getResponseCacheStore 响应缓存的条目较大，未使用 Redis 时使用 response_cache_memory_size 大小的单独内存缓存，
+// 首次使用时才分配内存
+func getResponseCacheStore() *marshaler.Marshaler {
+	if config.RedisEnabled {
+		return kvCache
+	}
+
+	responseCacheOnce.Do(func() {
+		freecacheStore := freecache_store.NewFreecache(freecache.NewCache(viper.GetInt("response_cache_memory_size") * 1024 * 1024))
+		responseCache = marshaler.New(cacheM.New[any](freecacheStore))
+	})
+
+	return responseCache
+}
+
+func GetResponseCache[T any](key string) (T, error) {
+	return getCache[T](getResponseCacheStore(), key)
+}
+
+func SetResponseCache(key string, value any, expiration time.Duration) error {
+	return getResponseCacheStore().Set(ctx, key, value, store.WithExpiration(expiration))
+}
+
 func DeleteCache(key string) error {
 	return kvCache.Delete(ctx, key)
 }
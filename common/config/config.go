@@ -36,6 +36,8 @@ func defaultConfig() {
 	viper.SetDefault("sqlite_path", "done-hub.db")
 	viper.SetDefault("sqlite_busy_timeout", 3000)
 	viper.SetDefault("sync_frequency", 600)
+	viper.SetDefault("memory_cache_size", 1)
+	viper.SetDefault("response_cache_memory_size", 64)
 	viper.SetDefault("batch_update_interval", 5)
 	viper.SetDefault("global.api_rate_limit", 300)
 	viper.SetDefault("global.web_rate_limit", 300)
@@ -43,6 +45,9 @@ func defaultConfig() {
 	viper.SetDefault("auto_price_updates", false)
 	viper.SetDefault("auto_price_updates_mode", "system")
 	viper.SetDefault("auto_price_updates_interval", 1440)
+	viper.SetDefault("channel_model_discovery_interval", 360)
+	viper.SetDefault("config_sync.file", "")
+	viper.SetDefault("config_sync.prune", false)
 	viper.SetDefault("update_price_service", "https://raw.githubusercontent.com/MartialBE/done-hub/prices/prices.json")
 	viper.SetDefault("language", "zh_CN")
 	viper.SetDefault("favicon", "")
@@ -188,14 +188,35 @@ var InviterRewardValue = 0
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
+
+// 自动禁用渠道的恢复探测：失败后按指数退避增加间隔（秒），连续成功指定次数后启用
+var ChannelRecoveryEnabled = false
+var ChannelRecoverySuccessThreshold = 2
+var ChannelRecoveryMinInterval = 60
+var ChannelRecoveryMaxInterval = 3600
 var QuotaRemindThreshold = 1000
 var PreConsumedQuota = 500
 var ApproximateTokenEnabled = false
 var EmptyResponseBillingEnabled = true
+
+// 响应缓存（令牌需在设置中单独开启）
+var ResponseCacheEnabled = false
+var ResponseCacheDefaultTTL = 3600  // 默认缓存时间，单位秒
+var ResponseCacheBillingRatio = 0.0 // 命中缓存时的计费倍率，0 为不计费
 var DisableTokenEncoders = false
 var RetryTimes = 0
 var RetryTimeOut = 10
 
+// 流式请求等待首个内容的时间（秒），超时后切换渠道重试，0 为不限制
+var StreamFirstContentTimeout = 60
+
+// 重试策略规则为 JSON 数组，未命中的错误按默认规则处理
+var RetryPolicyRules = ""
+
+// 渠道错误分类规则为 JSON 数组，分类的处理方式为 JSON，分类 -> 处理方式
+var ChannelErrorRules = ""
+var ChannelErrorActions = ""
+
 // 统一请求响应模型（响应中显示用户请求的原始模型名称）
 var UnifiedRequestResponseModelEnabled = false
 
@@ -203,6 +224,34 @@ var UnifiedRequestResponseModelEnabled = false
 var ModelNameCaseInsensitiveEnabled = false
 
 var DefaultChannelWeight = uint(1)
+
+// 熔断：连续失败达到阈值后熔断，熔断时长结束后进入半开状态放行少量请求探测
+var CircuitBreakerEnabled = false
+var CircuitBreakerFailureThreshold = 5
+var CircuitBreakerOpenSeconds = 30
+var CircuitBreakerHalfOpenRequests = 1
+
+// 渠道并发/RPM/TPM 均已达到上限时的排队长度与等待时间（秒）
+var ChannelLimitQueueSize = 100
+var ChannelLimitQueueTimeout = 30
+
+// 渠道选择策略：weight 按配置权重，adaptive 按延迟与错误率动态调整权重
+var ChannelRoutingStrategy = "weight"
+
+// 成本优先策略的延迟预算（毫秒），0 为不限制
+var ChannelRoutingLatencyBudget = 0
+
+// 渠道健康统计：分钟记录保留的小时数，超过后汇总为小时记录；全部记录保留的天数，0 为不清理
+var ChannelHealthMinuteRetentionHours = 24
+var ChannelHealthRetentionDays = 30
+
+// 渠道预算达到这些百分比时发送提醒，多个用逗号分隔；渠道标签的预算为 JSON，tag -> 预算
+var ChannelBudgetWarningPercents = "80"
+var ChannelTagBudgets = ""
+
+// 影子流量规则为 JSON 数组，影子请求记录保留的天数，0 为不清理
+var ShadowTrafficRules = ""
+var ShadowResultRetentionDays = 7
 var RetryCooldownSeconds = 5
 
 var CFWorkerImageUrl = ""
@@ -261,6 +310,7 @@ const (
 	ChannelStatusEnabled          = 1 // don't use 0, 0 is the default value!
 	ChannelStatusManuallyDisabled = 2 // also don't use 0
 	ChannelStatusAutoDisabled     = 3
+	ChannelStatusExhausted        = 4 // 余额耗尽，刷新余额后自动恢复
 )
 
 const (
@@ -1,6 +1,18 @@
 package common
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func Password2Hash(password string) (string, error) {
 	passwordBytes := []byte(password)
@@ -12,3 +24,200 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// 加密后的格式：enc:v1:<主密钥 id>:<被主密钥加密的数据密钥>:<被数据密钥加密的内容>
+const secretPrefix = "enc:v1:"
+
+type secretKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	currentSecretKey *secretKey
+	secretKeys       = make(map[string]*secretKey)
+)
+
+func newSecretKey(masterKey string) *secretKey {
+	key := sha256.Sum256([]byte(masterKey))
+	id := sha256.Sum256(key[:])
+	return &secretKey{
+		id:  hex.EncodeToString(id[:4]),
+		key: key[:],
+	}
+}
+
+// InitSecretEncryption 设置当前主密钥与轮换前的旧主密钥，未设置主密钥时不加密
+func InitSecretEncryption(masterKey string, oldMasterKeys []string) {
+	currentSecretKey = nil
+	secretKeys = make(map[string]*secretKey)
+
+	for _, oldKey := range oldMasterKeys {
+		oldKey = strings.TrimSpace(oldKey)
+		if oldKey == "" {
+			continue
+		}
+		key := newSecretKey(oldKey)
+		secretKeys[key.id] = key
+	}
+
+	if masterKey == "" {
+		return
+	}
+
+	currentSecretKey = newSecretKey(masterKey)
+	secretKeys[currentSecretKey.id] = currentSecretKey
+}
+
+func SecretEncryptionEnabled() bool {
+	return currentSecretKey != nil
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// IsSecretUpToDate 是否已经使用当前主密钥加密
+func IsSecretUpToDate(value string) bool {
+	if currentSecretKey == nil {
+		return !IsEncryptedSecret(value)
+	}
+
+	return strings.HasPrefix(value, secretPrefix+currentSecretKey.id+":")
+}
+
+func aesGCMSeal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("invalid secret ciphertext")
+	}
+
+	return gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+}
+
+func wrapSecret(dataKey, ciphertext []byte) (string, error) {
+	wrappedKey, err := aesGCMSeal(currentSecretKey.key, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return secretPrefix + currentSecretKey.id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// unwrapSecret 返回数据密钥与被数据密钥加密的内容
+func unwrapSecret(value string) ([]byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, secretPrefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("invalid secret format")
+	}
+
+	key, ok := secretKeys[parts[0]]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret master key %s not found", parts[0])
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey, err := aesGCMOpen(key.key, wrappedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, ciphertext, nil
+}
+
+// EncryptSecret 使用随机数据密钥加密内容，数据密钥再由主密钥加密
+// 未设置主密钥、内容为空或已经加密时原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if currentSecretKey == nil || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := aesGCMSeal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return wrapSecret(dataKey, ciphertext)
+}
+
+// DecryptSecret 未加密的内容原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+
+	dataKey, ciphertext, err := unwrapSecret(value)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := aesGCMOpen(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// RotateSecret 使用当前主密钥重新加密数据密钥，未加密的内容会被加密
+func RotateSecret(value string) (string, error) {
+	if currentSecretKey == nil {
+		return "", errors.New("secret encryption key is not set")
+	}
+
+	if !IsEncryptedSecret(value) {
+		return EncryptSecret(value)
+	}
+
+	if IsSecretUpToDate(value) {
+		return value, nil
+	}
+
+	dataKey, ciphertext, err := unwrapSecret(value)
+	if err != nil {
+		return "", err
+	}
+
+	return wrapSecret(dataKey, ciphertext)
+}
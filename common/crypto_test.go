@@ -0,0 +1,126 @@
+package common_test
+
+import (
+	"testing"
+
+	"done-hub/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	cases := []struct {
+		name      string
+		masterKey string
+		plaintext string
+		encrypted bool
+	}{
+		{"disabled", "", "sk-test", false},
+		{"empty", "master", "", false},
+		{"encrypt", "master", "sk-test", true},
+		{"already encrypted", "master", "enc:v1:abc:def:ghi", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			common.InitSecretEncryption(c.masterKey, nil)
+			defer common.InitSecretEncryption("", nil)
+
+			value, err := common.EncryptSecret(c.plaintext)
+			assert.NoError(t, err)
+			assert.Equal(t, c.encrypted, common.IsEncryptedSecret(value))
+
+			if !c.encrypted || common.IsEncryptedSecret(c.plaintext) {
+				assert.Equal(t, c.plaintext, value)
+				return
+			}
+
+			assert.NotContains(t, value, c.plaintext)
+			plaintext, err := common.DecryptSecret(value)
+			assert.NoError(t, err)
+			assert.Equal(t, c.plaintext, plaintext)
+		})
+	}
+}
+
+func TestDecryptSecret(t *testing.T) {
+	common.InitSecretEncryption("master", nil)
+	encrypted, err := common.EncryptSecret("sk-test")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		masterKey  string
+		oldKeys    []string
+		value      string
+		expected   string
+		shouldFail bool
+	}{
+		{"plaintext", "", nil, "sk-test", "sk-test", false},
+		{"current key", "master", nil, encrypted, "sk-test", false},
+		{"old key", "new-master", []string{"master"}, encrypted, "sk-test", false},
+		{"unknown key", "new-master", nil, encrypted, "", true},
+		{"invalid format", "master", nil, "enc:v1:broken", "", true},
+		{"tampered", "master", nil, encrypted[:len(encrypted)-4] + "AAAA", "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			common.InitSecretEncryption(c.masterKey, c.oldKeys)
+			defer common.InitSecretEncryption("", nil)
+
+			plaintext, err := common.DecryptSecret(c.value)
+			if c.shouldFail {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, plaintext)
+		})
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	common.InitSecretEncryption("master", nil)
+	oldEncrypted, err := common.EncryptSecret("sk-test")
+	assert.NoError(t, err)
+
+	common.InitSecretEncryption("new-master", []string{"master"})
+	defer common.InitSecretEncryption("", nil)
+	newEncrypted, err := common.EncryptSecret("sk-test")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name      string
+		value     string
+		unchanged bool
+	}{
+		{"plaintext", "sk-test", false},
+		{"old key", oldEncrypted, false},
+		{"up to date", newEncrypted, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.unchanged, common.IsSecretUpToDate(c.value))
+
+			rotated, err := common.RotateSecret(c.value)
+			assert.NoError(t, err)
+			assert.True(t, common.IsSecretUpToDate(rotated))
+			if c.unchanged {
+				assert.Equal(t, c.value, rotated)
+			}
+
+			// 轮换后不再依赖旧主密钥
+			common.InitSecretEncryption("new-master", nil)
+			defer common.InitSecretEncryption("new-master", []string{"master"})
+			plaintext, err := common.DecryptSecret(rotated)
+			assert.NoError(t, err)
+			assert.Equal(t, "sk-test", plaintext)
+		})
+	}
+
+	common.InitSecretEncryption("", nil)
+	_, err = common.RotateSecret("sk-test")
+	assert.Error(t, err)
+}
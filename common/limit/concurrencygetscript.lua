@@ -0,0 +1,5 @@
+-- KEYS[1] as concurrency_key
+-- ARGV[1] as now (in milliseconds)
+
+-- 只统计未到期的租约
+return redis.call('ZCOUNT', KEYS[1], '(' .. ARGV[1], '+inf')
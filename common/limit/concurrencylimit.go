@@ -0,0 +1,139 @@
+package limit
+
+import (
+	"context"
+	"done-hub/common/config"
+	"done-hub/common/redis"
+	"done-hub/common/utils"
+	_ "embed"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	concurrencyFormat = "{%s}:concurrency"
+	// 租约的过期时间，需大于单个请求的最长耗时
+	concurrencyExpiration = 10 * time.Minute
+)
+
+var (
+	//go:embed concurrencyscript.lua
+	concurrencyLuaScript string
+	concurrencyScript    = redis.NewScript(concurrencyLuaScript)
+
+	//go:embed concurrencyreleasescript.lua
+	concurrencyReleaseLuaScript string
+	concurrencyReleaseScript    = redis.NewScript(concurrencyReleaseLuaScript)
+
+	//go:embed concurrencygetscript.lua
+	concurrencyGetLuaScript string
+	concurrencyGetScript    = redis.NewScript(concurrencyGetLuaScript)
+)
+
+// ConcurrencyLimiter 并发数限制，Acquire 返回的租约在请求结束后需要通过 Release 释放
+type ConcurrencyLimiter interface {
+	Acquire(keyPrefix string, max int) (string, bool)
+	Release(keyPrefix string, lease string)
+	GetCurrent(keyPrefix string) (int, error)
+}
+
+// NewConcurrencyLimiter Redis启用时多节点共享并发计数，否则使用内存计数
+func NewConcurrencyLimiter() ConcurrencyLimiter {
+	if config.RedisEnabled {
+		return &RedisConcurrencyLimiter{}
+	}
+
+	return &MemoryConcurrencyLimiter{
+		counts: make(map[string]int),
+	}
+}
+
+// RedisConcurrencyLimiter 每个请求占用一条带过期时间的租约，节点崩溃后遗留的名额会在租约到期后释放
+type RedisConcurrencyLimiter struct{}
+
+func (l *RedisConcurrencyLimiter) Acquire(keyPrefix string, max int) (string, bool) {
+	lease := utils.GetUUID()
+	result, err := redis.ScriptRunCtx(context.Background(),
+		concurrencyScript,
+		[]string{
+			fmt.Sprintf(concurrencyFormat, keyPrefix),
+		},
+		max,                                  // ARGV[1]: max concurrency
+		time.Now().UnixMilli(),               // ARGV[2]: now in milliseconds
+		concurrencyExpiration.Milliseconds(), // ARGV[3]: lease expire in milliseconds
+		lease,                                // ARGV[4]: lease id
+	)
+	if err != nil || result.(int64) != 1 {
+		return "", false
+	}
+
+	return lease, true
+}
+
+func (l *RedisConcurrencyLimiter) Release(keyPrefix string, lease string) {
+	redis.ScriptRunCtx(context.Background(),
+		concurrencyReleaseScript,
+		[]string{
+			fmt.Sprintf(concurrencyFormat, keyPrefix),
+		},
+		lease, // ARGV[1]: lease id
+	)
+}
+
+func (l *RedisConcurrencyLimiter) GetCurrent(keyPrefix string) (int, error) {
+	result, err := redis.ScriptRunCtx(context.Background(),
+		concurrencyGetScript,
+		[]string{
+			fmt.Sprintf(concurrencyFormat, keyPrefix),
+		},
+		time.Now().UnixMilli(), // ARGV[1]: now in milliseconds
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	count, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("无法转换并发计数结果")
+	}
+
+	return int(count), nil
+}
+
+type MemoryConcurrencyLimiter struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+// Acquire 内存计数随进程退出一并清空，不需要租约
+func (l *MemoryConcurrencyLimiter) Acquire(keyPrefix string, max int) (string, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.counts[keyPrefix] >= max {
+		return "", false
+	}
+
+	l.counts[keyPrefix]++
+	return "", true
+}
+
+func (l *MemoryConcurrencyLimiter) Release(keyPrefix string, _ string) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.counts[keyPrefix] <= 1 {
+		delete(l.counts, keyPrefix)
+		return
+	}
+
+	l.counts[keyPrefix]--
+}
+
+func (l *MemoryConcurrencyLimiter) GetCurrent(keyPrefix string) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.counts[keyPrefix], nil
+}
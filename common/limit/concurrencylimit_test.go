@@ -0,0 +1,39 @@
+package limit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryConcurrencyLimiter(t *testing.T) {
+	limiter := &MemoryConcurrencyLimiter{counts: make(map[string]int)}
+
+	_, ok := limiter.Acquire("a", 2)
+	assert.True(t, ok)
+	_, ok = limiter.Acquire("a", 2)
+	assert.True(t, ok)
+	_, ok = limiter.Acquire("a", 2)
+	assert.False(t, ok)
+
+	// 不同的 key 互不影响
+	_, ok = limiter.Acquire("b", 1)
+	assert.True(t, ok)
+
+	current, err := limiter.GetCurrent("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, current)
+
+	limiter.Release("a", "")
+	current, _ = limiter.GetCurrent("a")
+	assert.Equal(t, 1, current)
+	_, ok = limiter.Acquire("a", 2)
+	assert.True(t, ok)
+
+	// 全部释放后清理计数，重复释放不会变为负数
+	limiter.Release("b", "")
+	limiter.Release("b", "")
+	current, _ = limiter.GetCurrent("b")
+	assert.Zero(t, current)
+	assert.NotContains(t, limiter.counts, "b")
+}
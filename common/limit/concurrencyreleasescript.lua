@@ -0,0 +1,5 @@
+-- KEYS[1] as concurrency_key
+-- ARGV[1] as lease id
+
+redis.call('ZREM', KEYS[1], ARGV[1])
+return redis.call('ZCARD', KEYS[1])
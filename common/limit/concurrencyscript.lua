@@ -0,0 +1,17 @@
+-- KEYS[1] as concurrency_key
+-- ARGV[1] as max concurrency
+-- ARGV[2] as now (in milliseconds)
+-- ARGV[3] as lease expire (in milliseconds)
+-- ARGV[4] as lease id
+
+-- 每个请求是一条租约，分数为到期时间，进程异常退出后未释放的租约到期后被清理
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+    return 0
+end
+
+redis.call('ZADD', KEYS[1], tonumber(ARGV[2]) + tonumber(ARGV[3]), ARGV[4])
+-- 集合的过期时间跟随最新的租约，没有新请求时整个 key 一并过期
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
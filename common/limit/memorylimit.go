@@ -98,6 +98,14 @@ func (l *MemoryLimiter) allowFixedWindow(keyPrefix string, n int) bool {
 	now := time.Now()
 	data, exists := l.windowStore[keyPrefix]
 
+	// n 为负数时退还当前窗口内的计数，窗口已重置时无需退还
+	if n < 0 {
+		if exists && now.Sub(data.windowStart) < l.window {
+			data.count = max(data.count+n, 0)
+		}
+		return true
+	}
+
 	if !exists {
 		// First request for this key
 		l.windowStore[keyPrefix] = &windowData{
@@ -57,9 +57,9 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 
 	req.Header.Set("Content-Type", "application/json")
 
-	provider := providers.GetProvider(channel, c)
-	if provider == nil {
-		return 0, errors.New("provider not found")
+	provider, err := providers.NewProvider(channel, c)
+	if err != nil {
+		return 0, err
 	}
 
 	balanceProvider, ok := provider.(providersBase.BalanceInterface)
@@ -67,8 +67,12 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 		return 0, errors.New("provider not implemented")
 	}
 
-	return balanceProvider.Balance()
+	balance, err := balanceProvider.Balance()
+	if err == nil && balance > 0 {
+		RestoreExhaustedChannel(channel)
+	}
 
+	return balance, err
 }
 
 func UpdateChannelBalance(c *gin.Context) {
@@ -109,7 +113,7 @@ func updateAllChannelsBalance() error {
 		return err
 	}
 	for _, channel := range channels {
-		if channel.Status != config.ChannelStatusEnabled {
+		if channel.Status != config.ChannelStatusEnabled && channel.Status != config.ChannelStatusExhausted {
 			continue
 		}
 		// TODO: support Azure
@@ -122,7 +126,7 @@ func updateAllChannelsBalance() error {
 		} else {
 			// err is nil & balance <= 0 means quota is used up
 			if balance <= 0 {
-				DisableChannel(channel.Id, channel.Name, "余额不足", true)
+				disableChannel(channel.Id, channel.Name, config.ChannelStatusExhausted, "["+model.ChannelErrorBalance+"] 余额不足", true)
 			}
 		}
 		time.Sleep(config.RequestInterval)
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChannelErrorRuleTestRequest struct {
+	// 为空时使用已保存的规则与处理方式，用于在保存前测试修改后的配置
+	Rules       *string     `json:"rules"`
+	Actions     *string     `json:"actions"`
+	ChannelType int         `json:"channel_type"`
+	Error       SampleError `json:"error"`
+}
+
+// GetChannelErrorRuleDefaults 返回默认的错误分类规则与分类的处理方式
+func GetChannelErrorRuleDefaults(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"rules":   model.ChannelErrorRules.GetDefaultRules(),
+			"actions": model.ChannelErrorRules.GetDefaultActions(),
+		},
+	})
+}
+
+// TestChannelErrorRule 返回示例错误的分类与处理方式，未命中任何规则时 data 为 null
+func TestChannelErrorRule(c *gin.Context) {
+	var request ChannelErrorRuleTestRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	rulesValue := config.ChannelErrorRules
+	if request.Rules != nil {
+		rulesValue = *request.Rules
+	}
+	rules, err := model.ParseChannelErrorRules(rulesValue)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	actionsValue := config.ChannelErrorActions
+	if request.Actions != nil {
+		actionsValue = *request.Actions
+	}
+	actions, err := model.ParseChannelErrorActions(actionsValue)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	class := model.ClassifyChannelError(rules, actions, request.ChannelType, request.Error.toOpenAIError())
+	if class == nil && common.DisableChannelKeywordsInstance.IsContains(request.Error.Message) {
+		class = model.NewChannelErrorClass(actions, "disable_keywords", model.ChannelErrorOther)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    class,
+	})
+}
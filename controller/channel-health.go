@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/model"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseChannelHealthQuery 默认查询最近 24 小时
+func parseChannelHealthQuery(c *gin.Context) (*model.ChannelHealthQuery, error) {
+	query := &model.ChannelHealthQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		return nil, err
+	}
+
+	if query.EndTime == 0 {
+		query.EndTime = time.Now().Unix()
+	}
+	if query.StartTime == 0 {
+		query.StartTime = query.EndTime - 24*3600
+	}
+	if query.StartTime >= query.EndTime {
+		return nil, errors.New("开始时间必须早于结束时间")
+	}
+	if query.Interval < 0 {
+		return nil, errors.New("无效的时间间隔")
+	}
+
+	return query, nil
+}
+
+// GetChannelHealth 返回单个渠道按时间间隔合并的健康统计
+func GetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	query, err := parseChannelHealthQuery(c)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+	query.ChannelId = id
+	if query.Interval == 0 {
+		query.Interval = 3600
+	}
+
+	points, err := model.GetChannelHealth(query, query.Model != "")
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    points,
+	})
+}
+
+// GetChannelUptime 返回各渠道各模型在时间段内的可用率
+func GetChannelUptime(c *gin.Context) {
+	query, err := parseChannelHealthQuery(c)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	points, err := model.GetChannelHealth(query, true)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    points,
+	})
+}
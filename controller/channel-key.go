@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/model"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AddChannelKeysRequest struct {
+	Keys   string `json:"keys" binding:"required"`
+	Weight uint   `json:"weight"`
+}
+
+type UpdateChannelKeyStatusRequest struct {
+	Status int `json:"status" binding:"required"`
+}
+
+func getKeyPoolChannel(c *gin.Context) (*model.Channel, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := model.GetChannelById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !channel.IsKeyPool() {
+		return nil, errors.New("该渠道未启用 key 池")
+	}
+
+	return channel, nil
+}
+
+func GetChannelKeys(c *gin.Context) {
+	channel, err := getKeyPoolChannel(c)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	keys, err := model.GetChannelKeys(channel.Id)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	for _, key := range keys {
+		key.MaskKey()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+func AddChannelKeys(c *gin.Context) {
+	channel, err := getKeyPoolChannel(c)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	var request AddChannelKeysRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	count, err := model.AddChannelKeys(channel.Id, strings.Split(request.Keys, "\n"), request.Weight)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+// UpdateChannelKeyStatus 手动禁用或重新启用单个 key
+func UpdateChannelKeyStatus(c *gin.Context) {
+	channel, err := getKeyPoolChannel(c)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	keyId, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	var request UpdateChannelKeyStatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	if request.Status != config.ChannelStatusEnabled && request.Status != config.ChannelStatusManuallyDisabled {
+		common.APIRespondWithError(c, http.StatusOK, errors.New("无效的状态"))
+		return
+	}
+
+	if _, err := model.GetChannelKeyById(channel.Id, keyId); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	if err := model.UpdateChannelKeyStatus(channel.Id, keyId, request.Status, ""); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
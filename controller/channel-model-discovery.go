@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/notify"
+	"done-hub/model"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApplyChannelModelDiffsRequest struct {
+	Items []struct {
+		ChannelId int      `json:"channel_id"`
+		Added     []string `json:"added"`
+		Removed   []string `json:"removed"`
+	} `json:"items" binding:"required"`
+}
+
+// DiscoverChannelModels 定时获取开启了模型发现的渠道的上游模型列表
+func DiscoverChannelModels() {
+	channels, err := model.GetAllChannels()
+	if err != nil {
+		logger.SysError("failed to get channels: " + err.Error())
+		return
+	}
+
+	applied := false
+	for _, channel := range channels {
+		discovery := channel.GetModelDiscovery()
+		if discovery == nil || channel.Status == config.ChannelStatusManuallyDisabled {
+			continue
+		}
+
+		if discoverChannelModels(channel, discovery) {
+			applied = true
+		}
+	}
+
+	if applied {
+		model.ChannelGroup.Reload()
+	}
+}
+
+// discoverChannelModels 返回是否自动修改了渠道的模型
+func discoverChannelModels(channel *model.Channel, discovery *model.ChannelModelDiscovery) bool {
+	channel.SetProxy()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodGet, "/v1/models", nil)
+
+	models, err := fetchProviderModels(channel, c)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("channel_model_discovery_failed channel_id=%d error=\"%s\"", channel.Id, err.Error()))
+		return false
+	}
+
+	previous, err := model.SaveDiscoveredModels(channel.Id, models)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("channel_model_discovery_save_failed channel_id=%d error=\"%s\"", channel.Id, err.Error()))
+		return false
+	}
+
+	// 首次获取时只记录模型列表，不视为上游变动
+	if len(previous) > 0 {
+		added, removed := model.DiffModels(previous, models)
+		if len(added) > 0 || len(removed) > 0 {
+			logger.SysLog(fmt.Sprintf("channel_model_discovery_changed channel_id=%d added=%d removed=%d", channel.Id, len(added), len(removed)))
+			subject := fmt.Sprintf("渠道「%s」（#%d）上游模型发生变化", channel.Name, channel.Id)
+			content := fmt.Sprintf("渠道「%s」（#%d）上游模型发生变化\n新增：%s\n移除：%s",
+				channel.Name, channel.Id, strings.Join(added, ","), strings.Join(removed, ","))
+			notify.Send(subject, content)
+		}
+	}
+
+	if !discovery.AutoApply {
+		return false
+	}
+
+	diff := channel.GetChannelModelDiff(&model.ChannelDiscoveredModels{Models: strings.Join(models, ",")})
+	added := discovery.FilterAutoApply(diff.Added)
+	removed := discovery.FilterAutoApply(diff.Removed)
+	if len(added) == 0 && len(removed) == 0 {
+		return false
+	}
+
+	if err := model.ApplyChannelModelDiff(channel.Id, added, removed); err != nil {
+		logger.SysError(fmt.Sprintf("channel_model_discovery_apply_failed channel_id=%d error=\"%s\"", channel.Id, err.Error()))
+		return false
+	}
+
+	logger.SysLog(fmt.Sprintf("channel_model_discovery_applied channel_id=%d added=%s removed=%s",
+		channel.Id, strings.Join(added, ","), strings.Join(removed, ",")))
+	return true
+}
+
+func GetChannelModelDiffs(c *gin.Context) {
+	diffs, err := model.GetChannelModelDiffs()
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    diffs,
+	})
+}
+
+// ApplyChannelModelDiffs 批量应用管理员确认后的模型差异
+func ApplyChannelModelDiffs(c *gin.Context) {
+	var request ApplyChannelModelDiffsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	if len(request.Items) == 0 {
+		common.APIRespondWithError(c, http.StatusOK, errors.New("items不能为空"))
+		return
+	}
+
+	count := 0
+	var errs []string
+	for _, item := range request.Items {
+		if err := model.ApplyChannelModelDiff(item.ChannelId, item.Added, item.Removed); err != nil {
+			errs = append(errs, fmt.Sprintf("#%d: %s", item.ChannelId, err.Error()))
+			continue
+		}
+		count++
+	}
+
+	if count > 0 {
+		model.ChannelGroup.Reload()
+	}
+
+	if len(errs) > 0 {
+		common.APIRespondWithError(c, http.StatusOK, errors.New(strings.Join(errs, "; ")))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"done-hub/model"
 	"done-hub/providers"
 	providersBase "done-hub/providers/base"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -42,41 +43,41 @@ func GetModelList(c *gin.Context) {
 		}
 	}
 
-	provider := providers.GetProvider(channel, c)
-	if provider == nil {
+	uniqueModels, err := fetchProviderModels(channel, c)
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "provider not found",
+			"message": err.Error(),
 		})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    uniqueModels,
+	})
+}
+
+// fetchProviderModels 通过渠道的 provider 获取上游模型列表
+func fetchProviderModels(channel *model.Channel, c *gin.Context) ([]string, error) {
+	provider, err := providers.NewProvider(channel, c)
+	if err != nil {
+		return nil, err
+	}
+
 	modelProvider, ok := provider.(providersBase.ModelListInterface)
 	if !ok {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "channel not implemented",
-		})
-		return
+		return nil, errors.New("channel not implemented")
 	}
 
 	modelList, err := modelProvider.GetModelList()
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
+		return nil, err
 	}
 
 	// 去除重复的模型名称
-	uniqueModels := removeDuplicates(modelList)
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    uniqueModels,
-	})
+	return removeDuplicates(modelList), nil
 }
 
 // 辅助函数：去除切片中的重复元素
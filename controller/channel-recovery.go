@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/model"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const channelRecoveryCheckInterval = 30 * time.Second
+
+type channelRecoveryState struct {
+	failures  int
+	successes int
+	nextProbe time.Time
+	// key 池渠道最近一次探测通过的 key
+	passedKeys []int
+}
+
+var (
+	channelRecoveryStates = make(map[int]*channelRecoveryState)
+	channelRecoveryLock   sync.Mutex
+)
+
+// channelRecoveryBackoff 失败次数越多，下次探测的间隔越长
+func channelRecoveryBackoff(failures int) time.Duration {
+	interval := time.Duration(config.ChannelRecoveryMinInterval) * time.Second
+	maxInterval := time.Duration(config.ChannelRecoveryMaxInterval) * time.Second
+	for i := 0; i < failures && interval < maxInterval; i++ {
+		interval *= 2
+	}
+
+	return min(interval, maxInterval)
+}
+
+// AutomaticallyRecoverChannels 只探测自动禁用的渠道，手动禁用的渠道不会被恢复
+func AutomaticallyRecoverChannels() {
+	// 多节点部署时只由主节点探测，探测状态保存在主节点上
+	if !config.IsMasterNode {
+		logger.SysLog("channel recovery is disabled on slave node")
+		return
+	}
+
+	for {
+		time.Sleep(channelRecoveryCheckInterval)
+		if !config.ChannelRecoveryEnabled {
+			continue
+		}
+
+		recoverChannels()
+	}
+}
+
+func recoverChannels() {
+	channels, err := model.GetChannelsByStatus(config.ChannelStatusAutoDisabled)
+	if err != nil {
+		logger.SysError("failed to get auto disabled channels: " + err.Error())
+		return
+	}
+
+	channelRecoveryLock.Lock()
+	defer channelRecoveryLock.Unlock()
+
+	// 清理已恢复或被手动处理的渠道
+	disabled := make(map[int]bool, len(channels))
+	for _, channel := range channels {
+		disabled[channel.Id] = true
+	}
+	for channelId := range channelRecoveryStates {
+		if !disabled[channelId] {
+			delete(channelRecoveryStates, channelId)
+		}
+	}
+
+	now := time.Now()
+	for _, channel := range channels {
+		state, ok := channelRecoveryStates[channel.Id]
+		if !ok {
+			state = &channelRecoveryState{nextProbe: now.Add(channelRecoveryBackoff(0))}
+			channelRecoveryStates[channel.Id] = state
+			continue
+		}
+
+		if now.Before(state.nextProbe) {
+			continue
+		}
+
+		probeChannel(channel, state)
+	}
+}
+
+func probeChannel(channel *model.Channel, state *channelRecoveryState) {
+	tik := time.Now()
+	var err error
+	if channel.IsKeyPool() {
+		state.passedKeys, err = probeChannelKeys(channel)
+	} else {
+		err = probeChannelOnce(channel)
+	}
+	milliseconds := time.Since(tik).Milliseconds()
+
+	if err != nil {
+		state.failures++
+		state.successes = 0
+		state.nextProbe = time.Now().Add(channelRecoveryBackoff(state.failures))
+		logger.SysLog(fmt.Sprintf("channel_recovery_probe_failed channel_id=%d failures=%d next_probe=%s error=\"%s\"",
+			channel.Id, state.failures, state.nextProbe.Format(time.RFC3339), err.Error()))
+		return
+	}
+
+	state.successes++
+	// 连续成功时尽快进行下一次探测
+	state.nextProbe = time.Now().Add(channelRecoveryBackoff(0))
+	logger.SysLog(fmt.Sprintf("channel_recovery_probe_success channel_id=%d successes=%d/%d",
+		channel.Id, state.successes, config.ChannelRecoverySuccessThreshold))
+
+	if state.successes < config.ChannelRecoverySuccessThreshold {
+		return
+	}
+
+	// key 池渠道先恢复探测通过的 key，否则渠道启用后仍没有可用的 key
+	for _, keyId := range state.passedKeys {
+		if err := model.UpdateChannelKeyStatus(channel.Id, keyId, config.ChannelStatusEnabled, ""); err != nil {
+			logger.SysError(fmt.Sprintf("channel_recovery_key_enable_failed channel_id=%d key_id=%d error=\"%s\"", channel.Id, keyId, err.Error()))
+			return
+		}
+		logger.SysLog(fmt.Sprintf("channel_key_recovered channel_id=%d key_id=%d", channel.Id, keyId))
+	}
+
+	channel.UpdateResponseTime(milliseconds)
+	EnableChannel(channel.Id, channel.Name, true)
+	// 自动禁用后重新加载过的渠道不在缓存中，需要重新加载
+	model.ChannelGroup.Reload()
+	delete(channelRecoveryStates, channel.Id)
+}
+
+func probeChannelOnce(channel *model.Channel) error {
+	openaiErr, err := testChannel(channel, "")
+	if err != nil {
+		return err
+	}
+	if openaiErr != nil {
+		return errors.New(openaiErr.Message)
+	}
+
+	return nil
+}
+
+// probeChannelKeys 逐个探测 key 池中自动禁用的 key，至少一个通过时视为探测成功
+func probeChannelKeys(channel *model.Channel) ([]int, error) {
+	keys, err := model.GetChannelKeysByStatus(channel.Id, config.ChannelStatusAutoDisabled)
+	if err != nil {
+		return nil, err
+	}
+	// 渠道因其他原因被禁用时 key 池中仍有可用的 key，按普通渠道探测
+	if len(keys) == 0 {
+		return nil, probeChannelOnce(channel)
+	}
+
+	var passed []int
+	var lastErr error
+	for _, key := range keys {
+		if lastErr = probeChannelOnce(channel.WithPoolKey(key)); lastErr == nil {
+			passed = append(passed, key.Id)
+		}
+	}
+
+	if len(passed) == 0 {
+		return nil, lastErr
+	}
+
+	return passed, nil
+}
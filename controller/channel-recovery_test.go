@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/model"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestChannelRecoveryBackoff(t *testing.T) {
+	minInterval, maxInterval := config.ChannelRecoveryMinInterval, config.ChannelRecoveryMaxInterval
+	config.ChannelRecoveryMinInterval = 60
+	config.ChannelRecoveryMaxInterval = 600
+	defer func() {
+		config.ChannelRecoveryMinInterval, config.ChannelRecoveryMaxInterval = minInterval, maxInterval
+	}()
+
+	cases := []struct {
+		failures int
+		interval time.Duration
+	}{
+		{0, 60 * time.Second},
+		{1, 120 * time.Second},
+		{2, 240 * time.Second},
+		{3, 480 * time.Second},
+		{4, 600 * time.Second},
+		{100, 600 * time.Second},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.interval, channelRecoveryBackoff(c.failures), "failures=%d", c.failures)
+	}
+}
+
+func TestRecoverChannelsState(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	assert.NoError(t, err)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	assert.NoError(t, db.AutoMigrate(&model.Channel{}))
+
+	previous := model.DB
+	model.DB = db
+	defer func() {
+		model.DB = previous
+		sqlDB.Close()
+		channelRecoveryStates = make(map[int]*channelRecoveryState)
+	}()
+
+	weight := uint(1)
+	autoDisabled := &model.Channel{Name: "auto", Status: config.ChannelStatusAutoDisabled, Weight: &weight}
+	manualDisabled := &model.Channel{Name: "manual", Status: config.ChannelStatusManuallyDisabled, Weight: &weight}
+	assert.NoError(t, db.Create(autoDisabled).Error)
+	assert.NoError(t, db.Create(manualDisabled).Error)
+
+	// 首次发现的渠道等待一个最小间隔后再探测，手动禁用的渠道不探测
+	recoverChannels()
+	assert.Len(t, channelRecoveryStates, 1)
+	state := channelRecoveryStates[autoDisabled.Id]
+	assert.NotNil(t, state)
+	assert.True(t, state.nextProbe.After(time.Now()))
+
+	// 未到探测时间时保留原有状态
+	state.failures = 3
+	recoverChannels()
+	assert.Equal(t, 3, channelRecoveryStates[autoDisabled.Id].failures)
+
+	// 已被手动处理的渠道清理探测状态
+	assert.NoError(t, db.Model(autoDisabled).Update("status", config.ChannelStatusEnabled).Error)
+	recoverChannels()
+	assert.Empty(t, channelRecoveryStates)
+}
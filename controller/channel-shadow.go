@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetShadowResults 分页返回影子请求与主请求的对比记录
+func GetShadowResults(c *gin.Context) {
+	var query model.ShadowResultQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	results, err := model.GetShadowResults(&query)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    results,
+	})
+}
+
+// GetShadowSummary 按影子渠道与模型汇总对比结果
+func GetShadowSummary(c *gin.Context) {
+	var query model.ShadowResultQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	summaries, err := model.GetShadowSummary(&query)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    summaries,
+	})
+}
@@ -30,12 +30,18 @@ var (
 	noSupportRegex  = regexp.MustCompile(`(?:^tts|rerank|whisper|speech|^mj_|^chirp)`)
 )
 
+func getChannelTestModel(channel *model.Channel, testModel string) string {
+	if testModel == "" {
+		return channel.TestModel
+	}
+
+	return testModel
+}
+
 func testChannel(channel *model.Channel, testModel string) (openaiErr *types.OpenAIErrorWithStatusCode, err error) {
+	testModel = getChannelTestModel(channel, testModel)
 	if testModel == "" {
-		testModel = channel.TestModel
-		if testModel == "" {
-			return nil, errors.New("请填写测速模型后再试")
-		}
+		return nil, errors.New("请填写测速模型后再试")
 	}
 
 	channelType := getModelType(testModel)
@@ -66,9 +72,9 @@ func testChannel(channel *model.Channel, testModel string) (openaiErr *types.Ope
 	c.Request = req
 
 	// 获取并验证provider
-	provider := providers.GetProvider(channel, c)
-	if provider == nil {
-		return nil, errors.New("channel not implemented")
+	provider, err := providers.NewProvider(channel, c)
+	if err != nil {
+		return nil, err
 	}
 
 	newModelName, err := provider.ModelMappingHandler(testModel)
@@ -84,6 +90,7 @@ func testChannel(channel *model.Channel, testModel string) (openaiErr *types.Ope
 	// 执行测试请求
 	var response any
 	var openAIErrorWithStatusCode *types.OpenAIErrorWithStatusCode
+	startTime := time.Now()
 
 	switch channelType {
 	case "embeddings":
@@ -142,9 +149,12 @@ func testChannel(channel *model.Channel, testModel string) (openaiErr *types.Ope
 		return nil, errors.New("不支持的模型类型")
 	}
 
+	// 测试结果同样计入渠道健康统计
 	if openAIErrorWithStatusCode != nil {
+		model.ChannelHealthStats.Record(channel.Id, testModel, 0, time.Since(startTime), model.ChannelHealthErrorClass(openAIErrorWithStatusCode.StatusCode))
 		return openAIErrorWithStatusCode, errors.New(openAIErrorWithStatusCode.Message)
 	}
+	model.ChannelHealthStats.Record(channel.Id, testModel, 0, time.Since(startTime), "")
 
 	// 转换为JSON字符串
 	jsonBytes, _ := json.Marshal(response)
@@ -200,9 +210,9 @@ func TestChannel(c *gin.Context) {
 	success := false
 	msg := ""
 	if openaiErr != nil {
-		if ShouldDisableChannel(channel.Type, openaiErr) {
-			msg = fmt.Sprintf("测速失败，已被禁用，原因：%s", err.Error())
-			DisableChannel(channel.Id, channel.Name, err.Error(), false)
+		if class := GetChannelErrorClass(channel.Type, openaiErr); class != nil {
+			msg = fmt.Sprintf("测速失败，错误分类为 %s，已按 %s 处理，原因：%s", class.Category, class.Action, err.Error())
+			HandleChannelError(channel, getChannelTestModel(channel, testModel), openaiErr, class, false)
 		} else {
 			msg = fmt.Sprintf("测速失败，原因：%s", err.Error())
 		}
@@ -264,7 +274,7 @@ func testAllChannels(isNotify bool) error {
 				// 如果已被禁用，但是请求成功，需要判断是否需要恢复
 				// 手动禁用的通道，不会自动恢复
 				if shouldEnableChannel(err, openaiErr) {
-					if channel.Status == config.ChannelStatusAutoDisabled {
+					if channel.Status == config.ChannelStatusAutoDisabled || channel.Status == config.ChannelStatusExhausted {
 						EnableChannel(channel.Id, channel.Name, false)
 						sendMessage += "- 已被启用 \n\n"
 					} else {
@@ -276,13 +286,13 @@ func testAllChannels(isNotify bool) error {
 				if milliseconds > disableThreshold {
 					errMsg := fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs ", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
 					sendMessage += fmt.Sprintf("- %s \n\n- 禁用\n\n", errMsg)
-					DisableChannel(channel.Id, channel.Name, errMsg, false)
+					DisableChannel(channel.Id, channel.Name, errMsg, !isNotify)
 					continue
 				}
 
-				if ShouldDisableChannel(channel.Type, openaiErr) {
-					sendMessage += fmt.Sprintf("- 已被禁用，原因：%s\n\n", utils.EscapeMarkdownText(err.Error()))
-					DisableChannel(channel.Id, channel.Name, err.Error(), false)
+				if class := GetChannelErrorClass(channel.Type, openaiErr); class != nil {
+					sendMessage += fmt.Sprintf("- 错误分类为 %s，已按 %s 处理，原因：%s\n\n", class.Category, class.Action, utils.EscapeMarkdownText(err.Error()))
+					HandleChannelError(channel, getChannelTestModel(channel, ""), openaiErr, class, !isNotify)
 					continue
 				}
 
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"done-hub/common"
+	"done-hub/common/config"
 	"done-hub/common/utils"
 	"done-hub/model"
 	"errors"
@@ -55,6 +56,37 @@ func GetChannel(c *gin.Context) {
 	})
 }
 
+// GetChannelEffectiveWeights 查看分组下模型各渠道当前的有效权重与统计
+func GetChannelEffectiveWeights(c *gin.Context) {
+	group := c.Query("group")
+	modelName := c.Query("model")
+	if group == "" || modelName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "group and model are required",
+		})
+		return
+	}
+
+	weights, err := model.ChannelGroup.GetEffectiveWeights(group, modelName)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"strategy": config.ChannelRoutingStrategy,
+			"channels": weights,
+		},
+	})
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -68,6 +100,17 @@ func AddChannel(c *gin.Context) {
 	channel.CreatedTime = utils.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
 
+	if err := channel.Validate(); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	// key 池渠道不拆分，所有 key 放入同一个渠道
+	if channel.IsKeyPool() {
+		addKeyPoolChannel(c, &channel, keys)
+		return
+	}
+
 	baseUrls := []string{}
 	if channel.BaseURL != nil && *channel.BaseURL != "" {
 		baseUrls = strings.Split(*channel.BaseURL, "\n")
@@ -105,6 +148,29 @@ func AddChannel(c *gin.Context) {
 	})
 }
 
+func addKeyPoolChannel(c *gin.Context, channel *model.Channel, keys []string) {
+	channel.Key = ""
+	if channel.BaseURL != nil {
+		baseURL := strings.Split(*channel.BaseURL, "\n")[0]
+		channel.BaseURL = &baseURL
+	}
+
+	if err := channel.Insert(); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	if _, err := model.AddChannelKeys(channel.Id, keys, 1); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	channel := model.Channel{Id: id}
@@ -164,6 +230,10 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if err := channel.Validate(); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
 	if channel.Models == "" {
 		err = channel.Update(false)
 	} else {
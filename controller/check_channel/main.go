@@ -70,9 +70,9 @@ func CreateCheckChannel(channelId int, models string) (*CheckChannel, error) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request = req
 
-	provider := providers.GetProvider(channel, c)
-	if provider == nil {
-		return nil, errors.New("channel not implemented")
+	provider, err := providers.NewProvider(channel, c)
+	if err != nil {
+		return nil, err
 	}
 
 	usage := &types.Usage{
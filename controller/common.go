@@ -31,41 +31,58 @@ func shouldEnableChannel(err error, openAIErr *types.OpenAIErrorWithStatusCode)
 	return true
 }
 
-func ShouldDisableChannel(channelType int, err *types.OpenAIErrorWithStatusCode) bool {
+// GetChannelErrorClass 按错误分类规则判断渠道错误的处理方式，未开启自动禁用或无需处理时返回 nil
+func GetChannelErrorClass(channelType int, err *types.OpenAIErrorWithStatusCode) *model.ChannelErrorClass {
 	if !config.AutomaticDisableChannelEnabled || err == nil || err.LocalError {
-		return false
+		return nil
 	}
 
-	// 状态码检查
-	if err.StatusCode == http.StatusUnauthorized {
-		return true
+	class := model.ChannelErrorRules.Classify(channelType, err)
+	if class == nil && model.RetryPolicy.Match(channelType, err).Action == model.RetryActionDisable {
+		class = model.NewChannelErrorClass(model.ChannelErrorRules.GetActions(), "retry_policy", model.ChannelErrorOther)
 	}
-	if err.StatusCode == http.StatusForbidden && channelType == config.ChannelTypeGemini {
-		return true
+	if class == nil && common.DisableChannelKeywordsInstance.IsContains(err.OpenAIError.Message) {
+		class = model.NewChannelErrorClass(model.ChannelErrorRules.GetActions(), "disable_keywords", model.ChannelErrorOther)
 	}
 
-	// 错误代码检查
-	switch err.OpenAIError.Code {
-	case "invalid_api_key", "account_deactivated", "billing_not_active":
-		return true
+	if class == nil || class.Action == model.ChannelErrorActionNone {
+		return nil
 	}
 
-	// 错误类型检查
-	switch err.OpenAIError.Type {
-	case "insufficient_quota", "authentication_error", "permission_error", "forbidden":
-		return true
-	}
+	return class
+}
 
-	switch err.OpenAIError.Param {
-	case "PERMISSIONDENIED":
-		return true
-	}
+func ShouldDisableChannel(channelType int, err *types.OpenAIErrorWithStatusCode) bool {
+	return GetChannelErrorClass(channelType, err) != nil
+}
+
+// HandleChannelError 按错误分类的处理方式禁用渠道、key 或移除模型，禁用原因中带有分类
+func HandleChannelError(channel *model.Channel, modelName string, err *types.OpenAIErrorWithStatusCode, class *model.ChannelErrorClass, sendNotify bool) {
+	reason := class.Reason(err.OpenAIError.Message)
 
-	return common.DisableChannelKeywordsInstance.IsContains(err.OpenAIError.Message)
+	switch class.Action {
+	case model.ChannelErrorActionDisableChannel:
+		DisableChannel(channel.Id, channel.Name, reason, sendNotify)
+	case model.ChannelErrorActionDisableKey:
+		// key 池渠道只禁用出错的 key
+		if channel.KeyId > 0 {
+			DisableChannelKey(channel.Id, channel.Name, channel.KeyId, reason)
+			return
+		}
+		DisableChannel(channel.Id, channel.Name, reason, sendNotify)
+	case model.ChannelErrorActionExhausted:
+		MarkChannelExhausted(channel, reason, sendNotify)
+	case model.ChannelErrorActionRemoveModel:
+		RemoveChannelModel(channel, modelName, reason, sendNotify)
+	}
 }
 
 // disable & notify
 func DisableChannel(channelId int, channelName string, reason string, sendNotify bool) {
+	disableChannel(channelId, channelName, config.ChannelStatusAutoDisabled, reason, sendNotify)
+}
+
+func disableChannel(channelId int, channelName string, status int, reason string, sendNotify bool) {
 	key := fmt.Sprintf("disable_channel_%d", channelId)
 
 	// 使用 singleflight 确保同一渠道的并发禁用请求只执行一次
@@ -77,16 +94,19 @@ func DisableChannel(channelId int, channelName string, reason string, sendNotify
 		}
 
 		// 如果渠道已经被禁用，不需要重复操作
-		if channel.Status == config.ChannelStatusAutoDisabled || channel.Status == config.ChannelStatusManuallyDisabled {
+		if channel.Status != config.ChannelStatusEnabled {
 			return nil, nil
 		}
 
 		// 执行禁用操作
-		model.UpdateChannelStatusById(channelId, config.ChannelStatusAutoDisabled)
+		model.UpdateChannelStatusWithReason(channelId, status, reason)
 
 		// 发送通知
 		if sendNotify {
 			subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelName, channelId)
+			if status == config.ChannelStatusExhausted {
+				subject = fmt.Sprintf("通道「%s」（#%d）余额耗尽，已暂停使用", channelName, channelId)
+			}
 			content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelName, channelId, reason)
 			notify.Send(subject, content)
 		}
@@ -100,6 +120,74 @@ func DisableChannel(channelId int, channelName string, reason string, sendNotify
 	}
 }
 
+// DisableChannelKey 自动禁用 key 池中的单个 key，没有可用 key 时禁用整个渠道
+func DisableChannelKey(channelId int, channelName string, keyId int, reason string) {
+	if err := model.UpdateChannelKeyStatus(channelId, keyId, config.ChannelStatusAutoDisabled, reason); err != nil {
+		logger.SysError(fmt.Sprintf("DisableChannelKey failed for channel %d key %d: %v", channelId, keyId, err))
+		return
+	}
+
+	if model.ChannelKeyPool.CountEnabled(channelId) == 0 {
+		DisableChannel(channelId, channelName, "key 池中的 key 已全部禁用，最后一个 key 的错误："+reason, true)
+	}
+}
+
+// MarkChannelExhausted 将渠道或 key 池中出错的 key 标记为余额耗尽，刷新余额后自动恢复
+func MarkChannelExhausted(channel *model.Channel, reason string, sendNotify bool) {
+	if channel.KeyId == 0 {
+		disableChannel(channel.Id, channel.Name, config.ChannelStatusExhausted, reason, sendNotify)
+		return
+	}
+
+	if err := model.UpdateChannelKeyStatus(channel.Id, channel.KeyId, config.ChannelStatusExhausted, reason); err != nil {
+		logger.SysError(fmt.Sprintf("MarkChannelExhausted failed for channel %d key %d: %v", channel.Id, channel.KeyId, err))
+		return
+	}
+
+	if model.ChannelKeyPool.CountEnabled(channel.Id) == 0 {
+		disableChannel(channel.Id, channel.Name, config.ChannelStatusExhausted, "key 池中的 key 已全部停用，最后一个 key 的错误："+reason, true)
+	}
+}
+
+// RestoreExhaustedChannel 刷新余额成功后恢复因余额耗尽而停用的渠道与 key
+func RestoreExhaustedChannel(channel *model.Channel) {
+	if count, err := model.EnableExhaustedChannelKeys(channel.Id); err != nil {
+		logger.SysError(fmt.Sprintf("RestoreExhaustedChannel failed for channel %d: %v", channel.Id, err))
+	} else if count > 0 {
+		logger.SysLog(fmt.Sprintf("channel_keys_restored channel_id=%d count=%d reason=\"balance_refreshed\"", channel.Id, count))
+	}
+
+	if channel.Status == config.ChannelStatusExhausted {
+		EnableChannel(channel.Id, channel.Name, true)
+	}
+}
+
+// RemoveChannelModel 从渠道中移除出错的模型，模型通过通配符匹配时无法移除，只记录日志
+func RemoveChannelModel(channel *model.Channel, modelName string, reason string, sendNotify bool) {
+	if modelName == "" {
+		return
+	}
+
+	removed, err := model.RemoveChannelModel(channel.Id, modelName)
+	if err != nil {
+		// 渠道只剩这一个模型时禁用整个渠道
+		logger.SysError(fmt.Sprintf("RemoveChannelModel failed for channel %d model %s: %v", channel.Id, modelName, err))
+		DisableChannel(channel.Id, channel.Name, reason, sendNotify)
+		return
+	}
+	if !removed {
+		logger.SysLog(fmt.Sprintf("channel_model_not_removed channel_id=%d model=\"%s\" reason=\"not_in_model_list\"", channel.Id, modelName))
+		return
+	}
+
+	logger.SysLog(fmt.Sprintf("channel_model_removed channel_id=%d model=\"%s\" reason=\"%s\"", channel.Id, modelName, reason))
+	if sendNotify {
+		subject := fmt.Sprintf("通道「%s」（#%d）已移除模型 %s", channel.Name, channel.Id, modelName)
+		content := fmt.Sprintf("通道「%s」（#%d）已移除模型 %s，原因：%s", channel.Name, channel.Id, modelName, reason)
+		notify.Send(subject, content)
+	}
+}
+
 // enable & notify
 func EnableChannel(channelId int, channelName string, sendNotify bool) {
 	model.UpdateChannelStatusById(channelId, config.ChannelStatusEnabled)
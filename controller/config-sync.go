@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/model"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApplyConfigSync 应用请求体中的 YAML 或 JSON 配置，dry_run=true 时只返回差异
+func ApplyConfigSync(c *gin.Context) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	prune := c.Query("prune") == "true"
+	changes, err := model.ApplyConfigSync(data, prune, dryRun)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    changes,
+	})
+}
+
+// ExportConfigSync 导出当前配置，渠道 key 以环境变量引用代替
+func ExportConfigSync(c *gin.Context) {
+	data, err := model.ExportConfigSync()
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
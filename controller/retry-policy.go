@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/model"
+	"done-hub/types"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SampleError 用于测试规则的示例错误
+type SampleError struct {
+	StatusCode int    `json:"status_code"`
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Param      string `json:"param"`
+	Message    string `json:"message"`
+}
+
+func (e *SampleError) toOpenAIError() *types.OpenAIErrorWithStatusCode {
+	apiErr := &types.OpenAIErrorWithStatusCode{
+		OpenAIError: types.OpenAIError{
+			Type:    e.Type,
+			Param:   e.Param,
+			Message: e.Message,
+		},
+		StatusCode: e.StatusCode,
+	}
+	if e.Code != "" {
+		apiErr.OpenAIError.Code = e.Code
+	}
+
+	return apiErr
+}
+
+type RetryPolicyTestRequest struct {
+	// 为空时使用已保存的规则，用于在保存前测试修改后的规则
+	Rules       *string     `json:"rules"`
+	ChannelType int         `json:"channel_type"`
+	Error       SampleError `json:"error"`
+}
+
+// GetRetryPolicyDefaults 返回未命中自定义规则时使用的默认规则
+func GetRetryPolicyDefaults(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.RetryPolicy.GetDefaultRules(),
+	})
+}
+
+// TestRetryPolicy 返回示例错误命中的规则与处理方式
+func TestRetryPolicy(c *gin.Context) {
+	var request RetryPolicyTestRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	rulesValue := config.RetryPolicyRules
+	if request.Rules != nil {
+		rulesValue = *request.Rules
+	}
+	rules, err := model.ParseRetryRules(rulesValue)
+	if err != nil {
+		common.APIRespondWithError(c, http.StatusOK, err)
+		return
+	}
+
+	rule := model.MatchRetryRule(rules, request.ChannelType, request.Error.toOpenAIError())
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"rule":       rule,
+			"is_default": slices.Contains(model.RetryPolicy.GetDefaultRules(), rule),
+			"action":     rule.Action,
+			"retry":      rule.Action != model.RetryActionFail,
+			"disable":    rule.Action == model.RetryActionDisable,
+		},
+	})
+}
@@ -436,6 +436,10 @@ func validateTokenSetting(setting *model.TokenSetting) error {
 		}
 	}
 
+	if setting.Cache.TTLSeconds < 0 || setting.Cache.TTLSeconds > 7*24*3600 {
+		return errors.New("cache ttl seconds must be between 0 and 604800")
+	}
+
 	// 验证models字段
 	if len(setting.Models) > 0 {
 		for _, model := range setting.Models {
@@ -453,6 +457,10 @@ func validateTokenSetting(setting *model.TokenSetting) error {
 		}
 	}
 
+	if err := setting.Fallbacks.Validate(); err != nil {
+		return err
+	}
+
 	// 验证subnet字段
 	if setting.Subnet != "" {
 		if !isValidSubnet(setting.Subnet) {
@@ -4,6 +4,7 @@ import (
 	"done-hub/common/config"
 	"done-hub/common/logger"
 	"done-hub/common/scheduler"
+	"done-hub/controller"
 	"done-hub/model"
 	"github.com/spf13/viper"
 	"time"
@@ -12,13 +13,25 @@ import (
 )
 
 func InitCron() {
+	// 渠道缓存在每个节点的内存中，时间窗口切换需要在所有节点上执行
+	err := scheduler.Manager.AddJob(
+		"apply_channel_schedules",
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() {
+			model.ChannelGroup.ApplySchedules()
+		}),
+	)
+	if err != nil {
+		logger.SysError("Cron job error: " + err.Error())
+	}
+
 	if !config.IsMasterNode {
 		logger.SysLog("Cron is disabled on slave node")
 		return
 	}
 
 	// 添加每日统计任务
-	err := scheduler.Manager.AddJob(
+	err = scheduler.Manager.AddJob(
 		"update_daily_statistics",
 		gocron.DailyJob(
 			1,
@@ -49,6 +62,19 @@ func InitCron() {
 		)
 	}
 
+	// 每小时汇总渠道健康统计，清理过期的健康统计与影子请求记录
+	err = scheduler.Manager.AddJob(
+		"rollup_channel_health",
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(func() {
+			model.RollupChannelHealth()
+			model.DeleteOldShadowResults()
+		}),
+	)
+	if err != nil {
+		logger.SysError("Cron job error: " + err.Error())
+	}
+
 	// 每十分钟更新一次统计数据
 	err = scheduler.Manager.AddJob(
 		"update_statistics",
@@ -59,6 +85,20 @@ func InitCron() {
 		}),
 	)
 
+	// 定时获取开启了模型发现的渠道的上游模型列表
+	if discoveryInterval := viper.GetInt("channel_model_discovery_interval"); discoveryInterval > 0 {
+		err := scheduler.Manager.AddJob(
+			"discover_channel_models",
+			gocron.DurationJob(time.Duration(discoveryInterval)*time.Minute),
+			gocron.NewTask(func() {
+				controller.DiscoverChannelModels()
+			}),
+		)
+		if err != nil {
+			logger.SysError("Cron job error: " + err.Error())
+		}
+	}
+
 	// 开启自动更新 并且设置了有效自动更新时间 同时自动更新模式不是system 则会从服务器拉取最新价格表
 	autoPriceUpdatesInterval := viper.GetInt("auto_price_updates_interval")
 	autoPriceUpdates := viper.GetBool("auto_price_updates")
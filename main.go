@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"done-hub/cli"
 	"done-hub/common"
 	"done-hub/common/cache"
@@ -21,9 +22,13 @@ import (
 	"done-hub/router"
 	"done-hub/safty"
 	"embed"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/sessions"
@@ -64,9 +69,14 @@ func main() {
 		logger.FatalLog("failed to initialize user token: " + err.Error())
 	}
 
+	common.InitSecretEncryption(viper.GetString("secret_encryption_key"), strings.Split(viper.GetString("secret_encryption_old_keys"), ","))
+
 	// Initialize SQL Database
 	model.SetupDB()
 	defer model.CloseDB()
+	if *cli.EncryptSecrets || *cli.RotateSecretKey {
+		runSecretMigration()
+	}
 	// Initialize Redis
 	redis.InitRedisClient()
 	cache.InitCacheManager()
@@ -78,9 +88,12 @@ func main() {
 	oidc.InitOIDCConfig()
 	model.NewPricing()
 	model.HandleOldTokenMaxId()
+	initConfigSync()
 
 	initMemoryCache()
 	initSync()
+	model.SubscribeChannelEvents()
+	model.ChannelBudgets.LoadPauses()
 
 	common.InitTokenEncoders()
 	requester.InitHttpClient()
@@ -103,6 +116,26 @@ func main() {
 	initHttpServer()
 }
 
+func runSecretMigration() {
+	err := model.MigrateSecrets(*cli.RotateSecretKey)
+	model.CloseDB()
+	if err != nil {
+		logger.FatalLog("failed to migrate secrets: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+func initConfigSync() {
+	file := viper.GetString("config_sync.file")
+	if file == "" || !config.IsMasterNode {
+		return
+	}
+
+	if err := model.ApplyConfigSyncFile(file, viper.GetBool("config_sync.prune")); err != nil {
+		logger.FatalLog("failed to apply config sync file: " + err.Error())
+	}
+}
+
 func initMemoryCache() {
 	if viper.GetBool("memory_cache_enabled") {
 		config.MemoryCacheEnabled = true
@@ -124,6 +157,7 @@ func initMemoryCache() {
 func initSync() {
 	// go controller.AutomaticallyUpdateChannels(viper.GetInt("channel.update_frequency"))
 	go controller.AutomaticallyTestChannels(viper.GetInt("channel.test_frequency"))
+	go controller.AutomaticallyRecoverChannels()
 }
 
 func initHttpServer() {
@@ -159,10 +193,30 @@ func initHttpServer() {
 	router.SetRouter(server, buildFS, indexPage)
 	port := viper.GetString("port")
 
-	err := server.Run(":" + port)
-	if err != nil {
-		logger.FatalLog("failed to start HTTP server: " + err.Error())
+	httpServer := &http.Server{
+		Addr:    ":" + port,
+		Handler: server,
 	}
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	logger.SysLog("shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.SysError("failed to shutdown HTTP server: " + err.Error())
+	}
+
+	// 写入还未结束的分钟的健康统计，避免重启时丢失
+	model.ChannelHealthStats.Flush(true)
 }
 
 func SyncChannelCache(frequency int) {
@@ -13,6 +13,7 @@ var (
 	httpRequestsTotal   *prometheus.CounterVec
 	httpRequestDuration *prometheus.HistogramVec
 	providerCounter     *prometheus.CounterVec
+	hedgeLatency        *prometheus.HistogramVec
 	panicCounter        *prometheus.CounterVec
 )
 
@@ -43,6 +44,15 @@ func init() {
 		[]string{"channel_type", "channel_id", "model", "type"},
 	)
 
+	hedgeLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "provider_hedge_latency_seconds",
+			Help:    "Latency of hedged provider requests in seconds.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"channel_type", "channel_id", "model", "result"},
+	)
+
 	// 3. 监控 panic
 	panicCounter = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -94,6 +104,18 @@ func RecordProvider(c *gin.Context, statusCode int) {
 	})
 }
 
+// 记录对冲请求中各渠道的耗时，result 为 won、lost 或 failed
+func RecordHedge(channelType, channelId int, model, result string, duration time.Duration) {
+	go SafelyRecordMetric(func() {
+		hedgeLatency.WithLabelValues(
+			strconv.Itoa(channelType),
+			strconv.Itoa(channelId),
+			model,
+			result,
+		).Observe(duration.Seconds())
+	})
+}
+
 // 记录 panic
 func RecordPanic(panicType string) {
 	panicCounter.WithLabelValues(panicType).Inc()
@@ -1,13 +1,16 @@
 package model
 
 import (
+	"context"
 	"done-hub/common/config"
 	"done-hub/common/logger"
+	"done-hub/common/redis"
 	"done-hub/common/utils"
 	"errors"
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -27,6 +30,12 @@ const (
 	ErrChannelDisabled                   = "该渠道已被禁用"
 )
 
+// 冷却的 Redis key，channelId:model，值为冷却结束时间
+const channelCooldownKey = "channel_cooldown:%s"
+
+// 本地没有冷却记录时，同一渠道模型两次读取 Redis 的最小间隔
+const cooldownRecheckInterval = time.Second
+
 // 关键词常量
 const (
 	KeywordNoAvailableChannel = "无可用渠道"
@@ -44,6 +53,13 @@ type ChannelsChooser struct {
 	Rule      map[string]map[string][][]int // group -> model -> priority -> channelIds
 	Match     []string
 	Cooldowns sync.Map
+	Affinity  map[string]int // group -> 亲和路由参与哈希的消息条数
+
+	// 本地未命中冷却时下次读取 Redis 的时间，避免每次选择渠道都访问 Redis
+	cooldownChecked sync.Map
+
+	Schedules      map[int]*ChannelSchedule // channelId -> 时间窗口
+	ScheduleActive map[int]bool             // channelId -> 加载时是否在时间窗口内
 
 	ModelGroup map[string]map[string]bool
 }
@@ -84,32 +100,94 @@ func init() {
 	}()
 }
 
+func cooldownKey(channelId int, modelName string) string {
+	return fmt.Sprintf("%d:%s", channelId, modelName)
+}
+
+// SetCooldowns 冷却渠道的模型，开启 Redis 时以 Redis 中带过期时间的 key 为准，本地状态与发布订阅只作为缓存
 func (cc *ChannelsChooser) SetCooldowns(channelId int, modelName string) bool {
 	if channelId == 0 || modelName == "" || config.RetryCooldownSeconds == 0 {
 		return false
 	}
 
-	key := fmt.Sprintf("%d:%s", channelId, modelName)
-	nowTime := time.Now().Unix()
+	until := time.Now().Unix() + int64(config.RetryCooldownSeconds)
+	if config.RedisEnabled {
+		ctx, cancel := context.WithTimeout(context.Background(), channelEventTimeout)
+		defer cancel()
+
+		redisKey := fmt.Sprintf(channelCooldownKey, cooldownKey(channelId, modelName))
+		ok, err := redis.GetRedisClient().SetNX(ctx, redisKey, until, time.Duration(config.RetryCooldownSeconds)*time.Second).Result()
+		if err != nil {
+			// Redis 不可用时只在本节点生效
+			logger.SysError(fmt.Sprintf("channel_cooldown_redis_failed channel_id=%d model=\"%s\" error=\"%s\"", channelId, modelName, err.Error()))
+		} else if !ok {
+			// 其他节点已设置冷却，不延长，同步结束时间到本地
+			cc.loadSharedCooldown(channelId, modelName)
+			return true
+		}
+	}
+
+	if cc.storeCooldown(channelId, modelName, until) {
+		publishChannelEvent(&channelEvent{
+			Action:    ChannelEventCooldown,
+			ChannelId: channelId,
+			Model:     modelName,
+			Until:     until,
+		})
+	}
+
+	return true
+}
+
+// storeCooldown 保存冷却结束时间，已在冷却中时不延长，返回是否新增了冷却
+func (cc *ChannelsChooser) storeCooldown(channelId int, modelName string, until int64) bool {
+	key := cooldownKey(channelId, modelName)
 
 	cooldownTime, exists := cc.Cooldowns.Load(key)
-	if exists && nowTime < cooldownTime.(int64) {
-		return true
+	if exists && time.Now().Unix() < cooldownTime.(int64) {
+		return false
 	}
 
-	cc.Cooldowns.LoadOrStore(key, nowTime+int64(config.RetryCooldownSeconds))
+	cc.Cooldowns.Store(key, until)
 	return true
 }
 
+// IsInCooldown 优先读取本地缓存，未命中时读取 Redis，启动较晚或错过发布订阅的节点同样能看到冷却
 func (cc *ChannelsChooser) IsInCooldown(channelId int, modelName string) bool {
-	key := fmt.Sprintf("%d:%s", channelId, modelName)
+	cooldownTime, exists := cc.Cooldowns.Load(cooldownKey(channelId, modelName))
+	if exists && time.Now().Unix() < cooldownTime.(int64) {
+		return true
+	}
 
-	cooldownTime, exists := cc.Cooldowns.Load(key)
-	if !exists {
+	if !config.RedisEnabled {
+		return false
+	}
+
+	return cc.loadSharedCooldown(channelId, modelName)
+}
+
+// loadSharedCooldown 读取 Redis 中的冷却并写入本地缓存，同一渠道模型在间隔内只读取一次
+func (cc *ChannelsChooser) loadSharedCooldown(channelId int, modelName string) bool {
+	key := cooldownKey(channelId, modelName)
+	now := time.Now()
+
+	if next, ok := cc.cooldownChecked.Load(key); ok && now.UnixNano() < next.(int64) {
+		return false
+	}
+	cc.cooldownChecked.Store(key, now.Add(cooldownRecheckInterval).UnixNano())
+
+	value, err := redis.RedisGet(fmt.Sprintf(channelCooldownKey, key))
+	if err != nil {
 		return false
 	}
 
-	return time.Now().Unix() < cooldownTime.(int64)
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || now.Unix() >= until {
+		return false
+	}
+
+	cc.storeCooldown(channelId, modelName, until)
+	return true
 }
 
 func (cc *ChannelsChooser) CleanupExpiredCooldowns() {
@@ -120,6 +198,12 @@ func (cc *ChannelsChooser) CleanupExpiredCooldowns() {
 		}
 		return true
 	})
+	cc.cooldownChecked.Range(func(key, value interface{}) bool {
+		if time.Now().UnixNano() >= value.(int64) {
+			cc.cooldownChecked.Delete(key)
+		}
+		return true
+	})
 }
 
 func (cc *ChannelsChooser) Disable(channelId int) {
@@ -142,42 +226,63 @@ func (cc *ChannelsChooser) Enable(channelId int) {
 	cc.Channels[channelId].Disable = false
 }
 
+// ChangeStatus 修改本节点的渠道状态，并通知其他节点
 func (cc *ChannelsChooser) ChangeStatus(channelId int, status bool) {
 	if status {
 		cc.Enable(channelId)
+		publishChannelEvent(&channelEvent{Action: ChannelEventEnable, ChannelId: channelId})
 	} else {
 		cc.Disable(channelId)
+		publishChannelEvent(&channelEvent{Action: ChannelEventDisable, ChannelId: channelId})
 	}
 }
 
-func (cc *ChannelsChooser) balancer(channelIds []int, filters []ChannelsFilterFunc, modelName string) *Channel {
-	totalWeight := 0
-
-	validChannels := make([]*ChannelChoice, 0, len(channelIds))
-	for _, channelId := range channelIds {
-		choice, ok := cc.Channels[channelId]
-		if !ok || choice.Disable {
-			continue
+// candidates 在读锁内复制各优先级下未禁用的渠道，冷却、熔断、限流等过滤可能访问 Redis，需在锁外进行
+func (cc *ChannelsChooser) candidates(channelsPriority [][]int) [][]*ChannelChoice {
+	priorities := make([][]*ChannelChoice, 0, len(channelsPriority))
+	for _, channelIds := range channelsPriority {
+		choices := make([]*ChannelChoice, 0, len(channelIds))
+		for _, channelId := range channelIds {
+			if choice, ok := cc.Channels[channelId]; ok && !choice.Disable {
+				choices = append(choices, choice)
+			}
 		}
+		priorities = append(priorities, choices)
+	}
 
-		if cc.IsInCooldown(channelId, modelName) {
-			continue
-		}
+	return priorities
+}
 
-		isSkip := false
-		for _, filter := range filters {
-			if filter(channelId, choice) {
-				isSkip = true
-				break
-			}
-		}
-		if isSkip {
-			continue
+// isAvailable 判断渠道是否可用于当前请求，不需要持有读锁
+func isAvailable(choice *ChannelChoice, filters []ChannelsFilterFunc, modelName string) bool {
+	channelId := choice.Channel.Id
+	if ChannelGroup.IsInCooldown(channelId, modelName) || !CircuitBreaker.IsAvailable(channelId, modelName) {
+		return false
+	}
+
+	if choice.Channel.IsKeyPool() && !ChannelKeyPool.HasAvailable(channelId) {
+		return false
+	}
+
+	if ChannelBudgets.IsPaused(choice.Channel) {
+		return false
+	}
+
+	for _, filter := range filters {
+		if filter(channelId, choice) {
+			return false
 		}
+	}
 
-		weight := int(*choice.Channel.Weight)
-		totalWeight += weight
-		validChannels = append(validChannels, choice)
+	return true
+}
+
+func balancer(choices []*ChannelChoice, filters []ChannelsFilterFunc, modelName, affinityKey string) *Channel {
+	validChannels := make([]*ChannelChoice, 0, len(choices))
+	for _, choice := range choices {
+		if isAvailable(choice, filters, modelName) {
+			validChannels = append(validChannels, choice)
+		}
 	}
 
 	if len(validChannels) == 0 {
@@ -188,16 +293,32 @@ func (cc *ChannelsChooser) balancer(channelIds []int, filters []ChannelsFilterFu
 		return validChannels[0].Channel
 	}
 
-	choiceWeight := rand.Intn(totalWeight)
-	for _, choice := range validChannels {
-		weight := int(*choice.Channel.Weight)
-		choiceWeight -= weight
+	if affinityKey != "" {
+		if channel := affinityChoice(choices, validChannels, affinityKey); channel != nil {
+			return channel
+		}
+	}
+
+	if config.ChannelRoutingStrategy == RoutingStrategyCost {
+		return costChoice(validChannels, modelName)
+	}
+
+	// 默认策略下有效权重即为配置的权重
+	weights := ChannelStats.EffectiveWeights(validChannels, modelName)
+	totalWeight := 0.0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+
+	choiceWeight := rand.Float64() * totalWeight
+	for i, choice := range validChannels {
+		choiceWeight -= weights[i]
 		if choiceWeight < 0 {
 			return choice.Channel
 		}
 	}
 
-	return nil
+	return validChannels[len(validChannels)-1].Channel
 }
 
 // GetMatchedModelName 获取匹配到的实际模型名称
@@ -244,6 +365,22 @@ func (cc *ChannelsChooser) GetMatchedModelName(group, modelName string) (string,
 }
 
 func (cc *ChannelsChooser) Next(group, modelName string, filters ...ChannelsFilterFunc) (*Channel, error) {
+	priorities, err := cc.nextCandidates(group, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, choices := range priorities {
+		channel := balancer(choices, filters, modelName, "")
+		if channel != nil {
+			return channel, nil
+		}
+	}
+
+	return nil, errors.New(ErrChannelNotFound)
+}
+
+func (cc *ChannelsChooser) nextCandidates(group, modelName string) ([][]*ChannelChoice, error) {
 	cc.RLock()
 	defer cc.RUnlock()
 	if _, ok := cc.Rule[group]; !ok {
@@ -284,18 +421,32 @@ func (cc *ChannelsChooser) Next(group, modelName string, filters ...ChannelsFilt
 		return nil, errors.New(ErrChannelNotFound)
 	}
 
-	for _, priority := range channelsPriority {
-		channel := cc.balancer(priority, filters, modelName)
+	return cc.candidates(channelsPriority), nil
+}
+
+// NextByValidatedModel 使用已经验证过的模型名称获取渠道，跳过模型匹配逻辑
+func (cc *ChannelsChooser) NextByValidatedModel(group, validatedModelName string, filters ...ChannelsFilterFunc) (*Channel, error) {
+	return cc.NextByAffinity(group, validatedModelName, "", filters...)
+}
+
+// NextByAffinity 与 NextByValidatedModel 相同，affinityKey 不为空时优先选择亲和渠道
+func (cc *ChannelsChooser) NextByAffinity(group, validatedModelName, affinityKey string, filters ...ChannelsFilterFunc) (*Channel, error) {
+	priorities, err := cc.validatedCandidates(group, validatedModelName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, choices := range priorities {
+		channel := balancer(choices, filters, validatedModelName, affinityKey)
 		if channel != nil {
 			return channel, nil
 		}
 	}
 
-	return nil, errors.New(ErrChannelNotFound)
+	return nil, errors.New(ErrNoAvailableChannelsAfterFiltering)
 }
 
-// NextByValidatedModel 使用已经验证过的模型名称获取渠道，跳过模型匹配逻辑
-func (cc *ChannelsChooser) NextByValidatedModel(group, validatedModelName string, filters ...ChannelsFilterFunc) (*Channel, error) {
+func (cc *ChannelsChooser) validatedCandidates(group, validatedModelName string) ([][]*ChannelChoice, error) {
 	cc.RLock()
 	defer cc.RUnlock()
 
@@ -312,14 +463,7 @@ func (cc *ChannelsChooser) NextByValidatedModel(group, validatedModelName string
 		return nil, errors.New(ErrNoChannelsAvailable)
 	}
 
-	for _, priority := range channelsPriority {
-		channel := cc.balancer(priority, filters, validatedModelName)
-		if channel != nil {
-			return channel, nil
-		}
-	}
-
-	return nil, errors.New(ErrNoAvailableChannelsAfterFiltering)
+	return cc.candidates(channelsPriority), nil
 }
 
 func (cc *ChannelsChooser) GetGroupModels(group string) ([]string, error) {
@@ -358,62 +502,32 @@ func (cc *ChannelsChooser) GetChannel(channelId int) *Channel {
 
 // CountAvailableChannels 计算指定分组和模型的可用渠道数量（排除禁用、冷却和过滤的渠道）
 func (cc *ChannelsChooser) CountAvailableChannels(group, modelName string, filters ...ChannelsFilterFunc) int {
-	cc.RLock()
-	defer cc.RUnlock()
-
-	if _, ok := cc.Rule[group]; !ok {
-		return 0
-	}
-
-	channelsPriority, ok := cc.Rule[group][modelName]
-	if !ok {
-		return 0
-	}
-
-	if len(channelsPriority) == 0 {
+	priorities, err := cc.validatedCandidates(group, modelName)
+	if err != nil {
 		return 0
 	}
 
+	// 与balancer方法使用相同的过滤逻辑
 	totalAvailable := 0
-	for _, priority := range channelsPriority {
-		totalAvailable += cc.countValidChannels(priority, filters, modelName)
+	for _, choices := range priorities {
+		for _, choice := range choices {
+			if isAvailable(choice, filters, modelName) {
+				totalAvailable++
+			}
+		}
 	}
 
 	return totalAvailable
 }
 
-// countValidChannels 计算指定渠道列表中的可用渠道数量
-// 与balancer方法使用相同的过滤逻辑
-func (cc *ChannelsChooser) countValidChannels(channelIds []int, filters []ChannelsFilterFunc, modelName string) int {
-	count := 0
-	for _, channelId := range channelIds {
-		choice, ok := cc.Channels[channelId]
-		if !ok || choice.Disable {
-			continue
-		}
-
-		if cc.IsInCooldown(channelId, modelName) {
-			continue
-		}
-
-		isSkip := false
-		for _, filter := range filters {
-			if filter(channelId, choice) {
-				isSkip = true
-				break
-			}
-		}
-		if isSkip {
-			continue
-		}
+var ChannelGroup = ChannelsChooser{}
 
-		count++
-	}
-	return count
+// Reload 重新加载本节点的渠道，并通知其他节点重新加载
+func (cc *ChannelsChooser) Reload() {
+	cc.Load()
+	publishChannelEvent(&channelEvent{Action: ChannelEventReload})
 }
 
-var ChannelGroup = ChannelsChooser{}
-
 func (cc *ChannelsChooser) Load() {
 	var channels []*Channel
 	DB.Where("status = ?", config.ChannelStatusEnabled).Find(&channels)
@@ -428,6 +542,9 @@ func (cc *ChannelsChooser) Load() {
 		model string
 	}
 	channelGroups := make(map[groupModelKey]map[int64][]int)
+	newSchedules := make(map[int]*ChannelSchedule)
+	newScheduleActive := make(map[int]bool)
+	now := time.Now()
 
 	// 处理每个channel
 	for _, channel := range channels {
@@ -441,6 +558,20 @@ func (cc *ChannelsChooser) Load() {
 			Disable:       false,
 		}
 
+		// 时间窗口外的渠道不参与选择或使用窗口外的优先级
+		priority := *channel.Priority
+		if schedule := channel.GetSchedule(); schedule != nil {
+			active := schedule.IsActive(now)
+			newSchedules[channel.Id] = schedule
+			newScheduleActive[channel.Id] = active
+			if !active {
+				if schedule.OutsideAction != ScheduleOutsidePriority {
+					continue
+				}
+				priority = schedule.OutsidePriority
+			}
+		}
+
 		// 处理groups和models
 		groups := strings.Split(channel.Group, ",")
 		models := strings.Split(channel.Models, ",")
@@ -463,7 +594,6 @@ func (cc *ChannelsChooser) Load() {
 				}
 
 				// 按priority分组存储channelId
-				priority := *channel.Priority
 				channelGroups[key][priority] = append(channelGroups[key][priority], channel.Id)
 
 				// 处理通配符模型
@@ -511,12 +641,16 @@ func (cc *ChannelsChooser) Load() {
 		newMatchList = append(newMatchList, match)
 	}
 
+	ChannelKeyPool.Load()
+
 	// 更新ChannelsChooser
 	cc.Lock()
 	cc.Rule = newGroup
 	cc.Channels = newChannels
 	cc.Match = newMatchList
 	cc.ModelGroup = newModelGroup
+	cc.Schedules = newSchedules
+	cc.ScheduleActive = newScheduleActive
 	cc.Unlock()
 	logger.SysLog("channels Load success")
 }
@@ -2,50 +2,64 @@ package model
 
 import (
 	"crypto/md5"
+	"done-hub/common"
 	"done-hub/common/config"
 	"done-hub/common/logger"
 	"done-hub/common/utils"
 	"encoding/hex"
+	"errors"
 	"slices"
 	"strings"
+	"time"
 
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Channel struct {
-	Id                 int                          `json:"id"`
-	Type               int                          `json:"type" form:"type" gorm:"default:0"`
-	Key                string                       `json:"key" form:"key" gorm:"type:text"`
-	Status             int                          `json:"status" form:"status" gorm:"default:1"`
-	Name               string                       `json:"name" form:"name" gorm:"index"`
-	Weight             *uint                        `json:"weight" gorm:"default:1"`
-	CreatedTime        int64                        `json:"created_time" gorm:"bigint"`
-	TestTime           int64                        `json:"test_time" gorm:"bigint"`
-	ResponseTime       int                          `json:"response_time"` // in milliseconds
-	BaseURL            *string                      `json:"base_url" gorm:"column:base_url;default:''"`
-	Other              string                       `json:"other" form:"other"`
-	Balance            float64                      `json:"balance"` // in USD
-	BalanceUpdatedTime int64                        `json:"balance_updated_time" gorm:"bigint"`
-	Models             string                       `json:"models" form:"models"`
-	Group              string                       `json:"group" form:"group" gorm:"type:varchar(32);default:'default'"`
-	Tag                string                       `json:"tag" form:"tag" gorm:"type:varchar(32);default:''"`
-	UsedQuota          int64                        `json:"used_quota" gorm:"bigint;default:0"`
-	ModelMapping       *string                      `json:"model_mapping" gorm:"type:text"`
-	ModelHeaders       *string                      `json:"model_headers" gorm:"type:varchar(1024);default:''"`
-	CustomParameter    *string                      `json:"custom_parameter" gorm:"type:varchar(1024);default:''"`
-	Priority           *int64                       `json:"priority" gorm:"bigint;default:0"`
-	Proxy              *string                      `json:"proxy" gorm:"type:varchar(255);default:''"`
-	TestModel          string                       `json:"test_model" form:"test_model" gorm:"type:varchar(50);default:''"`
-	OnlyChat           bool                         `json:"only_chat" form:"only_chat" gorm:"default:false"`
-	PreCost            int                          `json:"pre_cost" form:"pre_cost" gorm:"default:1"`
-	CompatibleResponse bool                         `json:"compatible_response" gorm:"default:false"`
-	SystemPrompt       string                       `json:"system_prompt" form:"system_prompt" gorm:"type:text"`
-	EnableSearch       bool                         `json:"enable_search" gorm:"default:false"`
-	DisabledStream     *datatypes.JSONSlice[string] `json:"disabled_stream,omitempty" gorm:"type:json"`
+	Id                 int                                        `json:"id"`
+	Type               int                                        `json:"type" form:"type" gorm:"default:0"`
+	Key                string                                     `json:"key" form:"key" gorm:"type:text;serializer:secret"`
+	Status             int                                        `json:"status" form:"status" gorm:"default:1"`
+	Name               string                                     `json:"name" form:"name" gorm:"index"`
+	Weight             *uint                                      `json:"weight" gorm:"default:1"`
+	CreatedTime        int64                                      `json:"created_time" gorm:"bigint"`
+	TestTime           int64                                      `json:"test_time" gorm:"bigint"`
+	ResponseTime       int                                        `json:"response_time"` // in milliseconds
+	BaseURL            *string                                    `json:"base_url" gorm:"column:base_url;default:''"`
+	Other              string                                     `json:"other" form:"other"`
+	Balance            float64                                    `json:"balance"` // in USD
+	BalanceUpdatedTime int64                                      `json:"balance_updated_time" gorm:"bigint"`
+	Models             string                                     `json:"models" form:"models"`
+	Group              string                                     `json:"group" form:"group" gorm:"type:varchar(32);default:'default'"`
+	Tag                string                                     `json:"tag" form:"tag" gorm:"type:varchar(32);default:''"`
+	UsedQuota          int64                                      `json:"used_quota" gorm:"bigint;default:0"`
+	ModelMapping       *string                                    `json:"model_mapping" gorm:"type:text"`
+	ModelHeaders       *string                                    `json:"model_headers" gorm:"type:varchar(1024);default:''"`
+	CustomParameter    *string                                    `json:"custom_parameter" gorm:"type:varchar(1024);default:''"`
+	Priority           *int64                                     `json:"priority" gorm:"bigint;default:0"`
+	Proxy              *string                                    `json:"proxy" gorm:"type:varchar(255);default:''"`
+	TestModel          string                                     `json:"test_model" form:"test_model" gorm:"type:varchar(50);default:''"`
+	OnlyChat           bool                                       `json:"only_chat" form:"only_chat" gorm:"default:false"`
+	PreCost            int                                        `json:"pre_cost" form:"pre_cost" gorm:"default:1"`
+	CompatibleResponse bool                                       `json:"compatible_response" gorm:"default:false"`
+	SystemPrompt       string                                     `json:"system_prompt" form:"system_prompt" gorm:"type:text"`
+	EnableSearch       bool                                       `json:"enable_search" gorm:"default:false"`
+	DisabledStream     *datatypes.JSONSlice[string]               `json:"disabled_stream,omitempty" gorm:"type:json"`
+	Limits             *datatypes.JSONType[ChannelLimits]         `json:"limits,omitempty" gorm:"type:json"`
+	Costs              *datatypes.JSONType[ChannelCosts]          `json:"costs,omitempty" gorm:"type:json"`
+	Budget             *datatypes.JSONType[ChannelBudget]         `json:"budget,omitempty" gorm:"type:json"`
+	ModelDiscovery     *datatypes.JSONType[ChannelModelDiscovery] `json:"model_discovery,omitempty" gorm:"type:json"`
+	Schedule           *datatypes.JSONType[ChannelSchedule]       `json:"schedule,omitempty" gorm:"type:json"`
+	KeyMode            string                                     `json:"key_mode" form:"key_mode" gorm:"type:varchar(16);default:''"` // 为空时使用单个 key，否则从 key 池中轮换
+	DisableReason      string                                     `json:"disable_reason" gorm:"type:varchar(255);default:''"`          // 自动禁用的原因，带有错误分类
 
 	Plugin    *datatypes.JSONType[PluginType] `json:"plugin" form:"plugin" gorm:"type:json"`
 	DeletedAt gorm.DeletedAt                  `json:"-" gorm:"index"`
+
+	CircuitBreakers []*CircuitBreakerStatus `json:"circuit_breakers,omitempty" gorm:"-"`
+	KeyId           int                     `json:"-" gorm:"-"` // 本次请求使用的 key 池中的 key
+	ScheduleState   string                  `json:"schedule_state,omitempty" gorm:"-"`
 }
 
 func (c *Channel) AllowStream(modelName string) bool {
@@ -116,8 +130,17 @@ func GetChannelsList(params *SearchChannelsParams) (*DataResult[Channel], error)
 	}
 
 	if params.Key != "" {
-		db = db.Where(quotePostgresField("key")+" = ?", params.Key)
-		tagDB = tagDB.Where(quotePostgresField("key")+" = ?", params.Key)
+		if common.SecretEncryptionEnabled() {
+			ids, err := getChannelIdsByKey(params.Key)
+			if err != nil {
+				return nil, err
+			}
+			db = db.Where("id IN ?", ids)
+			tagDB = tagDB.Where("id IN ?", ids)
+		} else {
+			db = db.Where(quotePostgresField("key")+" = ?", params.Key)
+			tagDB = tagDB.Where(quotePostgresField("key")+" = ?", params.Key)
+		}
 	}
 
 	if params.TestModel != "" {
@@ -139,7 +162,35 @@ func GetChannelsList(params *SearchChannelsParams) (*DataResult[Channel], error)
 		db = db.Where("tag = '' OR id IN (?)", tagDB)
 	}
 
-	return PaginateAndOrder(db, &params.PaginationParams, &channels, allowedChannelOrderFields)
+	result, err := PaginateAndOrder(db, &params.PaginationParams, &channels, allowedChannelOrderFields)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, channel := range channels {
+		channel.CircuitBreakers = CircuitBreaker.GetChannelStatuses(channel.Id)
+		channel.ScheduleState = channel.GetScheduleState(now)
+	}
+
+	return result, nil
+}
+
+// getChannelIdsByKey 加密后的 key 无法在数据库中直接比较，需要解密后查找
+func getChannelIdsByKey(key string) ([]int, error) {
+	var channels []*Channel
+	if err := DB.Select("id", quotePostgresField("key")).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0)
+	for _, channel := range channels {
+		if channel.Key == key {
+			ids = append(ids, channel.Id)
+		}
+	}
+
+	return ids, nil
 }
 
 func GetAllChannels() ([]*Channel, error) {
@@ -155,6 +206,12 @@ func GetChannelById(id int) (*Channel, error) {
 	return &channel, err
 }
 
+func GetChannelsByStatus(status int) ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Where("status = ?", status).Find(&channels).Error
+	return channels, err
+}
+
 func GetChannelsByTag(tag string) ([]*Channel, error) {
 	var channels []*Channel
 	err := DB.Where("tag = ?", tag).Find(&channels).Error
@@ -168,6 +225,9 @@ func DeleteChannelTag(channelId int) error {
 
 func BatchDeleteChannel(ids []int) (int64, error) {
 	result := DB.Where("id IN ?", ids).Delete(&Channel{})
+	if result.Error == nil {
+		result.Error = deleteOrphanChannelKeys(DB)
+	}
 	return result.RowsAffected, result.Error
 }
 
@@ -177,7 +237,7 @@ func BatchInsertChannels(channels []Channel) error {
 		return err
 	}
 
-	ChannelGroup.Load()
+	ChannelGroup.Reload()
 	return nil
 }
 
@@ -193,7 +253,7 @@ func BatchUpdateChannelsAzureApi(params *BatchChannelsParams) (int64, error) {
 	}
 
 	if db.RowsAffected > 0 {
-		ChannelGroup.Load()
+		ChannelGroup.Reload()
 	}
 	return db.RowsAffected, nil
 }
@@ -222,7 +282,7 @@ func BatchDelModelChannels(params *BatchChannelsParams) (int64, error) {
 	}
 
 	if count > 0 {
-		ChannelGroup.Load()
+		ChannelGroup.Reload()
 	}
 
 	return count, nil
@@ -275,7 +335,7 @@ func BatchAddUserGroupToChannels(params *BatchChannelsParams) (int64, error) {
 	}
 
 	if count > 0 {
-		ChannelGroup.Load()
+		ChannelGroup.Reload()
 	}
 
 	return count, nil
@@ -347,7 +407,7 @@ func BatchAddModelToChannels(params *BatchChannelsParams) (int64, error) {
 	}
 
 	if count > 0 {
-		ChannelGroup.Load()
+		ChannelGroup.Reload()
 	}
 
 	return count, nil
@@ -397,18 +457,42 @@ func (channel *Channel) GetCustomParameter() string {
 func (channel *Channel) Insert() error {
 	err := DB.Omit("UsedQuota").Create(channel).Error
 	if err == nil {
-		ChannelGroup.Load()
+		ChannelGroup.Reload()
 	}
 
 	return err
 }
 
+// Validate 校验 key 轮换方式以及时间窗口、预算、模型发现等 JSON 配置
+func (channel *Channel) Validate() error {
+	if !IsValidChannelKeyMode(channel.KeyMode) {
+		return errors.New("无效的 key 轮换方式")
+	}
+	if schedule := channel.GetSchedule(); schedule != nil {
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	if budget := channel.GetBudget(); budget != nil {
+		if err := budget.Validate(); err != nil {
+			return err
+		}
+	}
+	if discovery := channel.GetModelDiscovery(); discovery != nil {
+		if err := discovery.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (channel *Channel) Update(overwrite bool) error {
 
 	err := channel.UpdateRaw(overwrite)
 
 	if err == nil {
-		ChannelGroup.Load()
+		ChannelGroup.Reload()
 	}
 
 	return err
@@ -452,7 +536,8 @@ func (channel *Channel) UpdateBalance(balance float64) {
 func (channel *Channel) Delete() error {
 	err := DB.Delete(channel).Error
 	if err == nil {
-		ChannelGroup.Load()
+		err = deleteOrphanChannelKeys(DB)
+		ChannelGroup.Reload()
 	}
 	return err
 }
@@ -465,14 +550,28 @@ func (channel *Channel) StatusToStr() string {
 		return "自动禁用"
 	case config.ChannelStatusManuallyDisabled:
 		return "手动禁用"
+	case config.ChannelStatusExhausted:
+		return "余额耗尽"
 	}
 
 	return "禁用"
 }
 
 func UpdateChannelStatusById(id int, status int) {
+	UpdateChannelStatusWithReason(id, status, "")
+}
+
+// UpdateChannelStatusWithReason 更新状态的同时记录禁用原因，启用时原因为空
+func UpdateChannelStatusWithReason(id int, status int, reason string) {
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+
 	tx := DB.Begin()
-	err := tx.Model(&Channel{}).Where("id = ?", id).Update("status", status).Error
+	err := tx.Model(&Channel{}).Where("id = ?", id).Updates(map[string]any{
+		"status":         status,
+		"disable_reason": reason,
+	}).Error
 	if err != nil {
 		logger.SysError("failed to update channel status: " + err.Error())
 		tx.Rollback()
@@ -501,6 +600,9 @@ func updateChannelUsedQuota(id int, quota int) {
 
 func DeleteDisabledChannel() (int64, error) {
 	result := DB.Where("status = ? or status = ?", config.ChannelStatusAutoDisabled, config.ChannelStatusManuallyDisabled).Delete(&Channel{})
+	if result.Error == nil {
+		result.Error = deleteOrphanChannelKeys(DB)
+	}
 	return result.RowsAffected, result.Error
 }
 
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+)
+
+func (cc *ChannelsChooser) SetAffinity(affinity map[string]int) {
+	cc.Lock()
+	defer cc.Unlock()
+
+	cc.Affinity = affinity
+}
+
+// GetAffinityMessages 返回分组亲和路由参与哈希的消息条数，0 为不启用
+func (cc *ChannelsChooser) GetAffinityMessages(group string) int {
+	cc.RLock()
+	defer cc.RUnlock()
+
+	return cc.Affinity[group]
+}
+
+// affinityChoice 使用加权最高随机权重哈希计算首选渠道，渠道增减时只影响少量会话
+// 首选渠道不可用（冷却、熔断、饱和或被过滤）时返回 nil，由调用方按权重正常选择
+func affinityChoice(choices []*ChannelChoice, validChannels []*ChannelChoice, affinityKey string) *Channel {
+	preferredId := 0
+	maxScore := math.Inf(-1)
+	for _, choice := range choices {
+		if score := affinityScore(affinityKey, choice.Channel.Id, *choice.Channel.Weight); score > maxScore {
+			maxScore = score
+			preferredId = choice.Channel.Id
+		}
+	}
+
+	for _, choice := range validChannels {
+		if choice.Channel.Id == preferredId {
+			return choice.Channel
+		}
+	}
+
+	return nil
+}
+
+func affinityScore(affinityKey string, channelId int, weight uint) float64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(affinityKey))
+	hash.Write([]byte(":" + strconv.Itoa(channelId)))
+
+	// 映射到 (0, 1) 区间
+	value := (float64(mixHash(hash.Sum64())>>11) + 0.5) / float64(uint64(1)<<53)
+	return -float64(max(weight, 1)) / math.Log(value)
+}
+
+// mixHash FNV 对末尾字节的差异扩散不足，不同渠道的得分高位几乎相同，需要再打散一次
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAffinityTestChoices(weights ...uint) []*ChannelChoice {
+	choices := make([]*ChannelChoice, 0, len(weights))
+	for i, weight := range weights {
+		weight := weight
+		choices = append(choices, &ChannelChoice{Channel: &Channel{Id: i + 1, Weight: &weight}})
+	}
+	return choices
+}
+
+func TestAffinityChoice(t *testing.T) {
+	choices := newAffinityTestChoices(1, 1, 1)
+
+	// 相同的路由键总是选择同一个渠道
+	preferred := affinityChoice(choices, choices, "session-a")
+	assert.NotNil(t, preferred)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, preferred.Id, affinityChoice(choices, choices, "session-a").Id)
+	}
+
+	// 首选渠道不可用时交由调用方按权重选择
+	validChannels := make([]*ChannelChoice, 0, len(choices))
+	for _, choice := range choices {
+		if choice.Channel.Id != preferred.Id {
+			validChannels = append(validChannels, choice)
+		}
+	}
+	assert.Nil(t, affinityChoice(choices, validChannels, "session-a"))
+}
+
+func TestAffinityChoiceStable(t *testing.T) {
+	choices := newAffinityTestChoices(1, 1, 1)
+	added := append(newAffinityTestChoices(1, 1, 1), &ChannelChoice{Channel: &Channel{Id: 4, Weight: choices[0].Channel.Weight}})
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		before := affinityChoice(choices, choices, key)
+		after := affinityChoice(added, added, key)
+
+		// 新增渠道后只会有部分会话迁移到新渠道，其余会话保持不变
+		if before.Id != after.Id {
+			assert.Equal(t, 4, after.Id)
+			moved++
+		}
+	}
+
+	assert.InDelta(t, 250, moved, 60)
+}
+
+func TestAffinityChoiceWeight(t *testing.T) {
+	choices := newAffinityTestChoices(3, 1)
+
+	counts := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		counts[affinityChoice(choices, choices, fmt.Sprintf("session-%d", i)).Id]++
+	}
+
+	assert.InDelta(t, 3000, counts[1], 150)
+	assert.InDelta(t, 1000, counts[2], 150)
+}
+
+func TestBalancerAffinity(t *testing.T) {
+	choices := newAffinityTestChoices(1, 1, 1)
+	preferred := affinityChoice(choices, choices, "session-a")
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, preferred.Id, balancer(choices, nil, "gpt-4o", "session-a").Id)
+	}
+
+	// 首选渠道被过滤时仍能选到其他渠道
+	filter := func(channelId int, _ *ChannelChoice) bool { return channelId == preferred.Id }
+	for i := 0; i < 10; i++ {
+		channel := balancer(choices, []ChannelsFilterFunc{filter}, "gpt-4o", "session-a")
+		assert.NotNil(t, channel)
+		assert.NotEqual(t, preferred.Id, channel.Id)
+	}
+}
@@ -0,0 +1,386 @@
+package model
+
+import (
+	"context"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/notify"
+	"done-hub/common/redis"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelBudgetUnitUSD   = "usd"
+	ChannelBudgetUnitQuota = "quota"
+
+	channelBudgetCounterKey = "channel_budget:%s:%s:%s" // scope, period, periodKey
+	channelBudgetPauseKey   = "channel_budget_pause:%s" // scope
+)
+
+const (
+	budgetPeriodDaily   = "daily"
+	budgetPeriodWeekly  = "weekly"
+	budgetPeriodMonthly = "monthly"
+)
+
+var budgetPeriods = []string{budgetPeriodDaily, budgetPeriodWeekly, budgetPeriodMonthly}
+
+// ChannelBudget 渠道或渠道标签的消费上限，为 0 表示不限制
+type ChannelBudget struct {
+	Unit    string  `json:"unit,omitempty"` // usd 或 quota，默认为 usd
+	Daily   float64 `json:"daily,omitempty"`
+	Weekly  float64 `json:"weekly,omitempty"`
+	Monthly float64 `json:"monthly,omitempty"`
+}
+
+func (b *ChannelBudget) Validate() error {
+	if b.Unit != "" && b.Unit != ChannelBudgetUnitUSD && b.Unit != ChannelBudgetUnitQuota {
+		return fmt.Errorf("invalid budget unit %s", b.Unit)
+	}
+
+	if b.Daily < 0 || b.Weekly < 0 || b.Monthly < 0 {
+		return fmt.Errorf("budget must not be negative")
+	}
+
+	return nil
+}
+
+// limit 返回周期内的额度上限
+func (b *ChannelBudget) limit(period string) int64 {
+	var value float64
+	switch period {
+	case budgetPeriodDaily:
+		value = b.Daily
+	case budgetPeriodWeekly:
+		value = b.Weekly
+	case budgetPeriodMonthly:
+		value = b.Monthly
+	}
+
+	if b.Unit == ChannelBudgetUnitQuota {
+		return int64(value)
+	}
+
+	return int64(value * config.QuotaPerUnit)
+}
+
+func (b *ChannelBudget) formatQuota(quota int64) string {
+	if b.Unit == ChannelBudgetUnitQuota {
+		return strconv.FormatInt(quota, 10)
+	}
+
+	return fmt.Sprintf("$%.2f", float64(quota)/config.QuotaPerUnit)
+}
+
+// budgetPeriodRange 返回当前周期的标识与结束时间，周从周一开始
+func budgetPeriodRange(period string, now time.Time) (string, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case budgetPeriodWeekly:
+		start := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return start.Format("20060102"), start.AddDate(0, 0, 7)
+	case budgetPeriodMonthly:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start.Format("200601"), start.AddDate(0, 1, 0)
+	default:
+		return today.Format("20060102"), today.AddDate(0, 0, 1)
+	}
+}
+
+func (channel *Channel) GetBudget() *ChannelBudget {
+	if channel.Budget == nil {
+		return nil
+	}
+
+	budget := channel.Budget.Data()
+	return &budget
+}
+
+type budgetPause struct {
+	Period string    `json:"period"`
+	Spent  int64     `json:"spent"`
+	Until  time.Time `json:"until"`
+}
+
+type memoryBudgetCounter struct {
+	value    int64
+	expireAt time.Time
+}
+
+// ChannelBudgetManager 统计渠道与渠道标签在各周期内的上游成本，超出预算的渠道暂停到周期结束
+// 启用 Redis 时计数与暂停状态保存在 Redis 中，多节点共享同一份预算，暂停状态通过发布订阅同步到各节点的本地副本
+type ChannelBudgetManager struct {
+	sync.RWMutex
+	tagBudgets map[string]ChannelBudget
+	counters   map[string]*memoryBudgetCounter
+	paused     sync.Map // scope -> *budgetPause
+}
+
+var ChannelBudgets = &ChannelBudgetManager{
+	tagBudgets: make(map[string]ChannelBudget),
+	counters:   make(map[string]*memoryBudgetCounter),
+}
+
+func init() {
+	// 每小时清理一次过期的内存计数
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ChannelBudgets.cleanupCounters()
+		}
+	}()
+}
+
+func (m *ChannelBudgetManager) SetTagBudgets(value string) error {
+	tagBudgets := make(map[string]ChannelBudget)
+	if strings.TrimSpace(value) != "" {
+		if err := json.Unmarshal([]byte(value), &tagBudgets); err != nil {
+			return err
+		}
+	}
+
+	for tag, budget := range tagBudgets {
+		if err := budget.Validate(); err != nil {
+			return fmt.Errorf("tag %s: %w", tag, err)
+		}
+	}
+
+	m.Lock()
+	m.tagBudgets = tagBudgets
+	m.Unlock()
+
+	return nil
+}
+
+func (m *ChannelBudgetManager) getTagBudget(tag string) *ChannelBudget {
+	if tag == "" {
+		return nil
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	budget, ok := m.tagBudgets[tag]
+	if !ok {
+		return nil
+	}
+
+	return &budget
+}
+
+func channelBudgetScope(channelId int) string {
+	return fmt.Sprintf("channel:%d", channelId)
+}
+
+func tagBudgetScope(tag string) string {
+	return "tag:" + tag
+}
+
+// isScopePaused 预算被调高或取消后立即恢复
+func (m *ChannelBudgetManager) isScopePaused(scope string, budget *ChannelBudget) bool {
+	value, ok := m.paused.Load(scope)
+	if !ok {
+		return false
+	}
+
+	pause := value.(*budgetPause)
+	if budget == nil || time.Now().After(pause.Until) {
+		m.paused.Delete(scope)
+		return false
+	}
+
+	if limit := budget.limit(pause.Period); limit <= 0 || pause.Spent < limit {
+		m.paused.Delete(scope)
+		return false
+	}
+
+	return true
+}
+
+// IsPaused 渠道或其标签是否已达到预算上限
+func (m *ChannelBudgetManager) IsPaused(channel *Channel) bool {
+	if m.isScopePaused(channelBudgetScope(channel.Id), channel.GetBudget()) {
+		return true
+	}
+
+	if channel.Tag == "" {
+		return false
+	}
+
+	return m.isScopePaused(tagBudgetScope(channel.Tag), m.getTagBudget(channel.Tag))
+}
+
+// Record 记录渠道一次请求的上游成本（单位与额度相同），并检查提醒与暂停
+func (m *ChannelBudgetManager) Record(channel *Channel, cost int) {
+	if cost <= 0 {
+		return
+	}
+
+	if budget := channel.GetBudget(); budget != nil {
+		m.record(channelBudgetScope(channel.Id), fmt.Sprintf("渠道「%s」（#%d）", channel.Name, channel.Id), budget, int64(cost))
+	}
+
+	if budget := m.getTagBudget(channel.Tag); budget != nil {
+		m.record(tagBudgetScope(channel.Tag), fmt.Sprintf("渠道标签「%s」", channel.Tag), budget, int64(cost))
+	}
+}
+
+func (m *ChannelBudgetManager) record(scope, name string, budget *ChannelBudget, quota int64) {
+	now := time.Now()
+	for _, period := range budgetPeriods {
+		limit := budget.limit(period)
+		if limit <= 0 {
+			continue
+		}
+
+		periodKey, periodEnd := budgetPeriodRange(period, now)
+		spent, err := m.incr(fmt.Sprintf(channelBudgetCounterKey, scope, period, periodKey), quota, periodEnd)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("channel_budget_record_failed scope=%s period=%s error=\"%s\"", scope, period, err.Error()))
+			continue
+		}
+
+		previous := spent - quota
+		for _, percent := range parseBudgetWarningPercents() {
+			threshold := limit * percent / 100
+			if previous < threshold && spent >= threshold && spent < limit {
+				logger.SysLog(fmt.Sprintf("channel_budget_warning scope=%s period=%s percent=%d spent=%d limit=%d", scope, period, percent, spent, limit))
+				subject := fmt.Sprintf("%s的%s预算已使用 %d%%", name, budgetPeriodName(period), percent)
+				content := fmt.Sprintf("%s的%s预算已使用 %s / %s", name, budgetPeriodName(period), budget.formatQuota(spent), budget.formatQuota(limit))
+				go notify.Send(subject, content)
+			}
+		}
+
+		if spent < limit {
+			continue
+		}
+
+		pause := &budgetPause{Period: period, Spent: spent, Until: periodEnd}
+		// 暂停前已发出的请求完成时只更新本地状态
+		if previous >= limit {
+			m.paused.Store(scope, pause)
+			continue
+		}
+
+		m.pause(scope, pause)
+		logger.SysLog(fmt.Sprintf("channel_budget_paused scope=%s period=%s spent=%d limit=%d until=%s", scope, period, spent, limit, periodEnd.Format(time.RFC3339)))
+		subject := fmt.Sprintf("%s已达到%s预算上限，已暂停", name, budgetPeriodName(period))
+		content := fmt.Sprintf("%s的%s预算已使用 %s / %s，将暂停到 %s", name, budgetPeriodName(period), budget.formatQuota(spent), budget.formatQuota(limit), periodEnd.Format("2006-01-02 15:04:05"))
+		go notify.Send(subject, content)
+	}
+}
+
+// pause 暂停到周期结束，开启 Redis 时保存暂停状态并通知其他节点
+func (m *ChannelBudgetManager) pause(scope string, pause *budgetPause) {
+	m.paused.Store(scope, pause)
+	if !config.RedisEnabled {
+		return
+	}
+
+	data, err := json.Marshal(pause)
+	if err != nil {
+		return
+	}
+
+	if err := redis.RedisSet(fmt.Sprintf(channelBudgetPauseKey, scope), string(data), time.Until(pause.Until)); err != nil {
+		logger.SysError(fmt.Sprintf("channel_budget_pause_save_failed scope=%s error=\"%s\"", scope, err.Error()))
+	}
+	publishChannelEvent(&channelEvent{Action: ChannelEventBudgetPause, Scope: scope, BudgetPause: pause})
+}
+
+// LoadPauses 启动时从 Redis 恢复各渠道的暂停状态
+func (m *ChannelBudgetManager) LoadPauses() {
+	if !config.RedisEnabled {
+		return
+	}
+
+	ctx := context.Background()
+	client := redis.GetRedisClient()
+	iter := client.Scan(ctx, 0, fmt.Sprintf(channelBudgetPauseKey, "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		value, err := client.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+
+		pause := &budgetPause{}
+		if err := json.Unmarshal([]byte(value), pause); err != nil {
+			continue
+		}
+		m.paused.Store(strings.TrimPrefix(key, fmt.Sprintf(channelBudgetPauseKey, "")), pause)
+	}
+
+	if err := iter.Err(); err != nil {
+		logger.SysError("failed to load channel budget pauses: " + err.Error())
+	}
+}
+
+func (m *ChannelBudgetManager) incr(key string, quota int64, expireAt time.Time) (int64, error) {
+	if config.RedisEnabled {
+		ctx := context.Background()
+		pipe := redis.GetRedisClient().TxPipeline()
+		incr := pipe.IncrBy(ctx, key, quota)
+		pipe.ExpireAt(ctx, key, expireAt)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+
+		return incr.Val(), nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	counter, ok := m.counters[key]
+	if !ok {
+		counter = &memoryBudgetCounter{expireAt: expireAt}
+		m.counters[key] = counter
+	}
+	counter.value += quota
+
+	return counter.value, nil
+}
+
+func (m *ChannelBudgetManager) cleanupCounters() {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	for key, counter := range m.counters {
+		if now.After(counter.expireAt) {
+			delete(m.counters, key)
+		}
+	}
+}
+
+func parseBudgetWarningPercents() []int64 {
+	var percents []int64
+	for _, value := range strings.Split(config.ChannelBudgetWarningPercents, ",") {
+		percent, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			continue
+		}
+		percents = append(percents, percent)
+	}
+
+	return percents
+}
+
+func budgetPeriodName(period string) string {
+	switch period {
+	case budgetPeriodWeekly:
+		return "本周"
+	case budgetPeriodMonthly:
+		return "本月"
+	default:
+		return "今日"
+	}
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetPeriodRange(t *testing.T) {
+	location := time.FixedZone("UTC+8", 8*3600)
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, location)
+	}
+
+	cases := []struct {
+		name   string
+		period string
+		now    time.Time
+		key    string
+		end    time.Time
+	}{
+		{"daily", budgetPeriodDaily, at(2024, 3, 15, 13), "20240315", at(2024, 3, 16, 0)},
+		{"daily midnight", budgetPeriodDaily, at(2024, 3, 15, 0), "20240315", at(2024, 3, 16, 0)},
+		{"daily year end", budgetPeriodDaily, at(2024, 12, 31, 23), "20241231", at(2025, 1, 1, 0)},
+		{"weekly monday", budgetPeriodWeekly, at(2024, 3, 11, 0), "20240311", at(2024, 3, 18, 0)},
+		{"weekly sunday", budgetPeriodWeekly, at(2024, 3, 17, 23), "20240311", at(2024, 3, 18, 0)},
+		{"weekly across month", budgetPeriodWeekly, at(2024, 3, 1, 12), "20240226", at(2024, 3, 4, 0)},
+		{"weekly across year", budgetPeriodWeekly, at(2025, 1, 1, 12), "20241230", at(2025, 1, 6, 0)},
+		{"monthly", budgetPeriodMonthly, at(2024, 3, 15, 13), "202403", at(2024, 4, 1, 0)},
+		{"monthly leap february", budgetPeriodMonthly, at(2024, 2, 29, 23), "202402", at(2024, 3, 1, 0)},
+		{"monthly december", budgetPeriodMonthly, at(2024, 12, 1, 0), "202412", at(2025, 1, 1, 0)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, end := budgetPeriodRange(c.period, c.now)
+			assert.Equal(t, c.key, key)
+			assert.True(t, c.end.Equal(end), "end %s, expected %s", end, c.end)
+		})
+	}
+}
+
+func TestChannelBudgetLimit(t *testing.T) {
+	quotaPerUnit := config.QuotaPerUnit
+	config.QuotaPerUnit = 500000
+	defer func() { config.QuotaPerUnit = quotaPerUnit }()
+
+	cases := []struct {
+		name   string
+		budget ChannelBudget
+		period string
+		limit  int64
+	}{
+		{"usd daily", ChannelBudget{Daily: 10}, budgetPeriodDaily, 5000000},
+		{"usd weekly", ChannelBudget{Unit: ChannelBudgetUnitUSD, Weekly: 0.5}, budgetPeriodWeekly, 250000},
+		{"quota monthly", ChannelBudget{Unit: ChannelBudgetUnitQuota, Monthly: 1000}, budgetPeriodMonthly, 1000},
+		{"unset period", ChannelBudget{Daily: 10}, budgetPeriodMonthly, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.limit, c.budget.limit(c.period))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// RoutingStrategyCost 优先选择上游成本最低的渠道
+const RoutingStrategyCost = "cost"
+
+// ChannelCost 渠道调用模型的上游单价，单位与 Price 的 Input/Output 相同
+type ChannelCost struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// ChannelCosts 未单独设置的模型按模型价格乘以 Ratio 计算上游成本
+type ChannelCosts struct {
+	Ratio  float64                `json:"ratio"`
+	Models map[string]ChannelCost `json:"models,omitempty"`
+}
+
+// GetUpstreamCost 返回渠道调用模型的上游单价，优先使用渠道的单独设置。
+// 模型价格是售价，只有设置了 Ratio 或价格所属的渠道类型与渠道一致时才作为成本参考，否则成本未知
+// 按模型价格计算时，提示 token 数超过档位阈值则使用档位价格
+func (channel *Channel) GetUpstreamCost(modelName string, promptTokens int) (ChannelCost, bool) {
+	ratio := 0.0
+	if channel.Costs != nil {
+		costs := channel.Costs.Data()
+		if cost, ok := costs.Models[modelName]; ok {
+			return cost, true
+		}
+		ratio = costs.Ratio
+	}
+
+	price := PricingInstance.GetPrice(modelName)
+	if ratio <= 0 {
+		if price.ChannelType != channel.Type {
+			return ChannelCost{}, false
+		}
+		ratio = 1
+	}
+
+	input, output := price.GetInput(), price.GetOutput()
+	if tier := price.GetTier(promptTokens); tier != nil {
+		input, output = tier.Input, tier.Output
+	}
+
+	return ChannelCost{
+		Input:  input * ratio,
+		Output: output * ratio,
+	}, true
+}
+
+// costChoice 选择成本最低的渠道，成本相同的渠道按权重随机
+// 设置了延迟预算时只在延迟满足预算的渠道中选择，都不满足时选择延迟最低的渠道
+func costChoice(validChannels []*ChannelChoice, modelName string) *Channel {
+	candidates := validChannels
+	if budget := float64(config.ChannelRoutingLatencyBudget); budget > 0 {
+		var fastest *ChannelChoice
+		fastestLatency := 0.0
+		withinBudget := make([]*ChannelChoice, 0, len(validChannels))
+		for _, choice := range validChannels {
+			stat := ChannelStats.Get(choice.Channel.Id, modelName)
+			// 样本不足的渠道视为满足预算
+			if stat == nil || stat.Samples < channelStatsMinSamples || stat.latencyScore() <= budget {
+				withinBudget = append(withinBudget, choice)
+				continue
+			}
+			if fastest == nil || stat.latencyScore() < fastestLatency {
+				fastest = choice
+				fastestLatency = stat.latencyScore()
+			}
+		}
+
+		if len(withinBudget) == 0 {
+			return fastest.Channel
+		}
+		candidates = withinBudget
+	}
+
+	// 成本未知的渠道排在最后
+	costs := make(map[int]float64, len(candidates))
+	for _, choice := range candidates {
+		// 选择渠道时还不知道提示 token 数，按基础价格比较
+		cost, ok := choice.Channel.GetUpstreamCost(modelName, 0)
+		if !ok {
+			costs[choice.Channel.Id] = math.Inf(1)
+			continue
+		}
+		costs[choice.Channel.Id] = cost.Input + cost.Output
+	}
+
+	sorted := make([]*ChannelChoice, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return costs[sorted[i].Channel.Id] < costs[sorted[j].Channel.Id]
+	})
+
+	cheapest := costs[sorted[0].Channel.Id]
+	ties := sorted[:1]
+	for i := 1; i < len(sorted) && costs[sorted[i].Channel.Id] == cheapest; i++ {
+		ties = sorted[:i+1]
+	}
+
+	totalWeight := 0
+	for _, choice := range ties {
+		totalWeight += int(*choice.Channel.Weight)
+	}
+
+	choiceWeight := rand.Intn(totalWeight)
+	for _, choice := range ties {
+		choiceWeight -= int(*choice.Channel.Weight)
+		if choiceWeight < 0 {
+			return choice.Channel
+		}
+	}
+
+	return ties[len(ties)-1].Channel
+}
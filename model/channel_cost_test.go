@@ -0,0 +1,148 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func setupCostTestPricing(t *testing.T) {
+	tiers := datatypes.NewJSONType([]PriceTier{{Threshold: 1000, Input: 4, Output: 8}})
+	pricing := PricingInstance
+	PricingInstance = &Pricing{
+		Prices: map[string]*Price{
+			"gpt-4o": {Type: TokensPriceType, ChannelType: config.ChannelTypeOpenAI, Input: 2, Output: 4, Tiers: &tiers},
+		},
+		Match: make([]string, 0),
+	}
+	t.Cleanup(func() { PricingInstance = pricing })
+}
+
+func newCostTestChannel(channelId, channelType int, weight uint, costs *ChannelCosts) *Channel {
+	channel := &Channel{Id: channelId, Type: channelType, Weight: &weight}
+	if costs != nil {
+		data := datatypes.NewJSONType(*costs)
+		channel.Costs = &data
+	}
+	return channel
+}
+
+func TestGetUpstreamCost(t *testing.T) {
+	setupCostTestPricing(t)
+
+	cases := []struct {
+		name         string
+		channel      *Channel
+		modelName    string
+		promptTokens int
+		cost         ChannelCost
+		known        bool
+	}{
+		{
+			name:      "same channel type",
+			channel:   newCostTestChannel(1, config.ChannelTypeOpenAI, 1, nil),
+			modelName: "gpt-4o",
+			cost:      ChannelCost{Input: 2, Output: 4},
+			known:     true,
+		},
+		{
+			name:         "price tier",
+			channel:      newCostTestChannel(1, config.ChannelTypeOpenAI, 1, nil),
+			modelName:    "gpt-4o",
+			promptTokens: 2000,
+			cost:         ChannelCost{Input: 4, Output: 8},
+			known:        true,
+		},
+		{
+			// 其他类型渠道的售价不能代表上游成本
+			name:      "other channel type",
+			channel:   newCostTestChannel(1, config.ChannelTypeAzure, 1, nil),
+			modelName: "gpt-4o",
+		},
+		{
+			name:      "ratio",
+			channel:   newCostTestChannel(1, config.ChannelTypeAzure, 1, &ChannelCosts{Ratio: 0.5}),
+			modelName: "gpt-4o",
+			cost:      ChannelCost{Input: 1, Output: 2},
+			known:     true,
+		},
+		{
+			name: "model cost",
+			channel: newCostTestChannel(1, config.ChannelTypeAzure, 1, &ChannelCosts{
+				Ratio:  0.5,
+				Models: map[string]ChannelCost{"gpt-4o": {Input: 0.1, Output: 0.2}},
+			}),
+			modelName:    "gpt-4o",
+			promptTokens: 2000,
+			cost:         ChannelCost{Input: 0.1, Output: 0.2},
+			known:        true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cost, known := c.channel.GetUpstreamCost(c.modelName, c.promptTokens)
+			assert.Equal(t, c.known, known)
+			assert.Equal(t, c.cost, cost)
+		})
+	}
+}
+
+func TestCostChoice(t *testing.T) {
+	setupCostTestPricing(t)
+	latencyBudget := config.ChannelRoutingLatencyBudget
+	defer func() { config.ChannelRoutingLatencyBudget = latencyBudget }()
+
+	// 渠道统计是全局的，使用独立的渠道 ID
+	modelName := "gpt-4o"
+	cheap := newCostTestChannel(301, config.ChannelTypeAzure, 1, &ChannelCosts{Ratio: 0.5})
+	expensive := newCostTestChannel(302, config.ChannelTypeOpenAI, 1, nil)
+	unknown := newCostTestChannel(303, config.ChannelTypeAzure, 1, nil)
+	choices := []*ChannelChoice{{Channel: unknown}, {Channel: expensive}, {Channel: cheap}}
+
+	config.ChannelRoutingLatencyBudget = 0
+	assert.Equal(t, cheap.Id, costChoice(choices, modelName).Id)
+
+	// 成本未知的渠道排在最后
+	assert.Equal(t, expensive.Id, costChoice(choices[:2], modelName).Id)
+	assert.Equal(t, unknown.Id, costChoice(choices[:1], modelName).Id)
+
+	// 超出延迟预算的渠道不参与选择
+	for i := 0; i < channelStatsMinSamples; i++ {
+		ChannelStats.Record(cheap.Id, modelName, 0, 3*time.Second, true)
+		ChannelStats.Record(expensive.Id, modelName, 0, 2*time.Second, true)
+		ChannelStats.Record(unknown.Id, modelName, 0, 500*time.Millisecond, true)
+	}
+	config.ChannelRoutingLatencyBudget = 1000
+	assert.Equal(t, unknown.Id, costChoice(choices, modelName).Id)
+
+	// 都不满足预算时选择延迟最低的渠道
+	assert.Equal(t, expensive.Id, costChoice(choices[1:], modelName).Id)
+}
+
+func TestCostChoiceTies(t *testing.T) {
+	setupCostTestPricing(t)
+	latencyBudget := config.ChannelRoutingLatencyBudget
+	config.ChannelRoutingLatencyBudget = 0
+	defer func() { config.ChannelRoutingLatencyBudget = latencyBudget }()
+
+	// 成本相同的渠道按权重随机
+	choices := []*ChannelChoice{
+		{Channel: newCostTestChannel(1, config.ChannelTypeOpenAI, 3, nil)},
+		{Channel: newCostTestChannel(2, config.ChannelTypeOpenAI, 1, nil)},
+		{Channel: newCostTestChannel(3, config.ChannelTypeAzure, 100, nil)},
+	}
+
+	counts := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		counts[costChoice(choices, "gpt-4o").Id]++
+	}
+
+	assert.InDelta(t, 3000, counts[1], 200)
+	assert.InDelta(t, 1000, counts[2], 200)
+	assert.Zero(t, counts[3])
+}
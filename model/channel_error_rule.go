@@ -0,0 +1,242 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"done-hub/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 渠道错误的分类
+const (
+	ChannelErrorAuth          = "auth"            // key 无效、过期或账号被封禁
+	ChannelErrorBalance       = "balance"         // 余额或额度耗尽
+	ChannelErrorRegion        = "region"          // 所在地区不受支持
+	ChannelErrorModelNotFound = "model_not_found" // 渠道不支持该模型
+	ChannelErrorPermission    = "permission"      // 没有权限
+	ChannelErrorOther         = "other"           // 命中旧的禁用关键词等未分类的错误
+)
+
+// 分类对应的处理方式
+const (
+	ChannelErrorActionDisableChannel = "disable_channel" // 禁用整个渠道
+	ChannelErrorActionDisableKey     = "disable_key"     // key 池渠道只禁用出错的 key，否则禁用渠道
+	ChannelErrorActionRemoveModel    = "remove_model"    // 从渠道中移除该模型，不会自动恢复
+	ChannelErrorActionExhausted      = "exhausted"       // 标记为余额耗尽，刷新余额后自动恢复
+	ChannelErrorActionNone           = "none"            // 只记录，不处理
+)
+
+var defaultChannelErrorActions = map[string]string{
+	ChannelErrorAuth:          ChannelErrorActionDisableKey,
+	ChannelErrorBalance:       ChannelErrorActionExhausted,
+	ChannelErrorRegion:        ChannelErrorActionDisableChannel,
+	ChannelErrorModelNotFound: ChannelErrorActionNone, // 上游中转在自身渠道暂时不可用时也会返回该错误，移除模型需手动开启
+	ChannelErrorPermission:    ChannelErrorActionDisableKey,
+	ChannelErrorOther:         ChannelErrorActionDisableKey,
+}
+
+func isValidChannelErrorAction(action string) bool {
+	switch action {
+	case ChannelErrorActionDisableChannel, ChannelErrorActionDisableKey, ChannelErrorActionRemoveModel, ChannelErrorActionExhausted, ChannelErrorActionNone:
+		return true
+	}
+
+	return false
+}
+
+// ChannelErrorRule 命中后将错误归入 Category
+type ChannelErrorRule struct {
+	Name string `json:"name"`
+	ErrorMatcher
+	Category string `json:"category"`
+}
+
+func (r *ChannelErrorRule) Validate() error {
+	if strings.TrimSpace(r.Category) == "" {
+		return errors.New("分类不能为空")
+	}
+
+	return r.ErrorMatcher.Compile()
+}
+
+// 管理员配置的规则优先匹配，默认规则对应原来的禁用判断与禁用关键词
+var defaultChannelErrorRules = []*ChannelErrorRule{
+	{Name: "unauthorized", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"401"}}, Category: ChannelErrorAuth},
+	{Name: "gemini_forbidden", ErrorMatcher: ErrorMatcher{ChannelTypes: []int{config.ChannelTypeGemini}, StatusCodes: []string{"403"}}, Category: ChannelErrorPermission},
+	{Name: "invalid_api_key", ErrorMatcher: ErrorMatcher{ErrorCodes: []string{"invalid_api_key", "account_deactivated"}}, Category: ChannelErrorAuth},
+	{Name: "billing_not_active", ErrorMatcher: ErrorMatcher{ErrorCodes: []string{"billing_not_active"}}, Category: ChannelErrorBalance},
+	{Name: "unsupported_region", ErrorMatcher: ErrorMatcher{ErrorCodes: []string{"unsupported_country_region_territory"}}, Category: ChannelErrorRegion},
+	{Name: "model_not_found", ErrorMatcher: ErrorMatcher{ErrorCodes: []string{"model_not_found"}}, Category: ChannelErrorModelNotFound},
+	{Name: "insufficient_quota", ErrorMatcher: ErrorMatcher{ErrorTypes: []string{"insufficient_quota"}}, Category: ChannelErrorBalance},
+	{Name: "authentication_error", ErrorMatcher: ErrorMatcher{ErrorTypes: []string{"authentication_error"}}, Category: ChannelErrorAuth},
+	{Name: "permission_error", ErrorMatcher: ErrorMatcher{ErrorTypes: []string{"permission_error", "forbidden"}}, Category: ChannelErrorPermission},
+	{Name: "permission_denied_param", ErrorMatcher: ErrorMatcher{Params: []string{"PERMISSIONDENIED"}}, Category: ChannelErrorPermission},
+	{Name: "balance_message", ErrorMatcher: ErrorMatcher{Message: `(?i)credit balance is too low|exceeded your current quota|account balance is insufficient|Quota exceeded for quota metric`}, Category: ChannelErrorBalance},
+	{Name: "region_message", ErrorMatcher: ErrorMatcher{Message: `(?i)(country|region|territory|location) (is )?not supported|unsupported_country`}, Category: ChannelErrorRegion},
+	{Name: "auth_message", ErrorMatcher: ErrorMatcher{Message: `(?i)organization has been disabled|API key not valid|security token included in the request is invalid|account is not authorized|account is currently blocked|too many invalid requests`}, Category: ChannelErrorAuth},
+	{Name: "permission_message", ErrorMatcher: ErrorMatcher{Message: `(?i)Permission denied|Operation not allowed`}, Category: ChannelErrorPermission},
+}
+
+func init() {
+	for _, rule := range defaultChannelErrorRules {
+		if err := rule.Validate(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ChannelErrorClass 错误的分类与处理方式
+type ChannelErrorClass struct {
+	Rule     string `json:"rule"`
+	Category string `json:"category"`
+	Action   string `json:"action"`
+}
+
+// Reason 禁用原因与通知中带上分类
+func (class *ChannelErrorClass) Reason(message string) string {
+	return fmt.Sprintf("[%s] %s", class.Category, message)
+}
+
+type ChannelErrorRuleManager struct {
+	sync.RWMutex
+	rules   []*ChannelErrorRule
+	actions map[string]string
+}
+
+var ChannelErrorRules = &ChannelErrorRuleManager{}
+
+// ParseChannelErrorRules 解析并校验 JSON 格式的规则列表
+func ParseChannelErrorRules(value string) ([]*ChannelErrorRule, error) {
+	rules := make([]*ChannelErrorRule, 0)
+	if strings.TrimSpace(value) != "" {
+		if err := json.Unmarshal([]byte(value), &rules); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			name := rule.Name
+			if name == "" {
+				name = strconv.Itoa(i + 1)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// ParseChannelErrorActions 解析 JSON 格式的 分类 -> 处理方式
+func ParseChannelErrorActions(value string) (map[string]string, error) {
+	actions := make(map[string]string)
+	if strings.TrimSpace(value) != "" {
+		if err := json.Unmarshal([]byte(value), &actions); err != nil {
+			return nil, err
+		}
+	}
+
+	for category, action := range actions {
+		if !isValidChannelErrorAction(action) {
+			return nil, fmt.Errorf("category %s: 无效的处理方式: %s", category, action)
+		}
+	}
+
+	return actions, nil
+}
+
+func (m *ChannelErrorRuleManager) SetRules(value string) error {
+	rules, err := ParseChannelErrorRules(value)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.rules = rules
+	m.Unlock()
+
+	return nil
+}
+
+func (m *ChannelErrorRuleManager) SetActions(value string) error {
+	actions, err := ParseChannelErrorActions(value)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.actions = actions
+	m.Unlock()
+
+	return nil
+}
+
+func (m *ChannelErrorRuleManager) GetDefaultRules() []*ChannelErrorRule {
+	return defaultChannelErrorRules
+}
+
+func (m *ChannelErrorRuleManager) GetDefaultActions() map[string]string {
+	return defaultChannelErrorActions
+}
+
+func (m *ChannelErrorRuleManager) GetActions() map[string]string {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.actions
+}
+
+// Classify 未命中任何规则时返回 nil
+func (m *ChannelErrorRuleManager) Classify(channelType int, apiErr *types.OpenAIErrorWithStatusCode) *ChannelErrorClass {
+	m.RLock()
+	rules, actions := m.rules, m.actions
+	m.RUnlock()
+
+	return ClassifyChannelError(rules, actions, channelType, apiErr)
+}
+
+// ClassifyChannelError 指定渠道类型的规则先于全局规则匹配，都未命中时使用默认规则
+func ClassifyChannelError(rules []*ChannelErrorRule, actions map[string]string, channelType int, apiErr *types.OpenAIErrorWithStatusCode) *ChannelErrorClass {
+	rule := matchChannelErrorRule(rules, channelType, apiErr)
+	if rule == nil {
+		rule = matchChannelErrorRule(defaultChannelErrorRules, channelType, apiErr)
+	}
+	if rule == nil {
+		return nil
+	}
+
+	return NewChannelErrorClass(actions, rule.Name, rule.Category)
+}
+
+// NewChannelErrorClass 分类未配置处理方式时使用默认处理方式，自定义的分类默认为 disable_key
+func NewChannelErrorClass(actions map[string]string, ruleName, category string) *ChannelErrorClass {
+	action, ok := actions[category]
+	if !ok {
+		action, ok = defaultChannelErrorActions[category]
+	}
+	if !ok {
+		action = ChannelErrorActionDisableKey
+	}
+
+	return &ChannelErrorClass{
+		Rule:     ruleName,
+		Category: category,
+		Action:   action,
+	}
+}
+
+func matchChannelErrorRule(rules []*ChannelErrorRule, channelType int, apiErr *types.OpenAIErrorWithStatusCode) *ChannelErrorRule {
+	for _, typed := range []bool{true, false} {
+		for _, rule := range rules {
+			if rule.IsChannelTyped() == typed && rule.Match(channelType, apiErr) {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
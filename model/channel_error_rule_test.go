@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"testing"
+
+	"done-hub/common/config"
+	"done-hub/model"
+	"done-hub/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyChannelError(t *testing.T) {
+	rules, err := model.ParseChannelErrorRules(`[
+		{"name": "azure_content_filter", "channel_types": [3], "error_codes": ["content_filter"], "category": "content"},
+		{"name": "suspended", "message": "(?i)account suspended", "category": "auth"}
+	]`)
+	assert.NoError(t, err)
+	actions, err := model.ParseChannelErrorActions(`{"content": "none", "auth": "disable_channel"}`)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		rules       []*model.ChannelErrorRule
+		actions     map[string]string
+		channelType int
+		apiErr      *types.OpenAIErrorWithStatusCode
+		expected    *model.ChannelErrorClass
+	}{
+		{"typed custom rule", rules, actions, config.ChannelTypeAzure, newAPIError(400, "", "content_filter", "", ""),
+			&model.ChannelErrorClass{Rule: "azure_content_filter", Category: "content", Action: model.ChannelErrorActionNone}},
+		{"typed rule skips other types", rules, actions, config.ChannelTypeOpenAI, newAPIError(400, "", "content_filter", "", ""), nil},
+		{"custom action override", rules, actions, config.ChannelTypeOpenAI, newAPIError(403, "", "", "", "Account Suspended"),
+			&model.ChannelErrorClass{Rule: "suspended", Category: model.ChannelErrorAuth, Action: model.ChannelErrorActionDisableChannel}},
+		{"default unauthorized", nil, nil, config.ChannelTypeOpenAI, newAPIError(401, "", "", "", ""),
+			&model.ChannelErrorClass{Rule: "unauthorized", Category: model.ChannelErrorAuth, Action: model.ChannelErrorActionDisableKey}},
+		{"default gemini forbidden", nil, nil, config.ChannelTypeGemini, newAPIError(403, "", "", "", ""),
+			&model.ChannelErrorClass{Rule: "gemini_forbidden", Category: model.ChannelErrorPermission, Action: model.ChannelErrorActionDisableKey}},
+		{"default balance", nil, nil, config.ChannelTypeOpenAI, newAPIError(429, "insufficient_quota", "", "", ""),
+			&model.ChannelErrorClass{Rule: "insufficient_quota", Category: model.ChannelErrorBalance, Action: model.ChannelErrorActionExhausted}},
+		{"default model not found is opt-in", nil, nil, config.ChannelTypeOpenAI, newAPIError(404, "", "model_not_found", "", ""),
+			&model.ChannelErrorClass{Rule: "model_not_found", Category: model.ChannelErrorModelNotFound, Action: model.ChannelErrorActionNone}},
+		{"default region message", nil, nil, config.ChannelTypeOpenAI, newAPIError(403, "", "", "", "Country, region, or territory not supported"),
+			&model.ChannelErrorClass{Rule: "region_message", Category: model.ChannelErrorRegion, Action: model.ChannelErrorActionDisableChannel}},
+		{"unmatched", nil, nil, config.ChannelTypeOpenAI, newAPIError(500, "server_error", "", "", "internal error"), nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, model.ClassifyChannelError(c.rules, c.actions, c.channelType, c.apiErr))
+		})
+	}
+}
+
+func TestNewChannelErrorClass(t *testing.T) {
+	cases := []struct {
+		name     string
+		actions  map[string]string
+		category string
+		action   string
+	}{
+		{"default action", nil, model.ChannelErrorBalance, model.ChannelErrorActionExhausted},
+		{"configured action", map[string]string{model.ChannelErrorBalance: model.ChannelErrorActionNone}, model.ChannelErrorBalance, model.ChannelErrorActionNone},
+		{"custom category", nil, "content", model.ChannelErrorActionDisableKey},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.action, model.NewChannelErrorClass(c.actions, "rule", c.category).Action)
+		})
+	}
+}
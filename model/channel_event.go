@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/redis"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 多节点部署时通过 Redis 发布订阅同步渠道状态，Redis 不可用时各节点只修改本地状态，
+// 其他节点在下次同步渠道缓存时更新
+const (
+	channelEventTopic   = "channel_events"
+	channelEventTimeout = time.Second
+)
+
+const (
+	ChannelEventDisable = "disable"
+	ChannelEventEnable  = "enable"
+	ChannelEventReload  = "reload"
+	// 冷却与熔断状态同步到各节点的本地副本，冷却以 Redis 中的 key 为准，本地副本作为缓存
+	ChannelEventCooldown       = "cooldown"
+	ChannelEventCircuitBreaker = "circuit_breaker"
+	ChannelEventBudgetPause    = "budget_pause"
+)
+
+type channelEvent struct {
+	Node      string `json:"node"`
+	Action    string `json:"action"`
+	ChannelId int    `json:"channel_id,omitempty"`
+	Model     string `json:"model,omitempty"`
+	// 冷却结束时间
+	Until int64 `json:"until,omitempty"`
+	// 熔断状态，已恢复时为关闭状态
+	CircuitBreaker *CircuitBreakerStatus `json:"circuit_breaker,omitempty"`
+	// 预算暂停的范围与状态
+	Scope       string       `json:"scope,omitempty"`
+	BudgetPause *budgetPause `json:"budget_pause,omitempty"`
+}
+
+// 用于忽略本节点发布的事件
+var channelEventNode = uuid.New().String()
+
+func publishChannelEvent(event *channelEvent) {
+	if !config.RedisEnabled {
+		return
+	}
+
+	event.Node = channelEventNode
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), channelEventTimeout)
+	defer cancel()
+
+	if err := redis.GetRedisClient().Publish(ctx, channelEventTopic, data).Err(); err != nil {
+		logger.SysError(fmt.Sprintf("channel_event_publish_failed action=%s channel_id=%d error=\"%s\"", event.Action, event.ChannelId, err.Error()))
+	}
+}
+
+// SubscribeChannelEvents 订阅其他节点发布的渠道状态变化，连接断开后由客户端自动重连
+func SubscribeChannelEvents() {
+	if !config.RedisEnabled {
+		return
+	}
+
+	pubsub := redis.GetRedisClient().Subscribe(context.Background(), channelEventTopic)
+	logger.SysLog("subscribed to channel events")
+
+	go func() {
+		defer pubsub.Close()
+
+		for message := range pubsub.Channel() {
+			handleChannelEvent(message.Payload)
+		}
+	}()
+}
+
+func handleChannelEvent(payload string) {
+	var event channelEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		logger.SysError("invalid channel event: " + err.Error())
+		return
+	}
+
+	if event.Node == channelEventNode {
+		return
+	}
+
+	switch event.Action {
+	case ChannelEventDisable:
+		ChannelGroup.Disable(event.ChannelId)
+	case ChannelEventEnable:
+		ChannelGroup.Enable(event.ChannelId)
+	case ChannelEventReload:
+		ChannelGroup.Load()
+	case ChannelEventCooldown:
+		ChannelGroup.storeCooldown(event.ChannelId, event.Model, event.Until)
+		// 冷却与熔断事件较频繁，不记录日志
+		return
+	case ChannelEventBudgetPause:
+		if event.BudgetPause != nil {
+			ChannelBudgets.paused.Store(event.Scope, event.BudgetPause)
+		}
+	case ChannelEventCircuitBreaker:
+		if event.CircuitBreaker != nil {
+			CircuitBreaker.setLocal(event.ChannelId, event.Model, event.CircuitBreaker)
+		}
+		return
+	default:
+		return
+	}
+
+	logger.SysLog(fmt.Sprintf("channel_event_received action=%s channel_id=%d node=%s", event.Action, event.ChannelId, event.Node))
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/common/logger"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestChannelCooldown(t *testing.T) {
+	redisEnabled, cooldownSeconds := config.RedisEnabled, config.RetryCooldownSeconds
+	config.RedisEnabled = false
+	config.RetryCooldownSeconds = 60
+	defer func() {
+		config.RedisEnabled, config.RetryCooldownSeconds = redisEnabled, cooldownSeconds
+	}()
+
+	cc := &ChannelsChooser{}
+	assert.True(t, cc.SetCooldowns(1, "gpt-4o"))
+	assert.True(t, cc.IsInCooldown(1, "gpt-4o"))
+	// 冷却按渠道与模型区分
+	assert.False(t, cc.IsInCooldown(1, "o3"))
+	assert.False(t, cc.IsInCooldown(2, "gpt-4o"))
+
+	// 已在冷却中时不延长
+	until, _ := cc.Cooldowns.Load(cooldownKey(1, "gpt-4o"))
+	assert.False(t, cc.storeCooldown(1, "gpt-4o", until.(int64)+100))
+	current, _ := cc.Cooldowns.Load(cooldownKey(1, "gpt-4o"))
+	assert.Equal(t, until, current)
+
+	// 过期的冷却不再生效，并在清理时删除
+	assert.True(t, cc.storeCooldown(2, "gpt-4o", time.Now().Unix()-1))
+	assert.False(t, cc.IsInCooldown(2, "gpt-4o"))
+	assert.True(t, cc.storeCooldown(3, "gpt-4o", time.Now().Unix()-1))
+	cc.CleanupExpiredCooldowns()
+	_, ok := cc.Cooldowns.Load(cooldownKey(3, "gpt-4o"))
+	assert.False(t, ok)
+	_, ok = cc.Cooldowns.Load(cooldownKey(1, "gpt-4o"))
+	assert.True(t, ok)
+
+	assert.False(t, cc.SetCooldowns(0, "gpt-4o"))
+	assert.False(t, cc.SetCooldowns(1, ""))
+	config.RetryCooldownSeconds = 0
+	assert.False(t, cc.SetCooldowns(4, "gpt-4o"))
+	assert.False(t, cc.IsInCooldown(4, "gpt-4o"))
+}
+
+func TestHandleChannelEvent(t *testing.T) {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+
+	ChannelGroup.Lock()
+	channels := ChannelGroup.Channels
+	ChannelGroup.Channels = map[int]*ChannelChoice{
+		401: {Channel: &Channel{Id: 401}},
+		402: {Channel: &Channel{Id: 402}, Disable: true},
+	}
+	ChannelGroup.Unlock()
+	defer func() {
+		ChannelGroup.Lock()
+		ChannelGroup.Channels = channels
+		ChannelGroup.Unlock()
+		ChannelGroup.Cooldowns.Delete(cooldownKey(401, "gpt-4o"))
+		CircuitBreaker.setLocal(401, "gpt-4o", &CircuitBreakerStatus{Model: "gpt-4o", State: CircuitStateClosed})
+		ChannelBudgets.paused.Delete(channelBudgetScope(401))
+	}()
+
+	payload := func(event *channelEvent) string {
+		if event.Node == "" {
+			event.Node = "other-node"
+		}
+		data, _ := json.Marshal(event)
+		return string(data)
+	}
+
+	handleChannelEvent(payload(&channelEvent{Action: ChannelEventDisable, ChannelId: 401}))
+	handleChannelEvent(payload(&channelEvent{Action: ChannelEventEnable, ChannelId: 402}))
+	assert.True(t, ChannelGroup.Channels[401].Disable)
+	assert.False(t, ChannelGroup.Channels[402].Disable)
+
+	// 忽略本节点发布的事件
+	handleChannelEvent(payload(&channelEvent{Node: channelEventNode, Action: ChannelEventEnable, ChannelId: 401}))
+	assert.True(t, ChannelGroup.Channels[401].Disable)
+
+	// 不存在的渠道与无效的事件不影响现有状态
+	handleChannelEvent(payload(&channelEvent{Action: ChannelEventDisable, ChannelId: 403}))
+	handleChannelEvent(payload(&channelEvent{Action: "unknown", ChannelId: 401}))
+	handleChannelEvent("invalid")
+	assert.Len(t, ChannelGroup.Channels, 2)
+
+	until := time.Now().Unix() + 60
+	handleChannelEvent(payload(&channelEvent{Action: ChannelEventCooldown, ChannelId: 401, Model: "gpt-4o", Until: until}))
+	assert.True(t, ChannelGroup.IsInCooldown(401, "gpt-4o"))
+
+	handleChannelEvent(payload(&channelEvent{Action: ChannelEventCircuitBreaker, ChannelId: 401, Model: "gpt-4o",
+		CircuitBreaker: &CircuitBreakerStatus{Model: "gpt-4o", State: CircuitStateOpen, OpenedAt: time.Now().Unix()}}))
+	assert.Equal(t, CircuitStateOpen, CircuitBreaker.getLocal(401, "gpt-4o").State)
+
+	handleChannelEvent(payload(&channelEvent{Action: ChannelEventBudgetPause, Scope: channelBudgetScope(401),
+		BudgetPause: &budgetPause{Period: "day", Spent: 100, Until: time.Now().Add(time.Hour)}}))
+	pause, ok := ChannelBudgets.paused.Load(channelBudgetScope(401))
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), pause.(*budgetPause).Spent)
+}
@@ -0,0 +1,420 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	ChannelHealthMinute = "minute"
+	ChannelHealthHour   = "hour"
+)
+
+// 健康统计中的错误分类
+const (
+	HealthErrorRateLimit = "rate_limit"
+	HealthErrorAuth      = "auth"
+	HealthErrorTimeout   = "timeout"
+	HealthErrorServer    = "server"
+	HealthErrorClient    = "client"
+	HealthErrorNetwork   = "network"
+)
+
+// 延迟直方图的上界（毫秒），最后一个桶为超过最大上界的请求
+var healthLatencyBounds = []int64{100, 250, 500, 1000, 2000, 3000, 5000, 10000, 20000, 30000, 60000, 120000}
+
+// ChannelHealthErrorClass 按上游返回的状态码对错误分类，0 表示未收到上游响应
+func ChannelHealthErrorClass(statusCode int) string {
+	switch {
+	case statusCode == 0:
+		return HealthErrorNetwork
+	case statusCode == http.StatusTooManyRequests:
+		return HealthErrorRateLimit
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden || statusCode == http.StatusPaymentRequired:
+		return HealthErrorAuth
+	case statusCode == http.StatusGatewayTimeout || statusCode == http.StatusRequestTimeout:
+		return HealthErrorTimeout
+	case statusCode >= http.StatusInternalServerError:
+		return HealthErrorServer
+	default:
+		return HealthErrorClient
+	}
+}
+
+// ChannelHealth 渠道+模型在一个时间段内的健康统计
+// 每个节点各自写入，查询时合并同一时间段的多条记录
+type ChannelHealth struct {
+	Id               int64                                `json:"id"`
+	ChannelId        int                                  `json:"channel_id" gorm:"index:idx_channel_health,priority:1"`
+	Model            string                               `json:"model" gorm:"type:varchar(100);index:idx_channel_health,priority:2"`
+	Granularity      string                               `json:"granularity" gorm:"type:varchar(8);index:idx_channel_health,priority:3"`
+	BucketTime       int64                                `json:"bucket_time" gorm:"bigint;index:idx_channel_health,priority:4"`
+	SuccessCount     int64                                `json:"success_count" gorm:"bigint;default:0"`
+	ErrorCount       int64                                `json:"error_count" gorm:"bigint;default:0"`
+	Errors           datatypes.JSONType[map[string]int64] `json:"errors" gorm:"type:json"`
+	LatencyP50       int64                                `json:"latency_p50"`
+	LatencyP95       int64                                `json:"latency_p95"`
+	TTFTP50          int64                                `json:"ttft_p50"`
+	TTFTP95          int64                                `json:"ttft_p95"`
+	LatencyHistogram datatypes.JSONSlice[int64]           `json:"-" gorm:"type:json"`
+	TTFTHistogram    datatypes.JSONSlice[int64]           `json:"-" gorm:"type:json"`
+}
+
+type healthKey struct {
+	channelId  int
+	model      string
+	bucketTime int64
+}
+
+type healthBucket struct {
+	success int64
+	errors  map[string]int64
+	latency []int64
+	ttft    []int64
+}
+
+func newHistogram() []int64 {
+	return make([]int64, len(healthLatencyBounds)+1)
+}
+
+func observeHistogram(histogram []int64, value time.Duration) {
+	ms := value.Milliseconds()
+	index := sort.Search(len(healthLatencyBounds), func(i int) bool {
+		return ms <= healthLatencyBounds[i]
+	})
+	histogram[index]++
+}
+
+func mergeHistogram(dst, src []int64) {
+	for i := 0; i < len(dst) && i < len(src); i++ {
+		dst[i] += src[i]
+	}
+}
+
+// histogramPercentile 返回分位数所在桶的上界，超过最大上界时返回最大上界
+func histogramPercentile(histogram []int64, percentile float64) int64 {
+	var total int64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	target := int64(float64(total)*percentile + 0.5)
+	target = max(target, 1)
+	var count int64
+	for i, c := range histogram {
+		count += c
+		if count >= target {
+			if i >= len(healthLatencyBounds) {
+				return healthLatencyBounds[len(healthLatencyBounds)-1]
+			}
+			return healthLatencyBounds[i]
+		}
+	}
+
+	return healthLatencyBounds[len(healthLatencyBounds)-1]
+}
+
+// ChannelHealthRecorder 在内存中按分钟聚合，定期写入数据库
+type ChannelHealthRecorder struct {
+	sync.Mutex
+	buckets map[healthKey]*healthBucket
+}
+
+var ChannelHealthStats = &ChannelHealthRecorder{
+	buckets: make(map[healthKey]*healthBucket),
+}
+
+func init() {
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ChannelHealthStats.Flush(false)
+		}
+	}()
+}
+
+// Record 记录一次请求结果，errorClass 为空表示成功，ttft 为 0 时不记录首字时间
+func (r *ChannelHealthRecorder) Record(channelId int, modelName string, ttft, latency time.Duration, errorClass string) {
+	if channelId == 0 || modelName == "" {
+		return
+	}
+
+	key := healthKey{
+		channelId:  channelId,
+		model:      modelName,
+		bucketTime: time.Now().Truncate(time.Minute).Unix(),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &healthBucket{
+			errors:  make(map[string]int64),
+			latency: newHistogram(),
+			ttft:    newHistogram(),
+		}
+		r.buckets[key] = bucket
+	}
+
+	if errorClass != "" {
+		bucket.errors[errorClass]++
+		return
+	}
+
+	bucket.success++
+	observeHistogram(bucket.latency, latency)
+	if ttft > 0 {
+		observeHistogram(bucket.ttft, ttft)
+	}
+}
+
+// Flush 写入已经结束的分钟，all 为 true 时写入全部
+func (r *ChannelHealthRecorder) Flush(all bool) {
+	current := time.Now().Truncate(time.Minute).Unix()
+
+	r.Lock()
+	records := make([]*ChannelHealth, 0, len(r.buckets))
+	for key, bucket := range r.buckets {
+		if !all && key.bucketTime >= current {
+			continue
+		}
+		delete(r.buckets, key)
+		records = append(records, newChannelHealth(key, ChannelHealthMinute, bucket))
+	}
+	r.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+
+	if err := DB.CreateInBatches(records, 100).Error; err != nil {
+		logger.SysError("failed to save channel health: " + err.Error())
+	}
+}
+
+func newChannelHealth(key healthKey, granularity string, bucket *healthBucket) *ChannelHealth {
+	var errorCount int64
+	for _, count := range bucket.errors {
+		errorCount += count
+	}
+
+	return &ChannelHealth{
+		ChannelId:        key.channelId,
+		Model:            key.model,
+		Granularity:      granularity,
+		BucketTime:       key.bucketTime,
+		SuccessCount:     bucket.success,
+		ErrorCount:       errorCount,
+		Errors:           datatypes.NewJSONType(bucket.errors),
+		LatencyP50:       histogramPercentile(bucket.latency, 0.5),
+		LatencyP95:       histogramPercentile(bucket.latency, 0.95),
+		TTFTP50:          histogramPercentile(bucket.ttft, 0.5),
+		TTFTP95:          histogramPercentile(bucket.ttft, 0.95),
+		LatencyHistogram: bucket.latency,
+		TTFTHistogram:    bucket.ttft,
+	}
+}
+
+// mergeChannelHealth 将多条记录合并到 bucket 中
+func mergeChannelHealth(bucket *healthBucket, record *ChannelHealth) {
+	bucket.success += record.SuccessCount
+	for class, count := range record.Errors.Data() {
+		bucket.errors[class] += count
+	}
+	mergeHistogram(bucket.latency, record.LatencyHistogram)
+	mergeHistogram(bucket.ttft, record.TTFTHistogram)
+}
+
+// RollupChannelHealth 将超过保留时间的分钟记录汇总为小时记录，并删除超过保留天数的记录
+func RollupChannelHealth() {
+	now := time.Now()
+	minuteBefore := now.Add(-time.Duration(config.ChannelHealthMinuteRetentionHours) * time.Hour).Truncate(time.Hour).Unix()
+
+	var records []*ChannelHealth
+	err := DB.Where("granularity = ? AND bucket_time < ?", ChannelHealthMinute, minuteBefore).Find(&records).Error
+	if err != nil {
+		logger.SysError("failed to load channel health: " + err.Error())
+		return
+	}
+
+	if len(records) > 0 {
+		buckets := make(map[healthKey]*healthBucket)
+		for _, record := range records {
+			key := healthKey{
+				channelId:  record.ChannelId,
+				model:      record.Model,
+				bucketTime: time.Unix(record.BucketTime, 0).Truncate(time.Hour).Unix(),
+			}
+			bucket, ok := buckets[key]
+			if !ok {
+				bucket = &healthBucket{errors: make(map[string]int64), latency: newHistogram(), ttft: newHistogram()}
+				buckets[key] = bucket
+			}
+			mergeChannelHealth(bucket, record)
+		}
+
+		hours := make([]*ChannelHealth, 0, len(buckets))
+		for key, bucket := range buckets {
+			hours = append(hours, newChannelHealth(key, ChannelHealthHour, bucket))
+		}
+
+		ids := make([]int64, 0, len(records))
+		for _, record := range records {
+			ids = append(ids, record.Id)
+		}
+
+		tx := DB.Begin()
+		if err := tx.CreateInBatches(hours, 100).Error; err != nil {
+			tx.Rollback()
+			logger.SysError("failed to rollup channel health: " + err.Error())
+			return
+		}
+		for start := 0; start < len(ids); start += 500 {
+			end := min(start+500, len(ids))
+			if err := tx.Where("id IN ?", ids[start:end]).Delete(&ChannelHealth{}).Error; err != nil {
+				tx.Rollback()
+				logger.SysError("failed to rollup channel health: " + err.Error())
+				return
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			logger.SysError("failed to rollup channel health: " + err.Error())
+			return
+		}
+	}
+
+	if config.ChannelHealthRetentionDays <= 0 {
+		return
+	}
+
+	before := now.AddDate(0, 0, -config.ChannelHealthRetentionDays).Unix()
+	result := DB.Where("bucket_time < ?", before).Delete(&ChannelHealth{})
+	if result.Error != nil {
+		logger.SysError("failed to delete channel health: " + result.Error.Error())
+		return
+	}
+
+	logger.SysLog(fmt.Sprintf("channel_health_rollup minutes=%d deleted=%d", len(records), result.RowsAffected))
+}
+
+// ChannelHealthPoint 合并后的健康统计
+type ChannelHealthPoint struct {
+	ChannelId    int              `json:"channel_id"`
+	Model        string           `json:"model,omitempty"`
+	BucketTime   int64            `json:"bucket_time,omitempty"`
+	SuccessCount int64            `json:"success_count"`
+	ErrorCount   int64            `json:"error_count"`
+	Errors       map[string]int64 `json:"errors"`
+	Uptime       float64          `json:"uptime"` // 成功率百分比，无请求时为 -1
+	LatencyP50   int64            `json:"latency_p50"`
+	LatencyP95   int64            `json:"latency_p95"`
+	TTFTP50      int64            `json:"ttft_p50"`
+	TTFTP95      int64            `json:"ttft_p95"`
+}
+
+type ChannelHealthQuery struct {
+	ChannelId int    `form:"channel_id"`
+	Model     string `form:"model"`
+	StartTime int64  `form:"start_time"`
+	EndTime   int64  `form:"end_time"`
+	Interval  int64  `form:"interval"` // 按多少秒合并为一个点，0 表示整个时间段合并为一个点
+}
+
+func newChannelHealthPoint(key healthKey, bucket *healthBucket) *ChannelHealthPoint {
+	point := &ChannelHealthPoint{
+		ChannelId:    key.channelId,
+		Model:        key.model,
+		BucketTime:   key.bucketTime,
+		SuccessCount: bucket.success,
+		Errors:       bucket.errors,
+		Uptime:       -1,
+		LatencyP50:   histogramPercentile(bucket.latency, 0.5),
+		LatencyP95:   histogramPercentile(bucket.latency, 0.95),
+		TTFTP50:      histogramPercentile(bucket.ttft, 0.5),
+		TTFTP95:      histogramPercentile(bucket.ttft, 0.95),
+	}
+	for _, count := range bucket.errors {
+		point.ErrorCount += count
+	}
+
+	if total := point.SuccessCount + point.ErrorCount; total > 0 {
+		point.Uptime = float64(point.SuccessCount) * 100 / float64(total)
+	}
+
+	return point
+}
+
+// GetChannelHealth 按渠道、模型与时间间隔合并健康统计
+// 未指定模型时按渠道合并，所有渠道的结果按渠道与模型分别返回
+func GetChannelHealth(query *ChannelHealthQuery, groupByModel bool) ([]*ChannelHealthPoint, error) {
+	db := DB.Model(&ChannelHealth{})
+	if query.ChannelId > 0 {
+		db = db.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.Model != "" {
+		db = db.Where("model = ?", query.Model)
+	}
+	if query.StartTime > 0 {
+		db = db.Where("bucket_time >= ?", query.StartTime)
+	}
+	if query.EndTime > 0 {
+		db = db.Where("bucket_time < ?", query.EndTime)
+	}
+
+	var records []*ChannelHealth
+	if err := db.Order("bucket_time asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	// 未写入数据库的当前分钟不参与统计
+	buckets := make(map[healthKey]*healthBucket)
+	keys := make([]healthKey, 0)
+	for _, record := range records {
+		key := healthKey{channelId: record.ChannelId}
+		if groupByModel {
+			key.model = record.Model
+		}
+		if query.Interval > 0 {
+			key.bucketTime = record.BucketTime - record.BucketTime%query.Interval
+		}
+
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &healthBucket{errors: make(map[string]int64), latency: newHistogram(), ttft: newHistogram()}
+			buckets[key] = bucket
+			keys = append(keys, key)
+		}
+		mergeChannelHealth(bucket, record)
+	}
+
+	points := make([]*ChannelHealthPoint, 0, len(keys))
+	for _, key := range keys {
+		points = append(points, newChannelHealthPoint(key, buckets[key]))
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		if points[i].ChannelId != points[j].ChannelId {
+			return points[i].ChannelId < points[j].ChannelId
+		}
+		if points[i].Model != points[j].Model {
+			return points[i].Model < points[j].Model
+		}
+		return points[i].BucketTime < points[j].BucketTime
+	})
+
+	return points, nil
+}
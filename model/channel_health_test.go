@@ -0,0 +1,169 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/common/logger"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestChannelHealthErrorClass(t *testing.T) {
+	cases := []struct {
+		statusCode int
+		class      string
+	}{
+		{0, HealthErrorNetwork},
+		{http.StatusTooManyRequests, HealthErrorRateLimit},
+		{http.StatusUnauthorized, HealthErrorAuth},
+		{http.StatusForbidden, HealthErrorAuth},
+		{http.StatusPaymentRequired, HealthErrorAuth},
+		{http.StatusRequestTimeout, HealthErrorTimeout},
+		{http.StatusGatewayTimeout, HealthErrorTimeout},
+		{http.StatusInternalServerError, HealthErrorServer},
+		{http.StatusBadGateway, HealthErrorServer},
+		{http.StatusBadRequest, HealthErrorClient},
+		{http.StatusNotFound, HealthErrorClient},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.class, ChannelHealthErrorClass(c.statusCode), "status_code=%d", c.statusCode)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	histogram := newHistogram()
+	assert.Zero(t, histogramPercentile(histogram, 0.5))
+
+	for _, ms := range []int64{50, 100, 200, 300, 900} {
+		observeHistogram(histogram, time.Duration(ms)*time.Millisecond)
+	}
+	// 分位数取所在桶的上界
+	assert.Equal(t, int64(250), histogramPercentile(histogram, 0.5))
+	assert.Equal(t, int64(1000), histogramPercentile(histogram, 0.95))
+	assert.Equal(t, int64(100), histogramPercentile(histogram, 0))
+
+	// 超过最大上界的请求计入最后一个桶
+	overflow := newHistogram()
+	observeHistogram(overflow, 10*time.Minute)
+	assert.Equal(t, int64(1), overflow[len(healthLatencyBounds)])
+	assert.Equal(t, healthLatencyBounds[len(healthLatencyBounds)-1], histogramPercentile(overflow, 0.5))
+
+	merged := newHistogram()
+	mergeHistogram(merged, histogram)
+	mergeHistogram(merged, overflow)
+	assert.Equal(t, []int64{2, 1, 1, 1}, merged[:4])
+	assert.Equal(t, int64(1), merged[len(healthLatencyBounds)])
+}
+
+func TestChannelHealthRecord(t *testing.T) {
+	setupTestDB(t, &ChannelHealth{})
+	recorder := &ChannelHealthRecorder{buckets: make(map[healthKey]*healthBucket)}
+
+	recorder.Record(1, "gpt-4o", 200*time.Millisecond, 800*time.Millisecond, "")
+	recorder.Record(1, "gpt-4o", 0, 900*time.Millisecond, "")
+	recorder.Record(1, "gpt-4o", 0, 5*time.Second, HealthErrorServer)
+	recorder.Record(1, "gpt-4o", 0, 0, HealthErrorRateLimit)
+	recorder.Record(2, "gpt-4o", 0, time.Second, "")
+	// 无效的渠道或模型不记录
+	recorder.Record(0, "gpt-4o", 0, time.Second, "")
+	recorder.Record(1, "", 0, time.Second, "")
+
+	// 当前分钟未结束时不写入
+	recorder.Flush(false)
+	var count int64
+	DB.Model(&ChannelHealth{}).Count(&count)
+	assert.Zero(t, count)
+
+	recorder.Flush(true)
+	assert.Empty(t, recorder.buckets)
+
+	points, err := GetChannelHealth(&ChannelHealthQuery{}, true)
+	assert.NoError(t, err)
+	assert.Len(t, points, 2)
+
+	point := points[0]
+	assert.Equal(t, 1, point.ChannelId)
+	assert.Equal(t, "gpt-4o", point.Model)
+	assert.Equal(t, int64(2), point.SuccessCount)
+	assert.Equal(t, int64(2), point.ErrorCount)
+	assert.Equal(t, map[string]int64{HealthErrorServer: 1, HealthErrorRateLimit: 1}, point.Errors)
+	assert.Equal(t, float64(50), point.Uptime)
+	// 失败请求不计入延迟
+	assert.Equal(t, int64(1000), point.LatencyP95)
+	assert.Equal(t, int64(250), point.TTFTP50)
+
+	points, err = GetChannelHealth(&ChannelHealthQuery{ChannelId: 2}, false)
+	assert.NoError(t, err)
+	assert.Len(t, points, 1)
+	assert.Equal(t, float64(100), points[0].Uptime)
+	assert.Empty(t, points[0].Model)
+}
+
+func TestGetChannelHealthInterval(t *testing.T) {
+	db := setupTestDB(t, &ChannelHealth{})
+
+	for _, bucketTime := range []int64{3600, 3660, 7200} {
+		bucket := &healthBucket{errors: map[string]int64{HealthErrorTimeout: 1}, latency: newHistogram(), ttft: newHistogram()}
+		bucket.success = 3
+		assert.NoError(t, db.Create(newChannelHealth(healthKey{channelId: 1, model: "gpt-4o", bucketTime: bucketTime}, ChannelHealthMinute, bucket)).Error)
+	}
+
+	points, err := GetChannelHealth(&ChannelHealthQuery{ChannelId: 1, Interval: 3600}, false)
+	assert.NoError(t, err)
+	assert.Len(t, points, 2)
+	assert.Equal(t, int64(3600), points[0].BucketTime)
+	assert.Equal(t, int64(6), points[0].SuccessCount)
+	assert.Equal(t, int64(2), points[0].ErrorCount)
+	assert.Equal(t, float64(75), points[0].Uptime)
+	assert.Equal(t, int64(7200), points[1].BucketTime)
+
+	// 时间范围为左闭右开
+	points, err = GetChannelHealth(&ChannelHealthQuery{StartTime: 3660, EndTime: 7200}, false)
+	assert.NoError(t, err)
+	assert.Len(t, points, 1)
+	assert.Equal(t, int64(3), points[0].SuccessCount)
+}
+
+func TestRollupChannelHealth(t *testing.T) {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+	db := setupTestDB(t, &ChannelHealth{})
+	minuteRetention, retentionDays := config.ChannelHealthMinuteRetentionHours, config.ChannelHealthRetentionDays
+	config.ChannelHealthMinuteRetentionHours = 24
+	config.ChannelHealthRetentionDays = 30
+	defer func() {
+		config.ChannelHealthMinuteRetentionHours, config.ChannelHealthRetentionDays = minuteRetention, retentionDays
+	}()
+
+	hour := time.Now().Add(-48 * time.Hour).Truncate(time.Hour).Unix()
+	bucketTimes := []int64{
+		hour,              // 汇总
+		hour + 60,         // 汇总到同一小时
+		time.Now().Unix(), // 保留的分钟记录
+		hour - 40*24*3600, // 超过保留天数
+	}
+	for _, bucketTime := range bucketTimes {
+		bucket := &healthBucket{errors: map[string]int64{}, latency: newHistogram(), ttft: newHistogram()}
+		bucket.success = 1
+		observeHistogram(bucket.latency, 300*time.Millisecond)
+		assert.NoError(t, db.Create(newChannelHealth(healthKey{channelId: 1, model: "gpt-4o", bucketTime: bucketTime}, ChannelHealthMinute, bucket)).Error)
+	}
+
+	RollupChannelHealth()
+
+	var records []*ChannelHealth
+	assert.NoError(t, db.Order("bucket_time asc").Find(&records).Error)
+	assert.Len(t, records, 2)
+
+	assert.Equal(t, ChannelHealthHour, records[0].Granularity)
+	assert.Equal(t, hour, records[0].BucketTime)
+	assert.Equal(t, int64(2), records[0].SuccessCount)
+	assert.Equal(t, int64(500), records[0].LatencyP50)
+	assert.Equal(t, ChannelHealthMinute, records[1].Granularity)
+}
@@ -0,0 +1,288 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/utils"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ChannelKeyModeRoundRobin = "round_robin"
+	ChannelKeyModeWeight     = "weight"
+)
+
+var ErrNoAvailableChannelKey = errors.New("no available key in channel key pool")
+
+// ChannelKey 渠道 key 池中的单个 key
+type ChannelKey struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	Key          string `json:"key" gorm:"type:text;serializer:secret"`
+	Weight       *uint  `json:"weight" gorm:"default:1"`
+	Status       int    `json:"status" gorm:"default:1"`
+	Reason       string `json:"reason" gorm:"type:varchar(255);default:''"` // 自动禁用的原因
+	UsedQuota    int64  `json:"used_quota" gorm:"bigint;default:0"`
+	RequestCount int64  `json:"request_count" gorm:"bigint;default:0"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+}
+
+func IsValidChannelKeyMode(mode string) bool {
+	return mode == "" || mode == ChannelKeyModeRoundRobin || mode == ChannelKeyModeWeight
+}
+
+func (channel *Channel) IsKeyPool() bool {
+	return channel.KeyMode != ""
+}
+
+// WithPoolKey 返回使用 key 池中指定 key 的渠道副本
+func (channel *Channel) WithPoolKey(key *ChannelKey) *Channel {
+	channelCopy := *channel
+	channelCopy.Key = key.Key
+	channelCopy.KeyId = key.Id
+	return &channelCopy
+}
+
+// deleteOrphanChannelKeys 渠道为软删除，删除渠道后需要一并删除其 key 池中保存的密钥
+func deleteOrphanChannelKeys(tx *gorm.DB) error {
+	return tx.Where("channel_id NOT IN (?)", DB.Model(&Channel{}).Select("id")).Delete(&ChannelKey{}).Error
+}
+
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Order("id asc").Find(&keys).Error
+	return keys, err
+}
+
+func GetChannelKeysByStatus(channelId, status int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ? AND status = ?", channelId, status).Order("id asc").Find(&keys).Error
+	return keys, err
+}
+
+func GetChannelKeyById(channelId, keyId int) (*ChannelKey, error) {
+	var key ChannelKey
+	err := DB.Where("id = ? AND channel_id = ?", keyId, channelId).First(&key).Error
+	return &key, err
+}
+
+// AddChannelKeys 批量添加 key，已存在的 key 会被跳过
+func AddChannelKeys(channelId int, keys []string, weight uint) (int, error) {
+	existing, err := GetChannelKeys(channelId)
+	if err != nil {
+		return 0, err
+	}
+
+	existingKeys := make(map[string]bool, len(existing))
+	for _, key := range existing {
+		existingKeys[key.Key] = true
+	}
+
+	if weight == 0 {
+		weight = 1
+	}
+
+	newKeys := make([]*ChannelKey, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || existingKeys[key] {
+			continue
+		}
+		existingKeys[key] = true
+
+		newKeys = append(newKeys, &ChannelKey{
+			ChannelId:   channelId,
+			Key:         key,
+			Weight:      &weight,
+			Status:      config.ChannelStatusEnabled,
+			CreatedTime: utils.GetTimestamp(),
+		})
+	}
+
+	if len(newKeys) == 0 {
+		return 0, nil
+	}
+
+	if err := DB.Omit("UsedQuota", "RequestCount").Create(&newKeys).Error; err != nil {
+		return 0, err
+	}
+
+	ChannelKeyPool.Load()
+	return len(newKeys), nil
+}
+
+func UpdateChannelKeyStatus(channelId, keyId, status int, reason string) error {
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+
+	err := DB.Model(&ChannelKey{}).Where("id = ? AND channel_id = ?", keyId, channelId).Updates(map[string]any{
+		"status": status,
+		"reason": reason,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	ChannelKeyPool.Load()
+	return nil
+}
+
+// EnableExhaustedChannelKeys 刷新余额后恢复因余额耗尽而停用的 key
+func EnableExhaustedChannelKeys(channelId int) (int64, error) {
+	result := DB.Model(&ChannelKey{}).Where("channel_id = ? AND status = ?", channelId, config.ChannelStatusExhausted).Updates(map[string]any{
+		"status": config.ChannelStatusEnabled,
+		"reason": "",
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		ChannelKeyPool.Load()
+	}
+	return result.RowsAffected, nil
+}
+
+func UpdateChannelKeyUsage(keyId int, quota int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", keyId).Updates(map[string]any{
+		"used_quota":    gorm.Expr("used_quota + ?", quota),
+		"request_count": gorm.Expr("request_count + ?", 1),
+	}).Error
+	if err != nil {
+		logger.SysError("failed to update channel key usage: " + err.Error())
+	}
+}
+
+// ChannelKeyPoolManager 缓存启用状态的 key，并维护每个 key 的冷却时间
+type ChannelKeyPoolManager struct {
+	sync.RWMutex
+	keys      map[int][]*ChannelKey // channelId -> 启用的 key
+	cursors   map[int]*uint64
+	cooldowns sync.Map // keyId -> 冷却结束时间
+}
+
+var ChannelKeyPool = ChannelKeyPoolManager{
+	keys:    make(map[int][]*ChannelKey),
+	cursors: make(map[int]*uint64),
+}
+
+func (p *ChannelKeyPoolManager) Load() {
+	var keys []*ChannelKey
+	if err := DB.Where("status = ?", config.ChannelStatusEnabled).Order("id asc").Find(&keys).Error; err != nil {
+		logger.SysError("failed to load channel keys: " + err.Error())
+		return
+	}
+
+	newKeys := make(map[int][]*ChannelKey)
+	for _, key := range keys {
+		newKeys[key.ChannelId] = append(newKeys[key.ChannelId], key)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.keys = newKeys
+	for channelId := range newKeys {
+		if _, ok := p.cursors[channelId]; !ok {
+			p.cursors[channelId] = new(uint64)
+		}
+	}
+}
+
+func (p *ChannelKeyPoolManager) SetCooldown(keyId int) {
+	if keyId == 0 || config.RetryCooldownSeconds == 0 {
+		return
+	}
+
+	p.cooldowns.Store(keyId, time.Now().Unix()+int64(config.RetryCooldownSeconds))
+}
+
+func (p *ChannelKeyPoolManager) IsInCooldown(keyId int) bool {
+	cooldownTime, ok := p.cooldowns.Load(keyId)
+	if !ok {
+		return false
+	}
+
+	if time.Now().Unix() < cooldownTime.(int64) {
+		return true
+	}
+
+	p.cooldowns.Delete(keyId)
+	return false
+}
+
+func (p *ChannelKeyPoolManager) availableKeys(channelId int) []*ChannelKey {
+	keys := make([]*ChannelKey, 0, len(p.keys[channelId]))
+	for _, key := range p.keys[channelId] {
+		if !p.IsInCooldown(key.Id) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// HasAvailable 渠道是否还有未禁用且不在冷却中的 key
+func (p *ChannelKeyPoolManager) HasAvailable(channelId int) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	return len(p.availableKeys(channelId)) > 0
+}
+
+// CountEnabled 返回渠道中启用状态的 key 数量
+func (p *ChannelKeyPoolManager) CountEnabled(channelId int) int {
+	p.RLock()
+	defer p.RUnlock()
+
+	return len(p.keys[channelId])
+}
+
+// Next 按渠道的轮换方式选择一个 key
+func (p *ChannelKeyPoolManager) Next(channel *Channel) (*ChannelKey, error) {
+	p.RLock()
+	defer p.RUnlock()
+
+	keys := p.availableKeys(channel.Id)
+	if len(keys) == 0 {
+		return nil, ErrNoAvailableChannelKey
+	}
+
+	if channel.KeyMode == ChannelKeyModeWeight {
+		totalWeight := 0
+		for _, key := range keys {
+			totalWeight += int(max(*key.Weight, 1))
+		}
+
+		choiceWeight := rand.Intn(totalWeight)
+		for _, key := range keys {
+			choiceWeight -= int(max(*key.Weight, 1))
+			if choiceWeight < 0 {
+				return key, nil
+			}
+		}
+
+		return keys[len(keys)-1], nil
+	}
+
+	cursor := atomic.AddUint64(p.cursors[channel.Id], 1)
+	return keys[cursor%uint64(len(keys))], nil
+}
+
+// MaskKey 列表中只展示 key 的首尾部分
+func (key *ChannelKey) MaskKey() {
+	if len(key.Key) <= 12 {
+		key.Key = strings.Repeat("*", len(key.Key))
+		return
+	}
+
+	key.Key = key.Key[:6] + strings.Repeat("*", 6) + key.Key[len(key.Key)-4:]
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"testing"
+
+	"done-hub/common/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupChannelKeyTestDB(t *testing.T) {
+	setupTestDB(t, &ChannelKey{})
+
+	t.Cleanup(func() {
+		ChannelKeyPool.Lock()
+		ChannelKeyPool.keys = make(map[int][]*ChannelKey)
+		ChannelKeyPool.Unlock()
+		ChannelKeyPool.cooldowns.Range(func(key, _ any) bool {
+			ChannelKeyPool.cooldowns.Delete(key)
+			return true
+		})
+	})
+}
+
+func TestAddChannelKeys(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	added, err := AddChannelKeys(1, []string{"sk-a", " sk-b ", "", "sk-a"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	// 已存在的 key 会被跳过
+	added, err = AddChannelKeys(1, []string{"sk-b", "sk-c"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	keys, err := GetChannelKeys(1)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	assert.Equal(t, "sk-b", keys[1].Key)
+	assert.Equal(t, uint(1), *keys[0].Weight)
+	assert.Equal(t, uint(2), *keys[2].Weight)
+	assert.Equal(t, 3, ChannelKeyPool.CountEnabled(1))
+	assert.Zero(t, ChannelKeyPool.CountEnabled(2))
+}
+
+func TestChannelKeyStatus(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	_, err := AddChannelKeys(1, []string{"sk-a", "sk-b"}, 1)
+	assert.NoError(t, err)
+	keys, _ := GetChannelKeys(1)
+
+	// 禁用的 key 从池中移除
+	assert.NoError(t, UpdateChannelKeyStatus(1, keys[0].Id, config.ChannelStatusExhausted, "quota exhausted"))
+	assert.Equal(t, 1, ChannelKeyPool.CountEnabled(1))
+
+	key, err := GetChannelKeyById(1, keys[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "quota exhausted", key.Reason)
+
+	// 其他渠道的 key 不受影响
+	_, err = GetChannelKeyById(2, keys[0].Id)
+	assert.Error(t, err)
+
+	restored, err := EnableExhaustedChannelKeys(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), restored)
+	assert.Equal(t, 2, ChannelKeyPool.CountEnabled(1))
+
+	key, _ = GetChannelKeyById(1, keys[0].Id)
+	assert.Empty(t, key.Reason)
+
+	UpdateChannelKeyUsage(keys[1].Id, 100)
+	UpdateChannelKeyUsage(keys[1].Id, 50)
+	key, _ = GetChannelKeyById(1, keys[1].Id)
+	assert.Equal(t, int64(150), key.UsedQuota)
+	assert.Equal(t, int64(2), key.RequestCount)
+}
+
+func TestChannelKeyPoolNext(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	cooldownSeconds := config.RetryCooldownSeconds
+	config.RetryCooldownSeconds = 60
+	defer func() { config.RetryCooldownSeconds = cooldownSeconds }()
+
+	_, err := AddChannelKeys(1, []string{"sk-a", "sk-b", "sk-c"}, 1)
+	assert.NoError(t, err)
+	channel := &Channel{Id: 1, KeyMode: ChannelKeyModeRoundRobin}
+
+	// 轮询依次使用每个 key
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		key, err := ChannelKeyPool.Next(channel)
+		assert.NoError(t, err)
+		seen[key.Key]++
+	}
+	assert.Equal(t, map[string]int{"sk-a": 2, "sk-b": 2, "sk-c": 2}, seen)
+
+	// 冷却中的 key 不参与选择
+	keys, _ := GetChannelKeys(1)
+	ChannelKeyPool.SetCooldown(keys[0].Id)
+	ChannelKeyPool.SetCooldown(keys[1].Id)
+	for i := 0; i < 3; i++ {
+		key, err := ChannelKeyPool.Next(channel)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk-c", key.Key)
+	}
+	assert.True(t, ChannelKeyPool.HasAvailable(1))
+
+	ChannelKeyPool.SetCooldown(keys[2].Id)
+	assert.False(t, ChannelKeyPool.HasAvailable(1))
+	_, err = ChannelKeyPool.Next(channel)
+	assert.ErrorIs(t, err, ErrNoAvailableChannelKey)
+
+	_, err = ChannelKeyPool.Next(&Channel{Id: 2, KeyMode: ChannelKeyModeRoundRobin})
+	assert.ErrorIs(t, err, ErrNoAvailableChannelKey)
+}
+
+func TestChannelKeyPoolNextWeight(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	_, err := AddChannelKeys(1, []string{"sk-a"}, 3)
+	assert.NoError(t, err)
+	_, err = AddChannelKeys(1, []string{"sk-b"}, 1)
+	assert.NoError(t, err)
+	channel := &Channel{Id: 1, KeyMode: ChannelKeyModeWeight}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		key, err := ChannelKeyPool.Next(channel)
+		assert.NoError(t, err)
+		counts[key.Key]++
+	}
+
+	assert.InDelta(t, 3000, counts["sk-a"], 200)
+	assert.InDelta(t, 1000, counts["sk-b"], 200)
+}
+
+func TestIsAvailableKeyPool(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	_, err := AddChannelKeys(1, []string{"sk-a"}, 1)
+	assert.NoError(t, err)
+
+	assert.True(t, isAvailable(&ChannelChoice{Channel: &Channel{Id: 1, KeyMode: ChannelKeyModeRoundRobin}}, nil, "gpt-4o"))
+	// key 池中没有可用 key 的渠道不参与选择
+	assert.False(t, isAvailable(&ChannelChoice{Channel: &Channel{Id: 2, KeyMode: ChannelKeyModeRoundRobin}}, nil, "gpt-4o"))
+	assert.True(t, isAvailable(&ChannelChoice{Channel: &Channel{Id: 2}}, nil, "gpt-4o"))
+}
+
+func TestWithPoolKey(t *testing.T) {
+	channel := &Channel{Id: 1, Key: "sk-channel", KeyMode: ChannelKeyModeRoundRobin}
+	poolChannel := channel.WithPoolKey(&ChannelKey{Id: 5, Key: "sk-pool"})
+
+	assert.Equal(t, "sk-pool", poolChannel.Key)
+	assert.Equal(t, 5, poolChannel.KeyId)
+	// 不修改原渠道
+	assert.Equal(t, "sk-channel", channel.Key)
+	assert.Zero(t, channel.KeyId)
+}
+
+func TestChannelKeyMaskKey(t *testing.T) {
+	cases := []struct {
+		key    string
+		masked string
+	}{
+		{"sk-short", "********"},
+		{"sk-1234567890abcdef", "sk-123******cdef"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			key := &ChannelKey{Key: c.key}
+			key.MaskKey()
+			assert.Equal(t, c.masked, key.Key)
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package model
+
+import (
+	"context"
+	"done-hub/common/config"
+	"done-hub/common/limit"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	channelLimitWindow       = time.Minute
+	channelLimitPollInterval = 200 * time.Millisecond // Redis 模式下其他节点释放时无法通知，需要轮询
+)
+
+var (
+	ErrChannelLimitQueueFull    = errors.New("channel limit wait queue is full")
+	ErrChannelLimitQueueTimeout = errors.New("channel limit wait timeout")
+)
+
+// ChannelLimit 并发、每分钟请求数、每分钟 tokens 上限，0 表示不限制
+type ChannelLimit struct {
+	Concurrency int `json:"concurrency"`
+	RPM         int `json:"rpm"`
+	TPM         int `json:"tpm"`
+}
+
+func (l *ChannelLimit) IsEmpty() bool {
+	return l.Concurrency <= 0 && l.RPM <= 0 && l.TPM <= 0
+}
+
+// ChannelLimits 渠道级限制作用于渠道下的所有模型，Models 中为单个模型的限制
+type ChannelLimits struct {
+	ChannelLimit
+	Models map[string]ChannelLimit `json:"models,omitempty"`
+}
+
+type channelLimitScope struct {
+	key   string
+	limit ChannelLimit
+	lease string
+}
+
+// ChannelLimitTicket 请求结束后调用 Release 释放并发并记录输出 tokens
+type ChannelLimitTicket struct {
+	scopes []channelLimitScope
+}
+
+type ChannelLimitManager struct {
+	sync.Mutex
+	concurrency limit.ConcurrencyLimiter
+	limiters    map[string]limit.RateLimiter
+	released    chan struct{}
+	waiting     int64
+}
+
+var ChannelLimiter = ChannelLimitManager{
+	limiters: make(map[string]limit.RateLimiter),
+	released: make(chan struct{}),
+}
+
+func getChannelLimitScopes(channel *Channel, modelName string) []channelLimitScope {
+	if channel == nil || channel.Limits == nil {
+		return nil
+	}
+
+	limits := channel.Limits.Data()
+	scopes := make([]channelLimitScope, 0, 2)
+	if !limits.ChannelLimit.IsEmpty() {
+		scopes = append(scopes, channelLimitScope{
+			key:   fmt.Sprintf("channel_limit:%d", channel.Id),
+			limit: limits.ChannelLimit,
+		})
+	}
+
+	if modelLimit, ok := limits.Models[modelName]; ok && !modelLimit.IsEmpty() {
+		scopes = append(scopes, channelLimitScope{
+			key:   fmt.Sprintf("channel_limit:%d:%s", channel.Id, modelName),
+			limit: modelLimit,
+		})
+	}
+
+	return scopes
+}
+
+// concurrencyLimiter Redis 在启动后才初始化，需要在首次使用时创建
+func (m *ChannelLimitManager) concurrencyLimiter() limit.ConcurrencyLimiter {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.concurrency == nil {
+		m.concurrency = limit.NewConcurrencyLimiter()
+	}
+
+	return m.concurrency
+}
+
+// rateLimiter 使用固定窗口计数，相同上限的渠道共用一个限流器
+func (m *ChannelLimitManager) rateLimiter(rate int) limit.RateLimiter {
+	m.Lock()
+	defer m.Unlock()
+
+	key := fmt.Sprintf("%d", rate)
+	if limiter, ok := m.limiters[key]; ok {
+		return limiter
+	}
+
+	var limiter limit.RateLimiter
+	if config.RedisEnabled {
+		limiter = limit.NewCountLimiter(rate, rate, channelLimitWindow)
+	} else {
+		limiter = limit.NewMemoryLimiter(rate, rate, channelLimitWindow, false)
+	}
+	m.limiters[key] = limiter
+
+	return limiter
+}
+
+func (m *ChannelLimitManager) reachedRate(rate int, key string) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	current, err := m.rateLimiter(rate).GetCurrentRate(key)
+	return err == nil && current >= rate
+}
+
+// IsSaturated 只读判断渠道是否已达到任一上限，用于渠道选择时过滤
+func (m *ChannelLimitManager) IsSaturated(channel *Channel, modelName string) bool {
+	for _, scope := range getChannelLimitScopes(channel, modelName) {
+		if scope.limit.Concurrency > 0 {
+			current, err := m.concurrencyLimiter().GetCurrent(scope.key)
+			if err == nil && current >= scope.limit.Concurrency {
+				return true
+			}
+		}
+
+		if m.reachedRate(scope.limit.RPM, scope.key+":rpm") || m.reachedRate(scope.limit.TPM, scope.key+":tpm") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Acquire 发送请求前占用并发名额，并计入请求数与输入 tokens
+func (m *ChannelLimitManager) Acquire(channel *Channel, modelName string, promptTokens int) (*ChannelLimitTicket, bool) {
+	ticket := &ChannelLimitTicket{}
+	scopes := getChannelLimitScopes(channel, modelName)
+	if len(scopes) == 0 {
+		return ticket, true
+	}
+
+	for _, scope := range scopes {
+		if scope.limit.Concurrency > 0 {
+			lease, ok := m.concurrencyLimiter().Acquire(scope.key, scope.limit.Concurrency)
+			if !ok {
+				m.Release(ticket, 0)
+				return nil, false
+			}
+			scope.lease = lease
+		}
+		ticket.scopes = append(ticket.scopes, scope)
+	}
+
+	// 输入 tokens 超过 TPM 上限的请求按上限计入，窗口内无其他请求时仍可发送，否则会一直被拒绝
+	tokens := max(promptTokens, 1)
+	var reserved []channelLimitScope
+	for _, scope := range scopes {
+		if scope.limit.RPM > 0 && !m.rateLimiter(scope.limit.RPM).Allow(scope.key+":rpm") {
+			m.refundDenied(scope.limit.RPM, scope.key+":rpm", 1)
+			m.refundScopes(reserved, tokens)
+			m.Release(ticket, 0)
+			return nil, false
+		}
+
+		if scope.limit.TPM > 0 {
+			n := min(tokens, scope.limit.TPM)
+			if !m.rateLimiter(scope.limit.TPM).AllowN(scope.key+":tpm", n) {
+				m.refundDenied(scope.limit.TPM, scope.key+":tpm", n)
+				// 请求未发送，已计入的请求数一并退还
+				if scope.limit.RPM > 0 {
+					m.refundRate(scope.limit.RPM, scope.key+":rpm", 1)
+				}
+				m.refundScopes(reserved, tokens)
+				m.Release(ticket, 0)
+				return nil, false
+			}
+		}
+		reserved = append(reserved, scope)
+	}
+
+	return ticket, true
+}
+
+// refundScopes 退还已通过的范围计入的请求数与 tokens
+func (m *ChannelLimitManager) refundScopes(scopes []channelLimitScope, tokens int) {
+	for _, scope := range scopes {
+		if scope.limit.RPM > 0 {
+			m.refundRate(scope.limit.RPM, scope.key+":rpm", 1)
+		}
+		if scope.limit.TPM > 0 {
+			m.refundRate(scope.limit.TPM, scope.key+":tpm", min(tokens, scope.limit.TPM))
+		}
+	}
+}
+
+// refundRate 退还当前窗口内计入的数量
+func (m *ChannelLimitManager) refundRate(rate int, key string, n int) {
+	m.rateLimiter(rate).AllowN(key, -n)
+}
+
+// refundDenied Redis 计数超出上限时同样会累加，被拒绝的数量需要退还，内存计数被拒绝时不会累加
+func (m *ChannelLimitManager) refundDenied(rate int, key string, n int) {
+	if config.RedisEnabled {
+		m.refundRate(rate, key, n)
+	}
+}
+
+// Release 释放并发名额，输出 tokens 在请求完成后计入 TPM
+func (m *ChannelLimitManager) Release(ticket *ChannelLimitTicket, completionTokens int) {
+	if ticket == nil || len(ticket.scopes) == 0 {
+		return
+	}
+
+	for _, scope := range ticket.scopes {
+		if scope.limit.Concurrency > 0 {
+			m.concurrencyLimiter().Release(scope.key, scope.lease)
+		}
+
+		if scope.limit.TPM > 0 && completionTokens > 0 {
+			m.rateLimiter(scope.limit.TPM).AllowN(scope.key+":tpm", completionTokens)
+		}
+	}
+	ticket.scopes = nil
+
+	m.Lock()
+	close(m.released)
+	m.released = make(chan struct{})
+	m.Unlock()
+}
+
+// Wait 所有候选渠道都已饱和时排队等待，ready 返回 true 时结束等待
+func (m *ChannelLimitManager) Wait(ctx context.Context, ready func() bool) error {
+	if atomic.AddInt64(&m.waiting, 1) > int64(config.ChannelLimitQueueSize) {
+		atomic.AddInt64(&m.waiting, -1)
+		return ErrChannelLimitQueueFull
+	}
+	defer atomic.AddInt64(&m.waiting, -1)
+
+	timer := time.NewTimer(time.Duration(config.ChannelLimitQueueTimeout) * time.Second)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(channelLimitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Lock()
+		released := m.released
+		m.Unlock()
+
+		if ready() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return ErrChannelLimitQueueTimeout
+		case <-ticker.C:
+		case <-released:
+		}
+	}
+}
+
+func FilterSaturated(modelName string) ChannelsFilterFunc {
+	return func(_ int, choice *ChannelChoice) bool {
+		return ChannelLimiter.IsSaturated(choice.Channel, modelName)
+	}
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/common/limit"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func newLimitTestManager() *ChannelLimitManager {
+	return &ChannelLimitManager{
+		concurrency: limit.NewConcurrencyLimiter(),
+		limiters:    make(map[string]limit.RateLimiter),
+		released:    make(chan struct{}),
+	}
+}
+
+func newLimitTestChannel(channelId int, limits ChannelLimits) *Channel {
+	data := datatypes.NewJSONType(limits)
+	return &Channel{Id: channelId, Limits: &data}
+}
+
+func TestGetChannelLimitScopes(t *testing.T) {
+	assert.Empty(t, getChannelLimitScopes(nil, "gpt-4o"))
+	assert.Empty(t, getChannelLimitScopes(&Channel{Id: 1}, "gpt-4o"))
+
+	channel := newLimitTestChannel(1, ChannelLimits{
+		ChannelLimit: ChannelLimit{Concurrency: 2},
+		Models: map[string]ChannelLimit{
+			"gpt-4o":      {RPM: 10},
+			"gpt-4o-mini": {},
+		},
+	})
+
+	scopes := getChannelLimitScopes(channel, "gpt-4o")
+	assert.Len(t, scopes, 2)
+	assert.Equal(t, "channel_limit:1", scopes[0].key)
+	assert.Equal(t, "channel_limit:1:gpt-4o", scopes[1].key)
+	assert.Equal(t, 10, scopes[1].limit.RPM)
+
+	// 空的模型限制不生效
+	assert.Len(t, getChannelLimitScopes(channel, "gpt-4o-mini"), 1)
+}
+
+func TestChannelLimitConcurrency(t *testing.T) {
+	redisEnabled := config.RedisEnabled
+	config.RedisEnabled = false
+	defer func() { config.RedisEnabled = redisEnabled }()
+
+	manager := newLimitTestManager()
+	channel := newLimitTestChannel(1, ChannelLimits{ChannelLimit: ChannelLimit{Concurrency: 2}})
+
+	first, ok := manager.Acquire(channel, "gpt-4o", 10)
+	assert.True(t, ok)
+	assert.False(t, manager.IsSaturated(channel, "gpt-4o"))
+
+	second, ok := manager.Acquire(channel, "gpt-4o", 10)
+	assert.True(t, ok)
+	assert.True(t, manager.IsSaturated(channel, "gpt-4o"))
+
+	_, ok = manager.Acquire(channel, "gpt-4o", 10)
+	assert.False(t, ok)
+
+	manager.Release(first, 0)
+	assert.False(t, manager.IsSaturated(channel, "gpt-4o"))
+
+	// 重复释放同一个 ticket 不会多释放名额
+	manager.Release(first, 0)
+	_, ok = manager.Acquire(channel, "gpt-4o", 10)
+	assert.True(t, ok)
+	_, ok = manager.Acquire(channel, "gpt-4o", 10)
+	assert.False(t, ok)
+
+	manager.Release(second, 0)
+}
+
+func TestChannelLimitRate(t *testing.T) {
+	redisEnabled := config.RedisEnabled
+	config.RedisEnabled = false
+	defer func() { config.RedisEnabled = redisEnabled }()
+
+	cases := []struct {
+		name     string
+		limits   ChannelLimits
+		requests []int // 每个请求的输入 tokens
+		allowed  []bool
+	}{
+		{
+			name:     "rpm",
+			limits:   ChannelLimits{ChannelLimit: ChannelLimit{RPM: 2}},
+			requests: []int{1, 1, 1},
+			allowed:  []bool{true, true, false},
+		},
+		{
+			name:     "tpm",
+			limits:   ChannelLimits{ChannelLimit: ChannelLimit{TPM: 100}},
+			requests: []int{60, 60, 40},
+			allowed:  []bool{true, false, true},
+		},
+		{
+			// 超过上限的请求按上限计入，窗口内无其他请求时仍可发送
+			name:     "tokens over tpm",
+			limits:   ChannelLimits{ChannelLimit: ChannelLimit{TPM: 100}},
+			requests: []int{200, 1},
+			allowed:  []bool{true, false},
+		},
+		{
+			// 模型 TPM 拒绝时退还渠道已计入的请求数
+			name: "refund on model limit",
+			limits: ChannelLimits{
+				ChannelLimit: ChannelLimit{RPM: 2},
+				Models:       map[string]ChannelLimit{"gpt-4o": {TPM: 100}},
+			},
+			requests: []int{60, 60, 40, 1},
+			allowed:  []bool{true, false, true, false},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := newLimitTestManager()
+			channel := newLimitTestChannel(1, c.limits)
+
+			for i, tokens := range c.requests {
+				ticket, ok := manager.Acquire(channel, "gpt-4o", tokens)
+				assert.Equal(t, c.allowed[i], ok, "request %d", i)
+				manager.Release(ticket, 0)
+			}
+		})
+	}
+}
+
+func TestChannelLimitCompletionTokens(t *testing.T) {
+	redisEnabled := config.RedisEnabled
+	config.RedisEnabled = false
+	defer func() { config.RedisEnabled = redisEnabled }()
+
+	manager := newLimitTestManager()
+	channel := newLimitTestChannel(1, ChannelLimits{ChannelLimit: ChannelLimit{TPM: 100}})
+
+	ticket, ok := manager.Acquire(channel, "gpt-4o", 10)
+	assert.True(t, ok)
+	assert.False(t, manager.IsSaturated(channel, "gpt-4o"))
+
+	// 输出 tokens 在释放时计入
+	manager.Release(ticket, 90)
+	assert.True(t, manager.IsSaturated(channel, "gpt-4o"))
+}
+
+func TestChannelLimitWait(t *testing.T) {
+	queueSize, queueTimeout := config.ChannelLimitQueueSize, config.ChannelLimitQueueTimeout
+	defer func() {
+		config.ChannelLimitQueueSize, config.ChannelLimitQueueTimeout = queueSize, queueTimeout
+	}()
+	config.ChannelLimitQueueSize = 1
+	config.ChannelLimitQueueTimeout = 1
+
+	manager := newLimitTestManager()
+
+	// 释放名额后唤醒等待的请求
+	var ready atomic.Bool
+	done := make(chan error)
+	go func() {
+		done <- manager.Wait(context.Background(), ready.Load)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	// 队列已满
+	assert.ErrorIs(t, manager.Wait(context.Background(), func() bool { return false }), ErrChannelLimitQueueFull)
+
+	ready.Store(true)
+	manager.Release(&ChannelLimitTicket{scopes: []channelLimitScope{{key: "test"}}}, 0)
+	assert.NoError(t, <-done)
+
+	assert.ErrorIs(t, manager.Wait(context.Background(), func() bool { return false }), ErrChannelLimitQueueTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, manager.Wait(ctx, func() bool { return false }), context.Canceled)
+}
@@ -0,0 +1,239 @@
+package model
+
+import (
+	"done-hub/common/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// ChannelModelDiscovery 渠道的模型自动发现设置
+type ChannelModelDiscovery struct {
+	Enabled   bool   `json:"enabled"`
+	AutoApply bool   `json:"auto_apply"`        // 自动应用符合规则的新增与移除
+	Include   string `json:"include,omitempty"` // 自动应用的模型需要匹配的正则，为空表示全部
+	Exclude   string `json:"exclude,omitempty"` // 匹配该正则的模型不自动应用
+}
+
+func (d *ChannelModelDiscovery) Validate() error {
+	if _, err := regexp.Compile(d.Include); err != nil {
+		return fmt.Errorf("invalid include regex: %w", err)
+	}
+	if _, err := regexp.Compile(d.Exclude); err != nil {
+		return fmt.Errorf("invalid exclude regex: %w", err)
+	}
+
+	return nil
+}
+
+// FilterAutoApply 返回符合自动应用规则的模型
+func (d *ChannelModelDiscovery) FilterAutoApply(models []string) []string {
+	include, err := regexp.Compile(d.Include)
+	if err != nil {
+		return nil
+	}
+
+	var exclude *regexp.Regexp
+	if d.Exclude != "" {
+		exclude, err = regexp.Compile(d.Exclude)
+		if err != nil {
+			return nil
+		}
+	}
+
+	matched := make([]string, 0, len(models))
+	for _, modelName := range models {
+		if !include.MatchString(modelName) || (exclude != nil && exclude.MatchString(modelName)) {
+			continue
+		}
+		matched = append(matched, modelName)
+	}
+
+	return matched
+}
+
+func (channel *Channel) GetModelDiscovery() *ChannelModelDiscovery {
+	if channel.ModelDiscovery == nil {
+		return nil
+	}
+
+	discovery := channel.ModelDiscovery.Data()
+	if !discovery.Enabled {
+		return nil
+	}
+
+	return &discovery
+}
+
+// ChannelDiscoveredModels 最近一次从上游获取到的模型列表
+type ChannelDiscoveredModels struct {
+	ChannelId   int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	Models      string `json:"models" gorm:"type:text"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ChannelModelDiff 上游模型与渠道当前模型的差异
+type ChannelModelDiff struct {
+	ChannelId   int      `json:"channel_id"`
+	ChannelName string   `json:"channel_name"`
+	Added       []string `json:"added"`
+	Removed     []string `json:"removed"`
+	UpdatedTime int64    `json:"updated_time"`
+}
+
+func splitModels(models string) []string {
+	list := make([]string, 0)
+	for _, modelName := range strings.Split(models, ",") {
+		modelName = strings.TrimSpace(modelName)
+		if modelName != "" && !slices.Contains(list, modelName) {
+			list = append(list, modelName)
+		}
+	}
+
+	return list
+}
+
+// SaveDiscoveredModels 保存上游模型列表，返回上一次获取到的列表
+func SaveDiscoveredModels(channelId int, models []string) ([]string, error) {
+	var previous ChannelDiscoveredModels
+	err := DB.Where("channel_id = ?", channelId).Limit(1).Find(&previous).Error
+	if err != nil {
+		return nil, err
+	}
+
+	discovered := ChannelDiscoveredModels{
+		ChannelId:   channelId,
+		Models:      strings.Join(models, ","),
+		UpdatedTime: utils.GetTimestamp(),
+	}
+	err = DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&discovered).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return splitModels(previous.Models), nil
+}
+
+// DiffModels 返回 next 相对 prev 新增与移除的模型
+func DiffModels(prev, next []string) (added, removed []string) {
+	added = make([]string, 0)
+	removed = make([]string, 0)
+	for _, modelName := range next {
+		if !slices.Contains(prev, modelName) {
+			added = append(added, modelName)
+		}
+	}
+	for _, modelName := range prev {
+		if !slices.Contains(next, modelName) {
+			removed = append(removed, modelName)
+		}
+	}
+
+	return added, removed
+}
+
+// GetChannelModelDiff 通配符模型与模型映射中的别名不会被视为移除
+func (channel *Channel) GetChannelModelDiff(discovered *ChannelDiscoveredModels) *ChannelModelDiff {
+	mapping := make(map[string]string)
+	if channel.ModelMapping != nil && *channel.ModelMapping != "" {
+		_ = json.Unmarshal([]byte(*channel.ModelMapping), &mapping)
+	}
+
+	current := make([]string, 0)
+	for _, modelName := range splitModels(channel.Models) {
+		if strings.HasSuffix(modelName, "*") {
+			continue
+		}
+		if _, ok := mapping[modelName]; ok {
+			continue
+		}
+		current = append(current, modelName)
+	}
+
+	added, removed := DiffModels(current, splitModels(discovered.Models))
+	// 已通过模型映射提供的模型不需要再添加
+	added = slices.DeleteFunc(added, func(modelName string) bool {
+		return strings.Contains(","+channel.Models+",", ","+modelName+",")
+	})
+
+	return &ChannelModelDiff{
+		ChannelId:   channel.Id,
+		ChannelName: channel.Name,
+		Added:       added,
+		Removed:     removed,
+		UpdatedTime: discovered.UpdatedTime,
+	}
+}
+
+// GetChannelModelDiffs 返回所有存在差异的渠道
+func GetChannelModelDiffs() ([]*ChannelModelDiff, error) {
+	var discovered []*ChannelDiscoveredModels
+	if err := DB.Find(&discovered).Error; err != nil {
+		return nil, err
+	}
+
+	diffs := make([]*ChannelModelDiff, 0)
+	for _, item := range discovered {
+		channel, err := GetChannelById(item.ChannelId)
+		if err != nil {
+			continue
+		}
+
+		diff := channel.GetChannelModelDiff(item)
+		if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+// RemoveChannelModel 从渠道的模型列表中移除模型，模型不在列表中（如通过通配符匹配）时返回 false
+func RemoveChannelModel(channelId int, modelName string) (bool, error) {
+	var channel Channel
+	if err := DB.Select("id, models").First(&channel, "id = ?", channelId).Error; err != nil {
+		return false, err
+	}
+
+	if !slices.Contains(splitModels(channel.Models), modelName) {
+		return false, nil
+	}
+
+	if err := ApplyChannelModelDiff(channelId, nil, []string{modelName}); err != nil {
+		return false, err
+	}
+
+	ChannelGroup.Reload()
+	return true, nil
+}
+
+// ApplyChannelModelDiff 为渠道添加与移除指定的模型，不会重新加载渠道缓存
+func ApplyChannelModelDiff(channelId int, added, removed []string) error {
+	var channel Channel
+	if err := DB.Select("id, models").First(&channel, "id = ?", channelId).Error; err != nil {
+		return err
+	}
+
+	models := splitModels(channel.Models)
+	models = slices.DeleteFunc(models, func(modelName string) bool {
+		return slices.Contains(removed, modelName)
+	})
+	for _, modelName := range added {
+		modelName = strings.TrimSpace(modelName)
+		if modelName != "" && !slices.Contains(models, modelName) {
+			models = append(models, modelName)
+		}
+	}
+
+	if len(models) == 0 {
+		return errors.New("渠道至少需要保留一个模型")
+	}
+
+	return DB.Model(&Channel{}).Where("id = ?", channelId).Update("models", strings.Join(models, ",")).Error
+}
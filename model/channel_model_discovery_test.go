@@ -0,0 +1,121 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestDiffModels(t *testing.T) {
+	added, removed := DiffModels([]string{"a", "b", "c"}, []string{"b", "c", "d"})
+	assert.Equal(t, []string{"d"}, added)
+	assert.Equal(t, []string{"a"}, removed)
+
+	added, removed = DiffModels(nil, nil)
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+}
+
+func TestSplitModels(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitModels(" a, b,,a "))
+	assert.Empty(t, splitModels(""))
+}
+
+func TestChannelModelDiscoveryFilterAutoApply(t *testing.T) {
+	models := []string{"gpt-4o", "gpt-4o-audio-preview", "o3", "text-embedding-3-small"}
+
+	cases := []struct {
+		name      string
+		discovery ChannelModelDiscovery
+		matched   []string
+	}{
+		{"all", ChannelModelDiscovery{}, models},
+		{"include", ChannelModelDiscovery{Include: "^gpt-"}, []string{"gpt-4o", "gpt-4o-audio-preview"}},
+		{"exclude", ChannelModelDiscovery{Exclude: "preview|embedding"}, []string{"gpt-4o", "o3"}},
+		{"include and exclude", ChannelModelDiscovery{Include: "^gpt-", Exclude: "preview"}, []string{"gpt-4o"}},
+		{"invalid regex", ChannelModelDiscovery{Include: "("}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.matched, c.discovery.FilterAutoApply(models))
+		})
+	}
+}
+
+func TestChannelModelDiscoveryValidate(t *testing.T) {
+	assert.NoError(t, (&ChannelModelDiscovery{Include: "^gpt-", Exclude: "preview"}).Validate())
+	assert.Error(t, (&ChannelModelDiscovery{Include: "("}).Validate())
+	assert.Error(t, (&ChannelModelDiscovery{Exclude: "["}).Validate())
+}
+
+func TestGetModelDiscovery(t *testing.T) {
+	assert.Nil(t, (&Channel{}).GetModelDiscovery())
+
+	disabled := datatypes.NewJSONType(ChannelModelDiscovery{Include: "^gpt-"})
+	assert.Nil(t, (&Channel{ModelDiscovery: &disabled}).GetModelDiscovery())
+
+	enabled := datatypes.NewJSONType(ChannelModelDiscovery{Enabled: true, AutoApply: true})
+	discovery := (&Channel{ModelDiscovery: &enabled}).GetModelDiscovery()
+	assert.NotNil(t, discovery)
+	assert.True(t, discovery.AutoApply)
+}
+
+func TestGetChannelModelDiff(t *testing.T) {
+	mapping := `{"my-alias":"gpt-4o-mini"}`
+	channel := &Channel{
+		Id:           1,
+		Name:         "openai",
+		Models:       "gpt-4o,gpt-4*,my-alias,old-model",
+		ModelMapping: &mapping,
+	}
+
+	diff := channel.GetChannelModelDiff(&ChannelDiscoveredModels{
+		ChannelId:   1,
+		Models:      "gpt-4o,gpt-4.1,my-alias,new-model",
+		UpdatedTime: 100,
+	})
+
+	// 通配符模型与映射别名不视为移除，已存在的别名不视为新增
+	assert.Equal(t, []string{"gpt-4.1", "new-model"}, diff.Added)
+	assert.Equal(t, []string{"old-model"}, diff.Removed)
+	assert.Equal(t, "openai", diff.ChannelName)
+	assert.Equal(t, int64(100), diff.UpdatedTime)
+}
+
+func TestChannelModelDiscoveryStore(t *testing.T) {
+	db := setupTestDB(t, &Channel{}, &ChannelDiscoveredModels{})
+
+	weight := uint(1)
+	channel := &Channel{Name: "openai", Models: "gpt-4o,old-model", Weight: &weight}
+	assert.NoError(t, db.Create(channel).Error)
+
+	previous, err := SaveDiscoveredModels(channel.Id, []string{"gpt-4o", "new-model"})
+	assert.NoError(t, err)
+	assert.Empty(t, previous)
+
+	// 再次保存时返回上一次的列表
+	previous, err = SaveDiscoveredModels(channel.Id, []string{"gpt-4o", "new-model"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4o", "new-model"}, previous)
+
+	diffs, err := GetChannelModelDiffs()
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, []string{"new-model"}, diffs[0].Added)
+	assert.Equal(t, []string{"old-model"}, diffs[0].Removed)
+
+	assert.NoError(t, ApplyChannelModelDiff(channel.Id, diffs[0].Added, diffs[0].Removed))
+	updated, err := GetChannelById(channel.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4o,new-model", updated.Models)
+
+	// 应用后不再存在差异
+	diffs, err = GetChannelModelDiffs()
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	// 渠道至少保留一个模型
+	assert.Error(t, ApplyChannelModelDiff(channel.Id, nil, []string{"gpt-4o", "new-model"}))
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"done-hub/common/logger"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ScheduleOutsideExclude 时间窗口外不参与渠道选择
+	ScheduleOutsideExclude = "exclude"
+	// ScheduleOutsidePriority 时间窗口外使用 OutsidePriority 作为优先级
+	ScheduleOutsidePriority = "priority"
+
+	ScheduleStateActive   = "active"
+	ScheduleStateInactive = "inactive"
+)
+
+// ChannelScheduleWindow 星期与时间段，End 小于 Start 时表示跨越零点
+type ChannelScheduleWindow struct {
+	Weekdays []int  `json:"weekdays,omitempty"` // 0 为周日，为空表示每天
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+}
+
+type ChannelSchedule struct {
+	Timezone        string                  `json:"timezone,omitempty"` // 为空时使用服务器时区
+	Windows         []ChannelScheduleWindow `json:"windows"`
+	OutsideAction   string                  `json:"outside_action,omitempty"`
+	OutsidePriority int64                   `json:"outside_priority,omitempty"`
+}
+
+// location 返回时间窗口使用的时区，为空时使用服务器时区
+func (s *ChannelSchedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(s.Timezone)
+}
+
+func parseScheduleMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule time %s", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *ChannelSchedule) Validate() error {
+	if len(s.Windows) == 0 {
+		return errors.New("schedule windows are required")
+	}
+
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("invalid schedule timezone %s", s.Timezone)
+	}
+
+	switch s.OutsideAction {
+	case "", ScheduleOutsideExclude, ScheduleOutsidePriority:
+	default:
+		return fmt.Errorf("invalid schedule outside action %s", s.OutsideAction)
+	}
+
+	for _, window := range s.Windows {
+		if _, err := parseScheduleMinutes(window.Start); err != nil {
+			return err
+		}
+		if _, err := parseScheduleMinutes(window.End); err != nil {
+			return err
+		}
+		for _, weekday := range window.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("invalid schedule weekday %d", weekday)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *ChannelScheduleWindow) matchWeekday(weekday time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+
+	for _, day := range w.Weekdays {
+		if time.Weekday(day) == weekday {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsActive 判断指定时间是否在任一时间窗口内
+func (s *ChannelSchedule) IsActive(now time.Time) bool {
+	location, err := s.location()
+	if err != nil {
+		return true
+	}
+
+	now = now.In(location)
+	minutes := now.Hour()*60 + now.Minute()
+	for _, window := range s.Windows {
+		start, err := parseScheduleMinutes(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseScheduleMinutes(window.End)
+		if err != nil {
+			continue
+		}
+
+		if start <= end {
+			if minutes >= start && minutes < end && window.matchWeekday(now.Weekday()) {
+				return true
+			}
+			continue
+		}
+
+		// 跨越零点的时间段，零点之后的部分属于前一天的窗口
+		if minutes >= start && window.matchWeekday(now.Weekday()) {
+			return true
+		}
+		if minutes < end && window.matchWeekday(now.AddDate(0, 0, -1).Weekday()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (channel *Channel) GetSchedule() *ChannelSchedule {
+	if channel.Schedule == nil {
+		return nil
+	}
+
+	schedule := channel.Schedule.Data()
+	if len(schedule.Windows) == 0 {
+		return nil
+	}
+
+	return &schedule
+}
+
+// GetScheduleState 返回渠道当前的时间窗口状态，未设置时间窗口时为空
+func (channel *Channel) GetScheduleState(now time.Time) string {
+	schedule := channel.GetSchedule()
+	if schedule == nil {
+		return ""
+	}
+
+	if schedule.IsActive(now) {
+		return ScheduleStateActive
+	}
+
+	return ScheduleStateInactive
+}
+
+// ApplySchedules 由定时任务调用，有渠道进入或离开时间窗口时重新加载渠道
+func (cc *ChannelsChooser) ApplySchedules() {
+	now := time.Now()
+	changed := false
+
+	cc.RLock()
+	for channelId, schedule := range cc.Schedules {
+		active := schedule.IsActive(now)
+		if active == cc.ScheduleActive[channelId] {
+			continue
+		}
+
+		changed = true
+		logger.SysLog(fmt.Sprintf("channel_schedule_transition channel_id=%d active=%t outside_action=%s", channelId, active, schedule.OutsideAction))
+	}
+	cc.RUnlock()
+
+	if changed {
+		cc.Load()
+	}
+}
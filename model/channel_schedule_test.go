@@ -0,0 +1,96 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"done-hub/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelScheduleIsActive(t *testing.T) {
+	// 2024-01-01 为周一
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	weekdays := []int{1, 2, 3, 4, 5}
+
+	cases := []struct {
+		name   string
+		window model.ChannelScheduleWindow
+		now    time.Time
+		active bool
+	}{
+		{"inside", model.ChannelScheduleWindow{Start: "09:00", End: "18:00"}, at(1, 12, 0), true},
+		{"at start", model.ChannelScheduleWindow{Start: "09:00", End: "18:00"}, at(1, 9, 0), true},
+		{"at end", model.ChannelScheduleWindow{Start: "09:00", End: "18:00"}, at(1, 18, 0), false},
+		{"before start", model.ChannelScheduleWindow{Start: "09:00", End: "18:00"}, at(1, 8, 59), false},
+		{"weekday match", model.ChannelScheduleWindow{Weekdays: weekdays, Start: "09:00", End: "18:00"}, at(5, 12, 0), true},
+		{"weekend", model.ChannelScheduleWindow{Weekdays: weekdays, Start: "09:00", End: "18:00"}, at(6, 12, 0), false},
+		{"overnight before midnight", model.ChannelScheduleWindow{Start: "22:00", End: "06:00"}, at(1, 23, 0), true},
+		{"overnight after midnight", model.ChannelScheduleWindow{Start: "22:00", End: "06:00"}, at(2, 5, 59), true},
+		{"overnight at end", model.ChannelScheduleWindow{Start: "22:00", End: "06:00"}, at(2, 6, 0), false},
+		{"overnight midday", model.ChannelScheduleWindow{Start: "22:00", End: "06:00"}, at(2, 12, 0), false},
+		// 零点之后的部分属于前一天的窗口：周五晚上开始的窗口延续到周六早上
+		{"overnight friday into saturday", model.ChannelScheduleWindow{Weekdays: weekdays, Start: "22:00", End: "06:00"}, at(6, 3, 0), true},
+		{"overnight saturday night", model.ChannelScheduleWindow{Weekdays: weekdays, Start: "22:00", End: "06:00"}, at(6, 23, 0), false},
+		{"overnight sunday into monday", model.ChannelScheduleWindow{Weekdays: weekdays, Start: "22:00", End: "06:00"}, at(1, 3, 0), false},
+		{"overnight monday night", model.ChannelScheduleWindow{Weekdays: weekdays, Start: "22:00", End: "06:00"}, at(1, 22, 0), true},
+		{"sunday to monday wrap", model.ChannelScheduleWindow{Weekdays: []int{0}, Start: "20:00", End: "02:00"}, at(8, 1, 0), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			schedule := &model.ChannelSchedule{
+				Timezone: "UTC",
+				Windows:  []model.ChannelScheduleWindow{c.window},
+			}
+			assert.Equal(t, c.active, schedule.IsActive(c.now))
+		})
+	}
+}
+
+func TestChannelScheduleTimezone(t *testing.T) {
+	schedule := &model.ChannelSchedule{
+		Timezone: "Asia/Shanghai",
+		Windows:  []model.ChannelScheduleWindow{{Weekdays: []int{1}, Start: "00:00", End: "08:00"}},
+	}
+
+	// UTC 周日 20:00 为上海时间周一 04:00
+	assert.True(t, schedule.IsActive(time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.IsActive(time.Date(2024, 1, 8, 20, 0, 0, 0, time.UTC)))
+
+	// 未设置时区时使用服务器时区
+	local := time.Local
+	time.Local = time.FixedZone("UTC+8", 8*3600)
+	defer func() { time.Local = local }()
+	schedule.Timezone = ""
+	assert.True(t, schedule.IsActive(time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC)))
+}
+
+func TestChannelScheduleValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		schedule model.ChannelSchedule
+		valid    bool
+	}{
+		{"valid", model.ChannelSchedule{Windows: []model.ChannelScheduleWindow{{Weekdays: []int{0, 6}, Start: "22:00", End: "06:00"}}}, true},
+		{"no windows", model.ChannelSchedule{}, false},
+		{"invalid timezone", model.ChannelSchedule{Timezone: "Mars/Base", Windows: []model.ChannelScheduleWindow{{Start: "00:00", End: "01:00"}}}, false},
+		{"invalid time", model.ChannelSchedule{Windows: []model.ChannelScheduleWindow{{Start: "24:00", End: "01:00"}}}, false},
+		{"invalid weekday", model.ChannelSchedule{Windows: []model.ChannelScheduleWindow{{Weekdays: []int{7}, Start: "00:00", End: "01:00"}}}, false},
+		{"invalid outside action", model.ChannelSchedule{OutsideAction: "drop", Windows: []model.ChannelScheduleWindow{{Start: "00:00", End: "01:00"}}}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.schedule.Validate()
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
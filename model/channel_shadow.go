@@ -0,0 +1,214 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ShadowRule 按比例将命中的请求异步复制到影子渠道，客户端只会收到主渠道的响应
+type ShadowRule struct {
+	Model      string  `json:"model"` // 为空匹配所有模型
+	Group      string  `json:"group"` // 为空匹配所有分组
+	ChannelId  int     `json:"channel_id"`
+	Percent    float64 `json:"percent"`    // 复制的请求比例 0-100
+	Similarity bool    `json:"similarity"` // 是否计算与主渠道响应的相似度
+}
+
+func (r *ShadowRule) Validate() error {
+	if r.ChannelId <= 0 {
+		return errors.New("影子渠道不能为空")
+	}
+	if r.Percent <= 0 || r.Percent > 100 {
+		return errors.New("复制比例必须在 0-100 之间")
+	}
+
+	return nil
+}
+
+func (r *ShadowRule) match(group, modelName string) bool {
+	return (r.Model == "" || r.Model == modelName) && (r.Group == "" || r.Group == group)
+}
+
+type ShadowTrafficManager struct {
+	sync.RWMutex
+	rules []*ShadowRule
+}
+
+var ShadowTraffic = &ShadowTrafficManager{}
+
+func (m *ShadowTrafficManager) SetRules(value string) error {
+	rules := make([]*ShadowRule, 0)
+	if strings.TrimSpace(value) != "" {
+		if err := json.Unmarshal([]byte(value), &rules); err != nil {
+			return err
+		}
+	}
+
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+
+	m.Lock()
+	m.rules = rules
+	m.Unlock()
+
+	return nil
+}
+
+// Pick 返回第一条匹配的规则，并按比例决定本次请求是否复制，不复制时返回 nil
+func (m *ShadowTrafficManager) Pick(group, modelName string) *ShadowRule {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, rule := range m.rules {
+		if !rule.match(group, modelName) {
+			continue
+		}
+		if rand.Float64()*100 >= rule.Percent {
+			return nil
+		}
+		return rule
+	}
+
+	return nil
+}
+
+// ShadowResult 一次影子请求与主请求的对比，影子请求的额度只做记录，不向用户计费
+type ShadowResult struct {
+	Id                      int      `json:"id"`
+	CreatedAt               int64    `json:"created_at" gorm:"bigint;index"`
+	Model                   string   `json:"model" gorm:"type:varchar(255);index"`
+	TokenGroup              string   `json:"group" gorm:"type:varchar(50)"`
+	IsStream                bool     `json:"is_stream"`
+	PrimaryChannelId        int      `json:"primary_channel_id"`
+	PrimaryLatency          int64    `json:"primary_latency"`
+	PrimaryFirstResponse    int64    `json:"primary_first_response"`
+	PrimaryPromptTokens     int      `json:"primary_prompt_tokens"`
+	PrimaryCompletionTokens int      `json:"primary_completion_tokens"`
+	PrimaryQuota            int      `json:"primary_quota"`
+	ShadowChannelId         int      `json:"shadow_channel_id" gorm:"index"`
+	ShadowLatency           int64    `json:"shadow_latency"`
+	ShadowFirstResponse     int64    `json:"shadow_first_response"`
+	ShadowStatusCode        int      `json:"shadow_status_code"`
+	ShadowError             string   `json:"shadow_error" gorm:"type:text"`
+	ShadowPromptTokens      int      `json:"shadow_prompt_tokens"`
+	ShadowCompletionTokens  int      `json:"shadow_completion_tokens"`
+	ShadowQuota             int      `json:"shadow_quota"`
+	ShadowUpstreamCost      int      `json:"shadow_upstream_cost"`
+	Similarity              *float64 `json:"similarity"`
+}
+
+func RecordShadowResult(result *ShadowResult) {
+	result.CreatedAt = time.Now().Unix()
+	if err := DB.Create(result).Error; err != nil {
+		logger.SysError("failed to record shadow result: " + err.Error())
+	}
+}
+
+type ShadowResultQuery struct {
+	PaginationParams
+	Model           string `form:"model"`
+	ShadowChannelId int    `form:"shadow_channel_id"`
+	StartTime       int64  `form:"start_time"`
+	EndTime         int64  `form:"end_time"`
+}
+
+var allowedShadowResultOrderFields = map[string]bool{
+	"id":             true,
+	"created_at":     true,
+	"shadow_latency": true,
+	"similarity":     true,
+}
+
+func (query *ShadowResultQuery) apply() *gorm.DB {
+	db := DB.Model(&ShadowResult{})
+	if query.Model != "" {
+		db = db.Where("model = ?", query.Model)
+	}
+	if query.ShadowChannelId > 0 {
+		db = db.Where("shadow_channel_id = ?", query.ShadowChannelId)
+	}
+	if query.StartTime > 0 {
+		db = db.Where("created_at >= ?", query.StartTime)
+	}
+	if query.EndTime > 0 {
+		db = db.Where("created_at < ?", query.EndTime)
+	}
+
+	return db
+}
+
+func GetShadowResults(query *ShadowResultQuery) (*DataResult[ShadowResult], error) {
+	var results []*ShadowResult
+	return PaginateAndOrder(query.apply(), &query.PaginationParams, &results, allowedShadowResultOrderFields)
+}
+
+// ShadowSummary 按影子渠道与模型汇总的对比结果
+type ShadowSummary struct {
+	ShadowChannelId         int      `json:"shadow_channel_id"`
+	Model                   string   `json:"model"`
+	Count                   int64    `json:"count"`
+	ErrorCount              int64    `json:"error_count"`
+	PrimaryLatency          float64  `json:"primary_latency"`
+	ShadowLatency           float64  `json:"shadow_latency"`
+	PrimaryPromptTokens     int64    `json:"primary_prompt_tokens"`
+	PrimaryCompletionTokens int64    `json:"primary_completion_tokens"`
+	ShadowPromptTokens      int64    `json:"shadow_prompt_tokens"`
+	ShadowCompletionTokens  int64    `json:"shadow_completion_tokens"`
+	PrimaryQuota            int64    `json:"primary_quota"`
+	ShadowQuota             int64    `json:"shadow_quota"`
+	ShadowUpstreamCost      int64    `json:"shadow_upstream_cost"`
+	Similarity              *float64 `json:"similarity"`
+}
+
+// GetShadowSummary 延迟只统计影子请求成功的记录，相似度为计算过的记录的平均值
+func GetShadowSummary(query *ShadowResultQuery) ([]*ShadowSummary, error) {
+	var summaries []*ShadowSummary
+	err := query.apply().
+		Select(`shadow_channel_id, model, COUNT(*) AS count,
+			SUM(CASE WHEN shadow_error <> '' THEN 1 ELSE 0 END) AS error_count,
+			COALESCE(AVG(CASE WHEN shadow_error = '' THEN primary_latency END), 0) AS primary_latency,
+			COALESCE(AVG(CASE WHEN shadow_error = '' THEN shadow_latency END), 0) AS shadow_latency,
+			SUM(primary_prompt_tokens) AS primary_prompt_tokens,
+			SUM(primary_completion_tokens) AS primary_completion_tokens,
+			SUM(shadow_prompt_tokens) AS shadow_prompt_tokens,
+			SUM(shadow_completion_tokens) AS shadow_completion_tokens,
+			SUM(primary_quota) AS primary_quota,
+			SUM(shadow_quota) AS shadow_quota,
+			SUM(shadow_upstream_cost) AS shadow_upstream_cost,
+			AVG(similarity) AS similarity`).
+		Group("shadow_channel_id, model").
+		Order("shadow_channel_id, model").
+		Scan(&summaries).Error
+
+	return summaries, err
+}
+
+// DeleteOldShadowResults 清理超过保留天数的影子请求记录
+func DeleteOldShadowResults() {
+	if config.ShadowResultRetentionDays <= 0 {
+		return
+	}
+
+	before := time.Now().AddDate(0, 0, -config.ShadowResultRetentionDays).Unix()
+	result := DB.Where("created_at < ?", before).Delete(&ShadowResult{})
+	if result.Error != nil {
+		logger.SysError("failed to delete shadow results: " + result.Error.Error())
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logger.SysLog(fmt.Sprintf("shadow_results_cleanup deleted=%d", result.RowsAffected))
+	}
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/common/logger"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestShadowTrafficSetRules(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"empty", "", true},
+		{"valid", `[{"model":"gpt-4o","channel_id":1,"percent":10}]`, true},
+		{"invalid json", `[{"model":}]`, false},
+		{"missing channel", `[{"model":"gpt-4o","percent":10}]`, false},
+		{"zero percent", `[{"channel_id":1,"percent":0}]`, false},
+		{"percent over 100", `[{"channel_id":1,"percent":101}]`, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := &ShadowTrafficManager{}
+			err := manager.SetRules(c.value)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestShadowTrafficPick(t *testing.T) {
+	manager := &ShadowTrafficManager{}
+	assert.NoError(t, manager.SetRules(`[
+		{"model":"gpt-4o","group":"vip","channel_id":1,"percent":100},
+		{"model":"gpt-4o","channel_id":2,"percent":100},
+		{"model":"o3","channel_id":3,"percent":0.001}
+	]`))
+
+	assert.Equal(t, 1, manager.Pick("vip", "gpt-4o").ChannelId)
+	assert.Equal(t, 2, manager.Pick("default", "gpt-4o").ChannelId)
+	assert.Nil(t, manager.Pick("default", "gpt-4o-mini"))
+
+	// 只使用第一条匹配的规则，未命中比例时不再匹配后续规则
+	picked := 0
+	for i := 0; i < 1000; i++ {
+		if manager.Pick("default", "o3") != nil {
+			picked++
+		}
+	}
+	assert.Less(t, picked, 10)
+}
+
+func TestShadowResults(t *testing.T) {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+	db := setupTestDB(t, &ShadowResult{})
+
+	similarity := 0.8
+	RecordShadowResult(&ShadowResult{Model: "gpt-4o", ShadowChannelId: 2, PrimaryLatency: 100, ShadowLatency: 200, ShadowQuota: 10, Similarity: &similarity})
+	RecordShadowResult(&ShadowResult{Model: "gpt-4o", ShadowChannelId: 2, PrimaryLatency: 300, ShadowLatency: 400, ShadowQuota: 20})
+	RecordShadowResult(&ShadowResult{Model: "gpt-4o", ShadowChannelId: 2, PrimaryLatency: 500, ShadowLatency: 5000, ShadowError: "timeout"})
+	RecordShadowResult(&ShadowResult{Model: "o3", ShadowChannelId: 3, PrimaryLatency: 100, ShadowLatency: 100})
+
+	summaries, err := GetShadowSummary(&ShadowResultQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 2)
+
+	summary := summaries[0]
+	assert.Equal(t, 2, summary.ShadowChannelId)
+	assert.Equal(t, int64(3), summary.Count)
+	assert.Equal(t, int64(1), summary.ErrorCount)
+	// 延迟只统计影子请求成功的记录
+	assert.Equal(t, float64(200), summary.PrimaryLatency)
+	assert.Equal(t, float64(300), summary.ShadowLatency)
+	assert.Equal(t, int64(30), summary.ShadowQuota)
+	assert.Equal(t, &similarity, summary.Similarity)
+	assert.Nil(t, summaries[1].Similarity)
+
+	summaries, err = GetShadowSummary(&ShadowResultQuery{Model: "o3"})
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 1)
+
+	// 清理超过保留天数的记录
+	retentionDays := config.ShadowResultRetentionDays
+	config.ShadowResultRetentionDays = 7
+	defer func() { config.ShadowResultRetentionDays = retentionDays }()
+
+	assert.NoError(t, db.Model(&ShadowResult{}).Where("model = ?", "o3").Update("created_at", time.Now().AddDate(0, 0, -8).Unix()).Error)
+	DeleteOldShadowResults()
+
+	var count int64
+	db.Model(&ShadowResult{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// RoutingStrategyWeight 仅按渠道配置的权重选择
+	RoutingStrategyWeight = "weight"
+	// RoutingStrategyAdaptive 按延迟和错误率动态调整权重
+	RoutingStrategyAdaptive = "adaptive"
+)
+
+const (
+	channelStatsAlpha      = 0.2 // EWMA 平滑系数
+	channelStatsMinSamples = 5   // 样本数不足时不调整权重
+	latencyFactorMin       = 0.2
+	latencyFactorMax       = 5.0
+	errorFactorMin         = 0.05
+)
+
+// ChannelStat 渠道+模型维度的 EWMA 统计
+type ChannelStat struct {
+	FirstResponseMs float64 `json:"first_response_ms"`
+	LatencyMs       float64 `json:"latency_ms"`
+	ErrorRate       float64 `json:"error_rate"`
+	CacheHitRate    float64 `json:"cache_hit_rate"` // 输入 tokens 中命中上游提示词缓存的比例
+	CacheSamples    int64   `json:"cache_samples"`
+	Samples         int64   `json:"samples"`
+	UpdatedAt       int64   `json:"updated_at"`
+}
+
+type ChannelStatsStore struct {
+	sync.RWMutex
+	stats map[string]*ChannelStat
+}
+
+var ChannelStats = ChannelStatsStore{
+	stats: make(map[string]*ChannelStat),
+}
+
+func channelStatKey(channelId int, modelName string) string {
+	return fmt.Sprintf("%d:%s", channelId, modelName)
+}
+
+func ewma(current, sample float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return channelStatsAlpha*sample + (1-channelStatsAlpha)*current
+}
+
+// Record 记录一次请求结果，firstResponse 为 0 时不更新首字时间
+func (s *ChannelStatsStore) Record(channelId int, modelName string, firstResponse, latency time.Duration, success bool) {
+	if channelId == 0 || modelName == "" {
+		return
+	}
+
+	key := channelStatKey(channelId, modelName)
+
+	s.Lock()
+	defer s.Unlock()
+
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &ChannelStat{}
+		s.stats[key] = stat
+	}
+
+	first := stat.Samples == 0
+	errorSample := 0.0
+	if !success {
+		errorSample = 1
+	}
+	stat.ErrorRate = ewma(stat.ErrorRate, errorSample, first)
+
+	// 失败请求的耗时不能代表渠道的正常延迟
+	if success {
+		stat.LatencyMs = ewma(stat.LatencyMs, float64(latency.Milliseconds()), stat.LatencyMs == 0)
+		if firstResponse > 0 {
+			stat.FirstResponseMs = ewma(stat.FirstResponseMs, float64(firstResponse.Milliseconds()), stat.FirstResponseMs == 0)
+		}
+	}
+
+	stat.Samples++
+	stat.UpdatedAt = time.Now().Unix()
+}
+
+// RecordCacheUsage 记录上游提示词缓存命中的 tokens
+func (s *ChannelStatsStore) RecordCacheUsage(channelId int, modelName string, promptTokens, cachedTokens int) {
+	if channelId == 0 || modelName == "" || promptTokens <= 0 {
+		return
+	}
+
+	key := channelStatKey(channelId, modelName)
+
+	s.Lock()
+	defer s.Unlock()
+
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &ChannelStat{}
+		s.stats[key] = stat
+	}
+
+	hitRate := clampFloat(float64(cachedTokens)/float64(promptTokens), 0, 1)
+	stat.CacheHitRate = ewma(stat.CacheHitRate, hitRate, stat.CacheSamples == 0)
+	stat.CacheSamples++
+}
+
+func (s *ChannelStatsStore) Get(channelId int, modelName string) *ChannelStat {
+	s.RLock()
+	defer s.RUnlock()
+
+	stat, ok := s.stats[channelStatKey(channelId, modelName)]
+	if !ok {
+		return nil
+	}
+
+	statCopy := *stat
+	return &statCopy
+}
+
+// latencyScore 优先使用首字时间，没有时使用总耗时
+func (stat *ChannelStat) latencyScore() float64 {
+	if stat.FirstResponseMs > 0 {
+		return stat.FirstResponseMs
+	}
+	return stat.LatencyMs
+}
+
+// EffectiveWeights 根据同一优先级内各渠道的统计计算有效权重
+// 延迟以同级渠道的平均值为基准，样本不足的渠道保持原权重
+func (s *ChannelStatsStore) EffectiveWeights(choices []*ChannelChoice, modelName string) []float64 {
+	weights := make([]float64, len(choices))
+	stats := make([]*ChannelStat, len(choices))
+
+	totalLatency := 0.0
+	latencyCount := 0
+	for i, choice := range choices {
+		weights[i] = float64(*choice.Channel.Weight)
+		if config.ChannelRoutingStrategy != RoutingStrategyAdaptive {
+			continue
+		}
+
+		stat := s.Get(choice.Channel.Id, modelName)
+		if stat == nil || stat.Samples < channelStatsMinSamples {
+			continue
+		}
+		stats[i] = stat
+
+		if score := stat.latencyScore(); score > 0 {
+			totalLatency += score
+			latencyCount++
+		}
+	}
+
+	avgLatency := 0.0
+	if latencyCount > 0 {
+		avgLatency = totalLatency / float64(latencyCount)
+	}
+
+	for i, stat := range stats {
+		if stat == nil {
+			continue
+		}
+
+		factor := 1.0
+		if score := stat.latencyScore(); score > 0 && avgLatency > 0 {
+			factor = clampFloat(avgLatency/score, latencyFactorMin, latencyFactorMax)
+		}
+
+		successRate := 1 - stat.ErrorRate
+		factor *= clampFloat(successRate*successRate, errorFactorMin, 1)
+
+		weights[i] *= factor
+	}
+
+	return weights
+}
+
+func clampFloat(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+type ChannelEffectiveWeight struct {
+	ChannelId       int          `json:"channel_id"`
+	ChannelName     string       `json:"channel_name"`
+	Priority        int64        `json:"priority"`
+	Weight          uint         `json:"weight"`
+	EffectiveWeight float64      `json:"effective_weight"`
+	InCooldown      bool         `json:"in_cooldown"`
+	Stat            *ChannelStat `json:"stat"`
+}
+
+// GetEffectiveWeights 返回分组下某个模型各渠道当前的有效权重
+func (cc *ChannelsChooser) GetEffectiveWeights(group, modelName string) ([]*ChannelEffectiveWeight, error) {
+	cc.RLock()
+	defer cc.RUnlock()
+
+	if _, ok := cc.Rule[group]; !ok {
+		return nil, errors.New(ErrGroupNotFound)
+	}
+
+	channelsPriority, ok := cc.Rule[group][modelName]
+	if !ok {
+		return nil, errors.New(ErrModelNotFoundInGroup)
+	}
+
+	result := make([]*ChannelEffectiveWeight, 0)
+	for _, priority := range channelsPriority {
+		choices := make([]*ChannelChoice, 0, len(priority))
+		for _, channelId := range priority {
+			if choice, ok := cc.Channels[channelId]; ok && !choice.Disable {
+				choices = append(choices, choice)
+			}
+		}
+
+		weights := ChannelStats.EffectiveWeights(choices, modelName)
+		for i, choice := range choices {
+			result = append(result, &ChannelEffectiveWeight{
+				ChannelId:       choice.Channel.Id,
+				ChannelName:     choice.Channel.Name,
+				Priority:        *choice.Channel.Priority,
+				Weight:          *choice.Channel.Weight,
+				EffectiveWeight: weights[i],
+				InCooldown:      cc.IsInCooldown(choice.Channel.Id, modelName),
+				Stat:            ChannelStats.Get(choice.Channel.Id, modelName),
+			})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStatsTestChoice(channelId int, weight uint) *ChannelChoice {
+	return &ChannelChoice{Channel: &Channel{Id: channelId, Weight: &weight}}
+}
+
+func TestChannelStatsRecord(t *testing.T) {
+	store := ChannelStatsStore{stats: make(map[string]*ChannelStat)}
+
+	store.Record(1, "gpt-4o", 100*time.Millisecond, 1000*time.Millisecond, true)
+	stat := store.Get(1, "gpt-4o")
+	assert.Equal(t, float64(100), stat.FirstResponseMs)
+	assert.Equal(t, float64(1000), stat.LatencyMs)
+	assert.Zero(t, stat.ErrorRate)
+
+	// 失败请求只更新错误率
+	store.Record(1, "gpt-4o", 0, 5000*time.Millisecond, false)
+	stat = store.Get(1, "gpt-4o")
+	assert.Equal(t, float64(1000), stat.LatencyMs)
+	assert.InDelta(t, channelStatsAlpha, stat.ErrorRate, 1e-9)
+
+	// 首字时间为 0 时保留原值
+	store.Record(1, "gpt-4o", 0, 2000*time.Millisecond, true)
+	stat = store.Get(1, "gpt-4o")
+	assert.Equal(t, float64(100), stat.FirstResponseMs)
+	assert.InDelta(t, 1200, stat.LatencyMs, 1e-9)
+	assert.Equal(t, int64(3), stat.Samples)
+
+	// 无效的渠道或模型不记录
+	store.Record(0, "gpt-4o", 0, time.Second, true)
+	store.Record(2, "", 0, time.Second, true)
+	assert.Nil(t, store.Get(0, "gpt-4o"))
+	assert.Nil(t, store.Get(2, ""))
+
+	// 返回的是副本
+	stat.Samples = 100
+	assert.Equal(t, int64(3), store.Get(1, "gpt-4o").Samples)
+}
+
+func TestChannelStatsRecordCacheUsage(t *testing.T) {
+	store := ChannelStatsStore{stats: make(map[string]*ChannelStat)}
+
+	store.RecordCacheUsage(1, "gpt-4o", 100, 50)
+	assert.Equal(t, 0.5, store.Get(1, "gpt-4o").CacheHitRate)
+
+	store.RecordCacheUsage(1, "gpt-4o", 100, 200)
+	stat := store.Get(1, "gpt-4o")
+	assert.InDelta(t, 0.6, stat.CacheHitRate, 1e-9)
+	assert.Equal(t, int64(2), stat.CacheSamples)
+	assert.Zero(t, stat.Samples)
+
+	store.RecordCacheUsage(2, "gpt-4o", 0, 0)
+	assert.Nil(t, store.Get(2, "gpt-4o"))
+}
+
+func TestEffectiveWeights(t *testing.T) {
+	strategy := config.ChannelRoutingStrategy
+	defer func() { config.ChannelRoutingStrategy = strategy }()
+
+	type sample struct {
+		channelId     int
+		firstResponse time.Duration
+		latency       time.Duration
+		success       bool
+		count         int
+	}
+
+	cases := []struct {
+		name     string
+		strategy string
+		samples  []sample
+		weights  []float64
+	}{
+		{
+			name:     "weight strategy ignores stats",
+			strategy: RoutingStrategyWeight,
+			samples:  []sample{{channelId: 1, latency: time.Second, success: true, count: 10}},
+			weights:  []float64{10, 10},
+		},
+		{
+			name:     "no stats keeps weights",
+			strategy: RoutingStrategyAdaptive,
+			weights:  []float64{10, 10},
+		},
+		{
+			name:     "not enough samples",
+			strategy: RoutingStrategyAdaptive,
+			samples: []sample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: true, count: channelStatsMinSamples - 1},
+				{channelId: 2, latency: 300 * time.Millisecond, success: true, count: channelStatsMinSamples - 1},
+			},
+			weights: []float64{10, 10},
+		},
+		{
+			name:     "faster channel gets more weight",
+			strategy: RoutingStrategyAdaptive,
+			samples: []sample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: true, count: 5},
+				{channelId: 2, latency: 300 * time.Millisecond, success: true, count: 5},
+			},
+			weights: []float64{20, 10.0 * 200 / 300},
+		},
+		{
+			name:     "first response preferred over latency",
+			strategy: RoutingStrategyAdaptive,
+			samples: []sample{
+				{channelId: 1, firstResponse: 100 * time.Millisecond, latency: 900 * time.Millisecond, success: true, count: 5},
+				{channelId: 2, firstResponse: 100 * time.Millisecond, latency: 100 * time.Millisecond, success: true, count: 5},
+			},
+			weights: []float64{10, 10},
+		},
+		{
+			name:     "latency factor is clamped",
+			strategy: RoutingStrategyAdaptive,
+			samples: []sample{
+				{channelId: 1, latency: 10 * time.Millisecond, success: true, count: 5},
+				{channelId: 2, latency: 10000 * time.Millisecond, success: true, count: 5},
+			},
+			weights: []float64{10 * latencyFactorMax, 10.0 * 5005 / 10000},
+		},
+		{
+			name:     "errors reduce weight",
+			strategy: RoutingStrategyAdaptive,
+			samples: []sample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: false, count: 5},
+				{channelId: 2, latency: 100 * time.Millisecond, success: true, count: 5},
+			},
+			weights: []float64{10 * errorFactorMin, 10},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.ChannelRoutingStrategy = c.strategy
+			store := ChannelStatsStore{stats: make(map[string]*ChannelStat)}
+			for _, s := range c.samples {
+				for i := 0; i < s.count; i++ {
+					store.Record(s.channelId, "gpt-4o", s.firstResponse, s.latency, s.success)
+				}
+			}
+
+			choices := []*ChannelChoice{newStatsTestChoice(1, 10), newStatsTestChoice(2, 10)}
+			weights := store.EffectiveWeights(choices, "gpt-4o")
+			assert.Len(t, weights, len(c.weights))
+			for i := range weights {
+				assert.InDelta(t, c.weights[i], weights[i], 1e-9)
+			}
+		})
+	}
+}
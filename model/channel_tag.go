@@ -111,6 +111,9 @@ func UpdateChannelsTag(tag string, channel *Channel) error {
 	// 先处理要删除的数据
 	if len(delIds) > 0 {
 		err = tx.Where("id IN (?)", delIds).Delete(&Channel{}).Error
+		if err == nil {
+			err = tx.Where("channel_id IN (?)", delIds).Delete(&ChannelKey{}).Error
+		}
 		if err != nil {
 			tx.Rollback()
 			return err
@@ -168,7 +171,7 @@ func UpdateChannelsTag(tag string, channel *Channel) error {
 
 	tx.Commit()
 
-	ChannelGroup.Load()
+	ChannelGroup.Reload()
 
 	return err
 }
@@ -191,7 +194,8 @@ func DeleteChannelsTag(tag string, delDisabled bool) error {
 	}
 
 	tx.Commit()
-	ChannelGroup.Load()
+	err = deleteOrphanChannelKeys(DB)
+	ChannelGroup.Reload()
 
 	return err
 }
@@ -206,7 +210,7 @@ func ChangeChannelsTagStatus(tag string, status int) error {
 		return err
 	}
 
-	ChannelGroup.Load()
+	ChannelGroup.Reload()
 
 	return nil
 }
@@ -217,6 +221,6 @@ func UpdateChannelsTagPriority(tag string, value int) error {
 		return err
 	}
 
-	ChannelGroup.Load()
+	ChannelGroup.Reload()
 	return nil
 }
@@ -0,0 +1,380 @@
+package model
+
+import (
+	"context"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/redis"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+const (
+	circuitBreakerKey        = "circuit_breaker:%d:%s"
+	circuitBreakerModelsKey  = "circuit_breaker:models:%d"
+	circuitBreakerExpiration = 24 * time.Hour
+	circuitBreakerMaxRetries = 5
+)
+
+// CircuitBreakerStatus 渠道+模型维度的熔断状态
+type CircuitBreakerStatus struct {
+	Model     string `json:"model"`
+	State     string `json:"state"`
+	Failures  int    `json:"failures"`
+	OpenedAt  int64  `json:"opened_at"`
+	Probes    int    `json:"probes"`    // 半开状态下正在进行的探测请求数
+	Successes int    `json:"successes"` // 半开状态下探测成功的次数
+	ProbeAt   int64  `json:"probe_at"`
+}
+
+func (s *CircuitBreakerStatus) openExpired(now int64) bool {
+	return now >= s.OpenedAt+int64(config.CircuitBreakerOpenSeconds)
+}
+
+// probeExpired 探测请求可能因本地错误等原因没有上报结果，超过熔断时长后视为失效
+func (s *CircuitBreakerStatus) probeExpired(now int64) bool {
+	return now >= s.ProbeAt+int64(config.CircuitBreakerOpenSeconds)
+}
+
+func (s *CircuitBreakerStatus) available(now int64) bool {
+	switch s.State {
+	case CircuitStateOpen:
+		return s.openExpired(now)
+	case CircuitStateHalfOpen:
+		return s.Probes < config.CircuitBreakerHalfOpenRequests || s.probeExpired(now)
+	default:
+		return true
+	}
+}
+
+func (s *CircuitBreakerStatus) acquire(now int64) bool {
+	switch s.State {
+	case CircuitStateOpen:
+		if !s.openExpired(now) {
+			return false
+		}
+		s.State = CircuitStateHalfOpen
+		s.Probes = 0
+		s.Successes = 0
+	case CircuitStateHalfOpen:
+		if s.probeExpired(now) {
+			s.Probes = 0
+		}
+		if s.Probes >= config.CircuitBreakerHalfOpenRequests {
+			return false
+		}
+	default:
+		return true
+	}
+
+	s.Probes++
+	s.ProbeAt = now
+	return true
+}
+
+func (s *CircuitBreakerStatus) report(success bool, now int64) {
+	switch s.State {
+	case CircuitStateOpen:
+		// 熔断前发出的请求，结果不再影响状态
+		return
+	case CircuitStateHalfOpen:
+		if s.Probes > 0 {
+			s.Probes--
+		}
+		if !success {
+			s.open(now)
+			return
+		}
+		s.Successes++
+		if s.Successes >= config.CircuitBreakerHalfOpenRequests {
+			s.reset()
+		}
+	default:
+		if success {
+			s.Failures = 0
+			return
+		}
+		s.Failures++
+		if s.Failures >= config.CircuitBreakerFailureThreshold {
+			s.open(now)
+		}
+	}
+}
+
+func (s *CircuitBreakerStatus) open(now int64) {
+	s.State = CircuitStateOpen
+	s.OpenedAt = now
+	s.Probes = 0
+	s.Successes = 0
+}
+
+func (s *CircuitBreakerStatus) reset() {
+	s.State = CircuitStateClosed
+	s.Failures = 0
+	s.OpenedAt = 0
+	s.Probes = 0
+	s.Successes = 0
+}
+
+func (s *CircuitBreakerStatus) isClosed() bool {
+	return s.State == CircuitStateClosed && s.Failures == 0
+}
+
+// CircuitBreakerManager 启用 Redis 时状态保存在 Redis 中，各节点共享，
+// statuses 此时作为本地副本，由状态变更事件同步
+type CircuitBreakerManager struct {
+	sync.Mutex
+	statuses map[int]map[string]*CircuitBreakerStatus
+}
+
+var CircuitBreaker = CircuitBreakerManager{
+	statuses: make(map[int]map[string]*CircuitBreakerStatus),
+}
+
+// IsAvailable 只读判断，用于渠道选择时过滤，开启 Redis 时读取本地副本
+func (cb *CircuitBreakerManager) IsAvailable(channelId int, modelName string) bool {
+	if !config.CircuitBreakerEnabled {
+		return true
+	}
+
+	status := cb.getLocal(channelId, modelName)
+	return status == nil || status.available(time.Now().Unix())
+}
+
+// Acquire 发送请求前调用，半开状态下占用一个探测名额
+func (cb *CircuitBreakerManager) Acquire(channelId int, modelName string) bool {
+	if !config.CircuitBreakerEnabled {
+		return true
+	}
+
+	// 关闭状态无需更新
+	if status := cb.get(channelId, modelName); status == nil || status.State == CircuitStateClosed {
+		return true
+	}
+
+	allowed := true
+	cb.update(channelId, modelName, func(status *CircuitBreakerStatus) {
+		allowed = status.acquire(time.Now().Unix())
+	})
+
+	return allowed
+}
+
+// Release 请求未到达上游时释放占用的探测名额
+func (cb *CircuitBreakerManager) Release(channelId int, modelName string) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+
+	if status := cb.get(channelId, modelName); status == nil || status.State != CircuitStateHalfOpen {
+		return
+	}
+
+	cb.update(channelId, modelName, func(status *CircuitBreakerStatus) {
+		if status.State == CircuitStateHalfOpen && status.Probes > 0 {
+			status.Probes--
+		}
+	})
+}
+
+// Report 上报请求结果
+func (cb *CircuitBreakerManager) Report(channelId int, modelName string, success bool) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+
+	if success {
+		if status := cb.get(channelId, modelName); status == nil || status.isClosed() {
+			return
+		}
+	}
+
+	cb.update(channelId, modelName, func(status *CircuitBreakerStatus) {
+		before := status.State
+		status.report(success, time.Now().Unix())
+		if before != status.State {
+			logger.SysLog(fmt.Sprintf("circuit_breaker_state_changed channel_id=%d model=\"%s\" from=%s to=%s", channelId, modelName, before, status.State))
+		}
+	})
+}
+
+// GetChannelStatuses 返回渠道下非正常关闭状态的熔断信息
+func (cb *CircuitBreakerManager) GetChannelStatuses(channelId int) []*CircuitBreakerStatus {
+	if !config.CircuitBreakerEnabled {
+		return nil
+	}
+
+	var statuses []*CircuitBreakerStatus
+	if config.RedisEnabled {
+		models, err := redis.GetRedisClient().SMembers(context.Background(), fmt.Sprintf(circuitBreakerModelsKey, channelId)).Result()
+		if err != nil {
+			return nil
+		}
+		for _, modelName := range models {
+			if status := cb.get(channelId, modelName); status != nil {
+				statuses = append(statuses, status)
+			}
+		}
+	} else {
+		cb.Lock()
+		for _, status := range cb.statuses[channelId] {
+			statusCopy := *status
+			statuses = append(statuses, &statusCopy)
+		}
+		cb.Unlock()
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Model < statuses[j].Model
+	})
+
+	return statuses
+}
+
+func (cb *CircuitBreakerManager) get(channelId int, modelName string) *CircuitBreakerStatus {
+	if config.RedisEnabled {
+		value, err := redis.RedisGet(fmt.Sprintf(circuitBreakerKey, channelId, modelName))
+		if err != nil {
+			return nil
+		}
+
+		status := &CircuitBreakerStatus{}
+		if err := json.Unmarshal([]byte(value), status); err != nil {
+			return nil
+		}
+		return status
+	}
+
+	return cb.getLocal(channelId, modelName)
+}
+
+func (cb *CircuitBreakerManager) getLocal(channelId int, modelName string) *CircuitBreakerStatus {
+	cb.Lock()
+	defer cb.Unlock()
+
+	status, ok := cb.statuses[channelId][modelName]
+	if !ok {
+		return nil
+	}
+
+	statusCopy := *status
+	return &statusCopy
+}
+
+// setLocal 保存 Redis 中状态的本地副本
+func (cb *CircuitBreakerManager) setLocal(channelId int, modelName string, status *CircuitBreakerStatus) {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if status.isClosed() {
+		delete(cb.statuses[channelId], modelName)
+		return
+	}
+
+	if _, ok := cb.statuses[channelId]; !ok {
+		cb.statuses[channelId] = make(map[string]*CircuitBreakerStatus)
+	}
+	cb.statuses[channelId][modelName] = status
+}
+
+func (cb *CircuitBreakerManager) update(channelId int, modelName string, fn func(status *CircuitBreakerStatus)) {
+	if config.RedisEnabled {
+		status, err := cb.updateRedis(channelId, modelName, fn)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("circuit_breaker_update_failed channel_id=%d model=\"%s\" error=\"%s\"", channelId, modelName, err.Error()))
+			return
+		}
+
+		cb.setLocal(channelId, modelName, status)
+		publishChannelEvent(&channelEvent{
+			Action:         ChannelEventCircuitBreaker,
+			ChannelId:      channelId,
+			Model:          modelName,
+			CircuitBreaker: status,
+		})
+		return
+	}
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	if _, ok := cb.statuses[channelId]; !ok {
+		cb.statuses[channelId] = make(map[string]*CircuitBreakerStatus)
+	}
+
+	status, ok := cb.statuses[channelId][modelName]
+	if !ok {
+		status = &CircuitBreakerStatus{Model: modelName, State: CircuitStateClosed}
+	}
+
+	fn(status)
+
+	if status.isClosed() {
+		delete(cb.statuses[channelId], modelName)
+		return
+	}
+	cb.statuses[channelId][modelName] = status
+}
+
+// updateRedis 使用 WATCH 保证多节点并发更新时状态一致
+func (cb *CircuitBreakerManager) updateRedis(channelId int, modelName string, fn func(status *CircuitBreakerStatus)) (*CircuitBreakerStatus, error) {
+	ctx := context.Background()
+	client := redis.GetRedisClient()
+	key := fmt.Sprintf(circuitBreakerKey, channelId, modelName)
+	modelsKey := fmt.Sprintf(circuitBreakerModelsKey, channelId)
+
+	var status *CircuitBreakerStatus
+	txf := func(tx *goredis.Tx) error {
+		status = &CircuitBreakerStatus{Model: modelName, State: CircuitStateClosed}
+		value, err := tx.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, goredis.Nil) {
+			return err
+		}
+		if value != "" {
+			if err := json.Unmarshal([]byte(value), status); err != nil {
+				return err
+			}
+		}
+
+		fn(status)
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			if status.isClosed() {
+				pipe.Del(ctx, key)
+				pipe.SRem(ctx, modelsKey, modelName)
+				return nil
+			}
+
+			data, err := json.Marshal(status)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, key, data, circuitBreakerExpiration)
+			pipe.SAdd(ctx, modelsKey, modelName)
+			pipe.Expire(ctx, modelsKey, circuitBreakerExpiration)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < circuitBreakerMaxRetries; i++ {
+		err := client.Watch(ctx, txf, key)
+		if !errors.Is(err, goredis.TxFailedErr) {
+			return status, err
+		}
+	}
+
+	return nil, errors.New("too many concurrent updates")
+}
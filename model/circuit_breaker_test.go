@@ -0,0 +1,152 @@
+package model
+
+import (
+	"testing"
+
+	"done-hub/common/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerStatus(t *testing.T) {
+	failureThreshold, openSeconds, halfOpenRequests := config.CircuitBreakerFailureThreshold, config.CircuitBreakerOpenSeconds, config.CircuitBreakerHalfOpenRequests
+	config.CircuitBreakerFailureThreshold = 3
+	config.CircuitBreakerOpenSeconds = 60
+	config.CircuitBreakerHalfOpenRequests = 2
+	defer func() {
+		config.CircuitBreakerFailureThreshold, config.CircuitBreakerOpenSeconds, config.CircuitBreakerHalfOpenRequests = failureThreshold, openSeconds, halfOpenRequests
+	}()
+
+	const now = int64(1000)
+
+	type step struct {
+		at      int64
+		acquire bool // true 时调用 acquire，否则调用 report
+		success bool
+		allowed bool // acquire 的返回值
+	}
+
+	cases := []struct {
+		name     string
+		steps    []step
+		state    string
+		failures int
+	}{
+		{
+			name:     "failures below threshold",
+			steps:    []step{{at: now}, {at: now}},
+			state:    CircuitStateClosed,
+			failures: 2,
+		},
+		{
+			name:  "success resets failures",
+			steps: []step{{at: now}, {at: now}, {at: now, success: true}},
+			state: CircuitStateClosed,
+		},
+		{
+			name:     "open after threshold",
+			steps:    []step{{at: now}, {at: now}, {at: now}},
+			state:    CircuitStateOpen,
+			failures: 3,
+		},
+		{
+			name:     "open rejects before timeout",
+			steps:    []step{{at: now}, {at: now}, {at: now}, {at: now + 59, acquire: true, allowed: false}},
+			state:    CircuitStateOpen,
+			failures: 3,
+		},
+		{
+			name:     "half open after timeout",
+			steps:    []step{{at: now}, {at: now}, {at: now}, {at: now + 60, acquire: true, allowed: true}},
+			state:    CircuitStateHalfOpen,
+			failures: 3,
+		},
+		{
+			name: "half open limits probes",
+			steps: []step{{at: now}, {at: now}, {at: now},
+				{at: now + 60, acquire: true, allowed: true},
+				{at: now + 60, acquire: true, allowed: true},
+				{at: now + 61, acquire: true, allowed: false}},
+			state:    CircuitStateHalfOpen,
+			failures: 3,
+		},
+		{
+			name: "expired probes are released",
+			steps: []step{{at: now}, {at: now}, {at: now},
+				{at: now + 60, acquire: true, allowed: true},
+				{at: now + 60, acquire: true, allowed: true},
+				{at: now + 120, acquire: true, allowed: true}},
+			state:    CircuitStateHalfOpen,
+			failures: 3,
+		},
+		{
+			name: "half open failure reopens",
+			steps: []step{{at: now}, {at: now}, {at: now},
+				{at: now + 60, acquire: true, allowed: true},
+				{at: now + 61},
+				{at: now + 62, acquire: true, allowed: false}},
+			state:    CircuitStateOpen,
+			failures: 3,
+		},
+		{
+			name: "half open successes close",
+			steps: []step{{at: now}, {at: now}, {at: now},
+				{at: now + 60, acquire: true, allowed: true},
+				{at: now + 61, success: true},
+				{at: now + 61, acquire: true, allowed: true},
+				{at: now + 62, success: true}},
+			state: CircuitStateClosed,
+		},
+		{
+			name:     "results while open are ignored",
+			steps:    []step{{at: now}, {at: now}, {at: now}, {at: now + 1, success: true}},
+			state:    CircuitStateOpen,
+			failures: 3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status := &CircuitBreakerStatus{State: CircuitStateClosed}
+			for i, s := range c.steps {
+				if s.acquire {
+					assert.Equal(t, s.allowed, status.acquire(s.at), "step %d", i)
+					continue
+				}
+				status.report(s.success, s.at)
+			}
+
+			assert.Equal(t, c.state, status.State)
+			assert.Equal(t, c.failures, status.Failures)
+		})
+	}
+}
+
+func TestCircuitBreakerStatusAvailable(t *testing.T) {
+	openSeconds, halfOpenRequests := config.CircuitBreakerOpenSeconds, config.CircuitBreakerHalfOpenRequests
+	config.CircuitBreakerOpenSeconds = 60
+	config.CircuitBreakerHalfOpenRequests = 1
+	defer func() {
+		config.CircuitBreakerOpenSeconds, config.CircuitBreakerHalfOpenRequests = openSeconds, halfOpenRequests
+	}()
+
+	cases := []struct {
+		name      string
+		status    CircuitBreakerStatus
+		now       int64
+		available bool
+	}{
+		{"closed", CircuitBreakerStatus{State: CircuitStateClosed, Failures: 2}, 0, true},
+		{"open", CircuitBreakerStatus{State: CircuitStateOpen, OpenedAt: 100}, 159, false},
+		{"open expired", CircuitBreakerStatus{State: CircuitStateOpen, OpenedAt: 100}, 160, true},
+		{"half open with free probe", CircuitBreakerStatus{State: CircuitStateHalfOpen}, 100, true},
+		{"half open probes in use", CircuitBreakerStatus{State: CircuitStateHalfOpen, Probes: 1, ProbeAt: 100}, 120, false},
+		{"half open probes expired", CircuitBreakerStatus{State: CircuitStateHalfOpen, Probes: 1, ProbeAt: 100}, 160, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.available, c.status.available(c.now))
+		})
+	}
+}
@@ -0,0 +1,617 @@
+package model
+
+import (
+	"bytes"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	ConfigSyncActionCreate = "create"
+	ConfigSyncActionUpdate = "update"
+	ConfigSyncActionDelete = "delete"
+)
+
+var configSyncEnvRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ConfigSyncFile 声明式配置，字段名与管理接口中的 JSON 字段相同
+// 未出现的分类不会被修改，也不会被清理
+type ConfigSyncFile struct {
+	Channels     *[]map[string]any `json:"channels,omitempty"`
+	UserGroups   *[]map[string]any `json:"user_groups,omitempty"`
+	ModelOwnedBy *[]map[string]any `json:"model_owned_by,omitempty"`
+	Prices       *[]map[string]any `json:"prices,omitempty"`
+}
+
+type ConfigSyncChange struct {
+	Kind   string   `json:"kind"`
+	Key    string   `json:"key"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// configSyncKind 描述一类记录如何按稳定的 key 对账
+type configSyncKind[T any] struct {
+	kind      string
+	keyField  string // JSON 字段名，同时也是数据库列名
+	keyOf     func(*T) string
+	prunable  func(*T) bool
+	preCreate func(*T)
+	validate  func(*T) error
+	omit      []string
+	// extraFields 不属于记录本身的字段，如渠道的 key 池，由 syncExtra 单独对账
+	extraFields []string
+	syncExtra   func(tx *gorm.DB, record *T, extra map[string]any, prune, dryRun bool) (bool, error)
+	// afterPrune 删除记录后清理关联的数据，如渠道的 key 池
+	afterPrune func(tx *gorm.DB) error
+}
+
+// expandConfigSyncEnv 将字符串中的 ${NAME} 替换为环境变量的值
+func expandConfigSyncEnv(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		var missing []string
+		expanded := configSyncEnvRegex.ReplaceAllStringFunc(v, func(match string) string {
+			name := configSyncEnvRegex.FindStringSubmatch(match)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return env
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ","))
+		}
+		return expanded, nil
+	case map[string]any:
+		for key, item := range v {
+			expanded, err := expandConfigSyncEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []any:
+		for i, item := range v {
+			expanded, err := expandConfigSyncEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+
+	return value, nil
+}
+
+// ParseConfigSyncFile 解析 YAML 或 JSON 格式的配置
+func ParseConfigSyncFile(data []byte) (*ConfigSyncFile, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	raw, err := expandConfigSyncEnv(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+
+	file := &ConfigSyncFile{}
+	if err := decoder.Decode(file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// jsonFieldNames 返回 JSON 字段名对应的结构体字段名
+func jsonFieldNames(t reflect.Type) map[string]string {
+	names := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		names[name] = field.Name
+	}
+
+	return names
+}
+
+// configSyncValueEqual 比较两个 JSON 值，未出现的字段视为 null
+func configSyncValueEqual(a, b json.RawMessage) bool {
+	if len(a) == 0 {
+		a = json.RawMessage("null")
+	}
+	if len(b) == 0 {
+		b = json.RawMessage("null")
+	}
+
+	return bytes.Equal(a, b)
+}
+
+func toJSONMap(value any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func (k *configSyncKind[T]) reconcile(tx *gorm.DB, items []map[string]any, prune, dryRun bool) ([]*ConfigSyncChange, error) {
+	var existing []*T
+	if err := tx.Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	existingByKey := make(map[string]*T, len(existing))
+	for _, record := range existing {
+		key := k.keyOf(record)
+		if _, ok := existingByKey[key]; ok {
+			return nil, fmt.Errorf("%s: multiple records with %s %s", k.kind, k.keyField, key)
+		}
+		existingByKey[key] = record
+	}
+
+	fieldNames := jsonFieldNames(reflect.TypeOf(new(T)).Elem())
+	declared := make(map[string]bool, len(items))
+	changes := make([]*ConfigSyncChange, 0)
+
+	for _, item := range items {
+		keyValue, ok := item[k.keyField]
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is required", k.kind, k.keyField)
+		}
+		key := fmt.Sprint(keyValue)
+		if declared[key] {
+			return nil, fmt.Errorf("%s: duplicate %s %s", k.kind, k.keyField, key)
+		}
+		declared[key] = true
+
+		extra := make(map[string]any, len(k.extraFields))
+		for _, field := range k.extraFields {
+			if value, ok := item[field]; ok {
+				extra[field] = value
+				delete(item, field)
+			}
+		}
+
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		desired := new(T)
+		if err := decoder.Decode(desired); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+		}
+		if k.validate != nil {
+			if err := k.validate(desired); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+			}
+		}
+
+		record, ok := existingByKey[key]
+		if !ok {
+			changes = append(changes, &ConfigSyncChange{Kind: k.kind, Key: key, Action: ConfigSyncActionCreate})
+			if dryRun {
+				continue
+			}
+			if k.preCreate != nil {
+				k.preCreate(desired)
+			}
+			if err := tx.Omit(k.omit...).Create(desired).Error; err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+			}
+			if k.syncExtra != nil && len(extra) > 0 {
+				if _, err := k.syncExtra(tx, desired, extra, prune, false); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+				}
+			}
+			continue
+		}
+
+		// 两侧都经过同一类型编码后再比较，避免 JSON 字段的格式与键顺序差异产生无效的更新
+		current, err := toJSONMap(record)
+		if err != nil {
+			return nil, err
+		}
+		wanted, err := toJSONMap(desired)
+		if err != nil {
+			return nil, err
+		}
+
+		var fields, columns []string
+		for field := range item {
+			if configSyncValueEqual(wanted[field], current[field]) {
+				continue
+			}
+			// key 与主键不允许通过配置修改
+			name, ok := fieldNames[field]
+			if !ok || field == k.keyField || field == "id" {
+				continue
+			}
+			fields = append(fields, field)
+			columns = append(columns, name)
+		}
+
+		if len(columns) > 0 && !dryRun {
+			err = tx.Model(new(T)).Where(quotePostgresField(k.keyField)+" = ?", keyValue).Select(columns).Updates(desired).Error
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+			}
+		}
+
+		if k.syncExtra != nil && len(extra) > 0 {
+			changed, err := k.syncExtra(tx, record, extra, prune, dryRun)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+			}
+			if changed {
+				fields = append(fields, k.extraFields...)
+			}
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		sort.Strings(fields)
+		changes = append(changes, &ConfigSyncChange{Kind: k.kind, Key: key, Action: ConfigSyncActionUpdate, Fields: fields})
+	}
+
+	if !prune {
+		return changes, nil
+	}
+
+	pruned := false
+	for key, record := range existingByKey {
+		if declared[key] || (k.prunable != nil && !k.prunable(record)) {
+			continue
+		}
+
+		changes = append(changes, &ConfigSyncChange{Kind: k.kind, Key: key, Action: ConfigSyncActionDelete})
+		if dryRun {
+			continue
+		}
+		if err := tx.Where(quotePostgresField(k.keyField)+" = ?", k.keyOf(record)).Delete(new(T)).Error; err != nil {
+			return nil, fmt.Errorf("%s %s: %w", k.kind, key, err)
+		}
+		pruned = true
+	}
+
+	if pruned && k.afterPrune != nil {
+		if err := k.afterPrune(tx); err != nil {
+			return nil, fmt.Errorf("%s: %w", k.kind, err)
+		}
+	}
+
+	return changes, nil
+}
+
+var (
+	channelSyncKind = &configSyncKind[Channel]{
+		kind:     "channels",
+		keyField: "name",
+		keyOf:    func(channel *Channel) string { return channel.Name },
+		preCreate: func(channel *Channel) {
+			channel.CreatedTime = utils.GetTimestamp()
+		},
+		validate:    (*Channel).Validate,
+		omit:        []string{"UsedQuota"},
+		extraFields: []string{"keys"},
+		syncExtra:   syncChannelKeys,
+		afterPrune:  deleteOrphanChannelKeys,
+	}
+	userGroupSyncKind = &configSyncKind[UserGroup]{
+		kind:     "user_groups",
+		keyField: "symbol",
+		keyOf:    func(userGroup *UserGroup) string { return userGroup.Symbol },
+		preCreate: func(userGroup *UserGroup) {
+			if userGroup.Enable == nil {
+				enable := true
+				userGroup.Enable = &enable
+			}
+		},
+		validate: func(userGroup *UserGroup) error {
+			_, err := ParseModelFallbacks(userGroup.ModelFallbacks)
+			return err
+		},
+	}
+	modelOwnedBySyncKind = &configSyncKind[ModelOwnedBy]{
+		kind:     "model_owned_by",
+		keyField: "id",
+		keyOf:    func(ownedBy *ModelOwnedBy) string { return fmt.Sprint(ownedBy.Id) },
+		// 内置的模型归属不会被清理
+		prunable: func(ownedBy *ModelOwnedBy) bool { return ownedBy.Id >= ModelOwnedByReserveID },
+	}
+	priceSyncKind = &configSyncKind[Price]{
+		kind:     "prices",
+		keyField: "model",
+		keyOf:    func(price *Price) string { return price.Model },
+		// 锁定的价格不会被清理
+		prunable: func(price *Price) bool { return !price.Locked },
+		validate: (*Price).ValidateTiers,
+	}
+)
+
+// syncChannelKeys 对账渠道 key 池，添加配置中新增的 key，prune 时删除未声明的 key
+func syncChannelKeys(tx *gorm.DB, channel *Channel, extra map[string]any, prune, dryRun bool) (bool, error) {
+	items, ok := extra["keys"].([]any)
+	if !ok {
+		return false, errors.New("keys must be a list of strings")
+	}
+
+	declared := make(map[string]bool, len(items))
+	for _, item := range items {
+		key, ok := item.(string)
+		if !ok {
+			return false, errors.New("keys must be a list of strings")
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			declared[key] = true
+		}
+	}
+
+	var existing []*ChannelKey
+	if channel.Id > 0 {
+		if err := tx.Where("channel_id = ?", channel.Id).Order("id asc").Find(&existing).Error; err != nil {
+			return false, err
+		}
+	}
+
+	existingKeys := make(map[string]bool, len(existing))
+	var staleIds []int
+	for _, key := range existing {
+		existingKeys[key.Key] = true
+		if !declared[key.Key] {
+			staleIds = append(staleIds, key.Id)
+		}
+	}
+
+	weight := uint(1)
+	newKeys := make([]*ChannelKey, 0)
+	for _, item := range items {
+		key := strings.TrimSpace(item.(string))
+		if key == "" || existingKeys[key] {
+			continue
+		}
+		existingKeys[key] = true
+
+		newKeys = append(newKeys, &ChannelKey{
+			ChannelId:   channel.Id,
+			Key:         key,
+			Weight:      &weight,
+			Status:      config.ChannelStatusEnabled,
+			CreatedTime: utils.GetTimestamp(),
+		})
+	}
+
+	if !prune {
+		staleIds = nil
+	}
+	if len(newKeys) == 0 && len(staleIds) == 0 {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	if len(newKeys) > 0 {
+		if err := tx.Omit("UsedQuota", "RequestCount").Create(&newKeys).Error; err != nil {
+			return false, err
+		}
+	}
+	if len(staleIds) > 0 {
+		if err := tx.Where("channel_id = ? AND id IN (?)", channel.Id, staleIds).Delete(&ChannelKey{}).Error; err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// ApplyConfigSync 按配置对账渠道、用户分组、模型归属与价格
+// dryRun 时只返回差异，prune 时删除配置中未声明的记录
+func ApplyConfigSync(data []byte, prune, dryRun bool) ([]*ConfigSyncChange, error) {
+	file, err := ParseConfigSyncFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*ConfigSyncChange, 0)
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if file.Channels != nil {
+			kindChanges, err := channelSyncKind.reconcile(tx, *file.Channels, prune, dryRun)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, kindChanges...)
+		}
+		if file.UserGroups != nil {
+			kindChanges, err := userGroupSyncKind.reconcile(tx, *file.UserGroups, prune, dryRun)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, kindChanges...)
+		}
+		if file.ModelOwnedBy != nil {
+			kindChanges, err := modelOwnedBySyncKind.reconcile(tx, *file.ModelOwnedBy, prune, dryRun)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, kindChanges...)
+		}
+		if file.Prices != nil {
+			kindChanges, err := priceSyncKind.reconcile(tx, *file.Prices, prune, dryRun)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, kindChanges...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	ChannelGroup.Reload()
+	GlobalUserGroupRatio.Load()
+	if err := ModelOwnedBysInstance.Load(); err != nil {
+		return changes, err
+	}
+	if err := PricingInstance.Init(); err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+// ExportConfigSync 导出当前配置，渠道 key 以环境变量引用代替
+func ExportConfigSync() ([]byte, error) {
+	var channels []*Channel
+	if err := DB.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(channels))
+	exportChannels := make([]map[string]any, 0, len(channels))
+	for _, channel := range channels {
+		if names[channel.Name] {
+			return nil, fmt.Errorf("channels: multiple records with name %s", channel.Name)
+		}
+		names[channel.Name] = true
+
+		item, err := toExportMap(channel, "id", "created_time", "test_time", "response_time", "balance", "balance_updated_time", "used_quota", "disable_reason")
+		if err != nil {
+			return nil, err
+		}
+		item["key"] = fmt.Sprintf("${CHANNEL_%d_KEY}", channel.Id)
+		if channel.IsKeyPool() {
+			keys, err := GetChannelKeys(channel.Id)
+			if err != nil {
+				return nil, err
+			}
+			keyRefs := make([]string, 0, len(keys))
+			for i := range keys {
+				keyRefs = append(keyRefs, fmt.Sprintf("${CHANNEL_%d_KEY_%d}", channel.Id, i+1))
+			}
+			item["keys"] = keyRefs
+		}
+		exportChannels = append(exportChannels, item)
+	}
+
+	var userGroups []*UserGroup
+	if err := DB.Order("id asc").Find(&userGroups).Error; err != nil {
+		return nil, err
+	}
+	exportUserGroups := make([]map[string]any, 0, len(userGroups))
+	for _, userGroup := range userGroups {
+		item, err := toExportMap(userGroup, "id")
+		if err != nil {
+			return nil, err
+		}
+		exportUserGroups = append(exportUserGroups, item)
+	}
+
+	ownedBys, err := GetAllModelOwnedBy()
+	if err != nil {
+		return nil, err
+	}
+	exportOwnedBys := make([]map[string]any, 0, len(ownedBys))
+	for _, ownedBy := range ownedBys {
+		item, err := toExportMap(ownedBy)
+		if err != nil {
+			return nil, err
+		}
+		exportOwnedBys = append(exportOwnedBys, item)
+	}
+
+	prices, err := GetAllPrices()
+	if err != nil {
+		return nil, err
+	}
+	exportPrices := make([]map[string]any, 0, len(prices))
+	for _, price := range prices {
+		item, err := toExportMap(price)
+		if err != nil {
+			return nil, err
+		}
+		exportPrices = append(exportPrices, item)
+	}
+
+	return yaml.Marshal(map[string]any{
+		"channels":       exportChannels,
+		"user_groups":    exportUserGroups,
+		"model_owned_by": exportOwnedBys,
+		"prices":         exportPrices,
+	})
+}
+
+func toExportMap(value any, omit ...string) (map[string]any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	item := make(map[string]any)
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+
+	for _, key := range omit {
+		delete(item, key)
+	}
+
+	return item, nil
+}
+
+// ApplyConfigSyncFile 启动时应用配置文件
+func ApplyConfigSyncFile(path string, prune bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	changes, err := ApplyConfigSync(data, prune, false)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		logger.SysLog(fmt.Sprintf("config_sync_applied kind=%s key=%s action=%s fields=%s",
+			change.Kind, change.Key, change.Action, strings.Join(change.Fields, ",")))
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func setupConfigSyncTestDB(t *testing.T) *gorm.DB {
+	db := setupTestDB(t, &Channel{}, &ChannelKey{})
+
+	weight := uint(1)
+	baseURL := ""
+	limits := datatypes.NewJSONType(ChannelLimits{
+		ChannelLimit: ChannelLimit{RPM: 10, TPM: 1000},
+		Models:       map[string]ChannelLimit{"gpt-4o": {Concurrency: 2}},
+	})
+	channel := &Channel{
+		Name:    "openai",
+		Type:    1,
+		Key:     "sk-test",
+		Models:  "gpt-4o",
+		Group:   "default",
+		Weight:  &weight,
+		BaseURL: &baseURL,
+		Limits:  &limits,
+		KeyMode: ChannelKeyModeRoundRobin,
+	}
+	assert.NoError(t, db.Create(channel).Error)
+	assert.NoError(t, db.Create(&ChannelKey{ChannelId: channel.Id, Key: "sk-a", Weight: &weight, Status: 1}).Error)
+	assert.NoError(t, db.Create(&ChannelKey{ChannelId: channel.Id, Key: "sk-b", Weight: &weight, Status: 1}).Error)
+
+	return db
+}
+
+func TestChannelConfigSyncReconcile(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  string
+		prune   bool
+		changes []ConfigSyncChange
+		invalid bool
+	}{
+		{
+			name: "nested json in different order is unchanged",
+			config: `channels:
+  - name: openai
+    models: gpt-4o
+    limits: {models: {gpt-4o: {concurrency: 2}}, tpm: 1000, rpm: 10, concurrency: 0}
+`,
+			changes: []ConfigSyncChange{},
+		},
+		{
+			name: "changed nested field",
+			config: `channels:
+  - name: openai
+    limits: {rpm: 20, tpm: 1000, models: {gpt-4o: {concurrency: 2}}}
+`,
+			changes: []ConfigSyncChange{{Kind: "channels", Key: "openai", Action: ConfigSyncActionUpdate, Fields: []string{"limits"}}},
+		},
+		{
+			name: "changed scalar fields",
+			config: `channels:
+  - name: openai
+    models: gpt-4o,gpt-4.1
+    group: vip
+`,
+			changes: []ConfigSyncChange{{Kind: "channels", Key: "openai", Action: ConfigSyncActionUpdate, Fields: []string{"group", "models"}}},
+		},
+		{
+			name: "existing keys are unchanged",
+			config: `channels:
+  - name: openai
+    keys: [sk-b, sk-a]
+`,
+			changes: []ConfigSyncChange{},
+		},
+		{
+			name: "new key",
+			config: `channels:
+  - name: openai
+    keys: [sk-a, sk-b, sk-c]
+`,
+			changes: []ConfigSyncChange{{Kind: "channels", Key: "openai", Action: ConfigSyncActionUpdate, Fields: []string{"keys"}}},
+		},
+		{
+			name: "undeclared key is kept without prune",
+			config: `channels:
+  - name: openai
+    keys: [sk-a]
+`,
+			changes: []ConfigSyncChange{},
+		},
+		{
+			name:  "undeclared key is removed with prune",
+			prune: true,
+			config: `channels:
+  - name: openai
+    keys: [sk-a]
+`,
+			changes: []ConfigSyncChange{{Kind: "channels", Key: "openai", Action: ConfigSyncActionUpdate, Fields: []string{"keys"}}},
+		},
+		{
+			name:  "create and prune",
+			prune: true,
+			config: `channels:
+  - name: claude
+    type: 14
+    key: sk-ant
+`,
+			changes: []ConfigSyncChange{
+				{Kind: "channels", Key: "claude", Action: ConfigSyncActionCreate},
+				{Kind: "channels", Key: "openai", Action: ConfigSyncActionDelete},
+			},
+		},
+		{
+			name: "invalid key mode",
+			config: `channels:
+  - name: openai
+    key_mode: random
+`,
+			invalid: true,
+		},
+		{
+			name: "invalid schedule on create",
+			config: `channels:
+  - name: claude
+    schedule: {windows: [{start: "25:00", end: "01:00"}]}
+`,
+			invalid: true,
+		},
+		{
+			name: "unknown field",
+			config: `channels:
+  - name: openai
+    unknown: true
+`,
+			invalid: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, dryRun := range []bool{true, false} {
+				db := setupConfigSyncTestDB(t)
+				file, err := ParseConfigSyncFile([]byte(c.config))
+				assert.NoError(t, err)
+
+				changes, err := channelSyncKind.reconcile(db, *file.Channels, c.prune, dryRun)
+				if c.invalid {
+					assert.Error(t, err)
+					continue
+				}
+				assert.NoError(t, err)
+
+				actual := make([]ConfigSyncChange, 0, len(changes))
+				for _, change := range changes {
+					actual = append(actual, *change)
+				}
+				assert.ElementsMatch(t, c.changes, actual, "dry_run=%t", dryRun)
+
+				if dryRun {
+					continue
+				}
+
+				// 应用后再次对账不应产生差异
+				file, err = ParseConfigSyncFile([]byte(c.config))
+				assert.NoError(t, err)
+				changes, err = channelSyncKind.reconcile(db, *file.Channels, c.prune, true)
+				assert.NoError(t, err)
+				assert.Empty(t, changes)
+			}
+		})
+	}
+}
+
+func TestChannelConfigSyncPruneKeys(t *testing.T) {
+	db := setupConfigSyncTestDB(t)
+	file, err := ParseConfigSyncFile([]byte(`channels:
+  - name: claude
+    type: 14
+    key: sk-ant
+`))
+	assert.NoError(t, err)
+
+	_, err = channelSyncKind.reconcile(db, *file.Channels, true, false)
+	assert.NoError(t, err)
+
+	// 被清理的渠道的 key 池一并删除
+	var count int64
+	assert.NoError(t, db.Model(&ChannelKey{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"done-hub/types"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrorMatcher 按渠道类型与上游错误匹配，所有设置了的条件都满足时命中，未设置的条件不参与匹配
+type ErrorMatcher struct {
+	ChannelTypes []int    `json:"channel_types,omitempty"` // 为空匹配所有渠道类型
+	StatusCodes  []string `json:"status_codes,omitempty"`  // 支持 429、5xx 这样的写法
+	ErrorTypes   []string `json:"error_types,omitempty"`
+	ErrorCodes   []string `json:"error_codes,omitempty"`
+	Params       []string `json:"params,omitempty"`
+	Message      string   `json:"message,omitempty"` // 错误信息的正则
+
+	messageRegex *regexp.Regexp
+}
+
+// Compile 校验状态码并编译错误信息的正则，匹配前需要先调用
+func (m *ErrorMatcher) Compile() error {
+	for _, status := range m.StatusCodes {
+		if !isValidStatusPattern(status) {
+			return fmt.Errorf("无效的状态码: %s", status)
+		}
+	}
+
+	m.messageRegex = nil
+	if m.Message != "" {
+		regex, err := regexp.Compile(m.Message)
+		if err != nil {
+			return fmt.Errorf("无效的错误信息正则: %w", err)
+		}
+		m.messageRegex = regex
+	}
+
+	return nil
+}
+
+func (m *ErrorMatcher) IsChannelTyped() bool {
+	return len(m.ChannelTypes) > 0
+}
+
+func (m *ErrorMatcher) Match(channelType int, apiErr *types.OpenAIErrorWithStatusCode) bool {
+	if len(m.ChannelTypes) > 0 && !slices.Contains(m.ChannelTypes, channelType) {
+		return false
+	}
+
+	if len(m.StatusCodes) > 0 && !slices.ContainsFunc(m.StatusCodes, func(pattern string) bool {
+		return matchStatusPattern(pattern, apiErr.StatusCode)
+	}) {
+		return false
+	}
+
+	if len(m.ErrorTypes) > 0 && !slices.Contains(m.ErrorTypes, apiErr.OpenAIError.Type) {
+		return false
+	}
+
+	if len(m.ErrorCodes) > 0 {
+		code := ""
+		if apiErr.OpenAIError.Code != nil {
+			code = fmt.Sprint(apiErr.OpenAIError.Code)
+		}
+		if !slices.Contains(m.ErrorCodes, code) {
+			return false
+		}
+	}
+
+	if len(m.Params) > 0 && !slices.Contains(m.Params, apiErr.OpenAIError.Param) {
+		return false
+	}
+
+	if m.messageRegex != nil && !m.messageRegex.MatchString(apiErr.OpenAIError.Message) {
+		return false
+	}
+
+	return true
+}
+
+func isValidStatusPattern(pattern string) bool {
+	if len(pattern) != 3 {
+		return false
+	}
+
+	for i, char := range strings.ToLower(pattern) {
+		if char == 'x' && i > 0 {
+			continue
+		}
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchStatusPattern(pattern string, statusCode int) bool {
+	status := fmt.Sprintf("%03d", statusCode)
+	pattern = strings.ToLower(pattern)
+	for i := 0; i < 3; i++ {
+		if pattern[i] != 'x' && pattern[i] != status[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -124,6 +124,22 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&ChannelKey{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ChannelDiscoveredModels{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ChannelHealth{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ShadowResult{})
+		if err != nil {
+			return err
+		}
 		err = db.AutoMigrate(&Token{})
 		if err != nil {
 			return err
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ModelFallbacks 模型 -> 依次尝试的备用模型，如 {"gpt-4o": ["gpt-4.1", "claude-sonnet"]}
+// 模型没有可用渠道或重试耗尽时按顺序切换到下一个备用模型
+type ModelFallbacks map[string][]string
+
+// ParseModelFallbacks 解析并校验 JSON 格式的备用模型链
+func ParseModelFallbacks(value string) (ModelFallbacks, error) {
+	fallbacks := make(ModelFallbacks)
+	if strings.TrimSpace(value) == "" {
+		return fallbacks, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &fallbacks); err != nil {
+		return nil, err
+	}
+
+	if err := fallbacks.Validate(); err != nil {
+		return nil, err
+	}
+
+	return fallbacks, nil
+}
+
+func (f ModelFallbacks) Validate() error {
+	for modelName, chain := range f {
+		if strings.TrimSpace(modelName) == "" {
+			return errors.New("备用模型链的模型名称不能为空")
+		}
+
+		seen := map[string]bool{modelName: true}
+		for _, fallback := range chain {
+			if strings.TrimSpace(fallback) == "" {
+				return fmt.Errorf("模型 %s 的备用模型名称不能为空", modelName)
+			}
+			if seen[fallback] {
+				return fmt.Errorf("模型 %s 的备用模型 %s 重复", modelName, fallback)
+			}
+			seen[fallback] = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseModelFallbacks(t *testing.T) {
+	cases := []struct {
+		name      string
+		value     string
+		valid     bool
+		fallbacks ModelFallbacks
+	}{
+		{"empty", " ", true, ModelFallbacks{}},
+		{"valid", `{"gpt-4o":["gpt-4.1","claude-sonnet"]}`, true, ModelFallbacks{"gpt-4o": {"gpt-4.1", "claude-sonnet"}}},
+		{"invalid json", `{"gpt-4o":"gpt-4.1"}`, false, nil},
+		{"empty model", `{" ":["gpt-4.1"]}`, false, nil},
+		{"empty fallback", `{"gpt-4o":[""]}`, false, nil},
+		{"duplicate fallback", `{"gpt-4o":["gpt-4.1","gpt-4.1"]}`, false, nil},
+		{"fallback to itself", `{"gpt-4o":["gpt-4o"]}`, false, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fallbacks, err := ParseModelFallbacks(c.value)
+			if !c.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.fallbacks, fallbacks)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"done-hub/common"
 	"done-hub/common/config"
 	"done-hub/common/logger"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -40,9 +41,16 @@ func InitOptionMap() {
 	config.GlobalOption.RegisterBool("RegisterEnabled", &config.RegisterEnabled)
 	config.GlobalOption.RegisterBool("AutomaticDisableChannelEnabled", &config.AutomaticDisableChannelEnabled)
 	config.GlobalOption.RegisterBool("AutomaticEnableChannelEnabled", &config.AutomaticEnableChannelEnabled)
+	config.GlobalOption.RegisterBool("ChannelRecoveryEnabled", &config.ChannelRecoveryEnabled)
+	config.GlobalOption.RegisterInt("ChannelRecoverySuccessThreshold", &config.ChannelRecoverySuccessThreshold)
+	config.GlobalOption.RegisterInt("ChannelRecoveryMinInterval", &config.ChannelRecoveryMinInterval)
+	config.GlobalOption.RegisterInt("ChannelRecoveryMaxInterval", &config.ChannelRecoveryMaxInterval)
 	config.GlobalOption.RegisterBool("ApproximateTokenEnabled", &config.ApproximateTokenEnabled)
 	config.GlobalOption.RegisterBool("LogConsumeEnabled", &config.LogConsumeEnabled)
 	config.GlobalOption.RegisterBool("EmptyResponseBillingEnabled", &config.EmptyResponseBillingEnabled)
+	config.GlobalOption.RegisterBool("ResponseCacheEnabled", &config.ResponseCacheEnabled)
+	config.GlobalOption.RegisterInt("ResponseCacheDefaultTTL", &config.ResponseCacheDefaultTTL)
+	config.GlobalOption.RegisterFloat("ResponseCacheBillingRatio", &config.ResponseCacheBillingRatio)
 	config.GlobalOption.RegisterBool("DisplayInCurrencyEnabled", &config.DisplayInCurrencyEnabled)
 	config.GlobalOption.RegisterFloat("ChannelDisableThreshold", &config.ChannelDisableThreshold)
 	config.GlobalOption.RegisterBool("EmailDomainRestrictionEnabled", &config.EmailDomainRestrictionEnabled)
@@ -98,6 +106,45 @@ func InitOptionMap() {
 	config.GlobalOption.RegisterFloat("QuotaPerUnit", &config.QuotaPerUnit)
 	config.GlobalOption.RegisterInt("RetryTimes", &config.RetryTimes)
 	config.GlobalOption.RegisterInt("RetryCooldownSeconds", &config.RetryCooldownSeconds)
+	config.GlobalOption.RegisterCustom("RetryPolicyRules", func() string {
+		return config.RetryPolicyRules
+	}, func(value string) error {
+		if err := RetryPolicy.SetRules(value); err != nil {
+			return err
+		}
+		config.RetryPolicyRules = value
+		return nil
+	}, "")
+	config.GlobalOption.RegisterString("ChannelRoutingStrategy", &config.ChannelRoutingStrategy)
+	config.GlobalOption.RegisterInt("ChannelRoutingLatencyBudget", &config.ChannelRoutingLatencyBudget)
+	config.GlobalOption.RegisterInt("ChannelHealthMinuteRetentionHours", &config.ChannelHealthMinuteRetentionHours)
+	config.GlobalOption.RegisterInt("ChannelHealthRetentionDays", &config.ChannelHealthRetentionDays)
+	config.GlobalOption.RegisterString("ChannelBudgetWarningPercents", &config.ChannelBudgetWarningPercents)
+	config.GlobalOption.RegisterCustom("ChannelTagBudgets", func() string {
+		return config.ChannelTagBudgets
+	}, func(value string) error {
+		if err := ChannelBudgets.SetTagBudgets(value); err != nil {
+			return err
+		}
+		config.ChannelTagBudgets = value
+		return nil
+	}, "")
+	config.GlobalOption.RegisterCustom("ShadowTrafficRules", func() string {
+		return config.ShadowTrafficRules
+	}, func(value string) error {
+		if err := ShadowTraffic.SetRules(value); err != nil {
+			return err
+		}
+		config.ShadowTrafficRules = value
+		return nil
+	}, "")
+	config.GlobalOption.RegisterInt("ShadowResultRetentionDays", &config.ShadowResultRetentionDays)
+	config.GlobalOption.RegisterInt("ChannelLimitQueueSize", &config.ChannelLimitQueueSize)
+	config.GlobalOption.RegisterInt("ChannelLimitQueueTimeout", &config.ChannelLimitQueueTimeout)
+	config.GlobalOption.RegisterBool("CircuitBreakerEnabled", &config.CircuitBreakerEnabled)
+	config.GlobalOption.RegisterInt("CircuitBreakerFailureThreshold", &config.CircuitBreakerFailureThreshold)
+	config.GlobalOption.RegisterInt("CircuitBreakerOpenSeconds", &config.CircuitBreakerOpenSeconds)
+	config.GlobalOption.RegisterInt("CircuitBreakerHalfOpenRequests", &config.CircuitBreakerHalfOpenRequests)
 
 	config.GlobalOption.RegisterBool("MjNotifyEnabled", &config.MjNotifyEnabled)
 	config.GlobalOption.RegisterString("ChatImageRequestProxy", &config.ChatImageRequestProxy)
@@ -120,6 +167,25 @@ func InitOptionMap() {
 	config.GlobalOption.RegisterBool("GeminiAPIEnabled", &config.GeminiAPIEnabled)
 	config.GlobalOption.RegisterBool("ClaudeAPIEnabled", &config.ClaudeAPIEnabled)
 
+	config.GlobalOption.RegisterCustom("ChannelErrorRules", func() string {
+		return config.ChannelErrorRules
+	}, func(value string) error {
+		if err := ChannelErrorRules.SetRules(value); err != nil {
+			return err
+		}
+		config.ChannelErrorRules = value
+		return nil
+	}, "")
+	config.GlobalOption.RegisterCustom("ChannelErrorActions", func() string {
+		return config.ChannelErrorActions
+	}, func(value string) error {
+		if err := ChannelErrorRules.SetActions(value); err != nil {
+			return err
+		}
+		config.ChannelErrorActions = value
+		return nil
+	}, "")
+	// 旧的禁用关键词，未命中分类规则时作为 other 分类处理
 	config.GlobalOption.RegisterCustom("DisableChannelKeywords", func() string {
 		return common.DisableChannelKeywordsInstance.GetKeywords()
 	}, func(value string) error {
@@ -128,6 +194,7 @@ func InitOptionMap() {
 	}, common.GetDefaultDisableChannelKeywords())
 
 	config.GlobalOption.RegisterInt("RetryTimeOut", &config.RetryTimeOut)
+	config.GlobalOption.RegisterInt("StreamFirstContentTimeout", &config.StreamFirstContentTimeout)
 
 	config.GlobalOption.RegisterBool("EnableSafe", &config.EnableSafe)
 	config.GlobalOption.RegisterString("SafeToolName", &config.SafeToolName)
@@ -150,7 +217,12 @@ func InitOptionMap() {
 func loadOptionsFromDatabase() {
 	options, _ := AllOption()
 	for _, option := range options {
-		err := config.GlobalOption.Set(option.Key, option.Value)
+		value, err := common.DecryptSecret(option.Value)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to decrypt option %s: %s", option.Key, err.Error()))
+			continue
+		}
+		err = config.GlobalOption.Set(option.Key, value)
 		if err != nil {
 			logger.SysError("failed to update option map: " + err.Error())
 		}
@@ -173,6 +245,13 @@ func UpdateOption(key string, value string) error {
 	// https://gorm.io/docs/update.html#Save-All-Fields
 	DB.FirstOrCreate(&option, Option{Key: key})
 	option.Value = value
+	if isSecretOption(key) {
+		encrypted, err := common.EncryptSecret(value)
+		if err != nil {
+			return err
+		}
+		option.Value = encrypted
+	}
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
@@ -23,7 +23,7 @@ type Payment struct {
 	FixedFee     float64        `json:"fixed_fee" form:"fixed_fee" gorm:"type:decimal(10,2); default:0.00"`
 	PercentFee   float64        `json:"percent_fee" form:"percent_fee" gorm:"type:decimal(10,2); default:0.00"`
 	Currency     CurrencyType   `json:"currency" form:"currency" gorm:"type:varchar(5)"`
-	Config       string         `json:"config" form:"config" gorm:"type:text"`
+	Config       string         `json:"config" form:"config" gorm:"type:text;serializer:secret"`
 	Sort         int            `json:"sort" form:"sort" gorm:"default:1"`
 	Enable       *bool          `json:"enable" form:"enable" gorm:"default:true"`
 	CreatedAt    int64          `json:"created_at" gorm:"bigint"`
@@ -2,6 +2,9 @@ package model
 
 import (
 	"done-hub/common/config"
+	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
@@ -61,6 +64,27 @@ type Price struct {
 	Locked      bool    `json:"locked" gorm:"default:false"` // 如果模型为locked 则覆盖模式不会更新locked的模型价格
 
 	ExtraRatios *datatypes.JSONType[map[string]float64] `json:"extra_ratios,omitempty" gorm:"type:json"`
+	Tiers       *datatypes.JSONType[[]PriceTier]        `json:"tiers,omitempty" gorm:"type:json"`
+}
+
+// PriceTier 提示 token 数超过 Threshold 时按该档位的输入/输出倍率计费，额外 token 的倍率仍相对于档位价格计算
+type PriceTier struct {
+	Threshold int     `json:"threshold"`
+	Input     float64 `json:"input"`
+	Output    float64 `json:"output"`
+}
+
+// 按提示 token 数分档计费的默认价格，价格与 ModelTypes 的单位相同
+var defaultPriceTiers = map[string][]PriceTier{
+	// 超过 128k tokens: $7 / 1 million tokens  $21 / 1 million tokens
+	"gemini-1.5-pro":        {{Threshold: 128000, Input: 3.5, Output: 10.5}},
+	"gemini-1.5-pro-latest": {{Threshold: 128000, Input: 3.5, Output: 10.5}},
+	// 超过 200k tokens: $2.50 / 1 million tokens  $15 / 1 million tokens
+	"gemini-2.5-pro": {{Threshold: 200000, Input: 1.25, Output: 7.5}},
+	// 1M 上下文超过 200k tokens: $6 / 1 million tokens  $22.50 / 1 million tokens
+	"claude-sonnet-4-20250514":   {{Threshold: 200000, Input: 3, Output: 11.25}},
+	"claude-sonnet-4-5":          {{Threshold: 200000, Input: 3, Output: 11.25}},
+	"claude-sonnet-4-5-20250929": {{Threshold: 200000, Input: 3, Output: 11.25}},
 }
 
 func GetAllPrices() ([]*Price, error) {
@@ -134,6 +158,53 @@ func (price *Price) GetExtraRatio(key string) float64 {
 	return ratio
 }
 
+// GetTier 返回提示 token 数适用的最高档位，未超过任何档位或按次计费时返回 nil
+func (price *Price) GetTier(promptTokens int) *PriceTier {
+	if price.Tiers == nil || price.Type == TimesPriceType {
+		return nil
+	}
+
+	var tier *PriceTier
+	tiers := price.Tiers.Data()
+	for i := range tiers {
+		if promptTokens > tiers[i].Threshold && (tier == nil || tiers[i].Threshold > tier.Threshold) {
+			tier = &tiers[i]
+		}
+	}
+
+	return tier
+}
+
+// ValidateTiers 校验档位并按阈值从小到大排序
+func (price *Price) ValidateTiers() error {
+	if price.Tiers == nil {
+		return nil
+	}
+
+	tiers := price.Tiers.Data()
+	thresholds := make(map[int]bool, len(tiers))
+	for _, tier := range tiers {
+		if tier.Threshold <= 0 {
+			return errors.New("价格档位的阈值必须大于 0")
+		}
+		if tier.Input < 0 || tier.Output < 0 {
+			return errors.New("价格档位的倍率不能为负数")
+		}
+		if thresholds[tier.Threshold] {
+			return fmt.Errorf("价格档位的阈值 %d 重复", tier.Threshold)
+		}
+		thresholds[tier.Threshold] = true
+	}
+
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Threshold < tiers[j].Threshold
+	})
+	sortedTiers := datatypes.NewJSONType(tiers)
+	price.Tiers = &sortedTiers
+
+	return nil
+}
+
 func (price *Price) FetchInputCurrencyPrice(rate float64) string {
 	r := decimal.NewFromFloat(price.GetInput()).Mul(decimal.NewFromFloat(rate))
 	return r.String()
@@ -153,6 +224,7 @@ func UpdatePrices(tx *gorm.DB, models []string, prices *Price) error {
 			Output:      prices.Output,
 			Locked:      prices.Locked,
 			ExtraRatios: prices.ExtraRatios,
+			Tiers:       prices.Tiers,
 		}).Error
 
 	return err
@@ -264,6 +336,10 @@ func GetDefaultPrice() []*Price {
 		"claude-3-sonnet-20240229": {[]float64{1.3, 3.9}, config.ChannelTypeAnthropic},
 		//  $0.25 / M $1.25 / M  0.00025$ / 1k tokens 0.00125$ / 1k tokens
 		"claude-3-haiku-20240307": {[]float64{0.125, 0.625}, config.ChannelTypeAnthropic},
+		//  $3 / M $15 / M
+		"claude-sonnet-4-20250514":   {[]float64{1.5, 7.5}, config.ChannelTypeAnthropic},
+		"claude-sonnet-4-5":          {[]float64{1.5, 7.5}, config.ChannelTypeAnthropic},
+		"claude-sonnet-4-5-20250929": {[]float64{1.5, 7.5}, config.ChannelTypeAnthropic},
 
 		// ￥0.004 / 1k tokens ￥0.008 / 1k tokens
 		"ERNIE-Speed": {[]float64{0.2857, 0.5714}, config.ChannelTypeBaidu},
@@ -294,6 +370,8 @@ func GetDefaultPrice() []*Price {
 		"gemini-1.5-flash":        {[]float64{0.175, 0.265}, config.ChannelTypeGemini},
 		"gemini-1.5-flash-latest": {[]float64{0.175, 0.265}, config.ChannelTypeGemini},
 		"gemini-ultra":            {[]float64{1, 1}, config.ChannelTypeGemini},
+		// $1.25 / 1 million tokens  $10 / 1 million tokens
+		"gemini-2.5-pro": {[]float64{0.625, 5}, config.ChannelTypeGemini},
 
 		// ￥0.005 / 1k tokens
 		"glm-3-turbo": {[]float64{0.3572, 0.3572}, config.ChannelTypeZhipu},
@@ -411,13 +489,18 @@ func GetDefaultPrice() []*Price {
 	var prices []*Price
 
 	for model, modelType := range ModelTypes {
-		prices = append(prices, &Price{
+		price := &Price{
 			Model:       model,
 			Type:        TokensPriceType,
 			ChannelType: modelType.Type,
 			Input:       modelType.Ratio[0],
 			Output:      modelType.Ratio[1],
-		})
+		}
+		if tiers, ok := defaultPriceTiers[model]; ok {
+			priceTiers := datatypes.NewJSONType(tiers)
+			price.Tiers = &priceTiers
+		}
+		prices = append(prices, price)
 	}
 
 	var DefaultMJPrice = map[string]float64{
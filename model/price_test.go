@@ -0,0 +1,89 @@
+package model_test
+
+import (
+	"testing"
+
+	"done-hub/model"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func newTieredPrice(priceType string, tiers []model.PriceTier) *model.Price {
+	price := &model.Price{Type: priceType, Input: 1, Output: 2}
+	if tiers != nil {
+		priceTiers := datatypes.NewJSONType(tiers)
+		price.Tiers = &priceTiers
+	}
+
+	return price
+}
+
+func TestPriceGetTier(t *testing.T) {
+	tiers := []model.PriceTier{
+		{Threshold: 200000, Input: 3, Output: 6},
+		{Threshold: 128000, Input: 2, Output: 4},
+	}
+
+	cases := []struct {
+		name         string
+		price        *model.Price
+		promptTokens int
+		threshold    int // 0 表示不使用档位
+	}{
+		{"no tiers", newTieredPrice(model.TokensPriceType, nil), 500000, 0},
+		{"below threshold", newTieredPrice(model.TokensPriceType, tiers), 1000, 0},
+		{"at threshold", newTieredPrice(model.TokensPriceType, tiers), 128000, 0},
+		{"above first threshold", newTieredPrice(model.TokensPriceType, tiers), 128001, 128000},
+		{"highest matching tier", newTieredPrice(model.TokensPriceType, tiers), 300000, 200000},
+		{"times price ignores tiers", newTieredPrice(model.TimesPriceType, tiers), 300000, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tier := c.price.GetTier(c.promptTokens)
+			if c.threshold == 0 {
+				assert.Nil(t, tier)
+				return
+			}
+			assert.NotNil(t, tier)
+			assert.Equal(t, c.threshold, tier.Threshold)
+		})
+	}
+}
+
+func TestPriceValidateTiers(t *testing.T) {
+	cases := []struct {
+		name       string
+		tiers      []model.PriceTier
+		valid      bool
+		thresholds []int
+	}{
+		{"no tiers", nil, true, nil},
+		{"sorted", []model.PriceTier{{Threshold: 200000, Input: 3, Output: 6}, {Threshold: 128000, Input: 2, Output: 4}}, true, []int{128000, 200000}},
+		{"zero threshold", []model.PriceTier{{Threshold: 0, Input: 1, Output: 1}}, false, nil},
+		{"negative ratio", []model.PriceTier{{Threshold: 1000, Input: -1, Output: 1}}, false, nil},
+		{"duplicate threshold", []model.PriceTier{{Threshold: 1000, Input: 1, Output: 1}, {Threshold: 1000, Input: 2, Output: 2}}, false, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			price := newTieredPrice(model.TokensPriceType, c.tiers)
+			err := price.ValidateTiers()
+			if !c.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if c.thresholds == nil {
+				return
+			}
+
+			thresholds := make([]int, 0, len(c.thresholds))
+			for _, tier := range price.Tiers.Data() {
+				thresholds = append(thresholds, tier.Threshold)
+			}
+			assert.Equal(t, c.thresholds, thresholds)
+		})
+	}
+}
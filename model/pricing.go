@@ -163,6 +163,10 @@ func (p *Pricing) updateRawPrice(modelName string, price *Price) error {
 		return errors.New("model not found")
 	}
 
+	if err := price.ValidateTiers(); err != nil {
+		return err
+	}
+
 	if _, ok := p.Prices[price.Model]; modelName != price.Model && ok {
 		return errors.New("model names cannot be duplicated")
 	}
@@ -191,6 +195,10 @@ func (p *Pricing) addRawPrice(price *Price) error {
 		return errors.New("model already exists")
 	}
 
+	if err := price.ValidateTiers(); err != nil {
+		return err
+	}
+
 	return price.Insert()
 }
 
@@ -473,6 +481,10 @@ func (p *Pricing) BatchDeletePrices(models []string) error {
 }
 
 func (p *Pricing) BatchSetPrices(batchPrices *BatchPrices, originalModels []string) error {
+	if err := batchPrices.Price.ValidateTiers(); err != nil {
+		return err
+	}
+
 	// 查找需要删除的model
 	var deletePrices []string
 	var addPrices []*Price
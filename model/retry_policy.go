@@ -0,0 +1,139 @@
+package model
+
+import (
+	"done-hub/common/config"
+	"done-hub/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 重试规则命中后的处理方式
+const (
+	RetryActionRetry     = "retry"      // 换渠道重试
+	RetryActionRetrySame = "retry_same" // 退避后在同一渠道重试，超过次数后换渠道
+	RetryActionCooldown  = "cooldown"   // 冷却当前渠道的模型后换渠道重试
+	RetryActionDisable   = "disable"    // 禁用当前渠道后换渠道重试
+	RetryActionFail      = "fail"       // 不重试，直接返回错误
+)
+
+// RetryRule 命中错误时的重试方式
+type RetryRule struct {
+	Name string `json:"name"`
+	ErrorMatcher
+	Action      string `json:"action"`
+	Backoff     int    `json:"backoff,omitempty"`      // retry_same 的首次退避毫秒数，之后每次翻倍
+	MaxAttempts int    `json:"max_attempts,omitempty"` // retry_same 在同一渠道的最大重试次数，默认 1
+}
+
+func (r *RetryRule) Validate() error {
+	switch r.Action {
+	case RetryActionRetry, RetryActionRetrySame, RetryActionCooldown, RetryActionDisable, RetryActionFail:
+	default:
+		return fmt.Errorf("无效的处理方式: %s", r.Action)
+	}
+
+	if r.Backoff < 0 || r.MaxAttempts < 0 {
+		return errors.New("退避时间与重试次数不能为负数")
+	}
+
+	return r.ErrorMatcher.Compile()
+}
+
+// 未配置规则时的默认策略，管理员配置的规则优先匹配
+var defaultRetryRules = []*RetryRule{
+	{Name: "anthropic_credit_balance", ErrorMatcher: ErrorMatcher{ChannelTypes: []int{config.ChannelTypeAnthropic}, StatusCodes: []string{"400"}, Message: "Your credit balance is too low"}, Action: RetryActionRetry},
+	{Name: "bedrock_operation_not_allowed", ErrorMatcher: ErrorMatcher{ChannelTypes: []int{config.ChannelTypeBedrock}, StatusCodes: []string{"400"}, Message: "Operation not allowed"}, Action: RetryActionRetry},
+	{Name: "gemini_invalid_api_key", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"400"}, Params: []string{"INVALID_ARGUMENT"}, Message: "API key not valid"}, Action: RetryActionRetry},
+	{Name: "bad_request", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"400"}}, Action: RetryActionFail},
+	{Name: "rate_limit", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"429"}}, Action: RetryActionCooldown},
+	{Name: "redirect", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"307"}}, Action: RetryActionRetry},
+	{Name: "timeout", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"408", "504", "524"}}, Action: RetryActionFail},
+	{Name: "success", ErrorMatcher: ErrorMatcher{StatusCodes: []string{"2xx"}}, Action: RetryActionFail},
+	{Name: "default", Action: RetryActionRetry},
+}
+
+func init() {
+	for _, rule := range defaultRetryRules {
+		if err := rule.Validate(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+type RetryPolicyManager struct {
+	sync.RWMutex
+	rules []*RetryRule
+}
+
+var RetryPolicy = &RetryPolicyManager{}
+
+// ParseRetryRules 解析并校验 JSON 格式的规则列表
+func ParseRetryRules(value string) ([]*RetryRule, error) {
+	rules := make([]*RetryRule, 0)
+	if strings.TrimSpace(value) != "" {
+		if err := json.Unmarshal([]byte(value), &rules); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			name := rule.Name
+			if name == "" {
+				name = strconv.Itoa(i + 1)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (m *RetryPolicyManager) SetRules(value string) error {
+	rules, err := ParseRetryRules(value)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.rules = rules
+	m.Unlock()
+
+	return nil
+}
+
+func (m *RetryPolicyManager) GetDefaultRules() []*RetryRule {
+	return defaultRetryRules
+}
+
+// Match 返回第一条命中的规则，默认规则的最后一条匹配所有错误，因此不会返回 nil
+func (m *RetryPolicyManager) Match(channelType int, apiErr *types.OpenAIErrorWithStatusCode) *RetryRule {
+	m.RLock()
+	rules := m.rules
+	m.RUnlock()
+
+	return MatchRetryRule(rules, channelType, apiErr)
+}
+
+// MatchRetryRule 指定渠道类型的规则先于全局规则匹配，都未命中时使用默认规则
+func MatchRetryRule(rules []*RetryRule, channelType int, apiErr *types.OpenAIErrorWithStatusCode) *RetryRule {
+	for _, typed := range []bool{true, false} {
+		for _, rule := range rules {
+			if rule.IsChannelTyped() == typed && rule.Match(channelType, apiErr) {
+				return rule
+			}
+		}
+	}
+
+	for _, rule := range defaultRetryRules {
+		if rule.Match(channelType, apiErr) {
+			return rule
+		}
+	}
+
+	return defaultRetryRules[len(defaultRetryRules)-1]
+}
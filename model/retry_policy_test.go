@@ -0,0 +1,89 @@
+package model_test
+
+import (
+	"testing"
+
+	"done-hub/common/config"
+	"done-hub/model"
+	"done-hub/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAPIError(statusCode int, errType, code, param, message string) *types.OpenAIErrorWithStatusCode {
+	apiErr := &types.OpenAIErrorWithStatusCode{
+		OpenAIError: types.OpenAIError{
+			Type:    errType,
+			Param:   param,
+			Message: message,
+		},
+		StatusCode: statusCode,
+	}
+	if code != "" {
+		apiErr.OpenAIError.Code = code
+	}
+
+	return apiErr
+}
+
+func TestMatchRetryRule(t *testing.T) {
+	rules, err := model.ParseRetryRules(`[
+		{"name": "openai_overloaded", "channel_types": [1], "status_codes": ["5xx"], "action": "retry_same", "backoff": 200},
+		{"name": "server_error", "status_codes": ["5xx"], "action": "cooldown"},
+		{"name": "context_length", "error_codes": ["context_length_exceeded"], "action": "fail"}
+	]`)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		rules       []*model.RetryRule
+		channelType int
+		apiErr      *types.OpenAIErrorWithStatusCode
+		rule        string
+		action      string
+	}{
+		{"typed rule first", rules, config.ChannelTypeOpenAI, newAPIError(503, "", "", "", "overloaded"), "openai_overloaded", model.RetryActionRetrySame},
+		{"global rule for other type", rules, config.ChannelTypeAnthropic, newAPIError(502, "", "", "", "bad gateway"), "server_error", model.RetryActionCooldown},
+		{"error code", rules, config.ChannelTypeOpenAI, newAPIError(400, "", "context_length_exceeded", "", ""), "context_length", model.RetryActionFail},
+		{"default rate limit", rules, config.ChannelTypeOpenAI, newAPIError(429, "", "", "", ""), "rate_limit", model.RetryActionCooldown},
+		{"default typed message", nil, config.ChannelTypeAnthropic, newAPIError(400, "", "", "", "Your credit balance is too low"), "anthropic_credit_balance", model.RetryActionRetry},
+		{"default bad request", nil, config.ChannelTypeOpenAI, newAPIError(400, "", "", "", "Your credit balance is too low"), "bad_request", model.RetryActionFail},
+		{"default timeout", nil, config.ChannelTypeOpenAI, newAPIError(504, "", "", "", ""), "timeout", model.RetryActionFail},
+		{"default fallback", nil, config.ChannelTypeOpenAI, newAPIError(500, "", "", "", ""), "default", model.RetryActionRetry},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rule := model.MatchRetryRule(c.rules, c.channelType, c.apiErr)
+			assert.Equal(t, c.rule, rule.Name)
+			assert.Equal(t, c.action, rule.Action)
+		})
+	}
+}
+
+func TestParseRetryRules(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"empty", "", true},
+		{"valid", `[{"status_codes": ["429", "5xx"], "action": "retry"}]`, true},
+		{"invalid action", `[{"action": "explode"}]`, false},
+		{"invalid status", `[{"status_codes": ["x00"], "action": "retry"}]`, false},
+		{"invalid regex", `[{"message": "(", "action": "retry"}]`, false},
+		{"negative backoff", `[{"action": "retry_same", "backoff": -1}]`, false},
+		{"invalid json", `{`, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := model.ParseRetryRules(c.value)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"done-hub/common"
+	"done-hub/common/logger"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// SecretSerializer 写入数据库前加密，读取时解密，未加密的历史数据可以直接读取
+type SecretSerializer struct{}
+
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var value string
+	switch v := dbValue.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case nil:
+	default:
+		return fmt.Errorf("unsupported secret value type %T", dbValue)
+	}
+
+	plaintext, err := common.DecryptSecret(value)
+	if err != nil {
+		return err
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (SecretSerializer) Value(_ context.Context, _ *schema.Field, _ reflect.Value, fieldValue any) (any, error) {
+	return common.EncryptSecret(fieldValue.(string))
+}
+
+// 以这些后缀结尾的配置项视为密钥，保存时加密
+var secretOptionSuffixes = []string{"Secret", "Token", "SecretKey", "ImageKey"}
+
+func isSecretOption(key string) bool {
+	for _, suffix := range secretOptionSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type secretColumn struct {
+	table  string
+	column string
+	where  string
+}
+
+// 需要加密的列
+var secretColumns = []secretColumn{
+	{table: "channels", column: "key"},
+	{table: "channel_keys", column: "key"},
+	{table: "payments", column: "config"},
+}
+
+// MigrateSecrets 加密数据库中未加密的密钥，rotate 时同时使用当前主密钥重新加密旧主密钥加密的内容
+func MigrateSecrets(rotate bool) error {
+	if !common.SecretEncryptionEnabled() {
+		return fmt.Errorf("secret encryption key is not set")
+	}
+
+	total := 0
+	for _, item := range secretColumns {
+		count, err := migrateSecretColumn(item.table, "id", item.column, rotate)
+		if err != nil {
+			return err
+		}
+		total += count
+	}
+
+	var options []*Option
+	if err := DB.Find(&options).Error; err != nil {
+		return err
+	}
+	for _, option := range options {
+		if !isSecretOption(option.Key) || !needMigrateSecret(option.Value, rotate) {
+			continue
+		}
+
+		value, err := common.RotateSecret(option.Value)
+		if err != nil {
+			return fmt.Errorf("option %s: %w", option.Key, err)
+		}
+		if err := DB.Model(&Option{}).Where(quotePostgresField("key")+" = ?", option.Key).Update("value", value).Error; err != nil {
+			return err
+		}
+		total++
+	}
+
+	logger.SysLog(fmt.Sprintf("secret_migration_done rotate=%t updated=%d", rotate, total))
+	return nil
+}
+
+func needMigrateSecret(value string, rotate bool) bool {
+	if value == "" || common.IsSecretUpToDate(value) {
+		return false
+	}
+
+	return rotate || !common.IsEncryptedSecret(value)
+}
+
+// migrateSecretColumn 直接读写原始列值，避免经过 SecretSerializer
+func migrateSecretColumn(table, idColumn, column string, rotate bool) (int, error) {
+	var rows []struct {
+		Id    int
+		Value string
+	}
+	err := DB.Table(table).
+		Select(fmt.Sprintf("%s AS id, %s AS value", idColumn, quotePostgresField(column))).
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, row := range rows {
+		if !needMigrateSecret(row.Value, rotate) {
+			continue
+		}
+
+		value, err := common.RotateSecret(row.Value)
+		if err != nil {
+			return count, fmt.Errorf("%s #%d: %w", table, row.Id, err)
+		}
+
+		if err := DB.Table(table).Where(idColumn+" = ?", row.Id).UpdateColumn(column, value).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"testing"
+
+	"done-hub/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeedMigrateSecret(t *testing.T) {
+	common.InitSecretEncryption("master", nil)
+	oldEncrypted, err := common.EncryptSecret("sk-test")
+	assert.NoError(t, err)
+
+	common.InitSecretEncryption("new-master", []string{"master"})
+	defer common.InitSecretEncryption("", nil)
+	newEncrypted, err := common.EncryptSecret("sk-test")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		value   string
+		rotate  bool
+		migrate bool
+	}{
+		{"empty", "", true, false},
+		{"plaintext", "sk-test", false, true},
+		{"plaintext rotate", "sk-test", true, true},
+		{"old key without rotate", oldEncrypted, false, false},
+		{"old key rotate", oldEncrypted, true, true},
+		{"up to date", newEncrypted, true, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.migrate, needMigrateSecret(c.value, c.rotate))
+		})
+	}
+}
+
+func TestIsSecretOption(t *testing.T) {
+	cases := []struct {
+		key    string
+		secret bool
+	}{
+		{"GitHubClientSecret", true},
+		{"TelegramBotToken", true},
+		{"StorageSecretKey", true},
+		{"SMMSImageKey", true},
+		{"GitHubClientId", false},
+		{"SystemName", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			assert.Equal(t, c.secret, isSecretOption(c.key))
+		})
+	}
+}
+
+func TestSecretSerializer(t *testing.T) {
+	common.InitSecretEncryption("master", nil)
+	defer common.InitSecretEncryption("", nil)
+
+	db := setupTestDB(t, &ChannelKey{})
+	legacy := &ChannelKey{ChannelId: 1, Key: "sk-legacy"}
+	assert.NoError(t, db.Create(legacy).Error)
+	key := &ChannelKey{ChannelId: 1, Key: "sk-secret"}
+	assert.NoError(t, db.Create(key).Error)
+
+	// 数据库中保存的是密文
+	var raw string
+	assert.NoError(t, db.Table("channel_keys").Select("key").Where("id = ?", key.Id).Scan(&raw).Error)
+	assert.True(t, common.IsEncryptedSecret(raw))
+	assert.NotContains(t, raw, "sk-secret")
+
+	// 读取时解密，未加密的历史数据原样读取
+	assert.NoError(t, db.Table("channel_keys").Where("id = ?", legacy.Id).UpdateColumn("key", "sk-legacy").Error)
+	var keys []*ChannelKey
+	assert.NoError(t, db.Order("id asc").Find(&keys).Error)
+	values := make([]string, 0, len(keys))
+	for _, item := range keys {
+		values = append(values, item.Key)
+	}
+	assert.ElementsMatch(t, []string{"sk-legacy", "sk-secret"}, values)
+}
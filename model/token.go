@@ -65,6 +65,14 @@ type TokenSetting struct {
 	Heartbeat HeartbeatSetting `json:"heartbeat,omitempty"`
 	Models    []string         `json:"models,omitempty"`
 	Subnet    string           `json:"subnet,omitempty"`
+	Cache     CacheSetting     `json:"cache,omitempty"`
+	Fallbacks ModelFallbacks   `json:"fallbacks,omitempty"` // 优先于分组的备用模型链
+}
+
+// CacheSetting 响应缓存设置，TTLSeconds 为 0 时使用分组或全局的缓存时间
+type CacheSetting struct {
+	Enabled    bool `json:"enabled"`
+	TTLSeconds int  `json:"ttl_seconds"`
 }
 
 type HeartbeatSetting struct {
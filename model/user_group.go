@@ -9,16 +9,22 @@ import (
 )
 
 type UserGroup struct {
-	Id        int     `json:"id"`
-	Symbol    string  `json:"symbol" gorm:"type:varchar(50);uniqueIndex"`
-	Name      string  `json:"name" gorm:"type:varchar(50)"`
-	Ratio     float64 `json:"ratio" gorm:"type:decimal(10,2); default:1"`      // 倍率
-	APIRate   int     `json:"api_rate" gorm:"default:600"`                     // 每分组允许的请求数
-	Public    bool    `json:"public" form:"public" gorm:"default:false"`       // 是否为公开分组，如果是，则可以被用户在令牌中选择
-	Promotion bool    `json:"promotion" form:"promotion" gorm:"default:false"` // 是否是自动升级用户组， 如果是则用户充值金额满足条件自动升级
-	Min       int     `json:"min" form:"min" gorm:"default:0"`                 // 晋级条件最小值
-	Max       int     `json:"max" form:"max" gorm:"default:0"`                 // 晋级条件最大值
-	Enable    *bool   `json:"enable" form:"enable" gorm:"default:true"`        // 是否启用
+	Id         int     `json:"id"`
+	Symbol     string  `json:"symbol" gorm:"type:varchar(50);uniqueIndex"`
+	Name       string  `json:"name" gorm:"type:varchar(50)"`
+	Ratio      float64 `json:"ratio" gorm:"type:decimal(10,2); default:1"`      // 倍率
+	APIRate    int     `json:"api_rate" gorm:"default:600"`                     // 每分组允许的请求数
+	Public     bool    `json:"public" form:"public" gorm:"default:false"`       // 是否为公开分组，如果是，则可以被用户在令牌中选择
+	Promotion  bool    `json:"promotion" form:"promotion" gorm:"default:false"` // 是否是自动升级用户组， 如果是则用户充值金额满足条件自动升级
+	Min        int     `json:"min" form:"min" gorm:"default:0"`                 // 晋级条件最小值
+	Max        int     `json:"max" form:"max" gorm:"default:0"`                 // 晋级条件最大值
+	Enable     *bool   `json:"enable" form:"enable" gorm:"default:true"`        // 是否启用
+	CacheTTL   int     `json:"cache_ttl" form:"cache_ttl" gorm:"default:0"`     // 响应缓存时间（秒），0 为使用全局设置
+	HedgeDelay int     `json:"hedge_delay" form:"hedge_delay" gorm:"default:0"` // 对冲请求延迟（毫秒），0 为不启用
+
+	AffinityMessages int `json:"affinity_messages" form:"affinity_messages" gorm:"default:0"` // 亲和路由参与哈希的消息条数，0 为不启用
+
+	ModelFallbacks string `json:"model_fallbacks" form:"model_fallbacks" gorm:"type:text"` // 备用模型链，JSON 格式，模型 -> 备用模型列表
 }
 
 type SearchUserGroupParams struct {
@@ -79,7 +85,7 @@ func (c *UserGroup) Create() error {
 }
 
 func (c *UserGroup) Update() error {
-	err := DB.Select("name", "ratio", "public", "api_rate", "promotion", "min", "max").Updates(c).Error
+	err := DB.Select("name", "ratio", "public", "api_rate", "promotion", "min", "max", "cache_ttl", "hedge_delay", "affinity_messages").Updates(c).Error
 	if err == nil {
 		GlobalUserGroupRatio.Load()
 	}
@@ -106,9 +112,10 @@ func ChangeUserGroupEnable(id int, enable bool) error {
 
 type UserGroupRatio struct {
 	sync.RWMutex
-	UserGroup   map[string]*UserGroup
-	APILimiter  map[string]limit.RateLimiter
-	PublicGroup []string
+	UserGroup      map[string]*UserGroup
+	APILimiter     map[string]limit.RateLimiter
+	PublicGroup    []string
+	ModelFallbacks map[string]ModelFallbacks
 }
 
 var GlobalUserGroupRatio = UserGroupRatio{}
@@ -122,6 +129,8 @@ func (cgrm *UserGroupRatio) Load() {
 	newUserGroups := make(map[string]*UserGroup, len(userGroups))
 	newAPILimiter := make(map[string]limit.RateLimiter, len(userGroups))
 	publicGroup := make([]string, 0)
+	affinity := make(map[string]int)
+	modelFallbacks := make(map[string]ModelFallbacks)
 
 	for _, userGroup := range userGroups {
 		newUserGroups[userGroup.Symbol] = userGroup
@@ -129,14 +138,28 @@ func (cgrm *UserGroupRatio) Load() {
 		if userGroup.Public {
 			publicGroup = append(publicGroup, userGroup.Symbol)
 		}
+		if userGroup.AffinityMessages > 0 {
+			affinity[userGroup.Symbol] = userGroup.AffinityMessages
+		}
+		if userGroup.ModelFallbacks != "" {
+			fallbacks, err := ParseModelFallbacks(userGroup.ModelFallbacks)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("invalid model fallbacks for user group %s: %s", userGroup.Symbol, err.Error()))
+				continue
+			}
+			modelFallbacks[userGroup.Symbol] = fallbacks
+		}
 	}
 
+	ChannelGroup.SetAffinity(affinity)
+
 	cgrm.Lock()
 	defer cgrm.Unlock()
 
 	cgrm.UserGroup = newUserGroups
 	cgrm.APILimiter = newAPILimiter
 	cgrm.PublicGroup = publicGroup
+	cgrm.ModelFallbacks = modelFallbacks
 }
 
 func (cgrm *UserGroupRatio) GetBySymbol(symbol string) *UserGroup {
@@ -163,6 +186,14 @@ func (cgrm *UserGroupRatio) GetByTokenUserGroup(tokenGroup, userGroup string) *U
 	return cgrm.GetBySymbol(userGroup)
 }
 
+// GetModelFallbacks 返回分组为模型配置的备用模型链，未配置时返回 nil
+func (cgrm *UserGroupRatio) GetModelFallbacks(symbol, modelName string) []string {
+	cgrm.RLock()
+	defer cgrm.RUnlock()
+
+	return cgrm.ModelFallbacks[symbol][modelName]
+}
+
 func (cgrm *UserGroupRatio) GetAll() map[string]*UserGroup {
 	cgrm.RLock()
 	defer cgrm.RUnlock()
@@ -211,7 +242,7 @@ func CheckAndUpgradeUserGroup(userId int, rechargeAmount int) error {
 
 	// Calculate cumulative recharge amount
 	cumulativeAmount := user.Quota + user.UsedQuota + rechargeAmount
-	logger.SysError(fmt.Sprintf("use:%f q:%f  cumulative:%f rechargeAmount:%f", (float64)(user.UsedQuota)/config.QuotaPerUnit, (float64)(user.Quota)/config.QuotaPerUnit, (float64)(cumulativeAmount)/config.QuotaPerUnit, rechargeAmount))
+	logger.SysError(fmt.Sprintf("use:%f q:%f  cumulative:%f rechargeAmount:%d", (float64)(user.UsedQuota)/config.QuotaPerUnit, (float64)(user.Quota)/config.QuotaPerUnit, (float64)(cumulativeAmount)/config.QuotaPerUnit, rechargeAmount))
 	// Get all promotion-enabled user groups
 	var promotionGroups []*UserGroup
 	err = DB.Where("promotion = ? AND enable = ?", true, true).Find(&promotionGroups).Error
@@ -1,6 +1,7 @@
 package baidu
 
 import (
+	"crypto/md5"
 	"done-hub/common/cache"
 	"done-hub/common/logger"
 	"done-hub/common/requester"
@@ -190,7 +191,8 @@ func (p *BaiduProvider) GetRequestHeaders() (headers map[string]string) {
 
 func (p *BaiduProvider) getBaiduAccessToken() (string, error) {
 	apiKey := p.Channel.Key
-	cacheKey := fmt.Sprintf("%s:%d", baiduCacheKey, p.Channel.Id)
+	// key 池渠道的每个 key 有各自的 token
+	cacheKey := fmt.Sprintf("%s:%d:%x", baiduCacheKey, p.Channel.Id, md5.Sum([]byte(apiKey)))
 	tokenStr, err := cache.GetCache[string](cacheKey)
 	if err != nil {
 		logger.SysError("get baidu token error: " + err.Error())
@@ -7,7 +7,9 @@ import (
 	"done-hub/providers/bedrock/category"
 	"done-hub/providers/claude"
 	"done-hub/types"
+	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 func (p *BedrockProvider) CreateClaudeChat(request *claude.ClaudeRequest) (*claude.ClaudeResponse, *types.OpenAIErrorWithStatusCode) {
@@ -104,3 +106,55 @@ func (p *BedrockProvider) getClaudeRequest(request *claude.ClaudeRequest) (*http
 
 	return req, nil
 }
+
+func (p *BedrockProvider) CountClaudeTokens(request *claude.ClaudeCountTokensRequest) (*claude.ClaudeCountTokensResponse, *types.OpenAIErrorWithStatusCode) {
+	var err error
+	p.Category, err = category.GetCategory(request.Model)
+	if err != nil || p.Category == nil {
+		return nil, common.StringErrorWrapperLocal("bedrock provider not found", "bedrock_err", http.StatusInternalServerError)
+	}
+
+	// CountTokens 只接受基础模型ID，去掉跨区域推理前缀
+	modelName := p.Category.ModelName
+	if index := strings.Index(modelName, "anthropic."); index > 0 {
+		modelName = modelName[index:]
+	}
+
+	fullRequestURL := p.GetFullRequestURL(countTokensURL, modelName)
+	headers := p.GetRequestHeaders()
+
+	// invokeModel.body 需要是一个完整的 InvokeModel 请求，max_tokens 为必填项
+	invokeBody, err := json.Marshal(&category.ClaudeRequest{
+		ClaudeRequest: &claude.ClaudeRequest{
+			System:     request.System,
+			Messages:   request.Messages,
+			MaxTokens:  1,
+			Tools:      request.Tools,
+			ToolChoice: request.ToolChoice,
+			Thinking:   request.Thinking,
+		},
+		AnthropicVersion: category.AnthropicVersion,
+	})
+	if err != nil {
+		return nil, common.ErrorWrapperLocal(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+
+	countRequest := &CountTokensRequest{}
+	countRequest.Input.InvokeModel.Body = invokeBody
+
+	req, err := p.Requester.NewRequest(http.MethodPost, fullRequestURL, p.Requester.WithBody(countRequest), p.Requester.WithHeader(headers))
+	if err != nil {
+		return nil, common.StringErrorWrapperLocal(err.Error(), "new_request_failed", http.StatusInternalServerError)
+	}
+	defer req.Body.Close()
+
+	p.Sign(req)
+
+	countResponse := &CountTokensResponse{}
+	_, openaiErr := p.Requester.SendRequest(req, countResponse, false)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+
+	return &claude.ClaudeCountTokensResponse{InputTokens: countResponse.InputTokens}, nil
+}
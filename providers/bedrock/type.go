@@ -2,6 +2,8 @@ package bedrock
 
 const awsService = "bedrock"
 
+const countTokensURL = "/model/%s/count-tokens"
+
 type BedrockError struct {
 	Message string `json:"message"`
 }
@@ -9,3 +11,15 @@ type BedrockError struct {
 type BedrockResponseStream struct {
 	Bytes string `json:"bytes"`
 }
+
+type CountTokensRequest struct {
+	Input struct {
+		InvokeModel struct {
+			Body []byte `json:"body"`
+		} `json:"invokeModel"`
+	} `json:"input"`
+}
+
+type CountTokensResponse struct {
+	InputTokens int `json:"inputTokens"`
+}
@@ -11,3 +11,8 @@ type ClaudeChatInterface interface {
 	CreateClaudeChat(request *ClaudeRequest) (*ClaudeResponse, *types.OpenAIErrorWithStatusCode)
 	CreateClaudeChatStream(request *ClaudeRequest) (requester.StreamReaderInterface[string], *types.OpenAIErrorWithStatusCode)
 }
+
+type ClaudeCountTokensInterface interface {
+	base.ProviderInterface
+	CountClaudeTokens(request *ClaudeCountTokensRequest) (*ClaudeCountTokensResponse, *types.OpenAIErrorWithStatusCode)
+}
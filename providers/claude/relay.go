@@ -2,13 +2,17 @@ package claude
 
 import (
 	"bytes"
+	"done-hub/common"
 	"done-hub/common/requester"
 	"done-hub/types"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 )
 
+const countTokensURL = "/v1/messages/count_tokens"
+
 type ClaudeRelayStreamHandler struct {
 	Usage      *types.Usage
 	ModelName  string
@@ -70,6 +74,25 @@ func (p *ClaudeProvider) CreateClaudeChatStream(request *ClaudeRequest) (request
 	return stream, nil
 }
 
+func (p *ClaudeProvider) CountClaudeTokens(request *ClaudeCountTokensRequest) (*ClaudeCountTokensResponse, *types.OpenAIErrorWithStatusCode) {
+	fullRequestURL := p.GetFullRequestURL(countTokensURL)
+	headers := p.GetRequestHeaders()
+
+	req, err := p.Requester.NewRequest(http.MethodPost, fullRequestURL, p.Requester.WithBody(request), p.Requester.WithHeader(headers))
+	if err != nil {
+		return nil, common.ErrorWrapperLocal(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	defer req.Body.Close()
+
+	countResponse := &ClaudeCountTokensResponse{}
+	_, errWithCode := p.Requester.SendRequest(req, countResponse, false)
+	if errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return countResponse, nil
+}
+
 func (h *ClaudeRelayStreamHandler) HandlerStream(rawLine *[]byte, dataChan chan string, errChan chan error) {
 	rawStr := string(*rawLine)
 	// 如果rawLine 前缀不为data:，则直接返回
@@ -134,6 +134,33 @@ type ClaudeRequest struct {
 	Stream bool `json:"stream,omitempty"`
 }
 
+// ClaudeCountTokensRequest messages/count_tokens 请求体，只保留上游允许的字段
+type ClaudeCountTokensRequest struct {
+	Model      string      `json:"model,omitempty"`
+	System     any         `json:"system,omitempty"`
+	Messages   []Message   `json:"messages"`
+	Tools      []Tools     `json:"tools,omitempty"`
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+	Thinking   *Thinking   `json:"thinking,omitempty"`
+	McpServers any         `json:"mcp_servers,omitempty"`
+}
+
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+func NewCountTokensRequest(request *ClaudeRequest) *ClaudeCountTokensRequest {
+	return &ClaudeCountTokensRequest{
+		Model:      request.Model,
+		System:     request.System,
+		Messages:   request.Messages,
+		Tools:      request.Tools,
+		ToolChoice: request.ToolChoice,
+		Thinking:   request.Thinking,
+		McpServers: request.McpServers,
+	}
+}
+
 type Thinking struct {
 	Type         string `json:"type,omitempty"`
 	BudgetTokens int    `json:"budget_tokens,omitempty"`
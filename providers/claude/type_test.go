@@ -0,0 +1,38 @@
+package claude_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"done-hub/providers/claude"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCountTokensRequest(t *testing.T) {
+	temperature := 0.5
+	request := &claude.ClaudeRequest{
+		Model:       "claude-3-5-sonnet",
+		System:      "system",
+		Messages:    []claude.Message{{Role: "user", Content: "hello"}},
+		MaxTokens:   1024,
+		Temperature: &temperature,
+		Stream:      true,
+	}
+
+	body, err := json.Marshal(claude.NewCountTokensRequest(request))
+	assert.NoError(t, err)
+
+	// 上游 count_tokens 不接受生成参数
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(body, &fields))
+	assert.ElementsMatch(t, []string{"model", "system", "messages"}, keys(fields))
+}
+
+func keys(m map[string]any) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
@@ -16,3 +16,14 @@ type GeminiVeoInterface interface {
 	base.ProviderInterface
 	CreateVeoVideoAndDownload(request *VeoVideoRequest, modelName string) ([]byte, string, *types.OpenAIErrorWithStatusCode)
 }
+
+type GeminiEmbeddingsInterface interface {
+	base.ProviderInterface
+	CreateGeminiEmbedContent(request *GeminiEmbedContentRequest, modelName string) (*GeminiEmbedContentResponse, *types.OpenAIErrorWithStatusCode)
+	CreateGeminiBatchEmbedContents(request *GeminiBatchEmbedContentsRequest, modelName string) (*GeminiBatchEmbedContentsResponse, *types.OpenAIErrorWithStatusCode)
+}
+
+type GeminiCountTokensInterface interface {
+	base.ProviderInterface
+	CountGeminiTokens(request *GeminiCountTokensRequest) (*GeminiCountTokensResponse, *types.OpenAIErrorWithStatusCode)
+}
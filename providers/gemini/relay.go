@@ -122,3 +122,61 @@ func (h *GeminiRelayStreamHandler) HandlerStream(rawLine *[]byte, dataChan chan
 
 	dataChan <- rawStr
 }
+
+func (p *GeminiProvider) CreateGeminiEmbedContent(request *GeminiEmbedContentRequest, modelName string) (*GeminiEmbedContentResponse, *types.OpenAIErrorWithStatusCode) {
+	copyRequest := *request
+	copyRequest.Model = ""
+
+	embedResponse := &GeminiEmbedContentResponse{}
+	if errWithCode := p.sendNativeRequest("embedContent", modelName, &copyRequest, embedResponse); errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return embedResponse, nil
+}
+
+func (p *GeminiProvider) CreateGeminiBatchEmbedContents(request *GeminiBatchEmbedContentsRequest, modelName string) (*GeminiBatchEmbedContentsResponse, *types.OpenAIErrorWithStatusCode) {
+	// 批量请求中每一项都必须带上与 URL 一致的模型名
+	batchRequest := &GeminiBatchEmbedContentsRequest{
+		Requests: make([]GeminiEmbedContentRequest, 0, len(request.Requests)),
+	}
+	for _, item := range request.Requests {
+		item.Model = "models/" + modelName
+		batchRequest.Requests = append(batchRequest.Requests, item)
+	}
+
+	batchResponse := &GeminiBatchEmbedContentsResponse{}
+	if errWithCode := p.sendNativeRequest("batchEmbedContents", modelName, batchRequest, batchResponse); errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return batchResponse, nil
+}
+
+func (p *GeminiProvider) CountGeminiTokens(request *GeminiCountTokensRequest) (*GeminiCountTokensResponse, *types.OpenAIErrorWithStatusCode) {
+	if request.GenerateContentRequest != nil {
+		request.GenerateContentRequest.Model = "models/" + request.Model
+	}
+
+	countResponse := &GeminiCountTokensResponse{}
+	if errWithCode := p.sendNativeRequest("countTokens", request.Model, request, countResponse); errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return countResponse, nil
+}
+
+// sendNativeRequest 发送非对话类的 Gemini 原生请求
+func (p *GeminiProvider) sendNativeRequest(action, modelName string, body any, response any) *types.OpenAIErrorWithStatusCode {
+	fullRequestURL := p.GetFullRequestURL(action, modelName)
+	headers := p.GetRequestHeaders()
+
+	req, err := p.Requester.NewRequest(http.MethodPost, fullRequestURL, p.Requester.WithBody(body), p.Requester.WithHeader(headers))
+	if err != nil {
+		return common.ErrorWrapperLocal(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	defer req.Body.Close()
+
+	_, errWithCode := p.Requester.SendRequest(req, response, false)
+	return errWithCode
+}
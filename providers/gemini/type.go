@@ -159,12 +159,54 @@ func (r *GeminiChatRequest) SetJsonRaw(c *gin.Context) {
 	r.JsonRaw = rawData
 }
 
+type GeminiEmbedContentRequest struct {
+	Model                string            `json:"model,omitempty"`
+	Content              GeminiChatContent `json:"content"`
+	TaskType             string            `json:"taskType,omitempty"`
+	Title                string            `json:"title,omitempty"`
+	OutputDimensionality int               `json:"outputDimensionality,omitempty"`
+}
+
+type GeminiBatchEmbedContentsRequest struct {
+	Requests []GeminiEmbedContentRequest `json:"requests"`
+}
+
+type GeminiContentEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+type GeminiEmbedContentResponse struct {
+	Embedding GeminiContentEmbedding `json:"embedding"`
+}
+
+type GeminiBatchEmbedContentsResponse struct {
+	Embeddings []GeminiContentEmbedding `json:"embeddings"`
+}
+
+type GeminiCountTokensRequest struct {
+	Model                  string                             `json:"-"`
+	Contents               []GeminiChatContent                `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiCountGenerateContentRequest `json:"generateContentRequest,omitempty"`
+}
+
+type GeminiCountGenerateContentRequest struct {
+	Model string `json:"model,omitempty"`
+	*GeminiChatRequest
+}
+
+type GeminiCountTokensResponse struct {
+	TotalTokens             int                          `json:"totalTokens"`
+	CachedContentTokenCount int                          `json:"cachedContentTokenCount,omitempty"`
+	PromptTokensDetails     []GeminiUsageMetadataDetails `json:"promptTokensDetails,omitempty"`
+}
+
 type GeminiToolConfig struct {
 	FunctionCallingConfig *GeminiFunctionCallingConfig `json:"functionCallingConfig,omitempty"`
 }
 
 type GeminiFunctionCallingConfig struct {
 	Model                string `json:"model,omitempty"`
+	Mode                 string `json:"mode,omitempty"`
 	AllowedFunctionNames any    `json:"allowedFunctionNames,omitempty"`
 }
 type GeminiInlineData struct {
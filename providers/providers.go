@@ -41,6 +41,7 @@ import (
 	"done-hub/providers/xAI"
 	"done-hub/providers/xunfei"
 	"done-hub/providers/zhipu"
+	"errors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -96,15 +97,30 @@ func init() {
 	}
 }
 
-// GetProvider 获取供应商
+// GetProvider 获取供应商，无法创建时返回 nil
 func GetProvider(channel *model.Channel, c *gin.Context) base.ProviderInterface {
+	provider, _ := NewProvider(channel, c)
+	return provider
+}
+
+// NewProvider 获取供应商，并返回无法创建的原因
+func NewProvider(channel *model.Channel, c *gin.Context) (base.ProviderInterface, error) {
+	// key 池渠道每次请求选择一个 key，提供者使用替换了 key 的渠道副本，已指定 key 的副本直接使用
+	if channel.IsKeyPool() && channel.KeyId == 0 {
+		key, err := model.ChannelKeyPool.Next(channel)
+		if err != nil {
+			return nil, err
+		}
+		channel = channel.WithPoolKey(key)
+	}
+
 	factory, ok := providerFactories[channel.Type]
 	var provider base.ProviderInterface
 	if !ok {
 		// 处理未找到的供应商工厂
 		baseURL := channel.GetBaseURL()
 		if baseURL == "" {
-			return nil
+			return nil, errors.New("channel not implemented")
 		}
 
 		provider = openai.CreateOpenAIProvider(channel, baseURL)
@@ -113,5 +129,5 @@ func GetProvider(channel *model.Channel, c *gin.Context) base.ProviderInterface
 	}
 	provider.SetContext(c)
 
-	return provider
+	return provider, nil
 }
@@ -3,6 +3,7 @@ package vertexai
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"crypto/rand"
 	"done-hub/common"
 	"done-hub/common/cache"
@@ -130,7 +131,8 @@ func (p *VertexAIProvider) handleTokenError(err error) *types.OpenAIErrorWithSta
 }
 
 func (p *VertexAIProvider) GetToken() (string, error) {
-	cacheKey := fmt.Sprintf("%s:%s", TokenCacheKey, p.ProjectID)
+	// 同一项目可能配置了多个服务账号，按凭证区分
+	cacheKey := fmt.Sprintf("%s:%s:%x", TokenCacheKey, p.ProjectID, md5.Sum([]byte(p.Channel.Key)))
 	token, err := cache.GetCache[string](cacheKey)
 	if err != nil {
 		logger.SysError("Failed to get token from cache: " + err.Error())
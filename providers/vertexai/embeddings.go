@@ -0,0 +1,161 @@
+package vertexai
+
+import (
+	"done-hub/common"
+	"done-hub/providers/gemini"
+	"done-hub/types"
+	"net/http"
+	"strings"
+)
+
+type vertexEmbeddingInstance struct {
+	Content  string `json:"content"`
+	TaskType string `json:"task_type,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+type vertexEmbeddingParameters struct {
+	OutputDimensionality int `json:"outputDimensionality,omitempty"`
+}
+
+type vertexEmbeddingRequest struct {
+	Instances  []vertexEmbeddingInstance  `json:"instances"`
+	Parameters *vertexEmbeddingParameters `json:"parameters,omitempty"`
+}
+
+type vertexEmbeddingResponse struct {
+	Predictions []struct {
+		Embeddings struct {
+			Values     []float64 `json:"values"`
+			Statistics struct {
+				TokenCount int `json:"token_count"`
+			} `json:"statistics"`
+		} `json:"embeddings"`
+	} `json:"predictions"`
+}
+
+func (p *VertexAIProvider) CreateEmbeddings(request *types.EmbeddingRequest) (*types.EmbeddingResponse, *types.OpenAIErrorWithStatusCode) {
+	inputs := request.ParseInput()
+	instances := make([]vertexEmbeddingInstance, 0, len(inputs))
+	for _, input := range inputs {
+		instances = append(instances, vertexEmbeddingInstance{Content: input})
+	}
+
+	embeddings, errWithCode := p.predictEmbeddings(request.Model, instances, request.Dimensions)
+	if errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	response := &types.EmbeddingResponse{
+		Object: "list",
+		Model:  request.Model,
+		Data:   make([]types.Embedding, 0, len(embeddings)),
+		Usage:  p.GetUsage(),
+	}
+	for i, embedding := range embeddings {
+		response.Data = append(response.Data, types.Embedding{
+			Object:    "embedding",
+			Embedding: embedding.Values,
+			Index:     i,
+		})
+	}
+
+	return response, nil
+}
+
+func (p *VertexAIProvider) CreateGeminiEmbedContent(request *gemini.GeminiEmbedContentRequest, modelName string) (*gemini.GeminiEmbedContentResponse, *types.OpenAIErrorWithStatusCode) {
+	embeddings, errWithCode := p.predictEmbeddings(modelName, []vertexEmbeddingInstance{convertEmbeddingInstance(request)}, request.OutputDimensionality)
+	if errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return &gemini.GeminiEmbedContentResponse{Embedding: embeddings[0]}, nil
+}
+
+func (p *VertexAIProvider) CreateGeminiBatchEmbedContents(request *gemini.GeminiBatchEmbedContentsRequest, modelName string) (*gemini.GeminiBatchEmbedContentsResponse, *types.OpenAIErrorWithStatusCode) {
+	instances := make([]vertexEmbeddingInstance, 0, len(request.Requests))
+	dimensions := 0
+	for i := range request.Requests {
+		instances = append(instances, convertEmbeddingInstance(&request.Requests[i]))
+		if request.Requests[i].OutputDimensionality > 0 {
+			dimensions = request.Requests[i].OutputDimensionality
+		}
+	}
+
+	embeddings, errWithCode := p.predictEmbeddings(modelName, instances, dimensions)
+	if errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return &gemini.GeminiBatchEmbedContentsResponse{Embeddings: embeddings}, nil
+}
+
+// convertEmbeddingInstance Vertex AI 的 embeddings 只接受文本，多个文本 part 合并为一条输入
+func convertEmbeddingInstance(request *gemini.GeminiEmbedContentRequest) vertexEmbeddingInstance {
+	texts := make([]string, 0, len(request.Content.Parts))
+	for _, part := range request.Content.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+
+	return vertexEmbeddingInstance{
+		Content:  strings.Join(texts, "\n"),
+		TaskType: request.TaskType,
+		Title:    request.Title,
+	}
+}
+
+// predictEmbeddings 调用 Vertex AI 的 :predict 接口，并按返回的 token 数记录用量
+func (p *VertexAIProvider) predictEmbeddings(modelName string, instances []vertexEmbeddingInstance, dimensions int) ([]gemini.GeminiContentEmbedding, *types.OpenAIErrorWithStatusCode) {
+	if len(instances) == 0 {
+		return nil, common.StringErrorWrapperLocal("input is required", "invalid_request", http.StatusBadRequest)
+	}
+
+	fullRequestURL := p.GetFullRequestURL(modelName, "predict")
+	if fullRequestURL == "" {
+		return nil, common.StringErrorWrapperLocal("vertexAI config error", "invalid_vertexai_config", http.StatusInternalServerError)
+	}
+
+	headers, err := p.getRequestHeadersInternal()
+	if err != nil {
+		return nil, p.handleTokenError(err)
+	}
+
+	embeddingRequest := &vertexEmbeddingRequest{Instances: instances}
+	if dimensions > 0 {
+		embeddingRequest.Parameters = &vertexEmbeddingParameters{OutputDimensionality: dimensions}
+	}
+
+	p.Requester.ErrorHandler = RequestErrorHandle(nil)
+
+	req, err := p.Requester.NewRequest(http.MethodPost, fullRequestURL, p.Requester.WithBody(embeddingRequest), p.Requester.WithHeader(headers))
+	if err != nil {
+		return nil, common.ErrorWrapperLocal(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	defer req.Body.Close()
+
+	embeddingResponse := &vertexEmbeddingResponse{}
+	if _, errWithCode := p.Requester.SendRequest(req, embeddingResponse, false); errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	if len(embeddingResponse.Predictions) != len(instances) {
+		return nil, common.StringErrorWrapper("embedding count mismatch", "vertexAI_err", http.StatusInternalServerError)
+	}
+
+	promptTokens := 0
+	embeddings := make([]gemini.GeminiContentEmbedding, 0, len(embeddingResponse.Predictions))
+	for _, prediction := range embeddingResponse.Predictions {
+		promptTokens += prediction.Embeddings.Statistics.TokenCount
+		embeddings = append(embeddings, gemini.GeminiContentEmbedding{Values: prediction.Embeddings.Values})
+	}
+
+	if promptTokens > 0 {
+		usage := p.GetUsage()
+		usage.PromptTokens = promptTokens
+		usage.TotalTokens = promptTokens
+	}
+
+	return embeddings, nil
+}
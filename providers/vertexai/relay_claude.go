@@ -0,0 +1,41 @@
+package vertexai
+
+import (
+	"done-hub/common"
+	"done-hub/providers/claude"
+	"done-hub/providers/vertexai/category"
+	"done-hub/types"
+	"net/http"
+	"strings"
+)
+
+func (p *VertexAIProvider) CountClaudeTokens(request *claude.ClaudeCountTokensRequest) (*claude.ClaudeCountTokensResponse, *types.OpenAIErrorWithStatusCode) {
+	headers, err := p.getRequestHeadersInternal()
+	if err != nil {
+		return nil, p.handleTokenError(err)
+	}
+
+	// count-tokens 挂在 anthropic publisher 下，模型名放在请求体中
+	fullRequestURL := p.GetFullRequestURL("count-tokens", "rawPredict")
+	fullRequestURL = strings.Replace(fullRequestURL, "/publishers/google/", "/publishers/anthropic/", 1)
+
+	copyRequest := *request
+	copyRequest.Model = category.GetClaudeModelName(request.Model)
+
+	// 错误处理
+	p.Requester.ErrorHandler = RequestErrorHandle(claude.RequestErrorHandle)
+
+	req, err := p.Requester.NewRequest(http.MethodPost, fullRequestURL, p.Requester.WithBody(&copyRequest), p.Requester.WithHeader(headers))
+	if err != nil {
+		return nil, common.ErrorWrapperLocal(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	defer req.Body.Close()
+
+	countResponse := &claude.ClaudeCountTokensResponse{}
+	_, errWithCode := p.Requester.SendRequest(req, countResponse, false)
+	if errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return countResponse, nil
+}
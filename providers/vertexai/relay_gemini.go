@@ -152,3 +152,45 @@ func convertOpenAIUsage(geminiUsage *gemini.GeminiUsageMetadata) types.Usage {
 		},
 	}
 }
+
+func (p *VertexAIProvider) CountGeminiTokens(request *gemini.GeminiCountTokensRequest) (*gemini.GeminiCountTokensResponse, *types.OpenAIErrorWithStatusCode) {
+	var err error
+	p.Category, err = category.GetCategory(request.Model)
+	if err != nil || p.Category.Category != "gemini" {
+		return nil, common.StringErrorWrapperLocal("vertexAI gemini provider not found", "vertexAI_err", http.StatusInternalServerError)
+	}
+
+	fullRequestURL := p.GetFullRequestURL(p.Category.GetModelName(request.Model), getVertexAIGeminiURL("countTokens", false))
+	if fullRequestURL == "" {
+		return nil, common.StringErrorWrapperLocal("vertexAI config error", "invalid_vertexai_config", http.StatusInternalServerError)
+	}
+
+	headers, err := p.getRequestHeadersInternal()
+	if err != nil {
+		return nil, p.handleTokenError(err)
+	}
+
+	// Vertex AI 不支持 generateContentRequest 包装，展开为顶层字段
+	countRequest := &vertexCountTokensRequest{Contents: request.Contents}
+	if request.GenerateContentRequest != nil && request.GenerateContentRequest.GeminiChatRequest != nil {
+		countRequest.Contents = request.GenerateContentRequest.Contents
+		countRequest.SystemInstruction = request.GenerateContentRequest.SystemInstruction
+		countRequest.Tools = request.GenerateContentRequest.Tools
+	}
+
+	p.Requester.ErrorHandler = RequestErrorHandle(p.Category.ErrorHandler)
+
+	req, err := p.Requester.NewRequest(http.MethodPost, fullRequestURL, p.Requester.WithBody(countRequest), p.Requester.WithHeader(headers))
+	if err != nil {
+		return nil, common.ErrorWrapperLocal(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	defer req.Body.Close()
+
+	countResponse := &gemini.GeminiCountTokensResponse{}
+	_, errWithCode := p.Requester.SendRequest(req, countResponse, false)
+	if errWithCode != nil {
+		return nil, errWithCode
+	}
+
+	return countResponse, nil
+}
@@ -1,5 +1,7 @@
 package vertexai
 
+import "done-hub/providers/gemini"
+
 type Credentials struct {
 	Type                    string `json:"type"`
 	ProjectID               string `json:"project_id"`
@@ -27,3 +29,9 @@ type VertexaiError struct {
 func (e *VertexaiErrors) Error() *VertexaiError {
 	return (*e)[0]
 }
+
+type vertexCountTokensRequest struct {
+	Contents          []gemini.GeminiChatContent `json:"contents,omitempty"`
+	SystemInstruction any                        `json:"systemInstruction,omitempty"`
+	Tools             []gemini.GeminiChatTools   `json:"tools,omitempty"`
+}
@@ -1,6 +1,7 @@
 package zhipu
 
 import (
+	"crypto/md5"
 	"done-hub/common/cache"
 	"done-hub/common/logger"
 	"done-hub/common/requester"
@@ -85,7 +86,9 @@ func (p *ZhipuProvider) GetFullRequestURL(requestURL string) string {
 }
 
 func (p *ZhipuProvider) getZhipuToken() string {
-	cacheKey := fmt.Sprintf("%s:%d", zhiPuCacheKey, p.Channel.Id)
+	apikey := p.Channel.Key
+	// key 池渠道的每个 key 有各自的 token
+	cacheKey := fmt.Sprintf("%s:%d:%x", zhiPuCacheKey, p.Channel.Id, md5.Sum([]byte(apikey)))
 	tokenStr, err := cache.GetCache[string](cacheKey)
 	if err != nil {
 		logger.SysError("get zhipu token error: " + err.Error())
@@ -95,7 +98,6 @@ func (p *ZhipuProvider) getZhipuToken() string {
 		return tokenStr
 	}
 
-	apikey := p.Channel.Key
 	split := strings.Split(apikey, ".")
 	if len(split) != 2 {
 		logger.SysError("invalid zhipu key: " + apikey)
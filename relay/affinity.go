@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"done-hub/common/config"
+	"done-hub/model"
+	"done-hub/providers/claude"
+	"done-hub/types"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+const affinitySessionHeader = "X-Session-Id"
+
+// setAffinityKey 分组启用亲和路由时，优先使用会话标识，否则使用稳定的提示词前缀计算路由键，
+// 使同一会话尽量落在同一渠道以提高上游提示词缓存的命中率
+func setAffinityKey(c *gin.Context, session string, prefix func(n int) any) {
+	messages := model.ChannelGroup.GetAffinityMessages(c.GetString("token_group"))
+	if messages <= 0 {
+		return
+	}
+
+	if header := c.GetHeader(affinitySessionHeader); header != "" {
+		session = header
+	}
+
+	var data []byte
+	if session != "" {
+		data = []byte("session:" + session)
+	} else {
+		var err error
+		if data, err = json.Marshal(prefix(messages)); err != nil {
+			return
+		}
+	}
+
+	hash := sha256.Sum256(data)
+	c.Set("affinity_key", hex.EncodeToString(hash[:]))
+}
+
+func setChatAffinityKey(c *gin.Context, request *types.ChatCompletionRequest) {
+	setAffinityKey(c, request.User, func(n int) any {
+		// 开头的系统提示词全部参与计算，之后取前 n 条消息
+		end := 0
+		for end < len(request.Messages) && request.Messages[end].IsSystemRole() {
+			end++
+		}
+
+		return request.Messages[:min(end+n, len(request.Messages))]
+	})
+}
+
+func setClaudeAffinityKey(c *gin.Context, request *claude.ClaudeRequest) {
+	setAffinityKey(c, "", func(n int) any {
+		return []any{request.System, request.Messages[:min(n, len(request.Messages))]}
+	})
+}
+
+// recordPromptCacheUsage 记录渠道的提示词缓存命中率，OpenAI 与 Anthropic 的缓存读取分别记录在不同的字段
+func recordPromptCacheUsage(relay RelayBaseInterface, usage *types.Usage) {
+	extraTokens := usage.GetExtraTokens()
+	cachedTokens := extraTokens[config.UsageExtraCache] + extraTokens[config.UsageExtraCachedRead]
+
+	model.ChannelStats.RecordCacheUsage(relay.getProvider().GetChannel().Id, relay.getContext().GetString("matched_model"), usage.PromptTokens, cachedTokens)
+}
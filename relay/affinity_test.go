@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"done-hub/model"
+	"done-hub/providers/claude"
+	"done-hub/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAffinityTestContext(t *testing.T, group string, session string) *gin.Context {
+	model.ChannelGroup.SetAffinity(map[string]int{"affinity_test": 2})
+	t.Cleanup(func() { model.ChannelGroup.SetAffinity(nil) })
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if session != "" {
+		c.Request.Header.Set(affinitySessionHeader, session)
+	}
+	c.Set("token_group", group)
+	return c
+}
+
+func newAffinityTestMessages(contents ...string) []types.ChatCompletionMessage {
+	messages := []types.ChatCompletionMessage{{Role: types.ChatMessageRoleSystem, Content: "system"}}
+	for _, content := range contents {
+		messages = append(messages, types.ChatCompletionMessage{Role: types.ChatMessageRoleUser, Content: content})
+	}
+	return messages
+}
+
+func chatAffinityKey(t *testing.T, group, session string, request *types.ChatCompletionRequest) string {
+	c := newAffinityTestContext(t, group, session)
+	setChatAffinityKey(c, request)
+	return c.GetString("affinity_key")
+}
+
+func TestSetChatAffinityKey(t *testing.T) {
+	base := chatAffinityKey(t, "affinity_test", "", &types.ChatCompletionRequest{Messages: newAffinityTestMessages("a", "b")})
+	assert.NotEmpty(t, base)
+
+	// 未启用亲和路由的分组不设置路由键
+	assert.Empty(t, chatAffinityKey(t, "default", "", &types.ChatCompletionRequest{Messages: newAffinityTestMessages("a", "b")}))
+
+	// 只有前 n 条消息参与计算
+	assert.Equal(t, base, chatAffinityKey(t, "affinity_test", "", &types.ChatCompletionRequest{Messages: newAffinityTestMessages("a", "b", "c")}))
+	assert.NotEqual(t, base, chatAffinityKey(t, "affinity_test", "", &types.ChatCompletionRequest{Messages: newAffinityTestMessages("a", "c")}))
+
+	// 系统提示词不计入消息条数
+	changedSystem := newAffinityTestMessages("a", "b")
+	changedSystem[0].Content = "other system"
+	assert.NotEqual(t, base, chatAffinityKey(t, "affinity_test", "", &types.ChatCompletionRequest{Messages: changedSystem}))
+
+	// 会话标识优先于提示词，请求头优先于 user 字段
+	user := chatAffinityKey(t, "affinity_test", "", &types.ChatCompletionRequest{User: "user-1", Messages: newAffinityTestMessages("a")})
+	assert.Equal(t, user, chatAffinityKey(t, "affinity_test", "", &types.ChatCompletionRequest{User: "user-1", Messages: newAffinityTestMessages("b")}))
+	assert.Equal(t, user, chatAffinityKey(t, "affinity_test", "user-1", &types.ChatCompletionRequest{User: "user-2", Messages: newAffinityTestMessages("c")}))
+}
+
+func TestSetClaudeAffinityKey(t *testing.T) {
+	claudeAffinityKey := func(system string, contents ...string) string {
+		c := newAffinityTestContext(t, "affinity_test", "")
+		request := &claude.ClaudeRequest{System: system}
+		for _, content := range contents {
+			request.Messages = append(request.Messages, claude.Message{Role: "user", Content: content})
+		}
+		setClaudeAffinityKey(c, request)
+		return c.GetString("affinity_key")
+	}
+
+	base := claudeAffinityKey("system", "a", "b")
+	assert.NotEmpty(t, base)
+	assert.Equal(t, base, claudeAffinityKey("system", "a", "b", "c"))
+	assert.NotEqual(t, base, claudeAffinityKey("other system", "a", "b"))
+	assert.NotEqual(t, base, claudeAffinityKey("system", "a"))
+}
@@ -21,6 +21,10 @@ type relayBase struct {
 	otherArg       string
 	allowHeartbeat bool
 	heartbeat      *relay_util.Heartbeat
+	// 当前渠道占用的并发与速率名额，对冲请求由其他渠道胜出时会被替换
+	limitTicket *model.ChannelLimitTicket
+	// 向上游发送请求的时间，对冲请求由其他渠道胜出时替换为该渠道的发送时间
+	sendStartTime time.Time
 
 	firstResponseTime time.Time
 }
@@ -38,6 +42,10 @@ type RelayBaseInterface interface {
 	IsStream() bool
 	// HandleError(err *types.OpenAIErrorWithStatusCode)
 	GetFirstResponseTime() time.Time
+	getLimitTicket() *model.ChannelLimitTicket
+	setLimitTicket(ticket *model.ChannelLimitTicket)
+	getSendStartTime() time.Time
+	setSendStartTime(startTime time.Time)
 
 	HandleJsonError(err *types.OpenAIErrorWithStatusCode)
 	HandleStreamError(err *types.OpenAIErrorWithStatusCode)
@@ -65,6 +73,22 @@ func (r *relayBase) setProvider(modelName string) error {
 	return nil
 }
 
+func (r *relayBase) getLimitTicket() *model.ChannelLimitTicket {
+	return r.limitTicket
+}
+
+func (r *relayBase) setLimitTicket(ticket *model.ChannelLimitTicket) {
+	r.limitTicket = ticket
+}
+
+func (r *relayBase) getSendStartTime() time.Time {
+	return r.sendStartTime
+}
+
+func (r *relayBase) setSendStartTime(startTime time.Time) {
+	r.sendStartTime = startTime
+}
+
 func (r *relayBase) getOtherArg() string {
 	return r.otherArg
 }
@@ -95,11 +119,20 @@ func (r *relayBase) getModelName() string {
 	billingOriginalModel := r.c.GetBool("billing_original_model")
 
 	if billingOriginalModel {
-		return r.originalModel
+		return r.getServedModel()
 	}
 	return r.modelName
 }
 
+// getServedModel 发生模型降级时返回正在使用的备用模型，否则返回用户请求的模型
+func (r *relayBase) getServedModel() string {
+	if fallbackModel := r.c.GetString("fallback_model"); fallbackModel != "" {
+		return fallbackModel
+	}
+
+	return r.originalModel
+}
+
 func (r *relayBase) GetFirstResponseTime() time.Time {
 	return r.firstResponseTime
 }
@@ -51,6 +51,7 @@ func (r *relayChat) setRequest() error {
 	}
 
 	r.setOriginalModel(r.chatRequest.Model)
+	setChatAffinityKey(r.c, &r.chatRequest)
 
 	otherArg := r.getOtherArg()
 
@@ -119,21 +120,21 @@ func (r *relayChat) send() (err *types.OpenAIErrorWithStatusCode, done bool) {
 
 	if r.chatRequest.Stream {
 		var response requester.StreamReaderInterface[string]
-		response, err = chatProvider.CreateChatCompletionStream(&r.chatRequest)
+		response, err = r.createChatStreamWithHedge(chatProvider)
 		if err != nil {
 			return
 		}
 
-		if r.heartbeat != nil {
-			r.heartbeat.Stop()
-		}
-
 		doneStr := func() string {
 			return r.getUsageResponse()
 		}
 
 		var firstResponseTime time.Time
-		firstResponseTime, err = responseStreamClient(r.c, response, doneStr)
+		firstResponseTime, err = responseStreamClient(r.c, response, doneStr, r.heartbeat)
+		if err != nil {
+			// 首个内容到达前失败，客户端尚未收到数据，交由 Relay 切换渠道重试
+			return
+		}
 		r.SetFirstResponseTime(firstResponseTime)
 	} else {
 		var response *types.ChatCompletionResponse
@@ -190,16 +191,16 @@ func (r *relayChat) compatibleSend(resProvider providersBase.ResponsesInterface)
 			return
 		}
 
-		if r.heartbeat != nil {
-			r.heartbeat.Stop()
-		}
-
 		doneStr := func() string {
 			return r.getUsageResponse()
 		}
 
 		var firstResponseTime time.Time
-		firstResponseTime, err = responseStreamClient(r.c, response, doneStr)
+		firstResponseTime, err = responseStreamClient(r.c, response, doneStr, r.heartbeat)
+		if err != nil {
+			// 首个内容到达前失败，客户端尚未收到数据，交由 Relay 切换渠道重试
+			return
+		}
 		r.SetFirstResponseTime(firstResponseTime)
 	} else {
 		var response *types.OpenAIResponsesResponses
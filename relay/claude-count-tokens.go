@@ -0,0 +1,91 @@
+package relay
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/model_utils"
+	"done-hub/providers/claude"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaudeCountTokens 处理 /claude/v1/messages/count_tokens
+// Anthropic、VertexAI、Bedrock 渠道转发到上游，其他渠道使用本地计数，均不扣除额度
+func ClaudeCountTokens(c *gin.Context) {
+	relay := NewRelayClaudeOnly(c)
+
+	if err := relay.setRequest(); err != nil {
+		relay.HandleJsonError(common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusBadRequest))
+		return
+	}
+
+	if err := relay.setProvider(relay.getOriginalModel()); err != nil {
+		relay.HandleJsonError(common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusServiceUnavailable))
+		return
+	}
+
+	relay.claudeRequest.Model = relay.modelName
+
+	if relay.isUpstreamCountTokens() {
+		countProvider, ok := relay.provider.(claude.ClaudeCountTokensInterface)
+		if ok {
+			response, errWithCode := countProvider.CountClaudeTokens(claude.NewCountTokensRequest(relay.claudeRequest))
+			if errWithCode == nil {
+				c.JSON(http.StatusOK, response)
+				return
+			}
+
+			// 上游计数失败时回退到本地计数，避免客户端因预估失败而中断
+			channel := relay.provider.GetChannel()
+			logger.LogError(c.Request.Context(), fmt.Sprintf("count_tokens_upstream_failed channel_id=%d status_code=%d error=\"%s\" fallback=local",
+				channel.Id, errWithCode.StatusCode, errWithCode.Message))
+		}
+	}
+
+	c.JSON(http.StatusOK, &claude.ClaudeCountTokensResponse{
+		InputTokens: CountTokenClaudeRequest(relay.claudeRequest),
+	})
+}
+
+// isUpstreamCountTokens 判断当前渠道是否支持原生 count_tokens
+func (r *relayClaudeOnly) isUpstreamCountTokens() bool {
+	switch r.provider.GetChannel().Type {
+	case config.ChannelTypeAnthropic, config.ChannelTypeBedrock:
+		return true
+	case config.ChannelTypeVertexAI:
+		return !model_utils.ContainsCaseInsensitive(r.claudeRequest.Model, "gemini")
+	default:
+		return false
+	}
+}
+
+// CountTokenClaudeRequest 在 CountTokenMessages 的基础上补充 system 和 tools 的 token 数
+func CountTokenClaudeRequest(request *claude.ClaudeRequest) int {
+	tokenNum, _ := CountTokenMessages(request, config.PreCostDefault)
+	tokenEncoder := common.GetTokenEncoder(request.Model)
+
+	switch sys := request.System.(type) {
+	case string:
+		tokenNum += common.GetTokenNum(tokenEncoder, sys)
+	case []any:
+		for _, item := range sys {
+			if itemMap, ok := item.(map[string]any); ok {
+				if text, ok := itemMap["text"].(string); ok {
+					tokenNum += common.GetTokenNum(tokenEncoder, text)
+				}
+			}
+		}
+	}
+
+	if len(request.Tools) > 0 {
+		if toolsBytes, err := json.Marshal(request.Tools); err == nil {
+			tokenNum += common.GetTokenNum(tokenEncoder, string(toolsBytes))
+		}
+	}
+
+	return tokenNum
+}
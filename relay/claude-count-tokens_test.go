@@ -0,0 +1,44 @@
+package relay
+
+import (
+	"testing"
+
+	"done-hub/common/config"
+	"done-hub/providers/claude"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountTokenClaudeRequest(t *testing.T) {
+	// 不加载分词器，按字符数估算
+	config.DisableTokenEncoders = true
+
+	messages := []claude.Message{{Role: "user", Content: "hello world"}}
+	base := CountTokenClaudeRequest(&claude.ClaudeRequest{Model: "claude-3-5-sonnet", Messages: messages})
+
+	cases := []struct {
+		name    string
+		request *claude.ClaudeRequest
+		more    bool
+	}{
+		{"messages only", &claude.ClaudeRequest{Model: "claude-3-5-sonnet", Messages: messages}, false},
+		{"string system", &claude.ClaudeRequest{Model: "claude-3-5-sonnet", Messages: messages, System: "You are a helpful assistant."}, true},
+		{"block system", &claude.ClaudeRequest{Model: "claude-3-5-sonnet", Messages: messages, System: []any{
+			map[string]any{"type": "text", "text": "You are a helpful assistant."},
+		}}, true},
+		{"tools", &claude.ClaudeRequest{Model: "claude-3-5-sonnet", Messages: messages, Tools: []claude.Tools{
+			{Name: "get_weather", Description: "Get the current weather", InputSchema: map[string]any{"type": "object"}},
+		}}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tokens := CountTokenClaudeRequest(c.request)
+			if c.more {
+				assert.Greater(t, tokens, base)
+			} else {
+				assert.Equal(t, base, tokens)
+			}
+		})
+	}
+}
@@ -52,6 +52,7 @@ func (r *relayClaudeOnly) setRequest() error {
 	r.setOriginalModel(r.claudeRequest.Model)
 	// 设置原始模型到 Context，用于统一请求响应模型功能
 	r.c.Set("original_model", r.claudeRequest.Model)
+	setClaudeAffinityKey(r.c, r.claudeRequest)
 
 	// 保持原始的流式/非流式状态
 
@@ -115,6 +116,12 @@ func (r *relayClaudeOnly) send() (err *types.OpenAIErrorWithStatusCode, done boo
 			return
 		}
 
+		// 收到首个内容前失败时不向客户端输出，交由 Relay 切换渠道重试
+		response, err = holdStreamFirstContent(r.c, response, probeClaudeStreamChunk)
+		if err != nil {
+			return
+		}
+
 		if r.heartbeat != nil {
 			r.heartbeat.Stop()
 		}
@@ -290,6 +297,12 @@ func (r *relayClaudeOnly) sendCustomChannelWithClaudeFormat() (err *types.OpenAI
 			return err, true
 		}
 
+		// 收到首个内容前失败时不向客户端输出，交由 Relay 切换渠道重试
+		stream, err = holdStreamFirstContent(r.c, stream, probeStreamChunk)
+		if err != nil {
+			return err, false
+		}
+
 		if r.heartbeat != nil {
 			r.heartbeat.Stop()
 		}
@@ -1434,6 +1447,12 @@ func (r *relayClaudeOnly) sendVertexAIGeminiWithClaudeFormat() (err *types.OpenA
 			return err, true
 		}
 
+		// 收到首个内容前失败时不向客户端输出，交由 Relay 切换渠道重试
+		stream, err = holdStreamFirstContent(r.c, stream, probeStreamChunk)
+		if err != nil {
+			return err, false
+		}
+
 		if r.heartbeat != nil {
 			r.heartbeat.Stop()
 		}
@@ -1626,6 +1645,12 @@ func (r *relayClaudeOnly) sendGeminiWithClaudeFormat() (err *types.OpenAIErrorWi
 			return err, true
 		}
 
+		// 收到首个内容前失败时不向客户端输出，交由 Relay 切换渠道重试
+		stream, err = holdStreamFirstContent(r.c, stream, probeStreamChunk)
+		if err != nil {
+			return err, false
+		}
+
 		if r.heartbeat != nil {
 			r.heartbeat.Stop()
 		}
@@ -12,6 +12,7 @@ import (
 	"done-hub/model"
 	"done-hub/providers"
 	providersBase "done-hub/providers/base"
+	"done-hub/relay/relay_util"
 	"done-hub/types"
 	"encoding/json"
 	"errors"
@@ -20,6 +21,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -54,6 +56,8 @@ func Path2Relay(c *gin.Context, path string) RelayBaseInterface {
 			relay = NewRelayVeoOnly(c)
 		} else if strings.Contains(path, ":predict") {
 			relay = newRelayImageGenerations(c)
+		} else if strings.HasSuffix(path, ":embedContent") || strings.HasSuffix(path, ":batchEmbedContents") {
+			relay = NewRelayGeminiEmbeddings(c)
 		} else {
 			relay = NewRelayGeminiOnly(c)
 		}
@@ -76,16 +80,7 @@ func GetProvider(c *gin.Context, modelName string) (provider providersBase.Provi
 		return
 	}
 
-	// 检查token的模型限制
-	tokenId := c.GetInt("token_id")
-	if tokenId != 0 {
-		// 有token，验证模型是否在token的允许列表中
-		if !isModelAllowedForToken(c, modelName) {
-			fail = errors.New("model '" + modelName + "' is not allowed for this token")
-			return
-		}
-	}
-	matchedModelName, err := model.ChannelGroup.GetMatchedModelName(groupName, modelName)
+	matchedModelName, err := checkModelAccess(c, groupName, modelName)
 	if err != nil {
 		fail = err
 		return
@@ -100,10 +95,10 @@ func GetProvider(c *gin.Context, modelName string) (provider providersBase.Provi
 	}
 	c.Set("channel_id", channel.Id)
 	c.Set("channel_type", channel.Type)
+	c.Set("matched_model", actualModelName)
 
-	provider = providers.GetProvider(channel, c)
-	if provider == nil {
-		fail = errors.New("channel not found")
+	provider, fail = providers.NewProvider(channel, c)
+	if fail != nil {
 		return
 	}
 	provider.SetOriginalModel(modelName) // 保存用户原始请求的模型名称
@@ -127,6 +122,20 @@ func GetProvider(c *gin.Context, modelName string) (provider providersBase.Provi
 	return
 }
 
+// checkModelAccess 检查令牌的模型限制，并返回分组中匹配到的模型名称（处理大小写不敏感）
+func checkModelAccess(c *gin.Context, groupName, modelName string) (string, error) {
+	// 检查token的模型限制
+	tokenId := c.GetInt("token_id")
+	if tokenId != 0 {
+		// 有token，验证模型是否在token的允许列表中
+		if !isModelAllowedForToken(c, modelName) {
+			return "", errors.New("model '" + modelName + "' is not allowed for this token")
+		}
+	}
+
+	return model.ChannelGroup.GetMatchedModelName(groupName, modelName)
+}
+
 func fetchChannel(c *gin.Context, modelName string) (channel *model.Channel, fail error) {
 	channelId := c.GetInt("specific_channel_id")
 	ignore := c.GetBool("specific_channel_id_ignore")
@@ -176,9 +185,21 @@ func buildChannelFilters(c *gin.Context, modelName string) []model.ChannelsFilte
 
 func fetchChannelByModel(c *gin.Context, modelName string) (*model.Channel, error) {
 	group := c.GetString("token_group")
+	affinityKey := c.GetString("affinity_key")
 	filters := buildChannelFilters(c, modelName)
 
-	channel, err := model.ChannelGroup.NextByValidatedModel(group, modelName, filters...)
+	channel, err := model.ChannelGroup.NextByAffinity(group, modelName, affinityKey, append(filters, model.FilterSaturated(modelName))...)
+	if err != nil && model.ChannelGroup.CountAvailableChannels(group, modelName, filters...) > 0 {
+		// 候选渠道均已达到并发或速率上限，排队等待名额释放
+		waitErr := model.ChannelLimiter.Wait(c.Request.Context(), func() bool {
+			channel, err = model.ChannelGroup.NextByAffinity(group, modelName, affinityKey, append(filters, model.FilterSaturated(modelName))...)
+			return err == nil
+		})
+		if waitErr != nil {
+			logger.LogWarn(c.Request.Context(), fmt.Sprintf("channel_limit_wait_failed group=%s model=\"%s\" error=\"%s\"", group, modelName, waitErr.Error()))
+			return nil, fmt.Errorf("当前分组 %s 下模型 %s 的渠道均已达到并发或速率上限，请稍后再试", group, modelName)
+		}
+	}
 	if err != nil {
 		// 这里只处理渠道相关的错误，模型匹配错误已在上层处理
 		message := fmt.Sprintf(model.ErrNoAvailableChannelForModel, group, modelName)
@@ -242,22 +263,44 @@ func isModelAllowedForToken(c *gin.Context, modelName string) bool {
 
 type StreamEndHandler func() string
 
-func responseStreamClient(c *gin.Context, stream requester.StreamReaderInterface[string], endHandler StreamEndHandler) (firstResponseTime time.Time, errWithOP *types.OpenAIErrorWithStatusCode) {
-	requester.SetEventStreamHeaders(c)
+// responseStreamClient 在收到首个有效内容前暂存上游数据，期间上游中断或返回错误事件时不向客户端写入任何内容，
+// 返回的错误可由 Relay 切换渠道重试；首个内容到达后才停止心跳并开始向客户端输出
+func responseStreamClient(c *gin.Context, stream requester.StreamReaderInterface[string], endHandler StreamEndHandler, heartbeat *relay_util.Heartbeat) (firstResponseTime time.Time, errWithOP *types.OpenAIErrorWithStatusCode) {
 	dataChan, errChan := stream.Recv()
+	defer stream.Close()
+
+	pending, errWithOP := waitStreamFirstContent(c.Request.Context(), dataChan, errChan, probeStreamChunk)
+	if errWithOP != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("stream_failed_before_content channel_id=%d status_code=%d error=\"%s\"",
+			c.GetInt("channel_id"), errWithOP.StatusCode, errWithOP.Message))
+		return
+	}
+
+	if heartbeat != nil {
+		heartbeat.Stop()
+	}
+
+	requester.SetEventStreamHeaders(c)
+	firstResponseTime = time.Now()
 
 	// 创建一个done channel用于通知处理完成
 	done := make(chan struct{})
 	var finalErr *types.OpenAIErrorWithStatusCode
 
-	defer stream.Close()
-
-	var isFirstResponse bool
-
 	// 在新的goroutine中处理stream数据
 	go func() {
 		defer close(done)
 
+		// 先输出暂存的数据
+		for _, data := range pending {
+			select {
+			case <-c.Request.Context().Done():
+			default:
+				c.Writer.Write([]byte("data: " + data + "\n\n"))
+				c.Writer.Flush()
+			}
+		}
+
 		for {
 			select {
 			case data, ok := <-dataChan:
@@ -266,11 +309,6 @@ func responseStreamClient(c *gin.Context, stream requester.StreamReaderInterface
 				}
 				streamData := "data: " + data + "\n\n"
 
-				if !isFirstResponse {
-					firstResponseTime = time.Now()
-					isFirstResponse = true
-				}
-
 				// 尝试写入数据，如果客户端断开也继续处理
 				select {
 				case <-c.Request.Context().Done():
@@ -332,6 +370,219 @@ func responseStreamClient(c *gin.Context, stream requester.StreamReaderInterface
 	return firstResponseTime, nil
 }
 
+// streamContentProbe 判断上游的一条数据是否包含有效内容，streamErr 不为空表示上游返回了错误事件
+type streamContentProbe func(data string) (hasContent bool, streamErr string)
+
+// waitStreamFirstContent 读取上游数据直到出现首个有效内容，返回期间暂存的数据，
+// 客户端断开或超过首个内容的等待时间时结束等待
+func waitStreamFirstContent(ctx context.Context, dataChan <-chan string, errChan <-chan error, probe streamContentProbe) (pending []string, errWithOP *types.OpenAIErrorWithStatusCode) {
+	var timeout <-chan time.Time
+	if config.StreamFirstContentTimeout > 0 {
+		timer := time.NewTimer(time.Duration(config.StreamFirstContentTimeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case data, ok := <-dataChan:
+			if !ok {
+				errWithOP = common.StringErrorWrapper("upstream stream closed before first content", "stream_error", http.StatusBadGateway)
+				return
+			}
+
+			pending = append(pending, data)
+			hasContent, streamErr := probe(data)
+			if streamErr != "" {
+				errWithOP = common.StringErrorWrapper(streamErr, "stream_error", http.StatusBadGateway)
+				return
+			}
+			if hasContent {
+				return
+			}
+
+		case err := <-errChan:
+			if errors.Is(err, io.EOF) {
+				err = errors.New("upstream stream closed before first content")
+			}
+			errWithOP = common.StringErrorWrapper(err.Error(), "stream_error", http.StatusBadGateway)
+			return
+
+		case <-timeout:
+			errWithOP = common.StringErrorWrapper("upstream stream first content timeout", "stream_timeout", http.StatusGatewayTimeout)
+			return
+
+		case <-ctx.Done():
+			// 客户端已断开，不再切换渠道重试
+			errWithOP = common.StringErrorWrapperLocal("client disconnected before first content", "client_disconnected", http.StatusRequestTimeout)
+			return
+		}
+	}
+}
+
+// heldStream 已收到首个内容的流，先输出暂存的数据，再继续转发上游数据
+type heldStream struct {
+	stream   requester.StreamReaderInterface[string]
+	pending  []string
+	dataChan <-chan string
+	errChan  <-chan error
+	// 关闭时额外执行的清理
+	onClose func()
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newHeldStream(stream requester.StreamReaderInterface[string], pending []string, dataChan <-chan string, errChan <-chan error, onClose func()) *heldStream {
+	return &heldStream{
+		stream:   stream,
+		pending:  pending,
+		dataChan: dataChan,
+		errChan:  errChan,
+		onClose:  onClose,
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *heldStream) Recv() (<-chan string, <-chan error) {
+	dataChan := make(chan string)
+	errChan := make(chan error, 1)
+
+	go func() {
+		for _, data := range s.pending {
+			select {
+			case dataChan <- data:
+			case <-s.done:
+				return
+			}
+		}
+
+		for {
+			select {
+			case data, ok := <-s.dataChan:
+				if !ok {
+					close(dataChan)
+					return
+				}
+				select {
+				case dataChan <- data:
+				case <-s.done:
+					return
+				}
+			case err := <-s.errChan:
+				errChan <- err
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return dataChan, errChan
+}
+
+func (s *heldStream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.stream.Close()
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+}
+
+// holdStreamFirstContent 用于转换格式后再输出的流，在收到首个有效内容前不向客户端写入，
+// 失败时关闭上游并返回错误，由 Relay 切换渠道重试
+func holdStreamFirstContent(c *gin.Context, stream requester.StreamReaderInterface[string], probe streamContentProbe) (requester.StreamReaderInterface[string], *types.OpenAIErrorWithStatusCode) {
+	dataChan, errChan := stream.Recv()
+	pending, errWithOP := waitStreamFirstContent(c.Request.Context(), dataChan, errChan, probe)
+	if errWithOP != nil {
+		stream.Close()
+		logger.LogError(c.Request.Context(), fmt.Sprintf("stream_failed_before_content channel_id=%d status_code=%d error=\"%s\"",
+			c.GetInt("channel_id"), errWithOP.StatusCode, errWithOP.Message))
+		return nil, errWithOP
+	}
+
+	return newHeldStream(stream, pending, dataChan, errChan, nil), nil
+}
+
+type streamChunkProbe struct {
+	Error   *types.OpenAIError `json:"error,omitempty"`
+	Usage   any                `json:"usage,omitempty"`
+	Choices []struct {
+		Text         string `json:"text,omitempty"`
+		FinishReason any    `json:"finish_reason,omitempty"`
+		Delta        struct {
+			Content          any    `json:"content,omitempty"`
+			ReasoningContent string `json:"reasoning_content,omitempty"`
+			ToolCalls        []any  `json:"tool_calls,omitempty"`
+			FunctionCall     any    `json:"function_call,omitempty"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// probeStreamChunk 判断分片是否包含有效内容，无法识别的格式视为有效内容
+func probeStreamChunk(data string) (hasContent bool, streamErr string) {
+	var probe streamChunkProbe
+	if err := json.Unmarshal([]byte(data), &probe); err != nil {
+		return true, ""
+	}
+
+	if probe.Error != nil && (probe.Error.Message != "" || probe.Error.Code != nil) {
+		return false, probe.Error.Message
+	}
+
+	if probe.Usage != nil {
+		return true, ""
+	}
+
+	for _, choice := range probe.Choices {
+		if choice.Text != "" || choice.FinishReason != nil || choice.Delta.ReasoningContent != "" ||
+			len(choice.Delta.ToolCalls) > 0 || choice.Delta.FunctionCall != nil {
+			return true, ""
+		}
+
+		if content, ok := choice.Delta.Content.(string); (ok && content != "") || (!ok && choice.Delta.Content != nil) {
+			return true, ""
+		}
+	}
+
+	return false, ""
+}
+
+type claudeStreamChunkProbe struct {
+	Type  string `json:"type"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// probeClaudeStreamChunk Claude 流式数据按行下发，event 行与 message_start、ping 等事件不算内容，
+// 出现内容增量或消息结束事件时视为已有内容
+func probeClaudeStreamChunk(data string) (hasContent bool, streamErr string) {
+	line := strings.TrimSpace(data)
+	if !strings.HasPrefix(line, "data:") {
+		return false, ""
+	}
+
+	var probe claudeStreamChunkProbe
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &probe); err != nil {
+		return true, ""
+	}
+
+	switch probe.Type {
+	case "error":
+		if probe.Error != nil && probe.Error.Message != "" {
+			return false, probe.Error.Message
+		}
+		return false, "upstream stream error"
+	case "content_block_delta", "message_delta", "message_stop":
+		return true, ""
+	}
+
+	return false, ""
+}
+
 func responseGeneralStreamClient(c *gin.Context, stream requester.StreamReaderInterface[string], endHandler StreamEndHandler) (firstResponseTime time.Time) {
 	requester.SetEventStreamHeaders(c)
 	dataChan, errChan := stream.Recv()
@@ -461,51 +712,45 @@ func shouldRetry(c *gin.Context, apiErr *types.OpenAIErrorWithStatusCode, channe
 
 	metrics.RecordProvider(c, apiErr.StatusCode)
 
-	if apiErr.LocalError ||
+	if (apiErr.LocalError && !isChannelUnavailableError(apiErr)) ||
 		(channelId > 0 && !ignore) {
 		return false
 	}
 
-	switch apiErr.StatusCode {
-	case http.StatusTooManyRequests, http.StatusTemporaryRedirect:
+	if isChannelUnavailableError(apiErr) {
 		return true
-	case http.StatusRequestTimeout, http.StatusGatewayTimeout, 524:
-		return false
-	case http.StatusBadRequest:
-		return shouldRetryBadRequest(channelType, apiErr)
 	}
 
-	if apiErr.StatusCode/100 == 5 {
-		return true
-	}
+	return model.RetryPolicy.Match(channelType, apiErr).Action != model.RetryActionFail
+}
+
+const (
+	errCodeCircuitBreakerOpen  = "circuit_breaker_open"
+	errCodeChannelLimitReached = "channel_limit_reached"
+)
 
-	if apiErr.StatusCode/100 == 2 {
+// isChannelUnavailableError 熔断或限流拒绝的请求没有到达上游，不计入渠道错误，直接换渠道重试
+func isChannelUnavailableError(apiErr *types.OpenAIErrorWithStatusCode) bool {
+	if apiErr == nil || !apiErr.LocalError {
 		return false
 	}
-	return true
+
+	return apiErr.OpenAIError.Code == errCodeCircuitBreakerOpen || apiErr.OpenAIError.Code == errCodeChannelLimitReached
 }
 
-func shouldRetryBadRequest(channelType int, apiErr *types.OpenAIErrorWithStatusCode) bool {
-	switch channelType {
-	case config.ChannelTypeAnthropic:
-		return strings.Contains(apiErr.OpenAIError.Message, "Your credit balance is too low")
-	case config.ChannelTypeBedrock:
-		return strings.Contains(apiErr.OpenAIError.Message, "Operation not allowed")
-	default:
-		// gemini
-		if apiErr.OpenAIError.Param == "INVALID_ARGUMENT" && strings.Contains(apiErr.OpenAIError.Message, "API key not valid") {
-			return true
-		}
-		return false
+func processChannelRelayError(ctx context.Context, channel *model.Channel, modelName string, err *types.OpenAIErrorWithStatusCode) {
+	if isChannelUnavailableError(err) {
+		return
 	}
-}
 
-func processChannelRelayError(ctx context.Context, channelId int, channelName string, err *types.OpenAIErrorWithStatusCode, channelType int) {
-	if controller.ShouldDisableChannel(channelType, err) {
-		logger.LogError(ctx, fmt.Sprintf("channel_disabled channel_id=%d channel_name=\"%s\" channel_type=%d status_code=%d error=\"%s\" auto_disabled=true",
-			channelId, channelName, channelType, err.StatusCode, err.Message))
-		controller.DisableChannel(channelId, channelName, err.Message, true)
+	class := controller.GetChannelErrorClass(channel.Type, err)
+	if class == nil {
+		return
 	}
+
+	logger.LogError(ctx, fmt.Sprintf("channel_error_classified channel_id=%d key_id=%d channel_name=\"%s\" channel_type=%d model=\"%s\" status_code=%d category=%s action=%s rule=%s error=\"%s\"",
+		channel.Id, channel.KeyId, channel.Name, channel.Type, modelName, err.StatusCode, class.Category, class.Action, class.Rule, err.Message))
+	controller.HandleChannelError(channel, modelName, err, class, true)
 }
 
 var (
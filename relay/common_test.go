@@ -0,0 +1,212 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeStreamChunk(t *testing.T) {
+	cases := []struct {
+		name       string
+		data       string
+		hasContent bool
+		streamErr  string
+	}{
+		{"role only", `{"choices":[{"delta":{"role":"assistant"}}]}`, false, ""},
+		{"empty content", `{"choices":[{"delta":{"content":""}}]}`, false, ""},
+		{"content", `{"choices":[{"delta":{"content":"hi"}}]}`, true, ""},
+		{"reasoning", `{"choices":[{"delta":{"reasoning_content":"hmm"}}]}`, true, ""},
+		{"tool call", `{"choices":[{"delta":{"tool_calls":[{"index":0}]}}]}`, true, ""},
+		{"finish", `{"choices":[{"delta":{},"finish_reason":"stop"}]}`, true, ""},
+		{"usage", `{"choices":[],"usage":{"total_tokens":1}}`, true, ""},
+		{"error", `{"error":{"message":"overloaded"}}`, false, "overloaded"},
+		{"unknown format", `not json`, true, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hasContent, streamErr := probeStreamChunk(c.data)
+			assert.Equal(t, c.hasContent, hasContent)
+			assert.Equal(t, c.streamErr, streamErr)
+		})
+	}
+}
+
+func TestProbeClaudeStreamChunk(t *testing.T) {
+	cases := []struct {
+		name       string
+		data       string
+		hasContent bool
+		streamErr  string
+	}{
+		{"event line", "event: message_start\n", false, ""},
+		{"blank line", "\n", false, ""},
+		{"message start", `data: {"type":"message_start","message":{}}` + "\n", false, ""},
+		{"ping", `data: {"type":"ping"}` + "\n", false, ""},
+		{"block start", `data: {"type":"content_block_start","index":0}` + "\n", false, ""},
+		{"delta", `data: {"type":"content_block_delta","delta":{"text":"hi"}}` + "\n", true, ""},
+		{"message stop", `data: {"type":"message_stop"}` + "\n", true, ""},
+		{"error", `data: {"type":"error","error":{"message":"overloaded"}}` + "\n", false, "overloaded"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hasContent, streamErr := probeClaudeStreamChunk(c.data)
+			assert.Equal(t, c.hasContent, hasContent)
+			assert.Equal(t, c.streamErr, streamErr)
+		})
+	}
+}
+
+func TestWaitStreamFirstContent(t *testing.T) {
+	roleChunk := `{"choices":[{"delta":{"role":"assistant"}}]}`
+	contentChunk := `{"choices":[{"delta":{"content":"hi"}}]}`
+
+	cases := []struct {
+		name       string
+		data       []string
+		err        error
+		closeData  bool
+		statusCode int
+		pending    []string
+	}{
+		{name: "first content", data: []string{roleChunk, contentChunk}, pending: []string{roleChunk, contentChunk}},
+		{name: "error before content", data: []string{roleChunk}, err: errors.New("connection reset"), statusCode: http.StatusBadGateway},
+		{name: "eof before content", data: []string{roleChunk}, err: io.EOF, statusCode: http.StatusBadGateway},
+		{name: "closed before content", data: []string{roleChunk}, closeData: true, statusCode: http.StatusBadGateway},
+		{name: "error event", data: []string{`{"error":{"message":"overloaded"}}`}, statusCode: http.StatusBadGateway},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dataChan := make(chan string, len(c.data))
+			errChan := make(chan error, 1)
+			for _, data := range c.data {
+				dataChan <- data
+			}
+			if c.closeData {
+				close(dataChan)
+			}
+			go func() {
+				// 数据读完后才返回错误
+				for len(dataChan) > 0 {
+					time.Sleep(time.Millisecond)
+				}
+				if c.err != nil {
+					errChan <- c.err
+				}
+			}()
+
+			pending, errWithOP := waitStreamFirstContent(context.Background(), dataChan, errChan, probeStreamChunk)
+			if c.statusCode != 0 {
+				assert.NotNil(t, errWithOP)
+				assert.Equal(t, c.statusCode, errWithOP.StatusCode)
+				return
+			}
+
+			assert.Nil(t, errWithOP)
+			assert.Equal(t, c.pending, pending)
+		})
+	}
+}
+
+func TestWaitStreamFirstContentStop(t *testing.T) {
+	config.StreamFirstContentTimeout = 1
+	defer func() { config.StreamFirstContentTimeout = 60 }()
+
+	// 超过等待时间，可以切换渠道重试
+	_, errWithOP := waitStreamFirstContent(context.Background(), make(chan string), make(chan error), probeStreamChunk)
+	assert.NotNil(t, errWithOP)
+	assert.Equal(t, http.StatusGatewayTimeout, errWithOP.StatusCode)
+	assert.False(t, errWithOP.LocalError)
+
+	// 客户端断开，不再重试
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, errWithOP = waitStreamFirstContent(ctx, make(chan string), make(chan error), probeStreamChunk)
+	assert.NotNil(t, errWithOP)
+	assert.True(t, errWithOP.LocalError)
+}
+
+type testStream struct {
+	dataChan chan string
+	errChan  chan error
+	closed   bool
+}
+
+func (s *testStream) Recv() (<-chan string, <-chan error) {
+	return s.dataChan, s.errChan
+}
+
+func (s *testStream) Close() {
+	s.closed = true
+}
+
+func TestHeldStream(t *testing.T) {
+	upstream := &testStream{dataChan: make(chan string, 1), errChan: make(chan error, 1)}
+	upstream.dataChan <- "c"
+	close(upstream.dataChan)
+
+	closed := false
+	stream := newHeldStream(upstream, []string{"a", "b"}, upstream.dataChan, upstream.errChan, func() { closed = true })
+
+	dataChan, _ := stream.Recv()
+	received := make([]string, 0, 3)
+	for data := range dataChan {
+		received = append(received, data)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, received)
+
+	stream.Close()
+	stream.Close()
+	assert.True(t, upstream.closed)
+	assert.True(t, closed)
+}
+
+func TestShouldRetry(t *testing.T) {
+	cases := []struct {
+		name            string
+		err             *types.OpenAIErrorWithStatusCode
+		specificChannel bool
+		retry           bool
+	}{
+		{name: "no error"},
+		{name: "upstream error", err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError}, retry: true},
+		{name: "bad request", err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusBadRequest}},
+		{name: "local error", err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError, LocalError: true}},
+		{name: "circuit breaker open", err: &types.OpenAIErrorWithStatusCode{
+			OpenAIError: types.OpenAIError{Code: errCodeCircuitBreakerOpen}, StatusCode: http.StatusServiceUnavailable, LocalError: true,
+		}, retry: true},
+		{name: "channel limit reached", err: &types.OpenAIErrorWithStatusCode{
+			OpenAIError: types.OpenAIError{Code: errCodeChannelLimitReached}, StatusCode: http.StatusTooManyRequests, LocalError: true,
+		}, retry: true},
+		// 上游返回相同的错误码时不视为本地拒绝
+		{name: "upstream limit code", err: &types.OpenAIErrorWithStatusCode{
+			OpenAIError: types.OpenAIError{Code: errCodeChannelLimitReached}, StatusCode: http.StatusBadRequest,
+		}},
+		{name: "specific channel", err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError}, specificChannel: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if c.specificChannel {
+				ctx.Set("specific_channel_id", 1)
+			}
+
+			assert.Equal(t, c.retry, shouldRetry(ctx, c.err, 1))
+		})
+	}
+}
@@ -93,7 +93,11 @@ func (r *relayCompletions) send() (err *types.OpenAIErrorWithStatusCode, done bo
 		}
 
 		var firstResponseTime time.Time
-		firstResponseTime, err = responseStreamClient(r.c, response, doneStr)
+		firstResponseTime, err = responseStreamClient(r.c, response, doneStr, r.heartbeat)
+		if err != nil {
+			// 首个内容到达前失败，客户端尚未收到数据，交由 Relay 切换渠道重试
+			return
+		}
 		r.SetFirstResponseTime(firstResponseTime)
 	} else {
 		var response *types.CompletionResponse
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"done-hub/common/logger"
+	"done-hub/model"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelFallback 模型没有可用渠道或重试耗尽时，按令牌或分组配置的备用模型链依次切换模型
+// 响应中的模型名称仍按 GetResponseModelName 的规则处理，计费使用实际提供服务的模型
+type modelFallback struct {
+	c         *gin.Context
+	requested string   // 用户请求的模型
+	current   string   // 当前使用的模型
+	chain     []string // 剩余的备用模型
+	path      []string // 已使用过的模型，用于响应头与日志
+}
+
+func newModelFallback(c *gin.Context, requestedModel string) *modelFallback {
+	return &modelFallback{
+		c:         c,
+		requested: requestedModel,
+		current:   requestedModel,
+		chain:     getModelFallbacks(c, requestedModel),
+		path:      []string{requestedModel},
+	}
+}
+
+// getModelFallbacks 令牌的备用模型链优先于分组
+func getModelFallbacks(c *gin.Context, modelName string) []string {
+	if tokenSetting := c.GetString("token_setting"); tokenSetting != "" {
+		var setting model.TokenSetting
+		if err := json.Unmarshal([]byte(tokenSetting), &setting); err == nil {
+			if chain, ok := setting.Fallbacks[modelName]; ok {
+				return chain
+			}
+		}
+	}
+
+	return model.GlobalUserGroupRatio.GetModelFallbacks(c.GetString("token_group"), modelName)
+}
+
+// setProvider 为当前模型选择渠道
+func (f *modelFallback) setProvider(relay RelayBaseInterface) error {
+	if err := relay.setProvider(f.current); err != nil {
+		return err
+	}
+
+	// GetProvider 会将原始模型设置为备用模型，这里恢复为用户请求的模型
+	if f.current != f.requested {
+		f.c.Set("original_model", f.requested)
+	}
+
+	return nil
+}
+
+// setProviderWithFallback 当前模型没有可用渠道时依次切换备用模型，都失败时返回当前模型的错误
+func (f *modelFallback) setProviderWithFallback(relay RelayBaseInterface) error {
+	err := f.setProvider(relay)
+	for err != nil && f.next(err.Error()) {
+		err = f.setProvider(relay)
+	}
+
+	return err
+}
+
+// next 切换到下一个备用模型，没有备用模型时返回 false
+func (f *modelFallback) next(reason string) bool {
+	if len(f.chain) == 0 {
+		return false
+	}
+
+	previous := f.current
+	f.current, f.chain = f.chain[0], f.chain[1:]
+	f.path = append(f.path, f.current)
+	path := strings.Join(f.path, "->")
+
+	// 新模型重新选择渠道，不沿用上一个模型跳过的渠道
+	f.c.Set("skip_channel_ids", []int{})
+	f.c.Set("retry_same_channel_id", 0)
+	f.c.Set("fallback_model", f.current)
+	f.c.Set("model_fallback", path)
+	f.c.Header("X-Model-Fallback", path)
+
+	logger.LogWarn(f.c.Request.Context(), fmt.Sprintf("model_fallback from=\"%s\" to=\"%s\" path=\"%s\" reason=\"%s\"", previous, f.current, path, reason))
+
+	return true
+}
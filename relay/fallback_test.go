@@ -0,0 +1,140 @@
+package relay
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"done-hub/common/logger"
+	"done-hub/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fallbackTestRelay 只有 available 中的模型可以选到渠道
+type fallbackTestRelay struct {
+	RelayBaseInterface
+	available map[string]bool
+	tried     []string
+}
+
+func (r *fallbackTestRelay) setProvider(modelName string) error {
+	r.tried = append(r.tried, modelName)
+	if !r.available[modelName] {
+		return errors.New("no available channel for model " + modelName)
+	}
+	return nil
+}
+
+func newFallbackTestContext(t *testing.T, fallbacks string) *gin.Context {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+
+	chain, err := model.ParseModelFallbacks(fallbacks)
+	assert.NoError(t, err)
+
+	model.GlobalUserGroupRatio.Lock()
+	previous := model.GlobalUserGroupRatio.ModelFallbacks
+	model.GlobalUserGroupRatio.ModelFallbacks = map[string]model.ModelFallbacks{"fallback_test": chain}
+	model.GlobalUserGroupRatio.Unlock()
+	t.Cleanup(func() {
+		model.GlobalUserGroupRatio.Lock()
+		model.GlobalUserGroupRatio.ModelFallbacks = previous
+		model.GlobalUserGroupRatio.Unlock()
+	})
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set("token_group", "fallback_test")
+	return c
+}
+
+func TestGetModelFallbacks(t *testing.T) {
+	c := newFallbackTestContext(t, `{"gpt-4o":["gpt-4.1"]}`)
+	assert.Equal(t, []string{"gpt-4.1"}, getModelFallbacks(c, "gpt-4o"))
+	assert.Empty(t, getModelFallbacks(c, "o3"))
+
+	// 令牌的备用模型链优先于分组
+	c.Set("token_setting", `{"fallbacks":{"gpt-4o":["claude-sonnet"]}}`)
+	assert.Equal(t, []string{"claude-sonnet"}, getModelFallbacks(c, "gpt-4o"))
+
+	// 令牌未配置该模型时使用分组的配置
+	c.Set("token_setting", `{"fallbacks":{"o3":["o4-mini"]}}`)
+	assert.Equal(t, []string{"gpt-4.1"}, getModelFallbacks(c, "gpt-4o"))
+}
+
+func TestModelFallbackNext(t *testing.T) {
+	c := newFallbackTestContext(t, `{"gpt-4o":["gpt-4.1","claude-sonnet"]}`)
+	c.Set("skip_channel_ids", []int{1, 2})
+	c.Set("retry_same_channel_id", 1)
+
+	fallback := newModelFallback(c, "gpt-4o")
+	assert.True(t, fallback.next("upstream error"))
+	assert.Equal(t, "gpt-4.1", fallback.current)
+	assert.Equal(t, "gpt-4.1", c.GetString("fallback_model"))
+	assert.Equal(t, "gpt-4o->gpt-4.1", c.GetString("model_fallback"))
+
+	// 新模型重新选择渠道
+	skipChannelIds, _ := c.Get("skip_channel_ids")
+	assert.Empty(t, skipChannelIds)
+	assert.Zero(t, c.GetInt("retry_same_channel_id"))
+
+	assert.True(t, fallback.next("upstream error"))
+	assert.Equal(t, "gpt-4o->gpt-4.1->claude-sonnet", c.Writer.Header().Get("X-Model-Fallback"))
+	assert.False(t, fallback.next("upstream error"))
+	assert.Equal(t, "claude-sonnet", fallback.current)
+
+	// 未配置备用模型时不切换
+	assert.False(t, newModelFallback(c, "o3").next("upstream error"))
+}
+
+func TestModelFallbackSetProvider(t *testing.T) {
+	cases := []struct {
+		name      string
+		available map[string]bool
+		tried     []string
+		current   string
+		success   bool
+	}{
+		{"requested model", map[string]bool{"gpt-4o": true, "gpt-4.1": true}, []string{"gpt-4o"}, "gpt-4o", true},
+		{"first fallback", map[string]bool{"gpt-4.1": true}, []string{"gpt-4o", "gpt-4.1"}, "gpt-4.1", true},
+		{"last fallback", map[string]bool{"claude-sonnet": true}, []string{"gpt-4o", "gpt-4.1", "claude-sonnet"}, "claude-sonnet", true},
+		{"all unavailable", map[string]bool{}, []string{"gpt-4o", "gpt-4.1", "claude-sonnet"}, "claude-sonnet", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := newFallbackTestContext(t, `{"gpt-4o":["gpt-4.1","claude-sonnet"]}`)
+			ctx.Set("original_model", "gpt-4o")
+			relay := &fallbackTestRelay{available: c.available}
+
+			fallback := newModelFallback(ctx, "gpt-4o")
+			err := fallback.setProviderWithFallback(relay)
+			assert.Equal(t, c.success, err == nil)
+			assert.Equal(t, c.tried, relay.tried)
+			assert.Equal(t, c.current, fallback.current)
+			// 原始模型仍为用户请求的模型
+			assert.Equal(t, "gpt-4o", ctx.GetString("original_model"))
+		})
+	}
+}
+
+func TestGetServedModel(t *testing.T) {
+	c := newFallbackTestContext(t, "")
+	relay := &relayBase{c: c, originalModel: "gpt-4o", modelName: "gpt-4o-2024-08-06"}
+
+	assert.Equal(t, "gpt-4o", relay.getServedModel())
+	assert.Equal(t, "gpt-4o-2024-08-06", relay.getModelName())
+
+	c.Set("fallback_model", "gpt-4.1")
+	assert.Equal(t, "gpt-4.1", relay.getServedModel())
+
+	// 按原始模型计费时使用实际提供服务的模型
+	c.Set("billing_original_model", true)
+	assert.Equal(t, "gpt-4.1", relay.getModelName())
+}
@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/providers/gemini"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayGemini 按 action 分发 Gemini 原生请求，countTokens 不经过计费流程
+func RelayGemini(c *gin.Context) {
+	if strings.HasSuffix(c.Param("model"), ":countTokens") {
+		GeminiCountTokens(c)
+		return
+	}
+
+	Relay(c)
+}
+
+// GeminiCountTokens 处理 :countTokens，支持的渠道转发到上游，其他渠道使用本地计数，均不扣除额度
+func GeminiCountTokens(c *gin.Context) {
+	relay := NewRelayGeminiOnly(c)
+
+	modelName, _, err := parseGeminiModelAction(c)
+	if err != nil {
+		relay.HandleJsonError(common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusBadRequest))
+		return
+	}
+
+	countRequest := &gemini.GeminiCountTokensRequest{}
+	if err := common.UnmarshalBodyReusable(c, countRequest); err != nil {
+		relay.HandleJsonError(common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusBadRequest))
+		return
+	}
+
+	relay.setOriginalModel(modelName)
+	c.Set("original_model", modelName)
+
+	if err := relay.setProvider(relay.getOriginalModel()); err != nil {
+		relay.HandleJsonError(common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusServiceUnavailable))
+		return
+	}
+
+	countRequest.Model = relay.modelName
+
+	if countProvider, ok := relay.provider.(gemini.GeminiCountTokensInterface); ok {
+		response, errWithCode := countProvider.CountGeminiTokens(countRequest)
+		if errWithCode == nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		// 上游计数失败时回退到本地计数
+		channel := relay.provider.GetChannel()
+		logger.LogError(c.Request.Context(), fmt.Sprintf("count_tokens_upstream_failed channel_id=%d status_code=%d error=\"%s\" fallback=local",
+			channel.Id, errWithCode.StatusCode, errWithCode.Message))
+	}
+
+	// generateContentRequest 中的 systemInstruction 与 tools 也计入 token
+	chatRequest := gemini.GeminiChatRequest{Contents: countRequest.Contents}
+	if countRequest.GenerateContentRequest != nil && countRequest.GenerateContentRequest.GeminiChatRequest != nil {
+		chatRequest = *countRequest.GenerateContentRequest.GeminiChatRequest
+	}
+	chatRequest.Model = countRequest.Model
+
+	totalTokens, _ := CountGeminiTokenMessages(&chatRequest, config.PreCostDefault)
+
+	c.JSON(http.StatusOK, &gemini.GeminiCountTokensResponse{
+		TotalTokens: totalTokens,
+	})
+}
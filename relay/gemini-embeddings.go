@@ -0,0 +1,185 @@
+package relay
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	providersBase "done-hub/providers/base"
+	"done-hub/providers/gemini"
+	"done-hub/safty"
+	"done-hub/types"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type relayGeminiEmbeddings struct {
+	relayGeminiOnly
+	action       string
+	embedRequest *gemini.GeminiBatchEmbedContentsRequest
+}
+
+// NewRelayGeminiEmbeddings 处理 :embedContent 与 :batchEmbedContents
+// 不限制渠道类型，非 Gemini 渠道走 OpenAI embeddings 接口
+func NewRelayGeminiEmbeddings(c *gin.Context) *relayGeminiEmbeddings {
+	relay := &relayGeminiEmbeddings{}
+	relay.c = c
+	return relay
+}
+
+func (r *relayGeminiEmbeddings) setRequest() error {
+	modelName, action, err := parseGeminiModelAction(r.c)
+	if err != nil {
+		return err
+	}
+	r.action = action
+
+	r.embedRequest = &gemini.GeminiBatchEmbedContentsRequest{}
+	if action == "embedContent" {
+		embedRequest := gemini.GeminiEmbedContentRequest{}
+		if err := common.UnmarshalBodyReusable(r.c, &embedRequest); err != nil {
+			return err
+		}
+		r.embedRequest.Requests = []gemini.GeminiEmbedContentRequest{embedRequest}
+	} else if err := common.UnmarshalBodyReusable(r.c, r.embedRequest); err != nil {
+		return err
+	}
+
+	if len(r.embedRequest.Requests) == 0 {
+		return errors.New("requests is required")
+	}
+
+	r.setOriginalModel(modelName)
+	r.c.Set("original_model", modelName)
+
+	return nil
+}
+
+func (r *relayGeminiEmbeddings) getRequest() interface{} {
+	return r.embedRequest
+}
+
+func (r *relayGeminiEmbeddings) IsStream() bool {
+	return false
+}
+
+func (r *relayGeminiEmbeddings) getPromptTokens() (int, error) {
+	return common.CountTokenInput(r.getInputTexts(), r.modelName), nil
+}
+
+func (r *relayGeminiEmbeddings) send() (err *types.OpenAIErrorWithStatusCode, done bool) {
+	inputTexts := r.getInputTexts()
+
+	// 内容审查
+	if config.EnableSafe {
+		CheckResult, _ := safty.CheckContent(inputTexts)
+		if !CheckResult.IsSafe {
+			err = common.StringErrorWrapperLocal(CheckResult.Reason, CheckResult.Code, http.StatusBadRequest)
+			done = true
+			return
+		}
+	}
+
+	var response any
+	if geminiProvider, ok := r.provider.(gemini.GeminiEmbeddingsInterface); ok {
+		response, err = r.sendGeminiEmbeddings(geminiProvider)
+	} else {
+		response, err = r.sendOpenAIEmbeddings(inputTexts)
+	}
+	if err != nil {
+		return
+	}
+
+	err = responseJsonClient(r.c, response)
+	if err != nil {
+		done = true
+	}
+
+	return
+}
+
+func (r *relayGeminiEmbeddings) sendGeminiEmbeddings(geminiProvider gemini.GeminiEmbeddingsInterface) (response any, err *types.OpenAIErrorWithStatusCode) {
+	if r.action == "embedContent" {
+		response, err = geminiProvider.CreateGeminiEmbedContent(&r.embedRequest.Requests[0], r.modelName)
+	} else {
+		response, err = geminiProvider.CreateGeminiBatchEmbedContents(r.embedRequest, r.modelName)
+	}
+	if err != nil {
+		return
+	}
+
+	// Gemini embeddings 响应不包含用量，按本地计算的输入 token 计费
+	usage := r.provider.GetUsage()
+	usage.TotalTokens = usage.PromptTokens
+
+	return
+}
+
+func (r *relayGeminiEmbeddings) sendOpenAIEmbeddings(inputTexts []string) (any, *types.OpenAIErrorWithStatusCode) {
+	embeddingsProvider, ok := r.provider.(providersBase.EmbeddingsInterface)
+	if !ok {
+		return nil, common.StringErrorWrapperLocal("channel not implemented", "channel_error", http.StatusServiceUnavailable)
+	}
+
+	input := make([]any, 0, len(inputTexts))
+	for _, text := range inputTexts {
+		input = append(input, text)
+	}
+
+	embeddingResponse, err := embeddingsProvider.CreateEmbeddings(&types.EmbeddingRequest{
+		Model:      r.modelName,
+		Input:      input,
+		Dimensions: r.embedRequest.Requests[0].OutputDimensionality,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([]gemini.GeminiContentEmbedding, len(inputTexts))
+	for _, item := range embeddingResponse.Data {
+		if item.Index < 0 || item.Index >= len(embeddings) {
+			continue
+		}
+		embeddings[item.Index] = gemini.GeminiContentEmbedding{Values: convertEmbeddingValues(item.Embedding)}
+	}
+
+	if r.action == "embedContent" {
+		return &gemini.GeminiEmbedContentResponse{Embedding: embeddings[0]}, nil
+	}
+
+	return &gemini.GeminiBatchEmbedContentsResponse{Embeddings: embeddings}, nil
+}
+
+// getInputTexts 每个请求的文本 part 合并为一条输入
+func (r *relayGeminiEmbeddings) getInputTexts() []string {
+	inputTexts := make([]string, 0, len(r.embedRequest.Requests))
+	for _, request := range r.embedRequest.Requests {
+		texts := make([]string, 0, len(request.Content.Parts))
+		for _, part := range request.Content.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		inputTexts = append(inputTexts, strings.Join(texts, "\n"))
+	}
+
+	return inputTexts
+}
+
+func convertEmbeddingValues(embedding any) []float64 {
+	switch v := embedding.(type) {
+	case []float64:
+		return v
+	case []any:
+		values := make([]float64, 0, len(v))
+		for _, item := range v {
+			if value, ok := item.(float64); ok {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGeminiTestContext(modelAction, body string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/"+modelAction, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "model", Value: modelAction}}
+	return c
+}
+
+func TestGeminiEmbeddingsSetRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		modelAction string
+		body        string
+		action      string
+		inputs      []string
+		shouldFail  bool
+	}{
+		{
+			name:        "embed content",
+			modelAction: "text-embedding-004:embedContent",
+			body:        `{"content":{"parts":[{"text":"hello"},{"text":"world"}]}}`,
+			action:      "embedContent",
+			inputs:      []string{"hello\nworld"},
+		},
+		{
+			name:        "batch embed contents",
+			modelAction: "text-embedding-004:batchEmbedContents",
+			body:        `{"requests":[{"content":{"parts":[{"text":"a"}]}},{"content":{"parts":[{"text":"b"}]}}]}`,
+			action:      "batchEmbedContents",
+			inputs:      []string{"a", "b"},
+		},
+		{
+			name:        "empty batch",
+			modelAction: "text-embedding-004:batchEmbedContents",
+			body:        `{"requests":[]}`,
+			shouldFail:  true,
+		},
+		{
+			name:        "missing action",
+			modelAction: "text-embedding-004",
+			body:        `{}`,
+			shouldFail:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			relay := NewRelayGeminiEmbeddings(newGeminiTestContext(c.modelAction, c.body))
+			err := relay.setRequest()
+			if c.shouldFail {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.action, relay.action)
+			assert.Equal(t, "text-embedding-004", relay.getOriginalModel())
+			assert.Equal(t, c.inputs, relay.getInputTexts())
+		})
+	}
+}
+
+func TestConvertEmbeddingValues(t *testing.T) {
+	cases := []struct {
+		name      string
+		embedding any
+		expected  []float64
+	}{
+		{"float slice", []float64{0.1, 0.2}, []float64{0.1, 0.2}},
+		{"decoded json", []any{0.1, 0.2}, []float64{0.1, 0.2}},
+		{"base64 string", "AAAA", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, convertEmbeddingValues(c.embedding))
+		})
+	}
+}
@@ -0,0 +1,517 @@
+package relay
+
+import (
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/common/model_utils"
+	"done-hub/common/requester"
+	"done-hub/common/utils"
+	providersBase "done-hub/providers/base"
+	"done-hub/providers/gemini"
+	"done-hub/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isNativeGemini 判断当前渠道是否可以直接处理 Gemini 原生请求
+func (r *relayGeminiOnly) isNativeGemini() bool {
+	switch r.provider.GetChannel().Type {
+	case config.ChannelTypeGemini:
+		return true
+	case config.ChannelTypeVertexAI:
+		return model_utils.HasPrefixCaseInsensitive(r.modelName, "gemini")
+	default:
+		return false
+	}
+}
+
+// sendWithOpenAIFormat 实现 Gemini格式 -> OpenAI格式 -> 上游接口 -> OpenAI响应 -> Gemini格式 的转换
+func (r *relayGeminiOnly) sendWithOpenAIFormat() (err *types.OpenAIErrorWithStatusCode, done bool) {
+	chatProvider, ok := r.provider.(providersBase.ChatInterface)
+	if !ok {
+		err = common.StringErrorWrapperLocal("channel not implemented", "channel_error", http.StatusServiceUnavailable)
+		done = true
+		return
+	}
+
+	openaiRequest := r.convertGeminiToOpenAI()
+	openaiRequest.Model = r.modelName
+
+	if r.geminiRequest.Stream {
+		var stream requester.StreamReaderInterface[string]
+		stream, err = chatProvider.CreateChatCompletionStream(openaiRequest)
+		if err != nil {
+			return
+		}
+
+		// 收到首个内容前失败时不向客户端输出，交由 Relay 切换渠道重试
+		stream, err = holdStreamFirstContent(r.c, stream, probeStreamChunk)
+		if err != nil {
+			return
+		}
+
+		if r.heartbeat != nil {
+			r.heartbeat.Stop()
+		}
+
+		firstResponseTime := r.convertOpenAIStreamToGemini(stream)
+		r.SetFirstResponseTime(firstResponseTime)
+		return
+	}
+
+	var openaiResponse *types.ChatCompletionResponse
+	openaiResponse, err = chatProvider.CreateChatCompletion(openaiRequest)
+	if err != nil {
+		return
+	}
+
+	if r.heartbeat != nil {
+		r.heartbeat.Stop()
+	}
+
+	// 对于响应发送错误（如客户端断开连接），不应该触发重试
+	responseJsonClient(r.c, r.convertOpenAIResponseToGemini(openaiResponse))
+
+	return
+}
+
+// convertGeminiToOpenAI 将Gemini请求转换为OpenAI格式
+func (r *relayGeminiOnly) convertGeminiToOpenAI() *types.ChatCompletionRequest {
+	generationConfig := r.geminiRequest.GenerationConfig
+	openaiRequest := &types.ChatCompletionRequest{
+		Model:       r.geminiRequest.Model,
+		Messages:    make([]types.ChatCompletionMessage, 0, len(r.geminiRequest.Contents)+1),
+		MaxTokens:   generationConfig.MaxOutputTokens,
+		Temperature: generationConfig.Temperature,
+		TopP:        generationConfig.TopP,
+		TopK:        generationConfig.TopK,
+		Stream:      r.geminiRequest.Stream,
+	}
+
+	if generationConfig.CandidateCount > 1 {
+		openaiRequest.N = &generationConfig.CandidateCount
+	}
+
+	if len(generationConfig.StopSequences) > 0 {
+		openaiRequest.Stop = generationConfig.StopSequences
+	}
+
+	if generationConfig.ResponseMimeType == "application/json" {
+		if generationConfig.ResponseSchema != nil {
+			openaiRequest.ResponseFormat = &types.ChatCompletionResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &types.FormatJsonSchema{
+					Name:   "response",
+					Schema: convertGeminiSchema(generationConfig.ResponseSchema),
+				},
+			}
+		} else {
+			openaiRequest.ResponseFormat = &types.ChatCompletionResponseFormat{Type: "json_object"}
+		}
+	}
+
+	// 处理系统消息
+	if systemText := geminiSystemInstructionText(r.geminiRequest.SystemInstruction); systemText != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, types.ChatCompletionMessage{
+			Role:    types.ChatMessageRoleSystem,
+			Content: systemText,
+		})
+	}
+
+	// Gemini 的函数调用没有 id，按函数名排队生成并与后续的 functionResponse 对应
+	pendingToolCallIds := make(map[string][]string)
+
+	for _, content := range r.geminiRequest.Contents {
+		contentParts := make([]types.ChatMessagePart, 0, len(content.Parts))
+		toolCalls := make([]*types.ChatCompletionToolCalls, 0)
+
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				toolCall := part.FunctionCall.ToOpenAITool()
+				toolCall.Index = len(toolCalls)
+				pendingToolCallIds[part.FunctionCall.Name] = append(pendingToolCallIds[part.FunctionCall.Name], toolCall.Id)
+				toolCalls = append(toolCalls, toolCall)
+			case part.FunctionResponse != nil:
+				toolCallId := "call_" + utils.GetRandomString(24)
+				if ids := pendingToolCallIds[part.FunctionResponse.Name]; len(ids) > 0 {
+					toolCallId = ids[0]
+					pendingToolCallIds[part.FunctionResponse.Name] = ids[1:]
+				}
+
+				responseBytes, _ := json.Marshal(part.FunctionResponse.Response)
+				openaiRequest.Messages = append(openaiRequest.Messages, types.ChatCompletionMessage{
+					Role:       types.ChatMessageRoleTool,
+					Content:    string(responseBytes),
+					ToolCallID: toolCallId,
+				})
+			case part.Thought:
+				// 思考内容不回传给上游
+			case part.Text != "":
+				contentParts = append(contentParts, types.ChatMessagePart{
+					Type: types.ContentTypeText,
+					Text: part.Text,
+				})
+			case part.InlineData != nil:
+				contentParts = append(contentParts, geminiMediaPart(part.InlineData.MimeType, fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data)))
+			case part.FileData != nil:
+				contentParts = append(contentParts, geminiMediaPart(part.FileData.MimeType, part.FileData.FileUri))
+			}
+		}
+
+		role := types.ChatMessageRoleUser
+		if content.Role == "model" {
+			role = types.ChatMessageRoleAssistant
+		}
+
+		if len(contentParts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		message := types.ChatCompletionMessage{Role: role}
+		if len(contentParts) > 0 {
+			message.Content = contentParts
+			// 纯文本的助手消息使用字符串，兼容更多上游
+			if role == types.ChatMessageRoleAssistant {
+				message.Content = joinTextParts(contentParts)
+			}
+		}
+		if len(toolCalls) > 0 {
+			message.ToolCalls = toolCalls
+		}
+
+		openaiRequest.Messages = append(openaiRequest.Messages, message)
+	}
+
+	// 处理工具定义
+	for _, tool := range r.geminiRequest.Tools {
+		for _, function := range tool.FunctionDeclarations {
+			function.Parameters = convertGeminiSchema(function.Parameters)
+			openaiRequest.Tools = append(openaiRequest.Tools, &types.ChatCompletionTool{
+				Type:     types.ToolChoiceTypeFunction,
+				Function: function,
+			})
+		}
+	}
+
+	if len(openaiRequest.Tools) > 0 && r.geminiRequest.ToolConfig != nil && r.geminiRequest.ToolConfig.FunctionCallingConfig != nil {
+		openaiRequest.ToolChoice = convertGeminiToolChoice(r.geminiRequest.ToolConfig.FunctionCallingConfig)
+	}
+
+	return openaiRequest
+}
+
+// convertOpenAIResponseToGemini 将OpenAI响应转换为Gemini格式
+func (r *relayGeminiOnly) convertOpenAIResponseToGemini(openaiResponse *types.ChatCompletionResponse) *gemini.GeminiChatResponse {
+	geminiResponse := &gemini.GeminiChatResponse{
+		Candidates:   make([]gemini.GeminiChatCandidate, 0, len(openaiResponse.Choices)),
+		ModelVersion: r.provider.GetResponseModelName(r.modelName),
+		ResponseId:   openaiResponse.ID,
+	}
+
+	for _, choice := range openaiResponse.Choices {
+		parts := make([]gemini.GeminiPart, 0)
+		if choice.Message.ReasoningContent != "" {
+			parts = append(parts, gemini.GeminiPart{Text: choice.Message.ReasoningContent, Thought: true})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			parts = append(parts, gemini.GeminiPart{Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			parts = append(parts, openaiToolCallToGeminiPart(toolCall))
+		}
+
+		finishReason := convertOpenAIFinishReasonToGemini(choice.FinishReason)
+		geminiResponse.Candidates = append(geminiResponse.Candidates, gemini.GeminiChatCandidate{
+			Content: gemini.GeminiChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason: &finishReason,
+			Index:        int64(choice.Index),
+		})
+	}
+
+	geminiResponse.UsageMetadata = convertOpenAIUsageToGemini(r.provider.GetUsage())
+
+	return geminiResponse
+}
+
+// convertOpenAIStreamToGemini 将OpenAI流式响应转换为Gemini SSE格式
+// 工具调用的参数在OpenAI中是分片下发的，这里累积完整后再一次性输出
+func (r *relayGeminiOnly) convertOpenAIStreamToGemini(stream requester.StreamReaderInterface[string]) (firstResponseTime time.Time) {
+	requester.SetEventStreamHeaders(r.c)
+	dataChan, errChan := stream.Recv()
+	defer stream.Close()
+
+	responseModel := r.provider.GetResponseModelName(r.modelName)
+	toolCalls := make(map[int]*types.ChatCompletionToolCalls)
+	responseId := ""
+	finishReason := ""
+
+	writeChunk := func(geminiResponse *gemini.GeminiChatResponse) {
+		geminiResponse.ModelVersion = responseModel
+		geminiResponse.ResponseId = responseId
+
+		chunk, err := json.Marshal(geminiResponse)
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-r.c.Request.Context().Done():
+			// 客户端已断开，不执行任何操作，直接跳过
+		default:
+			r.c.Writer.Write([]byte("data: " + string(chunk) + "\n\n"))
+			r.c.Writer.Flush()
+		}
+	}
+
+	for {
+		select {
+		case data, ok := <-dataChan:
+			if !ok {
+				return
+			}
+
+			if firstResponseTime.IsZero() {
+				firstResponseTime = time.Now()
+			}
+
+			var openaiChunk types.ChatCompletionStreamResponse
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &openaiChunk); err != nil {
+				continue
+			}
+			if openaiChunk.ID != "" {
+				responseId = openaiChunk.ID
+			}
+
+			parts := make([]gemini.GeminiPart, 0)
+			for _, choice := range openaiChunk.Choices {
+				if choice.Delta.ReasoningContent != "" {
+					parts = append(parts, gemini.GeminiPart{Text: choice.Delta.ReasoningContent, Thought: true})
+				}
+				if choice.Delta.Content != "" {
+					parts = append(parts, gemini.GeminiPart{Text: choice.Delta.Content})
+				}
+				mergeOpenAIToolCallDelta(toolCalls, choice.Delta.ToolCalls)
+
+				if reason, ok := choice.FinishReason.(string); ok && reason != "" {
+					finishReason = reason
+				}
+			}
+
+			if len(parts) > 0 {
+				writeChunk(&gemini.GeminiChatResponse{
+					Candidates: []gemini.GeminiChatCandidate{{
+						Content: gemini.GeminiChatContent{Role: "model", Parts: parts},
+					}},
+				})
+			}
+
+		case err := <-errChan:
+			if !errors.Is(err, io.EOF) {
+				logger.LogError(r.c.Request.Context(), "Stream err:"+err.Error())
+				_, response := r.GetError(common.StringErrorWrapper(err.Error(), "stream_error", http.StatusInternalServerError))
+				if errorBytes, jsonErr := json.Marshal(response); jsonErr == nil {
+					r.c.Writer.Write([]byte("data: " + string(errorBytes) + "\n\n"))
+					r.c.Writer.Flush()
+				}
+				return
+			}
+
+			// 最后一个分片携带完整的工具调用、结束原因与用量
+			parts := make([]gemini.GeminiPart, 0, len(toolCalls))
+			indexes := make([]int, 0, len(toolCalls))
+			for index := range toolCalls {
+				indexes = append(indexes, index)
+			}
+			sort.Ints(indexes)
+			for _, index := range indexes {
+				parts = append(parts, openaiToolCallToGeminiPart(toolCalls[index]))
+			}
+
+			geminiFinishReason := convertOpenAIFinishReasonToGemini(finishReason)
+			writeChunk(&gemini.GeminiChatResponse{
+				Candidates: []gemini.GeminiChatCandidate{{
+					Content:      gemini.GeminiChatContent{Role: "model", Parts: parts},
+					FinishReason: &geminiFinishReason,
+				}},
+				UsageMetadata: convertOpenAIUsageToGemini(r.provider.GetUsage()),
+			})
+			return
+		}
+	}
+}
+
+func mergeOpenAIToolCallDelta(toolCalls map[int]*types.ChatCompletionToolCalls, deltas []*types.ChatCompletionToolCalls) {
+	for _, delta := range deltas {
+		if delta == nil || delta.Function == nil {
+			continue
+		}
+
+		toolCall, exists := toolCalls[delta.Index]
+		if !exists {
+			toolCall = &types.ChatCompletionToolCalls{
+				Id:       delta.Id,
+				Type:     delta.Type,
+				Index:    delta.Index,
+				Function: &types.ChatCompletionToolCallsFunction{},
+			}
+			toolCalls[delta.Index] = toolCall
+		}
+
+		if delta.Function.Name != "" {
+			toolCall.Function.Name = delta.Function.Name
+		}
+		toolCall.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+func openaiToolCallToGeminiPart(toolCall *types.ChatCompletionToolCalls) gemini.GeminiPart {
+	args := make(map[string]interface{})
+	if toolCall.Function != nil && toolCall.Function.Arguments != "" {
+		_ = json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
+	}
+
+	name := ""
+	if toolCall.Function != nil {
+		name = toolCall.Function.Name
+	}
+
+	return gemini.GeminiPart{
+		FunctionCall: &gemini.GeminiFunctionCall{
+			Name: name,
+			Args: args,
+		},
+	}
+}
+
+// convertOpenAIFinishReasonToGemini 转换停止原因从OpenAI格式到Gemini格式
+func convertOpenAIFinishReasonToGemini(finishReason string) string {
+	switch finishReason {
+	case types.FinishReasonLength:
+		return "MAX_TOKENS"
+	case types.FinishReasonContentFilter:
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func convertOpenAIUsageToGemini(usage *types.Usage) *gemini.GeminiUsageMetadata {
+	if usage == nil {
+		return nil
+	}
+
+	reasoningTokens := usage.CompletionTokensDetails.ReasoningTokens
+	return &gemini.GeminiUsageMetadata{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens - reasoningTokens,
+		ThoughtsTokenCount:      reasoningTokens,
+		TotalTokenCount:         usage.PromptTokens + usage.CompletionTokens,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+func convertGeminiToolChoice(config *gemini.GeminiFunctionCallingConfig) any {
+	switch strings.ToUpper(config.Mode) {
+	case "NONE":
+		return types.ToolChoiceTypeNone
+	case "ANY":
+		if names, ok := config.AllowedFunctionNames.([]any); ok && len(names) == 1 {
+			if name, ok := names[0].(string); ok {
+				return map[string]any{
+					"type":     types.ToolChoiceTypeFunction,
+					"function": map[string]string{"name": name},
+				}
+			}
+		}
+		return types.ToolChoiceTypeRequired
+	default:
+		return types.ToolChoiceTypeAuto
+	}
+}
+
+// convertGeminiSchema Gemini 使用大写的 OpenAPI 类型名，OpenAI 需要 JSON Schema 的小写类型名
+func convertGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, value := range v {
+			if typeName, ok := value.(string); ok && key == "type" {
+				converted[key] = strings.ToLower(typeName)
+				continue
+			}
+			converted[key] = convertGeminiSchema(value)
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(v))
+		for i, item := range v {
+			converted[i] = convertGeminiSchema(item)
+		}
+		return converted
+	default:
+		return schema
+	}
+}
+
+func geminiSystemInstructionText(systemInstruction any) string {
+	if systemInstruction == nil {
+		return ""
+	}
+
+	if text, ok := systemInstruction.(string); ok {
+		return text
+	}
+
+	systemBytes, err := json.Marshal(systemInstruction)
+	if err != nil {
+		return ""
+	}
+
+	var systemContent gemini.GeminiChatContent
+	if err := json.Unmarshal(systemBytes, &systemContent); err != nil {
+		return ""
+	}
+
+	texts := make([]string, 0, len(systemContent.Parts))
+	for _, part := range systemContent.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+func geminiMediaPart(mimeType, url string) types.ChatMessagePart {
+	if strings.HasPrefix(mimeType, "image/") || mimeType == "" {
+		return types.ChatMessagePart{
+			Type:     types.ContentTypeImageURL,
+			ImageURL: &types.ChatMessageImageURL{URL: url},
+		}
+	}
+
+	return types.ChatMessagePart{
+		Type: "file",
+		File: &types.ChatMessageFile{FileData: url},
+	}
+}
+
+func joinTextParts(parts []types.ChatMessagePart) string {
+	var builder strings.Builder
+	for _, part := range parts {
+		builder.WriteString(part.Text)
+	}
+
+	return builder.String()
+}
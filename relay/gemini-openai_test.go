@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"encoding/json"
+	"testing"
+
+	"done-hub/providers/gemini"
+	"done-hub/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertGeminiToOpenAI(t *testing.T) {
+	body := `{
+  "systemInstruction": {"parts": [{"text": "be brief"}]},
+  "contents": [
+    {"role": "user", "parts": [{"text": "weather?"}]},
+    {"role": "model", "parts": [{"thought": true, "text": "thinking"}, {"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+    {"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"temp": 20}}}]}
+  ],
+  "tools": [{"functionDeclarations": [{"name": "get_weather", "parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING"}}}}]}],
+  "toolConfig": {"functionCallingConfig": {"mode": "ANY", "allowedFunctionNames": ["get_weather"]}},
+  "generationConfig": {"maxOutputTokens": 100, "responseMimeType": "application/json"}
+}`
+	request := &gemini.GeminiChatRequest{}
+	assert.NoError(t, json.Unmarshal([]byte(body), request))
+
+	relay := &relayGeminiOnly{geminiRequest: request}
+	openaiRequest := relay.convertGeminiToOpenAI()
+
+	assert.Equal(t, 100, openaiRequest.MaxTokens)
+	assert.Equal(t, "json_object", openaiRequest.ResponseFormat.Type)
+
+	messages := openaiRequest.Messages
+	assert.Len(t, messages, 4)
+	assert.Equal(t, types.ChatMessageRoleSystem, messages[0].Role)
+	assert.Equal(t, "be brief", messages[0].Content)
+	assert.Equal(t, types.ChatMessageRoleUser, messages[1].Role)
+
+	// 思考内容不回传，函数调用与之后的函数结果使用相同的 id
+	assert.Equal(t, types.ChatMessageRoleAssistant, messages[2].Role)
+	assert.Nil(t, messages[2].Content)
+	assert.Len(t, messages[2].ToolCalls, 1)
+	assert.Equal(t, "get_weather", messages[2].ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"city":"Paris"}`, messages[2].ToolCalls[0].Function.Arguments)
+	assert.Equal(t, types.ChatMessageRoleTool, messages[3].Role)
+	assert.Equal(t, messages[2].ToolCalls[0].Id, messages[3].ToolCallID)
+	assert.JSONEq(t, `{"temp":20}`, messages[3].Content.(string))
+
+	assert.Len(t, openaiRequest.Tools, 1)
+	assert.Equal(t, map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]any{"type": "string"}},
+	}, openaiRequest.Tools[0].Function.Parameters)
+	assert.Equal(t, map[string]any{
+		"type":     types.ToolChoiceTypeFunction,
+		"function": map[string]string{"name": "get_weather"},
+	}, openaiRequest.ToolChoice)
+}
+
+func TestConvertGeminiToolChoice(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *gemini.GeminiFunctionCallingConfig
+		expected any
+	}{
+		{"none", &gemini.GeminiFunctionCallingConfig{Mode: "NONE"}, types.ToolChoiceTypeNone},
+		{"any", &gemini.GeminiFunctionCallingConfig{Mode: "ANY"}, types.ToolChoiceTypeRequired},
+		{"any with several names", &gemini.GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []any{"a", "b"}}, types.ToolChoiceTypeRequired},
+		{"auto", &gemini.GeminiFunctionCallingConfig{Mode: "AUTO"}, types.ToolChoiceTypeAuto},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, convertGeminiToolChoice(c.config))
+		})
+	}
+}
+
+func TestMergeOpenAIToolCallDelta(t *testing.T) {
+	toolCalls := make(map[int]*types.ChatCompletionToolCalls)
+	mergeOpenAIToolCallDelta(toolCalls, []*types.ChatCompletionToolCalls{
+		{Id: "call_1", Index: 0, Function: &types.ChatCompletionToolCallsFunction{Name: "get_weather", Arguments: `{"city":`}},
+	})
+	mergeOpenAIToolCallDelta(toolCalls, []*types.ChatCompletionToolCalls{
+		{Index: 0, Function: &types.ChatCompletionToolCallsFunction{Arguments: `"Paris"}`}},
+		nil,
+	})
+
+	assert.Len(t, toolCalls, 1)
+	part := openaiToolCallToGeminiPart(toolCalls[0])
+	assert.Equal(t, "get_weather", part.FunctionCall.Name)
+	assert.Equal(t, map[string]interface{}{"city": "Paris"}, part.FunctionCall.Args)
+}
+
+func TestConvertOpenAIFinishReasonToGemini(t *testing.T) {
+	assert.Equal(t, "MAX_TOKENS", convertOpenAIFinishReasonToGemini(types.FinishReasonLength))
+	assert.Equal(t, "SAFETY", convertOpenAIFinishReasonToGemini(types.FinishReasonContentFilter))
+	assert.Equal(t, "STOP", convertOpenAIFinishReasonToGemini(types.FinishReasonStop))
+}
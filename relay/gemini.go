@@ -22,8 +22,8 @@ type relayGeminiOnly struct {
 	geminiRequest *gemini.GeminiChatRequest
 }
 
+// NewRelayGeminiOnly 不限制渠道类型，非 Gemini 渠道通过 OpenAI 格式转换处理
 func NewRelayGeminiOnly(c *gin.Context) *relayGeminiOnly {
-	c.Set("allow_channel_type", AllowGeminiChannelType)
 	relay := &relayGeminiOnly{
 		relayBase: relayBase{
 			allowHeartbeat: true,
@@ -34,14 +34,16 @@ func NewRelayGeminiOnly(c *gin.Context) *relayGeminiOnly {
 	return relay
 }
 
-func (r *relayGeminiOnly) setRequest() error {
+// parseGeminiModelAction 解析 model:action 格式的路径参数
+func parseGeminiModelAction(c *gin.Context) (modelName string, action string, err error) {
 	// 支持两种格式: /:version/models/:model 和 /:version/models/*action
-	modelAction := r.c.Param("model")
+	modelAction := c.Param("model")
 	if modelAction == "" {
 		// 尝试获取action参数（用于 model:predict 格式）
-		actionPath := r.c.Param("action")
+		actionPath := c.Param("action")
 		if actionPath == "" {
-			return errors.New("model is required")
+			err = errors.New("model is required")
+			return
 		}
 		// 去掉开头的斜杠
 		actionPath = strings.TrimPrefix(actionPath, "/")
@@ -50,11 +52,20 @@ func (r *relayGeminiOnly) setRequest() error {
 
 	modelList := strings.Split(modelAction, ":")
 	if len(modelList) != 2 {
-		return errors.New("model error")
+		err = errors.New("model error")
+		return
+	}
+
+	return modelList[0], modelList[1], nil
+}
+
+func (r *relayGeminiOnly) setRequest() error {
+	modelName, action, err := parseGeminiModelAction(r.c)
+	if err != nil {
+		return err
 	}
 
 	isStream := false
-	action := modelList[1]
 	if action == "streamGenerateContent" {
 		isStream = true
 	}
@@ -63,7 +74,7 @@ func (r *relayGeminiOnly) setRequest() error {
 	if err := common.UnmarshalBodyReusable(r.c, r.geminiRequest); err != nil {
 		return err
 	}
-	r.geminiRequest.Model = modelList[0]
+	r.geminiRequest.Model = modelName
 	r.geminiRequest.Stream = isStream
 	r.geminiRequest.Action = action // 设置 Action
 	r.setOriginalModel(r.geminiRequest.Model)
@@ -87,11 +98,6 @@ func (r *relayGeminiOnly) getPromptTokens() (int, error) {
 }
 
 func (r *relayGeminiOnly) send() (err *types.OpenAIErrorWithStatusCode, done bool) {
-	chatProvider, ok := r.provider.(gemini.GeminiChatInterface)
-	if !ok {
-		return nil, false
-	}
-
 	// 内容审查
 	if config.EnableSafe {
 		for _, message := range r.geminiRequest.Contents {
@@ -106,6 +112,11 @@ func (r *relayGeminiOnly) send() (err *types.OpenAIErrorWithStatusCode, done boo
 		}
 	}
 
+	chatProvider, ok := r.provider.(gemini.GeminiChatInterface)
+	if !ok || !r.isNativeGemini() {
+		return r.sendWithOpenAIFormat()
+	}
+
 	r.geminiRequest.Model = r.modelName
 
 	if r.geminiRequest.Stream {
@@ -180,7 +191,22 @@ func CountGeminiTokenMessages(request *gemini.GeminiChatRequest, preCostType int
 	tokensPerMessage := 4
 	var textMsg strings.Builder
 
-	for _, message := range request.Contents {
+	contents := request.Contents
+	if request.SystemInstruction != nil {
+		// systemInstruction 可以是 content 对象或字符串
+		var systemContent gemini.GeminiChatContent
+		if data, err := json.Marshal(request.SystemInstruction); err == nil {
+			if json.Unmarshal(data, &systemContent) != nil {
+				var text string
+				if json.Unmarshal(data, &text) == nil {
+					systemContent.Parts = []gemini.GeminiPart{{Text: text}}
+				}
+			}
+		}
+		contents = append([]gemini.GeminiChatContent{systemContent}, contents...)
+	}
+
+	for _, message := range contents {
 		tokenNum += tokensPerMessage
 		for _, part := range message.Parts {
 			if part.Text != "" {
@@ -194,6 +220,13 @@ func CountGeminiTokenMessages(request *gemini.GeminiChatRequest, preCostType int
 		}
 	}
 
+	// 工具声明按 JSON 文本计算
+	if len(request.Tools) > 0 {
+		if data, err := json.Marshal(request.Tools); err == nil {
+			textMsg.Write(data)
+		}
+	}
+
 	if textMsg.Len() > 0 {
 		tokenNum += common.GetTokenNum(tokenEncoder, textMsg.String())
 	}
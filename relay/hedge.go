@@ -0,0 +1,289 @@
+package relay
+
+import (
+	"context"
+	"done-hub/common/logger"
+	"done-hub/common/requester"
+	"done-hub/metrics"
+	"done-hub/model"
+	"done-hub/providers"
+	providersBase "done-hub/providers/base"
+	"done-hub/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type hedgeAttempt struct {
+	provider     providersBase.ChatInterface
+	matchedModel string
+	modelName    string
+	limitTicket  *model.ChannelLimitTicket
+	startTime    time.Time
+	// 返回结果的耗时，被取消的请求为取消前已等待的时间
+	latency time.Duration
+	// 发起请求前的上下文，请求结束后恢复到 provider 上
+	parentCtx context.Context
+	cancel    context.CancelFunc
+	finished  bool
+	err       *types.OpenAIErrorWithStatusCode
+}
+
+type hedgeResult struct {
+	attempt *hedgeAttempt
+	stream  requester.StreamReaderInterface[string]
+	err     *types.OpenAIErrorWithStatusCode
+}
+
+// finish 取消请求并恢复 provider 原有的上下文
+func (a *hedgeAttempt) finish() {
+	a.cancel()
+	a.provider.GetRequester().Context = a.parentCtx
+}
+
+// getHedgeDelay 分组开启对冲请求时返回延迟时间，指定渠道的请求不做对冲
+func (r *relayChat) getHedgeDelay() time.Duration {
+	if r.c.GetInt("specific_channel_id") > 0 {
+		return 0
+	}
+
+	group := model.GlobalUserGroupRatio.GetBySymbol(r.c.GetString("token_group"))
+	if group == nil || group.HedgeDelay <= 0 {
+		return 0
+	}
+
+	return time.Duration(group.HedgeDelay) * time.Millisecond
+}
+
+// createChatStreamWithHedge 首个渠道在延迟时间内未返回首个内容时，向另一个渠道发起相同的请求，
+// 先返回首个内容的一方胜出，另一方被取消，计费只统计胜出的一方。
+// 主请求的结果由 RelayHandler 记录，对冲渠道胜出时改由这里记录主请求的结果，并将名额与发送时间交给胜出的渠道
+func (r *relayChat) createChatStreamWithHedge(chatProvider providersBase.ChatInterface) (requester.StreamReaderInterface[string], *types.OpenAIErrorWithStatusCode) {
+	delay := r.getHedgeDelay()
+	if delay <= 0 {
+		return chatProvider.CreateChatCompletionStream(&r.chatRequest)
+	}
+
+	results := make(chan *hedgeResult, 2)
+	primary := &hedgeAttempt{
+		provider:     chatProvider,
+		matchedModel: r.c.GetString("matched_model"),
+		modelName:    r.modelName,
+		limitTicket:  r.limitTicket,
+	}
+	r.startHedgeAttempt(primary, results)
+	attempts := []*hedgeAttempt{primary}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		// 未触发对冲
+		result.attempt.finished = true
+		if result.err != nil {
+			primary.finish()
+		}
+		return result.stream, result.err
+	case <-timer.C:
+	}
+
+	if hedge, err := r.getHedgeAttempt(); err == nil {
+		r.startHedgeAttempt(hedge, results)
+		attempts = append(attempts, hedge)
+		// 对冲渠道已参与本次请求，之后的重试不再选择
+		skipChannel(r.c, hedge.provider.GetChannel().Id)
+		logger.LogInfo(r.c.Request.Context(), fmt.Sprintf("hedge_start delay=%dms primary_channel_id=%d hedge_channel_id=%d",
+			delay.Milliseconds(), chatProvider.GetChannel().Id, hedge.provider.GetChannel().Id))
+	} else {
+		logger.LogInfo(r.c.Request.Context(), fmt.Sprintf("hedge_skipped reason=\"%s\"", err.Error()))
+	}
+
+	for received := 0; received < len(attempts); received++ {
+		result := <-results
+		attempt := result.attempt
+		attempt.finished = true
+		attempt.latency = time.Since(attempt.startTime)
+		channel := attempt.provider.GetChannel()
+		if result.err != nil {
+			metrics.RecordHedge(channel.Type, channel.Id, attempt.modelName, "failed", attempt.latency)
+			attempt.err = result.err
+			attempt.finish()
+			// 主请求的失败留给 RelayHandler 记录
+			if attempt != primary {
+				r.handleHedgeFailure(attempt)
+			}
+			continue
+		}
+
+		metrics.RecordHedge(channel.Type, channel.Id, attempt.modelName, "won", attempt.latency)
+		r.cancelHedgeLosers(attempt, attempts, results, len(attempts)-received-1)
+
+		if attempt != primary {
+			r.provider = attempt.provider
+			r.modelName = attempt.modelName
+			r.chatRequest.Model = attempt.modelName
+			r.limitTicket = attempt.limitTicket
+			r.sendStartTime = attempt.startTime
+			r.c.Set("channel_id", channel.Id)
+			r.c.Set("channel_type", channel.Type)
+		}
+
+		return result.stream, nil
+	}
+
+	return nil, primary.err
+}
+
+// startHedgeAttempt 使用独立的可取消上下文发起请求，收到首个内容后才返回结果
+func (r *relayChat) startHedgeAttempt(attempt *hedgeAttempt, results chan<- *hedgeResult) {
+	chatRequester := attempt.provider.GetRequester()
+	attempt.parentCtx = chatRequester.Context
+	parent := attempt.parentCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	// provider 读取请求器上的上下文创建请求，只在本次请求期间替换，结束后由 finish 恢复
+	var ctx context.Context
+	ctx, attempt.cancel = context.WithCancel(parent)
+	chatRequester.Context = ctx
+	attempt.startTime = time.Now()
+
+	request := r.chatRequest
+	request.Model = attempt.modelName
+
+	go func() {
+		stream, errWithCode := attempt.provider.CreateChatCompletionStream(&request)
+		if errWithCode != nil {
+			results <- &hedgeResult{attempt: attempt, err: errWithCode}
+			return
+		}
+
+		dataChan, errChan := stream.Recv()
+		pending, errWithCode := waitStreamFirstContent(ctx, dataChan, errChan, probeStreamChunk)
+		if errWithCode != nil {
+			stream.Close()
+			results <- &hedgeResult{attempt: attempt, err: errWithCode}
+			return
+		}
+
+		// 关闭时结束该次请求
+		results <- &hedgeResult{attempt: attempt, stream: newHeldStream(stream, pending, dataChan, errChan, attempt.finish)}
+	}()
+}
+
+// releaseHedgeAttempt 记录未胜出请求的结果并释放其限流名额
+func (r *relayChat) releaseHedgeAttempt(attempt *hedgeAttempt) {
+	channelId := attempt.provider.GetChannel().Id
+	if attempt.err != nil {
+		reportChannelResult(channelId, attempt.matchedModel, 0, attempt.latency, attempt.err)
+	} else {
+		// 被取消的请求不计入熔断，未返回首个内容说明首字时间不低于已等待的时间，按此记录使较慢的渠道权重降低
+		model.CircuitBreaker.Release(channelId, attempt.matchedModel)
+		model.ChannelStats.Record(channelId, attempt.matchedModel, attempt.latency, attempt.latency, true)
+		model.ChannelHealthStats.Record(channelId, attempt.matchedModel, attempt.latency, attempt.latency, "")
+	}
+	model.ChannelLimiter.Release(attempt.limitTicket, 0)
+}
+
+// handleHedgeFailure 不由 RelayHandler 处理的失败请求，同样按错误分类处理并冷却渠道
+func (r *relayChat) handleHedgeFailure(attempt *hedgeAttempt) {
+	r.releaseHedgeAttempt(attempt)
+
+	channel := attempt.provider.GetChannel()
+	go processChannelRelayError(r.c.Request.Context(), channel, attempt.matchedModel, attempt.err)
+	shouldCooldowns(r.c, channel, attempt.err)
+}
+
+// cancelHedgeLosers 取消未胜出的请求，仍在进行中的请求在返回后关闭
+func (r *relayChat) cancelHedgeLosers(winner *hedgeAttempt, attempts []*hedgeAttempt, results <-chan *hedgeResult, pending int) {
+	for _, attempt := range attempts {
+		if attempt == winner {
+			continue
+		}
+
+		// 主请求在对冲渠道胜出前已失败，此时才记录其结果
+		if attempt.finished {
+			if attempt == attempts[0] && attempt.err != nil {
+				r.handleHedgeFailure(attempt)
+			}
+			continue
+		}
+
+		attempt.cancel()
+		attempt.latency = time.Since(attempt.startTime)
+		r.releaseHedgeAttempt(attempt)
+		channel := attempt.provider.GetChannel()
+		metrics.RecordHedge(channel.Type, channel.Id, attempt.modelName, "lost", attempt.latency)
+	}
+
+	if pending == 0 {
+		return
+	}
+
+	go func() {
+		for i := 0; i < pending; i++ {
+			result := <-results
+			if result.stream != nil {
+				result.stream.Close()
+			} else {
+				result.attempt.finish()
+			}
+		}
+	}()
+}
+
+// getHedgeAttempt 选择当前渠道以外的渠道并占用其熔断与限流名额，不修改上下文中的渠道信息
+func (r *relayChat) getHedgeAttempt() (*hedgeAttempt, error) {
+	groupName := r.c.GetString("token_group")
+	matchedModelName, err := model.ChannelGroup.GetMatchedModelName(groupName, r.getServedModel())
+	if err != nil {
+		return nil, err
+	}
+
+	filters := buildChannelFilters(r.c, matchedModelName)
+	filters = append(filters, model.FilterChannelId([]int{r.provider.GetChannel().Id}), model.FilterSaturated(matchedModelName))
+
+	channel, err := model.ChannelGroup.NextByValidatedModel(groupName, matchedModelName, filters...)
+	if err != nil {
+		return nil, err
+	}
+
+	baseProvider, err := providers.NewProvider(channel, r.c)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, ok := baseProvider.(providersBase.ChatInterface)
+	if !ok {
+		return nil, errors.New("channel not implemented")
+	}
+
+	provider.SetOriginalModel(r.getServedModel())
+	provider.SetOtherArg(r.otherArg)
+	// 两个请求都会处理首个内容，各自使用独立的用量对象，胜出后由 RelayHandler 读取胜出一方的用量
+	provider.SetUsage(&types.Usage{PromptTokens: r.provider.GetUsage().PromptTokens})
+
+	modelName, err := provider.ModelMappingHandler(matchedModelName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !model.CircuitBreaker.Acquire(channel.Id, matchedModelName) {
+		return nil, errors.New("channel circuit breaker is open")
+	}
+
+	limitTicket, ok := model.ChannelLimiter.Acquire(channel, matchedModelName, r.provider.GetUsage().PromptTokens)
+	if !ok {
+		model.CircuitBreaker.Release(channel.Id, matchedModelName)
+		return nil, errors.New("channel concurrency or rate limit reached")
+	}
+
+	return &hedgeAttempt{
+		provider:     provider,
+		matchedModel: matchedModelName,
+		modelName:    strings.TrimPrefix(modelName, "+"),
+		limitTicket:  limitTicket,
+	}, nil
+}
@@ -0,0 +1,177 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"done-hub/common/logger"
+	"done-hub/common/requester"
+	"done-hub/common/utils"
+	"done-hub/model"
+	providersBase "done-hub/providers/base"
+	"done-hub/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// hedgeTestProvider 只实现对冲请求用到的方法
+type hedgeTestProvider struct {
+	providersBase.ChatInterface
+	channel   *model.Channel
+	requester *requester.HTTPRequester
+	delay     time.Duration
+	err       *types.OpenAIErrorWithStatusCode
+}
+
+func newHedgeTestProvider(channelId int, delay time.Duration, err *types.OpenAIErrorWithStatusCode) *hedgeTestProvider {
+	return &hedgeTestProvider{
+		channel:   &model.Channel{Id: channelId, Type: 1},
+		requester: &requester.HTTPRequester{},
+		delay:     delay,
+		err:       err,
+	}
+}
+
+func (p *hedgeTestProvider) GetChannel() *model.Channel {
+	return p.channel
+}
+
+func (p *hedgeTestProvider) GetRequester() *requester.HTTPRequester {
+	return p.requester
+}
+
+func (p *hedgeTestProvider) CreateChatCompletionStream(request *types.ChatCompletionRequest) (requester.StreamReaderInterface[string], *types.OpenAIErrorWithStatusCode) {
+	time.Sleep(p.delay)
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	stream := &testStream{dataChan: make(chan string, 1), errChan: make(chan error, 1)}
+	stream.dataChan <- `{"choices":[{"delta":{"content":"hi"}}]}`
+	return stream, nil
+}
+
+func newHedgeTestRelay(t *testing.T, hedgeDelay int) *relayChat {
+	gin.SetMode(gin.TestMode)
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set("token_group", "hedge_test")
+	c.Set("new_model", "gpt-4o")
+	c.Set("matched_model", "gpt-4o")
+
+	model.GlobalUserGroupRatio.Lock()
+	previous := model.GlobalUserGroupRatio.UserGroup
+	model.GlobalUserGroupRatio.UserGroup = map[string]*model.UserGroup{
+		"hedge_test": {Symbol: "hedge_test", HedgeDelay: hedgeDelay},
+	}
+	model.GlobalUserGroupRatio.Unlock()
+	t.Cleanup(func() {
+		model.GlobalUserGroupRatio.Lock()
+		model.GlobalUserGroupRatio.UserGroup = previous
+		model.GlobalUserGroupRatio.Unlock()
+	})
+
+	relay := &relayChat{relayBase: relayBase{c: c, modelName: "gpt-4o"}}
+	relay.chatRequest.Stream = true
+	return relay
+}
+
+func TestGetHedgeDelay(t *testing.T) {
+	relay := newHedgeTestRelay(t, 200)
+	assert.Equal(t, 200*time.Millisecond, relay.getHedgeDelay())
+
+	// 指定渠道的请求不做对冲
+	relay.c.Set("specific_channel_id", 1)
+	assert.Zero(t, relay.getHedgeDelay())
+
+	relay = newHedgeTestRelay(t, 0)
+	assert.Zero(t, relay.getHedgeDelay())
+}
+
+func TestCreateChatStreamWithHedge(t *testing.T) {
+	cases := []struct {
+		name    string
+		delay   time.Duration
+		err     *types.OpenAIErrorWithStatusCode
+		success bool
+	}{
+		// 主请求在延迟时间内返回，不发起对冲
+		{name: "primary before delay", success: true},
+		// 没有可用的对冲渠道时继续等待主请求
+		{name: "no hedge channel", delay: 50 * time.Millisecond, success: true},
+		{name: "primary failed", delay: 50 * time.Millisecond, err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			relay := newHedgeTestRelay(t, 10)
+			provider := newHedgeTestProvider(1, c.delay, c.err)
+			relay.provider = provider
+
+			stream, errWithCode := relay.createChatStreamWithHedge(provider)
+			if !c.success {
+				assert.Equal(t, c.err, errWithCode)
+				assert.Nil(t, provider.requester.Context)
+				return
+			}
+
+			assert.Nil(t, errWithCode)
+			dataChan, _ := stream.Recv()
+			assert.Equal(t, `{"choices":[{"delta":{"content":"hi"}}]}`, <-dataChan)
+
+			// 关闭后恢复 provider 原有的上下文
+			stream.Close()
+			assert.Nil(t, provider.requester.Context)
+			assert.Equal(t, 1, relay.provider.GetChannel().Id)
+		})
+	}
+}
+
+func TestCancelHedgeLosers(t *testing.T) {
+	relay := newHedgeTestRelay(t, 10)
+	startTime := time.Now().Add(-time.Second)
+	// 渠道统计是全局的，每次运行使用独立的模型名
+	modelName := fmt.Sprintf("hedge-test-%d", time.Now().UnixNano())
+
+	// 主请求已失败，对冲渠道胜出
+	primaryErr := &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError}
+	primary := &hedgeAttempt{
+		provider:     newHedgeTestProvider(101, 0, nil),
+		matchedModel: modelName,
+		startTime:    startTime,
+		latency:      100 * time.Millisecond,
+		finished:     true,
+		err:          primaryErr,
+	}
+	winner := &hedgeAttempt{provider: newHedgeTestProvider(102, 0, nil), matchedModel: modelName, startTime: startTime}
+	// 仍在进行中的请求被取消
+	loser := &hedgeAttempt{provider: newHedgeTestProvider(103, 0, nil), matchedModel: modelName, startTime: startTime, cancel: func() {}}
+
+	relay.cancelHedgeLosers(winner, []*hedgeAttempt{primary, winner, loser}, nil, 0)
+
+	primaryStat := model.ChannelStats.Get(101, modelName)
+	assert.NotNil(t, primaryStat)
+	assert.Equal(t, float64(1), primaryStat.ErrorRate)
+	assert.Equal(t, int64(1), primaryStat.Samples)
+
+	// 被取消的请求以已等待的时间作为首字时间记录
+	loserStat := model.ChannelStats.Get(103, modelName)
+	assert.NotNil(t, loserStat)
+	assert.Zero(t, loserStat.ErrorRate)
+	assert.GreaterOrEqual(t, loserStat.FirstResponseMs, float64(time.Second.Milliseconds()))
+
+	assert.Nil(t, model.ChannelStats.Get(102, modelName))
+
+	// 失败的主请求不再参与本次请求的重试
+	skipChannelIds, _ := utils.GetGinValue[[]int](relay.c, "skip_channel_ids")
+	assert.Contains(t, skipChannelIds, 101)
+	assert.NotContains(t, skipChannelIds, 102)
+}
@@ -2,6 +2,7 @@ package relay
 
 import (
 	"bytes"
+	"context"
 	"done-hub/common"
 	"done-hub/common/config"
 	"done-hub/common/logger"
@@ -42,12 +43,24 @@ func Relay(c *gin.Context) {
 	}
 
 	c.Set("is_stream", relay.IsStream())
-	if err := relay.setProvider(relay.getOriginalModel()); err != nil {
+
+	cacheHandler := NewResponseCache(c, relay)
+	if cacheHandler.Replay() {
+		return
+	}
+
+	fallback := newModelFallback(c, relay.getOriginalModel())
+	if err := fallback.setProviderWithFallback(relay); err != nil {
 		openaiErr := common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusServiceUnavailable)
 		relay.HandleJsonError(openaiErr)
 		return
 	}
 
+	// 心跳开始后会持续写入 c.Writer，需要先替换为记录响应的 Writer
+	cacheHandler.Record()
+	shadow := NewShadowMirror(c, relay)
+	shadow.Record()
+
 	heartbeat := relay.SetHeartbeat(relay.IsStream())
 	if heartbeat != nil {
 		defer heartbeat.Close()
@@ -68,16 +81,49 @@ func Relay(c *gin.Context) {
 		systemPrompt(channel.SystemPrompt, relay.getRequest().(*types.ChatCompletionRequest))
 	}
 
+	for {
+		apiErr, fallbackable := relayWithRetry(c, relay, fallback, channel)
+		if apiErr == nil {
+			metrics.RecordProvider(c, 200)
+			cacheHandler.Save(relay)
+			shadow.Start(relay)
+			return
+		}
+
+		// 当前模型的重试耗尽后切换到备用模型
+		if fallbackable && fallback.next(apiErr.OpenAIError.Message) {
+			if err := fallback.setProviderWithFallback(relay); err == nil {
+				channel = relay.getProvider().GetChannel()
+				continue
+			}
+		}
+
+		if heartbeat != nil && heartbeat.IsSafeWriteStream() {
+			relay.HandleStreamError(apiErr)
+			return
+		}
+
+		relay.HandleJsonError(apiErr)
+		return
+	}
+}
+
+// relayWithRetry 按重试策略在当前模型的渠道间重试，重试耗尽且错误允许重试时 fallbackable 为 true
+func relayWithRetry(c *gin.Context, relay RelayBaseInterface, fallback *modelFallback, channel *model.Channel) (apiErr *types.OpenAIErrorWithStatusCode, fallbackable bool) {
 	apiErr, done := RelayHandler(relay)
 	if apiErr == nil {
-		metrics.RecordProvider(c, 200)
 		return
 	}
+	// 对冲请求由其他渠道胜出后失败时，错误归属于胜出的渠道
+	channel = relay.getProvider().GetChannel()
 
-	go processChannelRelayError(c.Request.Context(), channel.Id, channel.Name, apiErr, channel.Type)
+	if !isChannelUnavailableError(apiErr) {
+		go processChannelRelayError(c.Request.Context(), channel, c.GetString("matched_model"), apiErr)
+	}
 
 	retryTimes := config.RetryTimes
-	if done || !shouldRetry(c, apiErr, channel.Type) {
+	fallbackable = !done && shouldRetry(c, apiErr, channel.Type)
+	if !fallbackable {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("relay error happen, status code is %d, won't retry in this case", apiErr.StatusCode))
 		retryTimes = 0
 	}
@@ -108,22 +154,44 @@ func Relay(c *gin.Context) {
 		modelName, totalChannelsAtStart, retryTimes, actualRetryTimes, apiErr.OpenAIError.Message, apiErr.StatusCode))
 
 	for i := retryTimes; i > 0; i-- {
-		// 冻结通道并记录是否应用了冷却
-		cooldownApplied := shouldCooldowns(c, channel, apiErr)
+		rule := model.RetryPolicy.Match(channel.Type, apiErr)
+		unavailable := isChannelUnavailableError(apiErr)
+		var backoff time.Duration
+		sameChannel := false
+		if !unavailable {
+			backoff, sameChannel = getRetrySameBackoff(c, channel.Id, rule)
+		}
+
+		cooldownApplied := false
+		if sameChannel {
+			if !sleepWithContext(c.Request.Context(), backoff) {
+				fallbackable = false
+				break
+			}
+		} else if unavailable {
+			// 渠道暂时不可用并非渠道出错，不冷却，只跳过当前渠道
+			skipChannel(c, channel.Id)
+		} else {
+			// 冻结通道并记录是否应用了冷却
+			cooldownApplied = shouldCooldowns(c, channel, apiErr)
+		}
 
 		if time.Since(startTime) > timeout {
 			logger.LogError(c.Request.Context(), fmt.Sprintf("retry_timeout elapsed_time=%.2fs timeout=%.2fs",
 				time.Since(startTime).Seconds(), timeout.Seconds()))
 			apiErr = common.StringErrorWrapperLocal("重试超时，上游负载已饱和，请稍后再试", "system_error", http.StatusTooManyRequests)
+			fallbackable = false
 			break
 		}
 
-		if err := relay.setProvider(relay.getOriginalModel()); err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("retry_provider_error error=\"%s\"", err.Error()))
-			break
-		}
+		if !sameChannel {
+			if err := fallback.setProvider(relay); err != nil {
+				logger.LogError(c.Request.Context(), fmt.Sprintf("retry_provider_error error=\"%s\"", err.Error()))
+				break
+			}
 
-		channel = relay.getProvider().GetChannel()
+			channel = relay.getProvider().GetChannel()
+		}
 
 		// 更新尝试计数
 		attemptCount := c.GetInt("attempt_count")
@@ -139,26 +207,30 @@ func Relay(c *gin.Context) {
 		actualRetryTimes := c.GetInt("actual_retry_times")
 
 		// 记录重试尝试 - 按照OpenAI规范的结构化日志
-		logger.LogError(c.Request.Context(), fmt.Sprintf("retry_attempt attempt=%d/%d channel_id=%d channel_name=\"%s\" remaining_channels=%d cooldown_applied=%t",
-			attemptCount, actualRetryTimes, channel.Id, channel.Name, remainChannels, cooldownApplied))
+		logger.LogError(c.Request.Context(), fmt.Sprintf("retry_attempt attempt=%d/%d channel_id=%d channel_name=\"%s\" remaining_channels=%d cooldown_applied=%t retry_rule=\"%s\" same_channel=%t backoff=%dms",
+			attemptCount, actualRetryTimes, channel.Id, channel.Name, remainChannels, cooldownApplied, rule.Name, sameChannel, backoff.Milliseconds()))
 
 		apiErr, done = RelayHandler(relay)
 		if apiErr == nil {
 			// 重试成功
 			logger.LogError(c.Request.Context(), fmt.Sprintf("retry_success attempt=%d/%d channel_id=%d final_channel=\"%s\"",
 				attemptCount, actualRetryTimes, channel.Id, channel.Name))
-			metrics.RecordProvider(c, 200)
 			return
 		}
 
+		channel = relay.getProvider().GetChannel()
+
 		// 记录重试失败
 		logger.LogError(c.Request.Context(), fmt.Sprintf("retry_failed attempt=%d/%d channel_id=%d status_code=%d error_type=\"%s\" error=\"%s\"",
 			attemptCount, actualRetryTimes, channel.Id, apiErr.StatusCode, apiErr.OpenAIError.Type, apiErr.OpenAIError.Message))
 
-		go processChannelRelayError(c.Request.Context(), channel.Id, channel.Name, apiErr, channel.Type)
-		if done || !shouldRetry(c, apiErr, channel.Type) {
+		if !isChannelUnavailableError(apiErr) {
+			go processChannelRelayError(c.Request.Context(), channel, c.GetString("matched_model"), apiErr)
+		}
+		fallbackable = !done && shouldRetry(c, apiErr, channel.Type)
+		if !fallbackable {
 			logger.LogError(c.Request.Context(), fmt.Sprintf("retry_stop_condition attempt=%d/%d done=%t should_retry=%t",
-				attemptCount, actualRetryTimes, done, shouldRetry(c, apiErr, channel.Type)))
+				attemptCount, actualRetryTimes, done, fallbackable))
 			break
 		}
 	}
@@ -169,14 +241,7 @@ func Relay(c *gin.Context) {
 	logger.LogError(c.Request.Context(), fmt.Sprintf("retry_exhausted total_attempts=%d actual_max_retries=%d config_max_retries=%d final_error=\"%s\" status_code=%d",
 		finalAttempt, actualRetryTimes, retryTimes, apiErr.OpenAIError.Message, apiErr.StatusCode))
 
-	if apiErr != nil {
-		if heartbeat != nil && heartbeat.IsSafeWriteStream() {
-			relay.HandleStreamError(apiErr)
-			return
-		}
-
-		relay.HandleJsonError(apiErr)
-	}
+	return
 }
 
 func RelayHandler(relay RelayBaseInterface) (err *types.OpenAIErrorWithStatusCode, done bool) {
@@ -199,7 +264,32 @@ func RelayHandler(relay RelayBaseInterface) (err *types.OpenAIErrorWithStatusCod
 		return
 	}
 
+	channel := relay.getProvider().GetChannel()
+	matchedModel := relay.getContext().GetString("matched_model")
+	if !model.CircuitBreaker.Acquire(channel.Id, matchedModel) {
+		quota.Undo(relay.getContext())
+		err = common.StringErrorWrapperLocal("channel circuit breaker is open", errCodeCircuitBreakerOpen, http.StatusServiceUnavailable)
+		return
+	}
+
+	limitTicket, ok := model.ChannelLimiter.Acquire(channel, matchedModel, promptTokens)
+	if !ok {
+		model.CircuitBreaker.Release(channel.Id, matchedModel)
+		quota.Undo(relay.getContext())
+		err = common.StringErrorWrapperLocal("channel concurrency or rate limit reached", errCodeChannelLimitReached, http.StatusServiceUnavailable)
+		return
+	}
+	relay.setLimitTicket(limitTicket)
+	defer func() {
+		// 对冲请求胜出时名额已换成胜出渠道的
+		model.ChannelLimiter.Release(relay.getLimitTicket(), usage.CompletionTokens)
+	}()
+
+	relay.setSendStartTime(time.Now())
 	err, done = relay.send()
+	recordChannelStats(relay, err)
+	// 对冲请求由其他渠道胜出时使用该渠道的用量
+	usage = relay.getProvider().GetUsage()
 	// 最后处理流式中断时计算tokens
 	if usage.CompletionTokens == 0 && usage.TextBuilder.Len() > 0 {
 		usage.CompletionTokens = common.CountTokenText(usage.TextBuilder.String(), relay.getModelName())
@@ -210,26 +300,81 @@ func RelayHandler(relay RelayBaseInterface) (err *types.OpenAIErrorWithStatusCod
 		return
 	}
 
+	// 对冲请求可能由其他渠道胜出，按实际响应的渠道记录
+	quota.SetChannel(relay.getProvider().GetChannel())
 	quota.SetFirstResponseTime(relay.GetFirstResponseTime())
 
 	quota.Consume(relay.getContext(), usage, relay.IsStream())
+	recordPromptCacheUsage(relay, usage)
 
 	return
 }
 
+// recordChannelStats 记录渠道的首字时间、耗时与错误率，用于动态权重与熔断
+func recordChannelStats(relay RelayBaseInterface, apiErr *types.OpenAIErrorWithStatusCode) {
+	startTime := relay.getSendStartTime()
+	var firstResponse time.Duration
+	if firstResponseTime := relay.GetFirstResponseTime(); !firstResponseTime.IsZero() {
+		firstResponse = firstResponseTime.Sub(startTime)
+	}
+
+	reportChannelResult(relay.getProvider().GetChannel().Id, relay.getContext().GetString("matched_model"), firstResponse, time.Since(startTime), apiErr)
+}
+
+func reportChannelResult(channelId int, modelName string, firstResponse, latency time.Duration, apiErr *types.OpenAIErrorWithStatusCode) {
+	// 本地错误未真正请求上游，只释放熔断的探测名额
+	if apiErr != nil && apiErr.LocalError {
+		model.CircuitBreaker.Release(channelId, modelName)
+		return
+	}
+
+	// 请求参数错误说明上游可用，但不计入延迟统计
+	if apiErr != nil && apiErr.StatusCode == http.StatusBadRequest {
+		model.CircuitBreaker.Report(channelId, modelName, true)
+		return
+	}
+
+	model.CircuitBreaker.Report(channelId, modelName, apiErr == nil)
+	model.ChannelStats.Record(channelId, modelName, firstResponse, latency, apiErr == nil)
+
+	errorClass := ""
+	if apiErr != nil {
+		errorClass = model.ChannelHealthErrorClass(apiErr.StatusCode)
+	}
+	model.ChannelHealthStats.Record(channelId, modelName, firstResponse, latency, errorClass)
+}
+
+// shouldCooldowns 按重试策略冻结渠道，并将当前渠道加入本次请求的跳过列表
 func shouldCooldowns(c *gin.Context, channel *model.Channel, apiErr *types.OpenAIErrorWithStatusCode) bool {
 	modelName := c.GetString("new_model")
 	channelId := channel.Id
 	cooldownApplied := false
+	if isChannelUnavailableError(apiErr) {
+		skipChannel(c, channelId)
+		return cooldownApplied
+	}
+	rule := model.RetryPolicy.Match(channel.Type, apiErr)
 
-	// 如果是频率限制，冻结通道
-	if apiErr.StatusCode == http.StatusTooManyRequests {
+	// key 池渠道只冻结出错的 key
+	if rule.Action == model.RetryActionCooldown && channel.KeyId > 0 && config.RetryCooldownSeconds > 0 {
+		model.ChannelKeyPool.SetCooldown(channel.KeyId)
+		cooldownApplied = true
+		logger.LogError(c.Request.Context(), fmt.Sprintf("channel_key_cooldown channel_id=%d key_id=%d duration=%ds reason=\"%s\"",
+			channelId, channel.KeyId, config.RetryCooldownSeconds, rule.Name))
+	} else if rule.Action == model.RetryActionCooldown {
 		model.ChannelGroup.SetCooldowns(channelId, modelName)
 		cooldownApplied = true
-		logger.LogError(c.Request.Context(), fmt.Sprintf("channel_cooldown channel_id=%d model=\"%s\" duration=%ds reason=\"rate_limit\"",
-			channelId, modelName, config.RetryCooldownSeconds))
+		logger.LogError(c.Request.Context(), fmt.Sprintf("channel_cooldown channel_id=%d model=\"%s\" duration=%ds reason=\"%s\"",
+			channelId, modelName, config.RetryCooldownSeconds, rule.Name))
 	}
 
+	skipChannel(c, channelId)
+
+	return cooldownApplied
+}
+
+// skipChannel 将渠道加入本次请求的跳过列表
+func skipChannel(c *gin.Context, channelId int) {
 	skipChannelIds, ok := utils.GetGinValue[[]int](c, "skip_channel_ids")
 	if !ok {
 		skipChannelIds = make([]int, 0)
@@ -237,8 +382,48 @@ func shouldCooldowns(c *gin.Context, channel *model.Channel, apiErr *types.OpenA
 
 	skipChannelIds = append(skipChannelIds, channelId)
 	c.Set("skip_channel_ids", skipChannelIds)
+}
 
-	return cooldownApplied
+// getRetrySameBackoff 命中 retry_same 规则且同一渠道的重试次数未用完时返回退避时间
+func getRetrySameBackoff(c *gin.Context, channelId int, rule *model.RetryRule) (time.Duration, bool) {
+	if rule.Action != model.RetryActionRetrySame {
+		return 0, false
+	}
+
+	maxAttempts := rule.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	attempts := 0
+	if c.GetInt("retry_same_channel_id") == channelId {
+		attempts = c.GetInt("retry_same_attempts")
+	}
+	if attempts >= maxAttempts {
+		return 0, false
+	}
+
+	c.Set("retry_same_channel_id", channelId)
+	c.Set("retry_same_attempts", attempts+1)
+
+	return time.Duration(rule.Backoff) * time.Millisecond << attempts, true
+}
+
+// sleepWithContext 请求被取消时提前返回 false
+func sleepWithContext(ctx context.Context, duration time.Duration) bool {
+	if duration <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // applies pre-mapping before setRequest to ensure modifications take effect
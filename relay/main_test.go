@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"done-hub/common/logger"
+	"done-hub/common/utils"
+	"done-hub/model"
+	"done-hub/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestShouldCooldowns(t *testing.T) {
+	if logger.Logger == nil {
+		logger.Logger = zap.NewNop()
+	}
+
+	cases := []struct {
+		name      string
+		channelId int
+		err       *types.OpenAIErrorWithStatusCode
+		cooldown  bool
+	}{
+		{name: "retry", channelId: 201, err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusInternalServerError}},
+		{name: "rate limit", channelId: 202, err: &types.OpenAIErrorWithStatusCode{StatusCode: http.StatusTooManyRequests}, cooldown: true},
+		// 限流拒绝的请求未到达上游，只跳过渠道不冻结
+		{name: "channel limit reached", channelId: 203, err: &types.OpenAIErrorWithStatusCode{
+			OpenAIError: types.OpenAIError{Code: errCodeChannelLimitReached}, StatusCode: http.StatusTooManyRequests, LocalError: true,
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			ctx.Set("new_model", "cooldown-test-model")
+
+			channel := &model.Channel{Id: c.channelId, Type: 1}
+			assert.Equal(t, c.cooldown, shouldCooldowns(ctx, channel, c.err))
+			assert.Equal(t, c.cooldown, model.ChannelGroup.IsInCooldown(c.channelId, "cooldown-test-model"))
+
+			skipChannelIds, _ := utils.GetGinValue[[]int](ctx, "skip_channel_ids")
+			assert.Equal(t, []int{c.channelId}, skipChannelIds)
+		})
+	}
+}
@@ -72,7 +72,7 @@ func RelayRecraftAI(c *gin.Context) {
 	}
 
 	channel := recraftProvider.GetChannel()
-	go processChannelRelayError(c.Request.Context(), channel.Id, channel.Name, apiErr, channel.Type)
+	go processChannelRelayError(c.Request.Context(), channel, c.GetString("matched_model"), apiErr)
 
 	retryTimes := config.RetryTimes
 	if !shouldRetry(c, apiErr, channel.Type) {
@@ -130,7 +130,7 @@ func RelayRecraftAI(c *gin.Context) {
 			return
 		}
 
-		go processChannelRelayError(c.Request.Context(), channel.Id, channel.Name, apiErr, channel.Type)
+		go processChannelRelayError(c.Request.Context(), channel, c.GetString("matched_model"), apiErr)
 		if !shouldRetry(c, apiErr, channel.Type) {
 			break
 		}
@@ -19,6 +19,7 @@ type Quota struct {
 	modelName        string
 	promptTokens     int
 	price            model.Price
+	tier             *model.PriceTier // 按提示 token 数选择的价格档位
 	groupName        string
 	groupRatio       float64
 	inputRatio       float64
@@ -27,9 +28,15 @@ type Quota struct {
 	cacheQuota       int
 	userId           int
 	channelId        int
+	channelKeyId     int
+	upstreamChannel  *model.Channel // 用于估算上游成本，成本未知时为 nil
 	tokenId          int
 	HandelStatus     bool
 
+	cacheHit          bool
+	cacheBillingRatio float64
+	modelFallback     string
+
 	startTime         time.Time
 	firstResponseTime time.Time
 	extraBillingData  map[string]ExtraBillingData
@@ -48,12 +55,25 @@ func NewQuota(c *gin.Context, modelName string, promptTokens int) *Quota {
 	quota.price = *model.PricingInstance.GetPrice(quota.modelName)
 	quota.groupRatio = c.GetFloat64("group_ratio")
 	quota.groupName = c.GetString("token_group")
-	quota.inputRatio = quota.price.GetInput() * quota.groupRatio
-	quota.outputRatio = quota.price.GetOutput() * quota.groupRatio
+	quota.modelFallback = c.GetString("model_fallback")
+	// 预扣费按估算的提示 token 数选择档位，结算时按实际用量重新选择
+	quota.applyPriceTier(promptTokens)
 
 	return quota
 }
 
+// applyPriceTier 按提示 token 数选择价格档位并计算倍率
+func (q *Quota) applyPriceTier(promptTokens int) {
+	input, output := q.price.GetInput(), q.price.GetOutput()
+	q.tier = q.price.GetTier(promptTokens)
+	if q.tier != nil {
+		input, output = q.tier.Input, q.tier.Output
+	}
+
+	q.inputRatio = input * q.groupRatio
+	q.outputRatio = output * q.groupRatio
+}
+
 func (q *Quota) PreQuotaConsumption() *types.OpenAIErrorWithStatusCode {
 	if q.price.Type == model.TimesPriceType {
 		q.preConsumedQuota = int(1000 * q.inputRatio)
@@ -100,6 +120,8 @@ func (q *Quota) UpdateUserRealtimeQuota(usage *types.UsageEvent, nowUsage *types
 		return nil
 	}
 
+	// 每次响应的输入 token 数不同，按本次响应重新选择档位
+	q.applyPriceTier(nowUsage.InputTokens)
 	promptTokens, completionTokens := q.getComputeTokensByUsageEvent(nowUsage)
 	increaseQuota := q.GetTotalQuota(promptTokens, completionTokens, nil)
 
@@ -129,6 +151,9 @@ func (q *Quota) completedQuotaConsumption(usage *types.Usage, tokenName string,
 	}()
 
 	quota := q.GetTotalQuotaByUsage(usage)
+	if q.cacheHit {
+		quota = int(math.Ceil(float64(quota) * q.cacheBillingRatio))
+	}
 
 	if quota > 0 {
 		quotaDelta := quota - q.preConsumedQuota
@@ -140,7 +165,16 @@ func (q *Quota) completedQuotaConsumption(usage *types.Usage, tokenName string,
 		if err != nil {
 			return errors.New("error consuming token remain quota: " + err.Error())
 		}
-		model.UpdateChannelUsedQuota(q.channelId, quota)
+		if q.channelId > 0 {
+			model.UpdateChannelUsedQuota(q.channelId, quota)
+			if channel := model.ChannelGroup.GetChannel(q.channelId); channel != nil {
+				model.ChannelBudgets.Record(channel, q.getBudgetCost(usage, quota))
+			}
+		}
+	}
+
+	if q.channelKeyId > 0 {
+		model.UpdateChannelKeyUsage(q.channelKeyId, quota)
 	}
 
 	model.RecordConsumeLog(
@@ -155,7 +189,7 @@ func (q *Quota) completedQuotaConsumption(usage *types.Usage, tokenName string,
 		"",
 		q.getRequestTime(),
 		isStream,
-		q.GetLogMeta(usage),
+		q.getLogMetaWithCost(usage, quota),
 		sourceIp,
 	)
 	model.UpdateUserUsedQuotaAndRequestCount(q.userId, quota)
@@ -189,6 +223,26 @@ func (q *Quota) Consume(c *gin.Context, usage *types.Usage, isStream bool) {
 	}(c.Request.Context())
 }
 
+// SetCacheHit 标记为响应缓存命中，按 billingRatio 折算额度且不计入渠道用量
+func (q *Quota) SetCacheHit(billingRatio float64) {
+	q.cacheHit = true
+	q.cacheBillingRatio = billingRatio
+	q.channelId = 0
+}
+
+// SetChannel 按实际返回响应的渠道记录用量与上游成本
+func (q *Quota) SetChannel(channel *model.Channel) {
+	if q.cacheHit {
+		return
+	}
+	q.channelId = channel.Id
+	q.channelKeyId = channel.KeyId
+	q.upstreamChannel = nil
+	if _, ok := channel.GetUpstreamCost(q.modelName, 0); ok {
+		q.upstreamChannel = channel
+	}
+}
+
 func (q *Quota) GetInputRatio() float64 {
 	return q.inputRatio
 }
@@ -202,6 +256,12 @@ func (q *Quota) GetLogMeta(usage *types.Usage) map[string]any {
 		"output_ratio": q.price.GetOutput(),
 	}
 
+	if q.tier != nil {
+		meta["price_tier"] = q.tier.Threshold
+		meta["input_ratio"] = q.tier.Input
+		meta["output_ratio"] = q.tier.Output
+	}
+
 	firstResponseTime := q.GetFirstResponseTime()
 	if firstResponseTime > 0 {
 		meta["first_response"] = firstResponseTime
@@ -221,9 +281,71 @@ func (q *Quota) GetLogMeta(usage *types.Usage) map[string]any {
 		meta["extra_billing"] = q.extraBillingData
 	}
 
+	if q.modelFallback != "" {
+		meta["model_fallback"] = q.modelFallback
+	}
+
+	if q.cacheHit {
+		meta["response_cache_hit"] = true
+		meta["response_cache_billing_ratio"] = q.cacheBillingRatio
+	}
+
+	return meta
+}
+
+// getLogMetaWithCost 在日志中记录估算的上游成本与毛利，单位与额度相同
+func (q *Quota) getLogMetaWithCost(usage *types.Usage, quota int) map[string]any {
+	meta := q.GetLogMeta(usage)
+	cost := q.getUpstreamCost(usage.PromptTokens)
+	if cost == nil || (cost.Input == 0 && cost.Output == 0) {
+		return meta
+	}
+
+	upstreamCost := q.GetUpstreamCostByUsage(usage)
+	meta["upstream_cost"] = upstreamCost
+	meta["margin"] = quota - upstreamCost
+
 	return meta
 }
 
+// GetUpstreamCostByUsage 按 SetChannel 设置的渠道估算上游成本，未设置渠道或成本未知时为 0
+func (q *Quota) GetUpstreamCostByUsage(usage *types.Usage) int {
+	cost := q.getUpstreamCost(usage.PromptTokens)
+	if cost == nil {
+		return 0
+	}
+
+	if q.price.Type == model.TimesPriceType {
+		return int(math.Ceil(1000 * cost.Input))
+	}
+
+	promptTokens, completionTokens := q.getComputeTokensByUsage(usage)
+	return int(math.Ceil(float64(promptTokens)*cost.Input + float64(completionTokens)*cost.Output))
+}
+
+// getUpstreamCost 按实际的提示 token 数选择上游价格档位
+func (q *Quota) getUpstreamCost(promptTokens int) *model.ChannelCost {
+	if q.upstreamChannel == nil {
+		return nil
+	}
+
+	cost, ok := q.upstreamChannel.GetUpstreamCost(q.modelName, promptTokens)
+	if !ok {
+		return nil
+	}
+
+	return &cost
+}
+
+// getBudgetCost 渠道预算按上游成本统计，成本未知时按计费额度统计，宁可提前暂停也不超出预算
+func (q *Quota) getBudgetCost(usage *types.Usage, quota int) int {
+	if q.upstreamChannel == nil {
+		return quota
+	}
+
+	return q.GetUpstreamCostByUsage(usage)
+}
+
 func (q *Quota) getRequestTime() int {
 	return int(time.Since(q.startTime).Milliseconds())
 }
@@ -308,6 +430,7 @@ func (q *Quota) getComputeTokensByUsageEvent(usage *types.UsageEvent) (promptTok
 
 // 通过 usage 获取消费配额
 func (q *Quota) GetTotalQuotaByUsage(usage *types.Usage) (quota int) {
+	q.applyPriceTier(usage.PromptTokens)
 	promptTokens, completionTokens := q.getComputeTokensByUsage(usage)
 	return q.GetTotalQuota(promptTokens, completionTokens, usage.ExtraBilling)
 }
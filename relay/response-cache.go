@@ -0,0 +1,248 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"done-hub/common/cache"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/model"
+	"done-hub/relay/relay_util"
+	"done-hub/types"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const responseCacheMaxBodySize = 4 * 1024 * 1024
+
+type responseCacheEntry struct {
+	Body             string `json:"body"`
+	IsStream         bool   `json:"is_stream"`
+	ModelName        string `json:"model_name"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// ResponseCache 相同请求（模型 + 消息 + 参数）的响应缓存，仅对开启了缓存的令牌生效
+type ResponseCache struct {
+	c        *gin.Context
+	key      string
+	ttl      time.Duration
+	isStream bool
+	writer   *responseCacheWriter
+}
+
+// NewResponseCache 不满足缓存条件时返回 nil，nil 上的方法均为空操作
+func NewResponseCache(c *gin.Context, relay RelayBaseInterface) *ResponseCache {
+	if !config.ResponseCacheEnabled {
+		return nil
+	}
+
+	setting := getTokenCacheSetting(c)
+	if setting == nil || !setting.Enabled {
+		return nil
+	}
+
+	var request any
+	switch r := relay.(type) {
+	case *relayChat:
+		request = r.chatRequest
+	case *relayEmbeddings:
+		request = r.request
+	default:
+		return nil
+	}
+
+	ttl := getResponseCacheTTL(c, setting)
+	if ttl <= 0 {
+		return nil
+	}
+
+	// 命中缓存时不会经过 GetProvider，需要先检查令牌与分组是否允许使用该模型
+	group := c.GetString("token_group")
+	if _, err := checkModelAccess(c, group, relay.getOriginalModel()); err != nil {
+		return nil
+	}
+
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return nil
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(requestBytes)
+
+	// 令牌的模型限制不同，分组不同可能路由到不同的渠道，因此都作为键的一部分
+	return &ResponseCache{
+		c:        c,
+		key:      fmt.Sprintf("response_cache:%d:%d:%s:%s", c.GetInt("id"), c.GetInt("token_id"), group, hex.EncodeToString(hash.Sum(nil))),
+		ttl:      ttl,
+		isStream: relay.IsStream(),
+	}
+}
+
+// Replay 命中缓存时直接返回缓存的响应并按配置的倍率计费
+func (rc *ResponseCache) Replay() bool {
+	if rc == nil {
+		return false
+	}
+
+	entry, err := cache.GetResponseCache[responseCacheEntry](rc.key)
+	if err != nil || entry.Body == "" || entry.IsStream != rc.isStream {
+		return false
+	}
+
+	usage := &types.Usage{
+		PromptTokens:     entry.PromptTokens,
+		CompletionTokens: entry.CompletionTokens,
+		TotalTokens:      entry.PromptTokens + entry.CompletionTokens,
+	}
+
+	quota := relay_util.NewQuota(rc.c, entry.ModelName, entry.PromptTokens)
+	quota.SetCacheHit(config.ResponseCacheBillingRatio)
+	if config.ResponseCacheBillingRatio > 0 {
+		if errWithCode := quota.PreQuotaConsumption(); errWithCode != nil {
+			// 额度不足时不使用缓存，交由正常流程返回错误
+			return false
+		}
+	}
+
+	rc.c.Header("X-Cache", "HIT")
+	responseCache(rc.c, entry.Body, entry.IsStream)
+
+	quota.SetFirstResponseTime(time.Now())
+	quota.Consume(rc.c, usage, entry.IsStream)
+
+	return true
+}
+
+// Record 开始记录写给客户端的响应
+func (rc *ResponseCache) Record() {
+	if rc == nil || rc.writer != nil {
+		return
+	}
+
+	rc.c.Header("X-Cache", "MISS")
+	rc.writer = &responseCacheWriter{ResponseWriter: rc.c.Writer}
+	rc.c.Writer = rc.writer
+}
+
+// Save 请求成功后保存响应，流式响应只有完整结束时才会保存
+func (rc *ResponseCache) Save(relay RelayBaseInterface) {
+	if rc == nil || rc.writer == nil {
+		return
+	}
+
+	if rc.writer.overflow || rc.writer.Status() != http.StatusOK || rc.writer.body.Len() == 0 {
+		return
+	}
+
+	// 由备用模型返回的响应不能作为请求模型的缓存
+	if rc.c.GetString("model_fallback") != "" {
+		return
+	}
+
+	body := rc.writer.String()
+	if rc.isStream && !strings.Contains(body, "data: [DONE]") {
+		return
+	}
+
+	usage := relay.getProvider().GetUsage()
+	if usage == nil {
+		return
+	}
+
+	entry := responseCacheEntry{
+		Body:             body,
+		IsStream:         rc.isStream,
+		ModelName:        relay.getModelName(),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+
+	if err := cache.SetResponseCache(rc.key, entry, rc.ttl); err != nil {
+		logger.LogError(rc.c.Request.Context(), fmt.Sprintf("response_cache_save_failed size=%d error=\"%s\"", len(body), err.Error()))
+	}
+}
+
+func getTokenCacheSetting(c *gin.Context) *model.CacheSetting {
+	tokenSetting := c.GetString("token_setting")
+	if tokenSetting == "" {
+		return nil
+	}
+
+	var setting model.TokenSetting
+	if err := json.Unmarshal([]byte(tokenSetting), &setting); err != nil {
+		return nil
+	}
+
+	return &setting.Cache
+}
+
+// getResponseCacheTTL 优先级：令牌 > 分组 > 全局
+func getResponseCacheTTL(c *gin.Context, setting *model.CacheSetting) time.Duration {
+	if setting.TTLSeconds > 0 {
+		return time.Duration(setting.TTLSeconds) * time.Second
+	}
+
+	if group := model.GlobalUserGroupRatio.GetBySymbol(c.GetString("token_group")); group != nil && group.CacheTTL > 0 {
+		return time.Duration(group.CacheTTL) * time.Second
+	}
+
+	return time.Duration(config.ResponseCacheDefaultTTL) * time.Second
+}
+
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+// String 返回记录的响应，去掉首个内容到达前写入的心跳
+func (w *responseCacheWriter) String() string {
+	body := w.body.String()
+	for {
+		switch {
+		case strings.HasPrefix(body, relay_util.HeartbeatStreamText):
+			body = body[len(relay_util.HeartbeatStreamText):]
+		case strings.HasPrefix(body, relay_util.HeartbeatJsonText):
+			body = body[len(relay_util.HeartbeatJsonText):]
+		default:
+			return body
+		}
+	}
+}
+
+func (w *responseCacheWriter) record(size int) bool {
+	if w.overflow || w.body.Len()+size > responseCacheMaxBodySize {
+		w.overflow = true
+		w.body.Reset()
+		return false
+	}
+
+	return true
+}
+
+func (w *responseCacheWriter) Write(data []byte) (int, error) {
+	if w.record(len(data)) {
+		w.body.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	if w.record(len(s)) {
+		w.body.WriteString(s)
+	}
+
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"done-hub/common/config"
+	"done-hub/model"
+	"done-hub/relay/relay_util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCacheWriter(t *testing.T) {
+	cases := []struct {
+		name     string
+		writes   []string
+		expected string
+		overflow bool
+	}{
+		{
+			name:     "stream heartbeat",
+			writes:   []string{relay_util.HeartbeatStreamText, relay_util.HeartbeatStreamText, "data: {}\n\n", "data: [DONE]\n\n"},
+			expected: "data: {}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name:     "json heartbeat",
+			writes:   []string{relay_util.HeartbeatJsonText, relay_util.HeartbeatJsonText, `{"id":"1"}`},
+			expected: `{"id":"1"}`,
+		},
+		{
+			name:     "without heartbeat",
+			writes:   []string{`{"id":"1"}`},
+			expected: `{"id":"1"}`,
+		},
+		{
+			name:     "overflow",
+			writes:   []string{strings.Repeat("a", responseCacheMaxBodySize), "a"},
+			overflow: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			writer := &responseCacheWriter{ResponseWriter: ctx.Writer}
+			for _, data := range c.writes {
+				_, err := writer.WriteString(data)
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, c.overflow, writer.overflow)
+			if !c.overflow {
+				assert.Equal(t, c.expected, writer.String())
+			}
+		})
+	}
+}
+
+func TestGetResponseCacheTTL(t *testing.T) {
+	config.ResponseCacheDefaultTTL = 3600
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	// 令牌设置优先于全局默认值
+	assert.Equal(t, 60*time.Second, getResponseCacheTTL(ctx, &model.CacheSetting{Enabled: true, TTLSeconds: 60}))
+	assert.Equal(t, time.Hour, getResponseCacheTTL(ctx, &model.CacheSetting{Enabled: true}))
+}
+
+func TestGetTokenCacheSetting(t *testing.T) {
+	cases := []struct {
+		name     string
+		setting  string
+		expected *model.CacheSetting
+	}{
+		{"empty", "", nil},
+		{"invalid", "{", nil},
+		{"enabled", `{"cache":{"enabled":true,"ttl_seconds":30}}`, &model.CacheSetting{Enabled: true, TTLSeconds: 30}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Set("token_setting", c.setting)
+			assert.Equal(t, c.expected, getTokenCacheSetting(ctx))
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"done-hub/common"
+	"done-hub/common/config"
+	"done-hub/common/logger"
+	"done-hub/model"
+	"done-hub/relay/relay_util"
+	"done-hub/types"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const shadowRequestTimeout = 5 * time.Minute
+
+// ShadowMirror 将命中影子规则的请求在主请求成功后异步发送到影子渠道，
+// 客户端只会收到主渠道的响应，影子请求不计费，只记录耗时、错误、用量与成本用于对比
+type ShadowMirror struct {
+	c         *gin.Context
+	rule      *model.ShadowRule
+	body      []byte
+	startTime time.Time
+	writer    *responseCacheWriter
+}
+
+// NewShadowMirror 未命中影子规则时返回 nil，nil 上的方法均为空操作
+func NewShadowMirror(c *gin.Context, relay RelayBaseInterface) *ShadowMirror {
+	// 只复制 JSON 请求，表单上传类的请求不会缓存请求体
+	body, ok := c.Get(config.GinRequestBodyKey)
+	if !ok {
+		return nil
+	}
+	bodyBytes, ok := body.([]byte)
+	if !ok || len(bodyBytes) == 0 {
+		return nil
+	}
+
+	rule := model.ShadowTraffic.Pick(c.GetString("token_group"), relay.getOriginalModel())
+	if rule == nil {
+		return nil
+	}
+
+	return &ShadowMirror{
+		c:    c,
+		rule: rule,
+		body: bodyBytes,
+	}
+}
+
+// Record 开始计时，需要计算相似度时同时记录写给客户端的响应
+func (sm *ShadowMirror) Record() {
+	if sm == nil {
+		return
+	}
+
+	sm.startTime = time.Now()
+	if sm.rule.Similarity {
+		sm.writer = &responseCacheWriter{ResponseWriter: sm.c.Writer}
+		sm.c.Writer = sm.writer
+	}
+}
+
+// Start 主请求成功后调用，影子渠道与主渠道相同时不复制
+func (sm *ShadowMirror) Start(relay RelayBaseInterface) {
+	if sm == nil {
+		return
+	}
+
+	primaryChannel := relay.getProvider().GetChannel()
+	if primaryChannel.Id == sm.rule.ChannelId {
+		return
+	}
+
+	result := &model.ShadowResult{
+		Model:            relay.getOriginalModel(),
+		TokenGroup:       sm.c.GetString("token_group"),
+		IsStream:         relay.IsStream(),
+		PrimaryChannelId: primaryChannel.Id,
+		PrimaryLatency:   time.Since(sm.startTime).Milliseconds(),
+		ShadowChannelId:  sm.rule.ChannelId,
+	}
+	if firstResponseTime := relay.GetFirstResponseTime(); !firstResponseTime.IsZero() {
+		result.PrimaryFirstResponse = firstResponseTime.Sub(sm.startTime).Milliseconds()
+	}
+	if usage := relay.getProvider().GetUsage(); usage != nil {
+		result.PrimaryPromptTokens = usage.PromptTokens
+		result.PrimaryCompletionTokens = usage.CompletionTokens
+		result.PrimaryQuota = relay_util.NewQuota(sm.c, relay.getModelName(), usage.PromptTokens).GetTotalQuotaByUsage(usage)
+	}
+
+	primaryBody := ""
+	if sm.writer != nil && !sm.writer.overflow {
+		primaryBody = sm.writer.String()
+	}
+
+	// 请求结束后 gin 会回收上下文，需要在这里复制影子请求用到的内容
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(sm.c.Request.Context()), shadowRequestTimeout)
+	shadowCtx, recorder, err := sm.newShadowContext(ctx)
+	if err != nil {
+		cancel()
+		logger.LogError(sm.c.Request.Context(), fmt.Sprintf("shadow_skipped shadow_channel_id=%d error=\"%s\"", sm.rule.ChannelId, err.Error()))
+		return
+	}
+
+	go func() {
+		defer cancel()
+		sm.run(shadowCtx, recorder, result, primaryBody)
+	}()
+}
+
+func (sm *ShadowMirror) newShadowContext(ctx context.Context) (*gin.Context, *httptest.ResponseRecorder, error) {
+	request, err := http.NewRequestWithContext(ctx, sm.c.Request.Method, sm.c.Request.URL.String(), bytes.NewReader(sm.body))
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header = sm.c.Request.Header.Clone()
+
+	recorder := httptest.NewRecorder()
+	shadowCtx, _ := gin.CreateTestContext(recorder)
+	shadowCtx.Request = request
+	shadowCtx.Params = append(gin.Params(nil), sm.c.Params...)
+
+	copied := sm.c.Copy()
+	for key, value := range copied.Keys {
+		shadowCtx.Set(key, value)
+	}
+	for _, key := range []string{"skip_channel_ids", "specific_channel_id_ignore", "attempt_count", "fallback_model", "model_fallback", config.GinRequestBodyKey} {
+		delete(shadowCtx.Keys, key)
+	}
+	shadowCtx.Set("specific_channel_id", sm.rule.ChannelId)
+	shadowCtx.Set("requestStartTime", time.Now())
+
+	return shadowCtx, recorder, nil
+}
+
+func (sm *ShadowMirror) run(c *gin.Context, recorder *httptest.ResponseRecorder, result *model.ShadowResult, primaryBody string) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("shadow_panic shadow_channel_id=%d error=\"%v\"", sm.rule.ChannelId, r))
+		}
+	}()
+
+	apiErr := sendShadowRequest(c, result)
+	if apiErr != nil {
+		result.ShadowStatusCode = apiErr.StatusCode
+		result.ShadowError = apiErr.OpenAIError.Message
+		if result.ShadowError == "" {
+			result.ShadowError = http.StatusText(apiErr.StatusCode)
+		}
+	} else {
+		result.ShadowStatusCode = recorder.Code
+		if sm.rule.Similarity && primaryBody != "" {
+			similarity := textSimilarity(extractResponseText(primaryBody), extractResponseText(recorder.Body.String()))
+			result.Similarity = &similarity
+		}
+	}
+
+	logger.LogInfo(c.Request.Context(), fmt.Sprintf("shadow_done model=\"%s\" primary_channel_id=%d shadow_channel_id=%d primary_latency=%dms shadow_latency=%dms status_code=%d",
+		result.Model, result.PrimaryChannelId, result.ShadowChannelId, result.PrimaryLatency, result.ShadowLatency, result.ShadowStatusCode))
+
+	model.RecordShadowResult(result)
+}
+
+// sendShadowRequest 不经过预扣费、熔断与限流，也不计入渠道的健康统计
+func sendShadowRequest(c *gin.Context, result *model.ShadowResult) *types.OpenAIErrorWithStatusCode {
+	relay := Path2Relay(c, c.Request.URL.Path)
+	if relay == nil {
+		return common.StringErrorWrapperLocal("Not Found", "one_hub_error", http.StatusNotFound)
+	}
+
+	if err := relay.setRequest(); err != nil {
+		return common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusBadRequest)
+	}
+	c.Set("is_stream", relay.IsStream())
+
+	if err := relay.setProvider(relay.getOriginalModel()); err != nil {
+		return common.StringErrorWrapperLocal(err.Error(), "one_hub_error", http.StatusServiceUnavailable)
+	}
+
+	channel := relay.getProvider().GetChannel()
+	if channel.SystemPrompt != "" {
+		if request, ok := relay.getRequest().(*types.ChatCompletionRequest); ok {
+			systemPrompt(channel.SystemPrompt, request)
+		}
+	}
+
+	promptTokens, err := relay.getPromptTokens()
+	if err != nil {
+		return common.ErrorWrapperLocal(err, "token_error", http.StatusBadRequest)
+	}
+
+	usage := &types.Usage{PromptTokens: promptTokens}
+	relay.getProvider().SetUsage(usage)
+
+	startTime := time.Now()
+	apiErr, _ := relay.send()
+	result.ShadowLatency = time.Since(startTime).Milliseconds()
+	if firstResponseTime := relay.GetFirstResponseTime(); !firstResponseTime.IsZero() {
+		result.ShadowFirstResponse = firstResponseTime.Sub(startTime).Milliseconds()
+	}
+	if apiErr != nil {
+		return apiErr
+	}
+
+	if usage.CompletionTokens == 0 && usage.TextBuilder.Len() > 0 {
+		usage.CompletionTokens = common.CountTokenText(usage.TextBuilder.String(), relay.getModelName())
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	result.ShadowPromptTokens = usage.PromptTokens
+	result.ShadowCompletionTokens = usage.CompletionTokens
+
+	// 影子请求的额度不向用户扣除，但上游实际产生了消耗，计入渠道用量与预算
+	quota := relay_util.NewQuota(c, relay.getModelName(), promptTokens)
+	quota.SetChannel(channel)
+	result.ShadowQuota = quota.GetTotalQuotaByUsage(usage)
+	result.ShadowUpstreamCost = quota.GetUpstreamCostByUsage(usage)
+	if result.ShadowQuota > 0 {
+		model.UpdateChannelUsedQuota(channel.Id, result.ShadowQuota)
+		model.ChannelBudgets.Record(channel, result.ShadowQuota)
+	}
+
+	return nil
+}
+
+// extractResponseText 从 JSON 或 SSE 响应中提取文本内容
+func extractResponseText(body string) string {
+	var builder strings.Builder
+	if gjson.Valid(body) {
+		collectResponseText(gjson.Parse(body), &builder)
+		return builder.String()
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "data:"))
+		if line == "" || !gjson.Valid(line) {
+			continue
+		}
+		collectResponseText(gjson.Parse(line), &builder)
+	}
+
+	return builder.String()
+}
+
+var responseTextKeys = map[string]bool{
+	"content":     true,
+	"text":        true,
+	"output_text": true,
+	"delta":       true,
+}
+
+func collectResponseText(value gjson.Result, builder *strings.Builder) {
+	value.ForEach(func(key, item gjson.Result) bool {
+		switch {
+		case item.Type == gjson.String && responseTextKeys[key.String()]:
+			builder.WriteString(item.String())
+		case item.IsObject() || item.IsArray():
+			collectResponseText(item, builder)
+		}
+		return true
+	})
+}
+
+// textSimilarity 按字符二元组计算 Dice 系数，忽略大小写与空白，范围 0-1
+func textSimilarity(a, b string) float64 {
+	gramsA, totalA := textBigrams(a)
+	gramsB, totalB := textBigrams(b)
+	if totalA == 0 && totalB == 0 {
+		return 1
+	}
+	if totalA == 0 || totalB == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for gram, countA := range gramsA {
+		intersection += min(countA, gramsB[gram])
+	}
+
+	return math.Round(2*float64(intersection)/float64(totalA+totalB)*10000) / 10000
+}
+
+func textBigrams(text string) (map[string]int, int) {
+	runes := make([]rune, 0, len(text))
+	for _, r := range strings.ToLower(text) {
+		if !unicode.IsSpace(r) {
+			runes = append(runes, r)
+		}
+	}
+
+	grams := make(map[string]int)
+	if len(runes) == 1 {
+		grams[string(runes)] = 1
+		return grams, 1
+	}
+
+	for i := 0; i+1 < len(runes); i++ {
+		grams[string(runes[i:i+2])]++
+	}
+
+	return grams, max(len(runes)-1, 0)
+}
@@ -0,0 +1,137 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"done-hub/common/config"
+	"done-hub/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractResponseText(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		text string
+	}{
+		{"chat", `{"choices":[{"message":{"role":"assistant","content":"Hello world"}}]}`, "Hello world"},
+		{"chat stream", "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\ndata: [DONE]\n\n", "Hello world"},
+		{"claude", `{"content":[{"type":"text","text":"Hello"},{"type":"text","text":" world"}]}`, "Hello world"},
+		{"claude stream", "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n", "Hello"},
+		{"responses", `{"output":[{"content":[{"type":"output_text","text":"Hello"}]}]}`, "Hello"},
+		{"invalid", "not json", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.text, extractResponseText(c.body))
+		})
+	}
+}
+
+func TestTextSimilarity(t *testing.T) {
+	cases := []struct {
+		name       string
+		a          string
+		b          string
+		similarity float64
+	}{
+		{"both empty", "", "", 1},
+		{"one empty", "hello", "", 0},
+		{"identical", "hello world", "hello world", 1},
+		{"ignore case and spaces", "Hello World", "helloworld", 1},
+		{"single rune", "a", "a", 1},
+		{"different", "abc", "xyz", 0},
+		{"partial", "night", "nacht", 0.25},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.similarity, textSimilarity(c.a, c.b))
+		})
+	}
+}
+
+func newShadowTestContext(t *testing.T, rules string, body string) *gin.Context {
+	assert.NoError(t, model.ShadowTraffic.SetRules(rules))
+	t.Cleanup(func() { model.ShadowTraffic.SetRules("") })
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Authorization", "Bearer sk-test")
+	c.Set("token_group", "default")
+	if body != "" {
+		c.Set(config.GinRequestBodyKey, []byte(body))
+	}
+	return c
+}
+
+func TestNewShadowMirror(t *testing.T) {
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	relay := &relayChat{relayBase: relayBase{originalModel: "gpt-4o"}}
+
+	// 未命中规则或没有缓存请求体时不复制
+	assert.Nil(t, NewShadowMirror(newShadowTestContext(t, "", body), relay))
+	assert.Nil(t, NewShadowMirror(newShadowTestContext(t, `[{"model":"o3","channel_id":2,"percent":100}]`, body), relay))
+	assert.Nil(t, NewShadowMirror(newShadowTestContext(t, `[{"model":"gpt-4o","channel_id":2,"percent":100}]`, ""), relay))
+
+	// nil 上的方法均为空操作
+	var mirror *ShadowMirror
+	mirror.Record()
+	mirror.Start(relay)
+
+	c := newShadowTestContext(t, `[{"model":"gpt-4o","channel_id":2,"percent":100,"similarity":true}]`, body)
+	mirror = NewShadowMirror(c, relay)
+	assert.NotNil(t, mirror)
+	assert.Equal(t, 2, mirror.rule.ChannelId)
+
+	// 需要计算相似度时记录写给客户端的响应
+	mirror.Record()
+	c.Writer.WriteString("hello")
+	assert.Equal(t, "hello", mirror.writer.String())
+}
+
+func TestShadowContext(t *testing.T) {
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	c := newShadowTestContext(t, `[{"model":"gpt-4o","channel_id":2,"percent":100}]`, body)
+	c.Params = gin.Params{{Key: "model", Value: "gpt-4o"}}
+	c.Set("id", 1)
+	c.Set("skip_channel_ids", []int{1})
+	c.Set("specific_channel_id", 1)
+	c.Set("specific_channel_id_ignore", true)
+	c.Set("attempt_count", 2)
+
+	mirror := NewShadowMirror(c, &relayChat{relayBase: relayBase{originalModel: "gpt-4o"}})
+	shadowCtx, recorder, err := mirror.newShadowContext(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, recorder)
+
+	assert.Equal(t, http.MethodPost, shadowCtx.Request.Method)
+	assert.Equal(t, "/v1/chat/completions", shadowCtx.Request.URL.Path)
+	assert.Equal(t, "Bearer sk-test", shadowCtx.Request.Header.Get("Authorization"))
+	assert.Equal(t, c.Params, shadowCtx.Params)
+
+	shadowBody, err := io.ReadAll(shadowCtx.Request.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(shadowBody))
+
+	// 影子请求固定使用影子渠道，且不继承主请求的重试状态
+	assert.Equal(t, 2, shadowCtx.GetInt("specific_channel_id"))
+	assert.Equal(t, 1, shadowCtx.GetInt("id"))
+	for _, key := range []string{"skip_channel_ids", "specific_channel_id_ignore", "attempt_count", config.GinRequestBodyKey} {
+		_, ok := shadowCtx.Get(key)
+		assert.False(t, ok, key)
+	}
+
+	// 修改影子请求的上下文不影响主请求
+	shadowCtx.Set("token_group", "other")
+	assert.Equal(t, "default", c.GetString("token_group"))
+}
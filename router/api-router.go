@@ -101,6 +101,12 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.POST("/config_sync", controller.ApplyConfigSync)
+			optionRoute.GET("/config_sync/export", controller.ExportConfigSync)
+			optionRoute.GET("/retry_policy/defaults", controller.GetRetryPolicyDefaults)
+			optionRoute.POST("/retry_policy/test", controller.TestRetryPolicy)
+			optionRoute.GET("/channel_error_rules/defaults", controller.GetChannelErrorRuleDefaults)
+			optionRoute.POST("/channel_error_rules/test", controller.TestChannelErrorRule)
 			optionRoute.GET("/telegram", controller.GetTelegramMenuList)
 			optionRoute.POST("/telegram", controller.AddOrUpdateTelegramMenu)
 			optionRoute.GET("/telegram/status", controller.GetTelegramBotStatus)
@@ -151,7 +157,13 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			channelRoute.GET("/", controller.GetChannelsList)
 			channelRoute.GET("/models", relay.ListModelsForAdmin)
+			channelRoute.GET("/effective_weights", controller.GetChannelEffectiveWeights)
+			channelRoute.GET("/uptime", controller.GetChannelUptime)
+			channelRoute.GET("/shadow_results", controller.GetShadowResults)
+			channelRoute.GET("/shadow_summary", controller.GetShadowSummary)
 			channelRoute.POST("/provider_models_list", controller.GetModelList)
+			channelRoute.GET("/model_diffs", controller.GetChannelModelDiffs)
+			channelRoute.POST("/model_diffs/apply", controller.ApplyChannelModelDiffs)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
@@ -164,6 +176,10 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.PUT("/batch/add_model", controller.BatchAddModelToChannels)
 			channelRoute.PUT("/batch/add_user_group", controller.BatchAddUserGroupToChannels)
 			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
+			channelRoute.GET("/:id/health", controller.GetChannelHealth)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys", controller.AddChannelKeys)
+			channelRoute.PUT("/:id/keys/:key_id/status", controller.UpdateChannelKeyStatus)
 			channelRoute.DELETE("/:id/tag", controller.DeleteChannelTag)
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
 			channelRoute.DELETE("/batch", controller.BatchDeleteChannel)
@@ -113,6 +113,7 @@ func setClaudeRouter(router *gin.Engine) {
 	relayV1Router.Use(middleware.APIEnabled("claude"), middleware.RelayCluadePanicRecover(), middleware.ClaudeAuth(), middleware.Distribute(), middleware.DynamicRedisRateLimiter())
 	{
 		relayV1Router.POST("/messages", relay.Relay)
+		relayV1Router.POST("/messages/count_tokens", relay.ClaudeCountTokens)
 		relayV1Router.GET("/models", relay.ListClaudeModelsByToken)
 	}
 }
@@ -121,7 +122,7 @@ func setGeminiRouter(router *gin.Engine) {
 	relayGeminiRouter := router.Group("/gemini")
 	relayGeminiRouter.Use(middleware.APIEnabled("gemini"), middleware.RelayGeminiPanicRecover(), middleware.GeminiAuth(), middleware.Distribute(), middleware.DynamicRedisRateLimiter())
 	{
-		relayGeminiRouter.POST("/:version/models/:model", relay.Relay)
+		relayGeminiRouter.POST("/:version/models/:model", relay.RelayGemini)
 		relayGeminiRouter.GET("/:version/models", relay.ListGeminiModelsByToken)
 	}
 }